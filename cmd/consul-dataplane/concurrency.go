@@ -0,0 +1,62 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// concurrencyAuto is the value that enables deriving the Envoy concurrency
+// from the CPUs available to the dataplane.
+const concurrencyAuto = "auto"
+
+// Concurrency is the Envoy worker thread count, which is either a fixed
+// number or "auto". It supports unmarshalling both from JSON.
+type Concurrency struct {
+	Auto  bool
+	Value int
+}
+
+func parseConcurrency(s string) (Concurrency, error) {
+	if s == concurrencyAuto {
+		return Concurrency{Auto: true}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return Concurrency{}, fmt.Errorf("invalid concurrency %q: must be a number or %q", s, concurrencyAuto)
+	}
+	return Concurrency{Value: n}, nil
+}
+
+func (c *Concurrency) UnmarshalJSON(b []byte) error {
+	var unmarshalledJson interface{}
+
+	err := json.Unmarshal(b, &unmarshalledJson)
+	if err != nil {
+		return err
+	}
+
+	switch value := unmarshalledJson.(type) {
+	case float64:
+		*c = Concurrency{Value: int(value)}
+	case string:
+		*c, err = parseConcurrency(value)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid concurrency: %#v", unmarshalledJson)
+	}
+
+	return nil
+}
+
+func (c Concurrency) String() string {
+	if c.Auto {
+		return concurrencyAuto
+	}
+	return strconv.Itoa(c.Value)
+}
@@ -0,0 +1,38 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalConcurrency(t *testing.T) {
+	cases := map[string]struct {
+		input    string
+		expected Concurrency
+		wantErr  bool
+	}{
+		"number":         {input: `4`, expected: Concurrency{Value: 4}},
+		"numeric string": {input: `"4"`, expected: Concurrency{Value: 4}},
+		"auto":           {input: `"auto"`, expected: Concurrency{Auto: true}},
+		"invalid string": {input: `"lots"`, wantErr: true},
+		"invalid type":   {input: `true`, wantErr: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var c Concurrency
+			err := json.Unmarshal([]byte(tc.input), &c)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, c)
+		})
+	}
+}
@@ -104,8 +104,41 @@ type XDSServerFlags struct {
 }
 
 type DNSServerFlags struct {
-	BindAddr *string `json:"bindAddress,omitempty"`
-	BindPort *int    `json:"bindPort,omitempty"`
+	BindAddr             *string   `json:"bindAddress,omitempty"`
+	BindPort             *int      `json:"bindPort,omitempty"`
+	DisableCache         *bool     `json:"disableCache,omitempty"`
+	CacheSize            *int      `json:"cacheSize,omitempty"`
+	CacheMaxTTL          *Duration `json:"cacheMaxTTL,omitempty"`
+	ServeStaleWindow     *Duration `json:"serveStaleWindow,omitempty"`
+	Domain               *string   `json:"domain,omitempty"`
+	AltDomains           []string  `json:"altDomains,omitempty"`
+	Recursors            []string  `json:"recursors,omitempty"`
+	ResolvConf           *string   `json:"resolvConf,omitempty"`
+	RecursorTimeout      *Duration `json:"recursorTimeout,omitempty"`
+	DoTAddr              *string   `json:"dotAddress,omitempty"`
+	DoHAddr              *string   `json:"dohAddress,omitempty"`
+	DoHPath              *string   `json:"dohPath,omitempty"`
+	TLSCertFile          *string   `json:"tlsCertFile,omitempty"`
+	TLSKeyFile           *string   `json:"tlsKeyFile,omitempty"`
+	UDPWorkers           *int      `json:"udpWorkers,omitempty"`
+	UDPQueueSize         *int      `json:"udpQueueSize,omitempty"`
+	UDPDropPolicy        *string   `json:"udpDropPolicy,omitempty"`
+	TCPIdleTimeout       *Duration `json:"tcpIdleTimeout,omitempty"`
+	TCPMaxConns          *int      `json:"tcpMaxConnections,omitempty"`
+	QueryLog             *bool     `json:"queryLog,omitempty"`
+	QueryLogFile         *string   `json:"queryLogFile,omitempty"`
+	QueryLogMaxSize      *int      `json:"queryLogMaxSize,omitempty"`
+	QueryLogMaxFiles     *int      `json:"queryLogMaxFiles,omitempty"`
+	QueryLogSampleRate   *float64  `json:"queryLogSampleRate,omitempty"`
+	QueryLogNames        []string  `json:"queryLogNames,omitempty"`
+	QueryLogExcludeNames []string  `json:"queryLogExcludeNames,omitempty"`
+	AllowCIDRs           []string  `json:"allowCIDRs,omitempty"`
+	DenyCIDRs            []string  `json:"denyCIDRs,omitempty"`
+	RateLimit            *float64  `json:"rateLimit,omitempty"`
+	RateLimitBurst       *int      `json:"rateLimitBurst,omitempty"`
+	RateLimitAction      *string   `json:"rateLimitAction,omitempty"`
+	RRLRate              *float64  `json:"rrlRate,omitempty"`
+	RRLSlip              *int      `json:"rrlSlip,omitempty"`
 }
 
 type LogFlags struct {
@@ -115,29 +148,80 @@ type LogFlags struct {
 }
 
 type TelemetryFlags struct {
-	UseCentralConfig *bool                    `json:"useCentralConfig"`
-	Prometheus       PrometheusTelemetryFlags `json:"prometheus,omitempty"`
+	UseCentralConfig      *bool                    `json:"useCentralConfig"`
+	Prometheus            PrometheusTelemetryFlags `json:"prometheus,omitempty"`
+	OTLP                  OTLPTelemetryFlags       `json:"otlp,omitempty"`
+	StatsdURL             *string                  `json:"statsdURL,omitempty"`
+	DogstatsdURL          *string                  `json:"dogstatsdURL,omitempty"`
+	StatsTags             []string                 `json:"statsTags,omitempty"`
+	MetricsCacheMaxSeries *int                     `json:"metricsCacheMaxSeries,omitempty"`
+}
+
+type OTLPTelemetryFlags struct {
+	Endpoint       *string           `json:"endpoint,omitempty"`
+	Protocol       *string           `json:"protocol,omitempty"`
+	Insecure       *bool             `json:"insecure,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	ExportInterval *Duration         `json:"exportInterval,omitempty"`
+	EnvoyStats     *bool             `json:"envoyStats,omitempty"`
 }
 
 type PrometheusTelemetryFlags struct {
-	RetentionTime     *Duration `json:"retentionTime,omitempty"`
-	CACertsPath       *string   `json:"caCertsPath,omitempty"`
-	KeyFile           *string   `json:"keyFile,omitempty"`
-	CertFile          *string   `json:"certFile,omitempty"`
-	ServiceMetricsURL *string   `json:"serviceMetricsURL,omitempty"`
-	ScrapePath        *string   `json:"scrapePath,omitempty"`
-	MergePort         *int      `json:"mergePort,omitempty"`
+	RetentionTime         *Duration                   `json:"retentionTime,omitempty"`
+	CACertsPath           *string                     `json:"caCertsPath,omitempty"`
+	KeyFile               *string                     `json:"keyFile,omitempty"`
+	CertFile              *string                     `json:"certFile,omitempty"`
+	ServiceMetricsURL     *string                     `json:"serviceMetricsURL,omitempty"`
+	ServiceMetricsTargets []ServiceMetricsTargetFlags `json:"serviceMetricsTargets,omitempty"`
+	ScrapePath            *string                     `json:"scrapePath,omitempty"`
+	BindAddr              *string                     `json:"bindAddress,omitempty"`
+	MergePort             *int                        `json:"mergePort,omitempty"`
+	MergeBindAddr         *string                     `json:"mergeBindAddress,omitempty"`
+	DataplaneBindAddr     *string                     `json:"dataplaneBindAddress,omitempty"`
+	DataplanePort         *int                        `json:"dataplanePort,omitempty"`
+	ServerTLS             *bool                       `json:"serverTLS,omitempty"`
+	ServerVerifyIncoming  *bool                       `json:"serverVerifyIncoming,omitempty"`
+	ServerBearerToken     *string                     `json:"serverBearerToken,omitempty"`
+	ServerBearerTokenPath *string                     `json:"serverBearerTokenPath,omitempty"`
+	ScrapeTimeout         *Duration                   `json:"scrapeTimeout,omitempty"`
+	MergeCollisionMode    *string                     `json:"mergeCollisionMode,omitempty"`
+	ConstLabels           map[string]string           `json:"constLabels,omitempty"`
+	Push                  PrometheusPushFlags         `json:"push,omitempty"`
+}
+
+type PrometheusPushFlags struct {
+	URL      *string           `json:"url,omitempty"`
+	Protocol *string           `json:"protocol,omitempty"`
+	Interval *Duration         `json:"interval,omitempty"`
+	Job      *string           `json:"job,omitempty"`
+	Instance *string           `json:"instance,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+type ServiceMetricsTargetFlags struct {
+	Name                  *string           `json:"name,omitempty"`
+	URL                   *string           `json:"url,omitempty"`
+	Headers               map[string]string `json:"headers,omitempty"`
+	BearerTokenFile       *string           `json:"bearerTokenFile,omitempty"`
+	BasicAuthUsername     *string           `json:"basicAuthUsername,omitempty"`
+	BasicAuthPasswordFile *string           `json:"basicAuthPasswordFile,omitempty"`
+	TLS                   *TLSFlags         `json:"tls,omitempty"`
+	Timeout               *Duration         `json:"timeout,omitempty"`
+	Labels                map[string]string `json:"labels,omitempty"`
 }
 
 type EnvoyFlags struct {
-	AdminBindAddr    *string `json:"adminBindAddress,omitempty"`
-	AdminBindPort    *int    `json:"adminBindPort,omitempty"`
-	ReadyBindAddr    *string `json:"readyBindAddress,omitempty"`
-	ReadyBindPort    *int    `json:"readyBindPort,omitempty"`
-	Concurrency      *int    `json:"concurrency,omitempty"`
-	DrainTimeSeconds *int    `json:"drainTimeSeconds,omitempty"`
-	DrainStrategy    *string `json:"drainStrategy,omitempty"`
-	ExecutablePath   *string `json:"executablePath,omitempty"`
+	AdminBindAddr    *string      `json:"adminBindAddress,omitempty"`
+	AdminBindPort    *int         `json:"adminBindPort,omitempty"`
+	ReadyBindAddr    *string      `json:"readyBindAddress,omitempty"`
+	ReadyBindPort    *int         `json:"readyBindPort,omitempty"`
+	Concurrency      *Concurrency `json:"concurrency,omitempty"`
+	ConcurrencyMin   *int         `json:"concurrencyMin,omitempty"`
+	ConcurrencyMax   *int         `json:"concurrencyMax,omitempty"`
+	ConcurrencyRatio *float64     `json:"concurrencyRatio,omitempty"`
+	DrainTimeSeconds *int         `json:"drainTimeSeconds,omitempty"`
+	DrainStrategy    *string      `json:"drainStrategy,omitempty"`
+	ExecutablePath   *string      `json:"executablePath,omitempty"`
 
 	ShutdownDrainListenersEnabled *bool   `json:"shutdownDrainListenersEnabled,omitempty"`
 	ShutdownGracePeriodSeconds    *int    `json:"shutdownGracePeriodSeconds,omitempty"`
@@ -149,6 +233,27 @@ type EnvoyFlags struct {
 	StartupGracePeriodSeconds *int `json:"startupGracePeriodSeconds,omitempty"`
 	//Endpoint for graceful startup function.
 	GracefulStartupPath *string `json:"gracefulStartupPath,omitempty"`
+
+	StatsMatcher    StatsMatcherFlags    `json:"statsMatcher,omitempty"`
+	OverloadManager OverloadManagerFlags `json:"overloadManager,omitempty"`
+}
+
+type StatsMatcherFlags struct {
+	InclusionPrefixes []string `json:"inclusionPrefixes,omitempty"`
+	InclusionSuffixes []string `json:"inclusionSuffixes,omitempty"`
+	InclusionRegexes  []string `json:"inclusionRegexes,omitempty"`
+	ExclusionPrefixes []string `json:"exclusionPrefixes,omitempty"`
+	ExclusionSuffixes []string `json:"exclusionSuffixes,omitempty"`
+	ExclusionRegexes  []string `json:"exclusionRegexes,omitempty"`
+}
+
+type OverloadManagerFlags struct {
+	Enabled                           *bool    `json:"enabled,omitempty"`
+	MaxHeapSizeBytes                  *int     `json:"maxHeapSizeBytes,omitempty"`
+	ShrinkHeapThreshold               *float64 `json:"shrinkHeapThreshold,omitempty"`
+	StopAcceptingRequestsThreshold    *float64 `json:"stopAcceptingRequestsThreshold,omitempty"`
+	StopAcceptingConnectionsThreshold *float64 `json:"stopAcceptingConnectionsThreshold,omitempty"`
+	MaxDownstreamConnections          *int     `json:"maxDownstreamConnections,omitempty"`
 }
 
 const (
@@ -235,6 +340,9 @@ func buildDefaultConsulDPFlags() (DataplaneConfigFlags, error) {
 			"adminBindPort": 19000,
 			"readyBindPort": 0,
 			"concurrency": 2,
+			"concurrencyMin": 1,
+			"concurrencyMax": 0,
+			"concurrencyRatio": 1,
 			"drainTimeSeconds": 30,
 			"drainStrategy": "immediate",
 			"shutdownDrainListenersEnabled": false,
@@ -243,7 +351,15 @@ func buildDefaultConsulDPFlags() (DataplaneConfigFlags, error) {
 			"gracefulPort": 20300,
 			"dumpEnvoyConfigOnExitEnabled": false,
 			"gracefulStartupPath": "/graceful_startup",
-			"startupGracePeriodSeconds": 0
+			"startupGracePeriodSeconds": 0,
+			"overloadManager": {
+				"enabled": false,
+				"maxHeapSizeBytes": 0,
+				"shrinkHeapThreshold": 0.95,
+				"stopAcceptingRequestsThreshold": 0.98,
+				"stopAcceptingConnectionsThreshold": 0.98,
+				"maxDownstreamConnections": 0
+			}
 		},
 		"xdsServer": {
 			"bindAddress": "127.0.0.1",
@@ -329,7 +445,11 @@ func constructRuntimeConfig(cfg DataplaneConfigFlags, extraArgs []string) (*cons
 			ExecutablePath:                stringVal(cfg.Envoy.ExecutablePath),
 			ReadyBindAddress:              stringVal(cfg.Envoy.ReadyBindAddr),
 			ReadyBindPort:                 intVal(cfg.Envoy.ReadyBindPort),
-			EnvoyConcurrency:              intVal(cfg.Envoy.Concurrency),
+			EnvoyConcurrency:              concurrencyVal(cfg.Envoy.Concurrency).Value,
+			EnvoyConcurrencyAuto:          concurrencyVal(cfg.Envoy.Concurrency).Auto,
+			EnvoyConcurrencyMin:           intVal(cfg.Envoy.ConcurrencyMin),
+			EnvoyConcurrencyMax:           intVal(cfg.Envoy.ConcurrencyMax),
+			EnvoyConcurrencyRatio:         float64Val(cfg.Envoy.ConcurrencyRatio),
 			EnvoyDrainTimeSeconds:         intVal(cfg.Envoy.DrainTimeSeconds),
 			EnvoyDrainStrategy:            stringVal(cfg.Envoy.DrainStrategy),
 			ShutdownDrainListenersEnabled: boolVal(cfg.Envoy.ShutdownDrainListenersEnabled),
@@ -341,17 +461,65 @@ func constructRuntimeConfig(cfg DataplaneConfigFlags, extraArgs []string) (*cons
 			StartupGracePeriodSeconds:     intVal(cfg.Envoy.StartupGracePeriodSeconds),
 			GracefulStartupPath:           stringVal(cfg.Envoy.GracefulStartupPath),
 			ExtraArgs:                     extraArgs,
+			StatsMatcher: consuldp.StatsMatcherConfig{
+				InclusionPrefixes: cfg.Envoy.StatsMatcher.InclusionPrefixes,
+				InclusionSuffixes: cfg.Envoy.StatsMatcher.InclusionSuffixes,
+				InclusionRegexes:  cfg.Envoy.StatsMatcher.InclusionRegexes,
+				ExclusionPrefixes: cfg.Envoy.StatsMatcher.ExclusionPrefixes,
+				ExclusionSuffixes: cfg.Envoy.StatsMatcher.ExclusionSuffixes,
+				ExclusionRegexes:  cfg.Envoy.StatsMatcher.ExclusionRegexes,
+			},
+			OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+				Enabled:                           boolVal(cfg.Envoy.OverloadManager.Enabled),
+				MaxHeapSizeBytes:                  intVal(cfg.Envoy.OverloadManager.MaxHeapSizeBytes),
+				ShrinkHeapThreshold:               float64Val(cfg.Envoy.OverloadManager.ShrinkHeapThreshold),
+				StopAcceptingRequestsThreshold:    float64Val(cfg.Envoy.OverloadManager.StopAcceptingRequestsThreshold),
+				StopAcceptingConnectionsThreshold: float64Val(cfg.Envoy.OverloadManager.StopAcceptingConnectionsThreshold),
+				MaxDownstreamConnections:          intVal(cfg.Envoy.OverloadManager.MaxDownstreamConnections),
+			},
 		},
 		Telemetry: &consuldp.TelemetryConfig{
-			UseCentralConfig: boolVal(cfg.Telemetry.UseCentralConfig),
+			UseCentralConfig:      boolVal(cfg.Telemetry.UseCentralConfig),
+			StatsdURL:             stringVal(cfg.Telemetry.StatsdURL),
+			DogstatsdURL:          stringVal(cfg.Telemetry.DogstatsdURL),
+			StatsTags:             cfg.Telemetry.StatsTags,
+			MetricsCacheMaxSeries: intVal(cfg.Telemetry.MetricsCacheMaxSeries),
 			Prometheus: consuldp.PrometheusTelemetryConfig{
-				RetentionTime:     durationVal(cfg.Telemetry.Prometheus.RetentionTime),
-				CACertsPath:       stringVal(cfg.Telemetry.Prometheus.CACertsPath),
-				CertFile:          stringVal(cfg.Telemetry.Prometheus.CertFile),
-				KeyFile:           stringVal(cfg.Telemetry.Prometheus.KeyFile),
-				ServiceMetricsURL: stringVal(cfg.Telemetry.Prometheus.ServiceMetricsURL),
-				ScrapePath:        stringVal(cfg.Telemetry.Prometheus.ScrapePath),
-				MergePort:         intVal(cfg.Telemetry.Prometheus.MergePort),
+				RetentionTime:         durationVal(cfg.Telemetry.Prometheus.RetentionTime),
+				CACertsPath:           stringVal(cfg.Telemetry.Prometheus.CACertsPath),
+				CertFile:              stringVal(cfg.Telemetry.Prometheus.CertFile),
+				KeyFile:               stringVal(cfg.Telemetry.Prometheus.KeyFile),
+				ServiceMetricsURL:     stringVal(cfg.Telemetry.Prometheus.ServiceMetricsURL),
+				ServiceMetricsTargets: serviceMetricsTargets(cfg.Telemetry.Prometheus.ServiceMetricsTargets),
+				ScrapePath:            stringVal(cfg.Telemetry.Prometheus.ScrapePath),
+				BindAddr:              stringVal(cfg.Telemetry.Prometheus.BindAddr),
+				MergePort:             intVal(cfg.Telemetry.Prometheus.MergePort),
+				MergeBindAddr:         stringVal(cfg.Telemetry.Prometheus.MergeBindAddr),
+				DataplaneBindAddr:     stringVal(cfg.Telemetry.Prometheus.DataplaneBindAddr),
+				DataplanePort:         intVal(cfg.Telemetry.Prometheus.DataplanePort),
+				ServerTLS:             boolVal(cfg.Telemetry.Prometheus.ServerTLS),
+				ServerVerifyIncoming:  boolVal(cfg.Telemetry.Prometheus.ServerVerifyIncoming),
+				ServerBearerToken:     stringVal(cfg.Telemetry.Prometheus.ServerBearerToken),
+				ServerBearerTokenPath: stringVal(cfg.Telemetry.Prometheus.ServerBearerTokenPath),
+				ScrapeTimeout:         durationVal(cfg.Telemetry.Prometheus.ScrapeTimeout),
+				MergeCollisionMode:    stringVal(cfg.Telemetry.Prometheus.MergeCollisionMode),
+				ConstLabels:           cfg.Telemetry.Prometheus.ConstLabels,
+				Push: consuldp.PrometheusPushConfig{
+					URL:      stringVal(cfg.Telemetry.Prometheus.Push.URL),
+					Protocol: stringVal(cfg.Telemetry.Prometheus.Push.Protocol),
+					Interval: durationVal(cfg.Telemetry.Prometheus.Push.Interval),
+					Job:      stringVal(cfg.Telemetry.Prometheus.Push.Job),
+					Instance: stringVal(cfg.Telemetry.Prometheus.Push.Instance),
+					Headers:  cfg.Telemetry.Prometheus.Push.Headers,
+				},
+			},
+			OTLP: consuldp.OTLPTelemetryConfig{
+				Endpoint:       stringVal(cfg.Telemetry.OTLP.Endpoint),
+				Protocol:       stringVal(cfg.Telemetry.OTLP.Protocol),
+				Insecure:       boolVal(cfg.Telemetry.OTLP.Insecure),
+				Headers:        cfg.Telemetry.OTLP.Headers,
+				ExportInterval: durationVal(cfg.Telemetry.OTLP.ExportInterval),
+				EnvoyStats:     boolVal(cfg.Telemetry.OTLP.EnvoyStats),
 			},
 		},
 		XDSServer: &consuldp.XDSServer{
@@ -359,12 +527,75 @@ func constructRuntimeConfig(cfg DataplaneConfigFlags, extraArgs []string) (*cons
 			BindPort:    intVal(cfg.XDSServer.BindPort),
 		},
 		DNSServer: &consuldp.DNSServerConfig{
-			BindAddr: stringVal(cfg.DNSServer.BindAddr),
-			Port:     intVal(cfg.DNSServer.BindPort),
+			BindAddr:             stringVal(cfg.DNSServer.BindAddr),
+			Port:                 intVal(cfg.DNSServer.BindPort),
+			DisableCache:         boolVal(cfg.DNSServer.DisableCache),
+			CacheSize:            intVal(cfg.DNSServer.CacheSize),
+			CacheMaxTTL:          durationVal(cfg.DNSServer.CacheMaxTTL),
+			ServeStaleWindow:     durationVal(cfg.DNSServer.ServeStaleWindow),
+			Domain:               stringVal(cfg.DNSServer.Domain),
+			AltDomains:           cfg.DNSServer.AltDomains,
+			Recursors:            cfg.DNSServer.Recursors,
+			ResolvConf:           stringVal(cfg.DNSServer.ResolvConf),
+			RecursorTimeout:      durationVal(cfg.DNSServer.RecursorTimeout),
+			DoTAddr:              stringVal(cfg.DNSServer.DoTAddr),
+			DoHAddr:              stringVal(cfg.DNSServer.DoHAddr),
+			DoHPath:              stringVal(cfg.DNSServer.DoHPath),
+			TLSCertFile:          stringVal(cfg.DNSServer.TLSCertFile),
+			TLSKeyFile:           stringVal(cfg.DNSServer.TLSKeyFile),
+			UDPWorkers:           intVal(cfg.DNSServer.UDPWorkers),
+			UDPQueueSize:         intVal(cfg.DNSServer.UDPQueueSize),
+			UDPDropPolicy:        stringVal(cfg.DNSServer.UDPDropPolicy),
+			TCPIdleTimeout:       durationVal(cfg.DNSServer.TCPIdleTimeout),
+			TCPMaxConns:          intVal(cfg.DNSServer.TCPMaxConns),
+			QueryLog:             boolVal(cfg.DNSServer.QueryLog),
+			QueryLogFile:         stringVal(cfg.DNSServer.QueryLogFile),
+			QueryLogMaxSize:      intVal(cfg.DNSServer.QueryLogMaxSize),
+			QueryLogMaxFiles:     intVal(cfg.DNSServer.QueryLogMaxFiles),
+			QueryLogSampleRate:   float64Val(cfg.DNSServer.QueryLogSampleRate),
+			QueryLogNames:        cfg.DNSServer.QueryLogNames,
+			QueryLogExcludeNames: cfg.DNSServer.QueryLogExcludeNames,
+			AllowCIDRs:           cfg.DNSServer.AllowCIDRs,
+			DenyCIDRs:            cfg.DNSServer.DenyCIDRs,
+			RateLimit:            float64Val(cfg.DNSServer.RateLimit),
+			RateLimitBurst:       intVal(cfg.DNSServer.RateLimitBurst),
+			RateLimitAction:      stringVal(cfg.DNSServer.RateLimitAction),
+			RRLRate:              float64Val(cfg.DNSServer.RRLRate),
+			RRLSlip:              intVal(cfg.DNSServer.RRLSlip),
 		},
 	}, nil
 }
 
+// serviceMetricsTargets constructs the runtime config of the service metrics
+// targets.
+func serviceMetricsTargets(targets []ServiceMetricsTargetFlags) []consuldp.ServiceMetricsTarget {
+	var result []consuldp.ServiceMetricsTarget
+	for _, t := range targets {
+		target := consuldp.ServiceMetricsTarget{
+			Name:                  stringVal(t.Name),
+			URL:                   stringVal(t.URL),
+			Headers:               t.Headers,
+			BearerTokenFile:       stringVal(t.BearerTokenFile),
+			BasicAuthUsername:     stringVal(t.BasicAuthUsername),
+			BasicAuthPasswordFile: stringVal(t.BasicAuthPasswordFile),
+			Timeout:               durationVal(t.Timeout),
+			Labels:                t.Labels,
+		}
+		if t.TLS != nil {
+			target.TLS = &consuldp.TLSConfig{
+				Disabled:           boolVal(t.TLS.Disabled),
+				CACertsPath:        stringVal(t.TLS.CACertsPath),
+				CertFile:           stringVal(t.TLS.CertFile),
+				KeyFile:            stringVal(t.TLS.KeyFile),
+				ServerName:         stringVal(t.TLS.ServerName),
+				InsecureSkipVerify: boolVal(t.TLS.InsecureSkipVerify),
+			}
+		}
+		result = append(result, target)
+	}
+	return result
+}
+
 func mergeConfigs(c1, c2 DataplaneConfigFlags) (DataplaneConfigFlags, error) {
 	err := mergo.Merge(&c1, c2, mergo.WithOverride, mergo.WithoutDereference)
 	if err != nil {
@@ -83,12 +83,19 @@ func TestConfigGeneration(t *testing.T) {
 						ReadyBindAddress:              "127.0.1.0",
 						ReadyBindPort:                 18003,
 						EnvoyConcurrency:              4,
+						EnvoyConcurrencyMin:           1,
+						EnvoyConcurrencyRatio:         1,
 						EnvoyDrainStrategy:            "test-strategy",
 						ShutdownDrainListenersEnabled: true,
 						GracefulShutdownPath:          "/graceful_shutdown",
 						EnvoyDrainTimeSeconds:         30,
 						GracefulPort:                  20300,
 						GracefulStartupPath:           "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
 					},
 					Telemetry: &consuldp.TelemetryConfig{
 						UseCentralConfig: true,
@@ -162,12 +169,19 @@ func TestConfigGeneration(t *testing.T) {
 						ReadyBindAddress:              "127.0.1.0",
 						ReadyBindPort:                 18003,
 						EnvoyConcurrency:              4,
+						EnvoyConcurrencyMin:           1,
+						EnvoyConcurrencyRatio:         1,
 						EnvoyDrainStrategy:            "test-strategy",
 						ShutdownDrainListenersEnabled: true,
 						GracefulStartupPath:           "/graceful_startup",
 						GracefulShutdownPath:          "/graceful_shutdown",
 						EnvoyDrainTimeSeconds:         30,
 						GracefulPort:                  20300,
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
 					},
 					Telemetry: &consuldp.TelemetryConfig{
 						UseCentralConfig: true,
@@ -267,6 +281,8 @@ func TestConfigGeneration(t *testing.T) {
 						ReadyBindAddress:              "127.0.1.0",
 						ReadyBindPort:                 18003,
 						EnvoyConcurrency:              4,
+						EnvoyConcurrencyMin:           1,
+						EnvoyConcurrencyRatio:         1,
 						EnvoyDrainStrategy:            "test-strategy",
 						ShutdownDrainListenersEnabled: true,
 						GracefulStartupPath:           "/graceful_startup",
@@ -274,6 +290,11 @@ func TestConfigGeneration(t *testing.T) {
 						EnvoyDrainTimeSeconds:         30,
 						GracefulPort:                  20300,
 						DumpEnvoyConfigOnExitEnabled:  true,
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
 					},
 					Telemetry: &consuldp.TelemetryConfig{
 						UseCentralConfig: true,
@@ -372,6 +393,8 @@ func TestConfigGeneration(t *testing.T) {
 						ReadyBindAddress:              "127.0.1.0",
 						ReadyBindPort:                 18003,
 						EnvoyConcurrency:              4,
+						EnvoyConcurrencyMin:           1,
+						EnvoyConcurrencyRatio:         1,
 						EnvoyDrainStrategy:            "test-strategy",
 						ShutdownDrainListenersEnabled: true,
 						GracefulShutdownPath:          "/graceful_shutdown",
@@ -379,6 +402,11 @@ func TestConfigGeneration(t *testing.T) {
 						GracefulPort:                  20300,
 						DumpEnvoyConfigOnExitEnabled:  true,
 						GracefulStartupPath:           "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
 					},
 					Telemetry: &consuldp.TelemetryConfig{
 						UseCentralConfig: true,
@@ -463,12 +491,19 @@ func TestConfigGeneration(t *testing.T) {
 						ReadyBindAddress:              "127.0.1.0",
 						ReadyBindPort:                 18003,
 						EnvoyConcurrency:              4,
+						EnvoyConcurrencyMin:           1,
+						EnvoyConcurrencyRatio:         1,
 						EnvoyDrainStrategy:            "test-strategy",
 						ShutdownDrainListenersEnabled: true,
 						GracefulShutdownPath:          "/graceful_shutdown",
 						GracefulStartupPath:           "/graceful_startup",
 						EnvoyDrainTimeSeconds:         30,
 						GracefulPort:                  20300,
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
 					},
 					Telemetry: &consuldp.TelemetryConfig{
 						UseCentralConfig: true,
@@ -562,6 +597,8 @@ func TestConfigGeneration(t *testing.T) {
 						AdminBindPort:                 19000,
 						ReadyBindPort:                 0,
 						EnvoyConcurrency:              2,
+						EnvoyConcurrencyMin:           1,
+						EnvoyConcurrencyRatio:         1,
 						EnvoyDrainStrategy:            "immediate",
 						ShutdownDrainListenersEnabled: false,
 						GracefulShutdownPath:          "/graceful_shutdown",
@@ -569,6 +606,11 @@ func TestConfigGeneration(t *testing.T) {
 						GracefulPort:                  20300,
 						DumpEnvoyConfigOnExitEnabled:  false,
 						GracefulStartupPath:           "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
 					},
 					Telemetry: &consuldp.TelemetryConfig{
 						UseCentralConfig: true,
@@ -583,42 +625,26 @@ func TestConfigGeneration(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			desc: "test whether CLI flag values override the file values with service flags",
+			desc: "able to generate the envoy stats matcher from the config file and flags",
 			flagOpts: func() (*FlagOpts, error) {
-				opts, err := generateFlagOptsWithServiceFlags()
-				if err != nil {
-					return nil, err
-				}
+				opts := &FlagOpts{}
 				opts.configFile = "test.json"
-
-				opts.dataplaneConfig.Logging.LogLevel = strReference("info")
-				opts.dataplaneConfig.Logging.LogJSON = boolReference(false)
-				opts.dataplaneConfig.Consul.Credentials.Login.Meta = map[string]string{
-					"key1": "value1",
-				}
-
+				opts.dataplaneConfig.Envoy.StatsMatcher.ExclusionSuffixes = []string{".upstream_cx_length_ms"}
 				return opts, nil
 			},
 			writeConfigFile: func(t *testing.T) error {
 				inputJson := `{
 					"consul": {
-					  "addresses": "consul_server.dc1",
-					  "grpcPort": 8502,
-					  "serverWatchDisabled": false
+					  "addresses": "consul_server.dc1"
 					},
-					"service": {
-					  "nodeName": "test-node-1",
-					  "serviceId": "frontend-service-sidecar-proxy",
-					  "namespace": "default",
-					  "partition": "default"
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
 					},
 					"envoy": {
-					  "adminBindAddress": "127.0.0.1",
-					  "adminBindPort": 19000
-					},
-					"logging": {
-					  "logLevel": "warn",
-					  "logJSON": true
+					  "statsMatcher": {
+						"exclusionPrefixes": ["cluster.passthrough~", "http.public_listener"],
+						"exclusionSuffixes": [".upstream_rq_time"]
+					  }
 					}
 				  }`
 
@@ -636,74 +662,56 @@ func TestConfigGeneration(t *testing.T) {
 				return &consuldp.Config{
 					Mode: consuldp.ModeTypeSidecar,
 					Consul: &consuldp.ConsulConfig{
-						Addresses:           stringVal(flagOpts.dataplaneConfig.Consul.Addresses),
-						GRPCPort:            intVal(flagOpts.dataplaneConfig.Consul.GRPCPort),
-						ServerWatchDisabled: true,
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
 						Credentials: &consuldp.CredentialsConfig{
-							Type: "static",
-							Static: consuldp.StaticCredentialsConfig{
-								Token: "test-token-123",
-							},
-							Login: consuldp.LoginCredentialsConfig{
-								AuthMethod:  "test-iam-auth",
-								BearerToken: "bearer-login",
-								Meta: map[string]string{
-									"key1": "value1",
-								},
-							},
-						},
-						TLS: &consuldp.TLSConfig{
-							Disabled:           false,
-							CACertsPath:        "/consul/",
-							CertFile:           "ca-cert.pem",
-							KeyFile:            "key.pem",
-							ServerName:         "tls-server-name",
-							InsecureSkipVerify: true,
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
 						},
+						TLS: &consuldp.TLSConfig{},
 					},
 					Proxy: &consuldp.ProxyConfig{
-						NodeName:  "test-node-dc1",
-						NodeID:    "dc1.node.id",
-						Namespace: "default",
-						ProxyID:   "node1.service1",
-						Partition: "default",
+						ProxyID: "frontend-service-sidecar-proxy",
 					},
 					Logging: &consuldp.LoggingConfig{
 						Name:     DefaultLogName,
-						LogJSON:  false,
 						LogLevel: "INFO",
 					},
 					DNSServer: &consuldp.DNSServerConfig{
 						BindAddr: "127.0.0.1",
-						Port:     8604,
+						Port:     -1,
 					},
 					XDSServer: &consuldp.XDSServer{
-						BindAddress: "127.0.1.0",
-						BindPort:    0,
+						BindAddress: "127.0.0.1",
 					},
 					Envoy: &consuldp.EnvoyConfig{
-						AdminBindAddress:              "127.0.1.0",
-						AdminBindPort:                 18000,
-						ReadyBindAddress:              "127.0.1.0",
-						ReadyBindPort:                 18003,
-						EnvoyConcurrency:              4,
-						EnvoyDrainStrategy:            "test-strategy",
-						ShutdownDrainListenersEnabled: true,
-						GracefulShutdownPath:          "/graceful_shutdown",
-						EnvoyDrainTimeSeconds:         30,
-						GracefulPort:                  20300,
-						DumpEnvoyConfigOnExitEnabled:  false,
-						GracefulStartupPath:           "/graceful_startup",
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						StatsMatcher: consuldp.StatsMatcherConfig{
+							ExclusionPrefixes: []string{"cluster.passthrough~", "http.public_listener"},
+							// CLI flags replace the values from the config file.
+							ExclusionSuffixes: []string{".upstream_cx_length_ms"},
+						},
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
 					},
 					Telemetry: &consuldp.TelemetryConfig{
 						UseCentralConfig: true,
 						Prometheus: consuldp.PrometheusTelemetryConfig{
-							RetentionTime: 10 * time.Second,
+							RetentionTime: 60 * time.Second,
 							ScrapePath:    "/metrics",
-							MergePort:     12000,
-							CACertsPath:   "/consul/",
-							CertFile:      "prom-ca-cert.pem",
-							KeyFile:       "prom-key.pem",
+							MergePort:     20100,
 						},
 					},
 				}
@@ -711,43 +719,29 @@ func TestConfigGeneration(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			desc: "test whether CLI flag values override the file values with proxy flags",
+			desc: "able to generate the envoy overload manager config from the config file and flags",
 			flagOpts: func() (*FlagOpts, error) {
-				opts, err := generateFlagOptsWithProxyFlags()
-				opts.dataplaneConfig.Mode = strReference("dns-proxy")
-				if err != nil {
-					return nil, err
-				}
+				opts := &FlagOpts{}
 				opts.configFile = "test.json"
-
-				opts.dataplaneConfig.Logging.LogLevel = strReference("info")
-				opts.dataplaneConfig.Logging.LogJSON = boolReference(false)
-				opts.dataplaneConfig.Consul.Credentials.Login.Meta = map[string]string{
-					"key1": "value1",
-				}
-
+				opts.dataplaneConfig.Envoy.OverloadManager.Enabled = boolReference(true)
+				opts.dataplaneConfig.Envoy.OverloadManager.StopAcceptingConnectionsThreshold = float64Reference(0)
 				return opts, nil
 			},
 			writeConfigFile: func(t *testing.T) error {
 				inputJson := `{
 					"consul": {
-					  "addresses": "consul_server.dc1",
-					  "grpcPort": 8502,
-					  "serverWatchDisabled": false
+					  "addresses": "consul_server.dc1"
 					},
 					"proxy": {
-					  "nodeName": "test-node-1",
-					  "proxyId": "frontend-service-sidecar-proxy",
-					  "namespace": "default",
-					  "partition": "default"
+					  "id": "frontend-service-sidecar-proxy"
 					},
 					"envoy": {
-					  "adminBindAddress": "127.0.0.1",
-					  "adminBindPort": 19000
-					},
-					"logging": {
-					  "logLevel": "warn",
-					  "logJSON": true
+					  "overloadManager": {
+						"maxHeapSizeBytes": 536870912,
+						"shrinkHeapThreshold": 0.9,
+						"stopAcceptingConnectionsThreshold": 0.99,
+						"maxDownstreamConnections": 10000
+					  }
 					}
 				  }`
 
@@ -763,143 +757,1614 @@ func TestConfigGeneration(t *testing.T) {
 			},
 			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
 				return &consuldp.Config{
-					Mode: consuldp.ModeTypeDNSProxy,
+					Mode: consuldp.ModeTypeSidecar,
 					Consul: &consuldp.ConsulConfig{
-						Addresses:           stringVal(flagOpts.dataplaneConfig.Consul.Addresses),
-						GRPCPort:            intVal(flagOpts.dataplaneConfig.Consul.GRPCPort),
-						ServerWatchDisabled: true,
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
 						Credentials: &consuldp.CredentialsConfig{
-							Type: "static",
-							Static: consuldp.StaticCredentialsConfig{
-								Token: "test-token-123",
-							},
-							Login: consuldp.LoginCredentialsConfig{
-								AuthMethod:  "test-iam-auth",
-								BearerToken: "bearer-login",
-								Meta: map[string]string{
-									"key1": "value1",
-								},
-							},
-						},
-						TLS: &consuldp.TLSConfig{
-							Disabled:           false,
-							CACertsPath:        "/consul/",
-							CertFile:           "ca-cert.pem",
-							KeyFile:            "key.pem",
-							ServerName:         "tls-server-name",
-							InsecureSkipVerify: true,
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
 						},
+						TLS: &consuldp.TLSConfig{},
 					},
 					Proxy: &consuldp.ProxyConfig{
-						NodeName:  "test-node-dc1",
-						NodeID:    "dc1.node.id",
-						Namespace: "default",
-						ProxyID:   "node1.service1",
-						Partition: "default",
+						ProxyID: "frontend-service-sidecar-proxy",
 					},
 					Logging: &consuldp.LoggingConfig{
 						Name:     DefaultLogName,
-						LogJSON:  false,
 						LogLevel: "INFO",
 					},
 					DNSServer: &consuldp.DNSServerConfig{
 						BindAddr: "127.0.0.1",
-						Port:     8604,
+						Port:     -1,
 					},
 					XDSServer: &consuldp.XDSServer{
-						BindAddress: "127.0.1.0",
-						BindPort:    0,
+						BindAddress: "127.0.0.1",
 					},
 					Envoy: &consuldp.EnvoyConfig{
-						AdminBindAddress:              "127.0.1.0",
-						AdminBindPort:                 18000,
-						ReadyBindAddress:              "127.0.1.0",
-						ReadyBindPort:                 18003,
-						EnvoyConcurrency:              4,
-						EnvoyDrainStrategy:            "test-strategy",
-						ShutdownDrainListenersEnabled: true,
-						GracefulShutdownPath:          "/graceful_shutdown",
-						GracefulStartupPath:           "/graceful_startup",
-						EnvoyDrainTimeSeconds:         30,
-						GracefulPort:                  20300,
-						DumpEnvoyConfigOnExitEnabled:  false,
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							Enabled:                        true,
+							MaxHeapSizeBytes:               536870912,
+							ShrinkHeapThreshold:            0.9,
+							StopAcceptingRequestsThreshold: 0.98,
+							// The CLI flag disables the action set in the config file.
+							StopAcceptingConnectionsThreshold: 0,
+							MaxDownstreamConnections:          10000,
+						},
 					},
 					Telemetry: &consuldp.TelemetryConfig{
 						UseCentralConfig: true,
 						Prometheus: consuldp.PrometheusTelemetryConfig{
-							RetentionTime: 10 * time.Second,
+							RetentionTime: 60 * time.Second,
 							ScrapePath:    "/metrics",
-							MergePort:     12000,
-							CACertsPath:   "/consul/",
-							CertFile:      "prom-ca-cert.pem",
-							KeyFile:       "prom-key.pem",
+							MergePort:     20100,
 						},
 					},
 				}
 			},
 			wantErr: false,
 		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.desc, func(t *testing.T) {
-			opts, err := tc.flagOpts()
-			require.NoError(t, err)
-
-			if tc.writeConfigFile != nil {
-				require.NoError(t, tc.writeConfigFile(t))
-			}
-
-			cfg, err := opts.buildDataplaneConfig(nil)
+		{
+			desc: "able to configure OTLP metrics export from the config file and flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts := &FlagOpts{}
+				opts.configFile = "test.json"
+				opts.dataplaneConfig.Telemetry.OTLP.Protocol = strReference("http/protobuf")
+				opts.dataplaneConfig.Telemetry.OTLP.EnvoyStats = boolReference(true)
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1"
+					},
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
+					},
+					"telemetry": {
+					  "otlp": {
+						"endpoint": "otel-collector:4317",
+						"protocol": "grpc",
+						"insecure": true,
+						"headers": {
+						  "x-api-key": "secret"
+						},
+						"exportInterval": "15s"
+					  }
+					}
+				  }`
 
-			if tc.wantErr {
-				require.Error(t, err)
-			} else {
-				require.NoError(t, err)
-				expCfg := tc.makeExpectedCfg(opts)
-				require.Equal(t, expCfg, cfg)
-			}
-		})
-	}
-}
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
 
-func generateFlagOptsWithServiceFlags() (*FlagOpts, error) {
-	data := `
-	{
-		"consul": {
-			"addresses": "` + fmt.Sprintf("consul.address.server_%d", rand.Int()) + `",
-			"grpcPort": ` + fmt.Sprintf("%d", rand.Int()) + `,
-			"serverWatchDisabled": true,
-			"tls": {
-				"disabled": false,
-				"caCertsPath": "/consul/",
-				"certFile": "ca-cert.pem",
-				"keyFile": "key.pem",
-				"serverName": "tls-server-name",
-				"insecureSkipVerify": true
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
 			},
-			"credentials": {
-				"type": "static",
-				"static": {
-					"token": "test-token-123"
-				},
-				"login": {
-					"authMethod": "test-iam-auth",
-					"bearerToken": "bearer-login"
-				}
-			}
-		},
-		"service": {
-			"nodeName": "test-node-dc1",
-			"nodeID": "dc1.node.id",
-			"namespace": "default",
-			"serviceID": "node1.service1",
-			"partition": "default"
-		},
-		"logging": {
-			"logJSON": true,
-			"logLevel": "warn"
-		},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
+						Credentials: &consuldp.CredentialsConfig{
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
+						},
+						TLS: &consuldp.TLSConfig{},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						ProxyID: "frontend-service-sidecar-proxy",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr: "127.0.0.1",
+						Port:     -1,
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.0.1",
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: true,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime: 60 * time.Second,
+							ScrapePath:    "/metrics",
+							MergePort:     20100,
+						},
+						OTLP: consuldp.OTLPTelemetryConfig{
+							Endpoint:       "otel-collector:4317",
+							Protocol:       "http/protobuf",
+							Insecure:       true,
+							Headers:        map[string]string{"x-api-key": "secret"},
+							ExportInterval: 15 * time.Second,
+							EnvoyStats:     true,
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "able to configure merged metrics from the config file and flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts := &FlagOpts{}
+				opts.configFile = "test.json"
+				opts.dataplaneConfig.Telemetry.Prometheus.MergeCollisionMode = strReference("prefix")
+				opts.dataplaneConfig.Telemetry.Prometheus.ConstLabels = map[string]string{"zone": "us-east-1a"}
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1"
+					},
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
+					},
+					"telemetry": {
+					  "prometheus": {
+						"scrapeTimeout": "2s",
+						"mergeCollisionMode": "label",
+						"constLabels": {
+						  "cluster": "prod"
+						}
+					  }
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
+						Credentials: &consuldp.CredentialsConfig{
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
+						},
+						TLS: &consuldp.TLSConfig{},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						ProxyID: "frontend-service-sidecar-proxy",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr: "127.0.0.1",
+						Port:     -1,
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.0.1",
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: true,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime:      60 * time.Second,
+							ScrapePath:         "/metrics",
+							MergePort:          20100,
+							ScrapeTimeout:      2 * time.Second,
+							MergeCollisionMode: "prefix",
+							ConstLabels:        map[string]string{"cluster": "prod", "zone": "us-east-1a"},
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "able to configure the metrics cache max series from the config file and flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts := &FlagOpts{}
+				opts.configFile = "test.json"
+				opts.dataplaneConfig.Telemetry.MetricsCacheMaxSeries = intReference(2000)
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1"
+					},
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
+					},
+					"telemetry": {
+					  "metricsCacheMaxSeries": 500
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
+						Credentials: &consuldp.CredentialsConfig{
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
+						},
+						TLS: &consuldp.TLSConfig{},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						ProxyID: "frontend-service-sidecar-proxy",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr: "127.0.0.1",
+						Port:     -1,
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.0.1",
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig:      true,
+						MetricsCacheMaxSeries: 2000,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime: 60 * time.Second,
+							ScrapePath:    "/metrics",
+							MergePort:     20100,
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "able to configure the dns cache, udp workers and tcp connections from the config file and flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts := &FlagOpts{}
+				opts.configFile = "test.json"
+				opts.dataplaneConfig.DNSServer.CacheSize = intReference(2000)
+				opts.dataplaneConfig.DNSServer.UDPWorkers = intReference(10)
+				opts.dataplaneConfig.DNSServer.TCPMaxConns = intReference(200)
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1"
+					},
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
+					},
+					"dnsServer": {
+					  "cacheSize": 500,
+					  "cacheMaxTTL": "30s",
+					  "serveStaleWindow": "5m",
+					  "udpQueueSize": 50,
+					  "udpDropPolicy": "drop-oldest",
+					  "tcpIdleTimeout": "30s",
+					  "tcpMaxConnections": 100
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
+						Credentials: &consuldp.CredentialsConfig{
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
+						},
+						TLS: &consuldp.TLSConfig{},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						ProxyID: "frontend-service-sidecar-proxy",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr:         "127.0.0.1",
+						Port:             -1,
+						CacheSize:        2000,
+						CacheMaxTTL:      30 * time.Second,
+						ServeStaleWindow: 5 * time.Minute,
+						UDPWorkers:       10,
+						UDPQueueSize:     50,
+						UDPDropPolicy:    "drop-oldest",
+						TCPIdleTimeout:   30 * time.Second,
+						TCPMaxConns:      200,
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.0.1",
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: true,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime: 60 * time.Second,
+							ScrapePath:    "/metrics",
+							MergePort:     20100,
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "able to configure dns recursors and encrypted listeners from the config file and flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts := &FlagOpts{}
+				opts.configFile = "test.json"
+				opts.dataplaneConfig.DNSServer.Recursors = []string{"10.0.0.2", "10.0.0.3:5353"}
+				opts.dataplaneConfig.DNSServer.RecursorTimeout = &Duration{Duration: time.Second}
+				opts.dataplaneConfig.DNSServer.DoHPath = strReference("/custom-dns-query")
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1"
+					},
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
+					},
+					"dnsServer": {
+					  "domain": "example.consul",
+					  "altDomains": ["consul.internal"],
+					  "recursors": ["8.8.8.8"],
+					  "resolvConf": "/etc/resolv.conf",
+					  "recursorTimeout": "5s",
+					  "dotAddress": "127.0.0.1:853",
+					  "dohAddress": "127.0.0.1:443",
+					  "tlsCertFile": "/certs/tls.crt",
+					  "tlsKeyFile": "/certs/tls.key"
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
+						Credentials: &consuldp.CredentialsConfig{
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
+						},
+						TLS: &consuldp.TLSConfig{},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						ProxyID: "frontend-service-sidecar-proxy",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr:        "127.0.0.1",
+						Port:            -1,
+						Domain:          "example.consul",
+						AltDomains:      []string{"consul.internal"},
+						Recursors:       []string{"10.0.0.2", "10.0.0.3:5353"},
+						ResolvConf:      "/etc/resolv.conf",
+						RecursorTimeout: time.Second,
+						DoTAddr:         "127.0.0.1:853",
+						DoHAddr:         "127.0.0.1:443",
+						DoHPath:         "/custom-dns-query",
+						TLSCertFile:     "/certs/tls.crt",
+						TLSKeyFile:      "/certs/tls.key",
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.0.1",
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: true,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime: 60 * time.Second,
+							ScrapePath:    "/metrics",
+							MergePort:     20100,
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "able to configure dns client acls and rate limits from the config file and flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts := &FlagOpts{}
+				opts.configFile = "test.json"
+				opts.dataplaneConfig.DNSServer.DenyCIDRs = []string{"10.1.0.0/16"}
+				opts.dataplaneConfig.DNSServer.RateLimit = float64Reference(50)
+				opts.dataplaneConfig.DNSServer.RateLimitAction = strReference("drop")
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1"
+					},
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
+					},
+					"dnsServer": {
+					  "allowCIDRs": ["10.0.0.0/8", "fd00::/8"],
+					  "denyCIDRs": ["10.2.0.0/16"],
+					  "rateLimit": 20,
+					  "rateLimitBurst": 40,
+					  "rateLimitAction": "refuse",
+					  "rrlRate": 5.5,
+					  "rrlSlip": 3
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
+						Credentials: &consuldp.CredentialsConfig{
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
+						},
+						TLS: &consuldp.TLSConfig{},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						ProxyID: "frontend-service-sidecar-proxy",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr:        "127.0.0.1",
+						Port:            -1,
+						AllowCIDRs:      []string{"10.0.0.0/8", "fd00::/8"},
+						DenyCIDRs:       []string{"10.1.0.0/16"},
+						RateLimit:       50,
+						RateLimitBurst:  40,
+						RateLimitAction: "drop",
+						RRLRate:         5.5,
+						RRLSlip:         3,
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.0.1",
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: true,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime: 60 * time.Second,
+							ScrapePath:    "/metrics",
+							MergePort:     20100,
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "able to configure the dns query log from the config file and flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts := &FlagOpts{}
+				opts.configFile = "test.json"
+				opts.dataplaneConfig.DNSServer.QueryLog = boolReference(true)
+				opts.dataplaneConfig.DNSServer.QueryLogSampleRate = float64Reference(0.25)
+				opts.dataplaneConfig.DNSServer.QueryLogExcludeNames = []string{"db.service.consul"}
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1"
+					},
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
+					},
+					"dnsServer": {
+					  "queryLog": false,
+					  "queryLogFile": "/var/log/dns-queries.log",
+					  "queryLogMaxSize": 10,
+					  "queryLogMaxFiles": 3,
+					  "queryLogSampleRate": 0.5,
+					  "queryLogNames": ["service.consul"]
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
+						Credentials: &consuldp.CredentialsConfig{
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
+						},
+						TLS: &consuldp.TLSConfig{},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						ProxyID: "frontend-service-sidecar-proxy",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr:             "127.0.0.1",
+						Port:                 -1,
+						QueryLog:             true,
+						QueryLogFile:         "/var/log/dns-queries.log",
+						QueryLogMaxSize:      10,
+						QueryLogMaxFiles:     3,
+						QueryLogSampleRate:   0.25,
+						QueryLogNames:        []string{"service.consul"},
+						QueryLogExcludeNames: []string{"db.service.consul"},
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.0.1",
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: true,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime: 60 * time.Second,
+							ScrapePath:    "/metrics",
+							MergePort:     20100,
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "able to configure prometheus push from the config file and flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts := &FlagOpts{}
+				opts.configFile = "test.json"
+				opts.dataplaneConfig.Telemetry.Prometheus.Push.Protocol = strReference("remote-write")
+				opts.dataplaneConfig.Telemetry.Prometheus.Push.Instance = strReference("web-1")
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1"
+					},
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
+					},
+					"telemetry": {
+					  "prometheus": {
+						"push": {
+						  "url": "https://metrics.example.com/api/v1/write",
+						  "protocol": "pushgateway",
+						  "interval": "15s",
+						  "job": "batch",
+						  "headers": {"X-Scope-OrgID": "tenant-1"}
+						}
+					  }
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
+						Credentials: &consuldp.CredentialsConfig{
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
+						},
+						TLS: &consuldp.TLSConfig{},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						ProxyID: "frontend-service-sidecar-proxy",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr: "127.0.0.1",
+						Port:     -1,
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.0.1",
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: true,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime: 60 * time.Second,
+							ScrapePath:    "/metrics",
+							MergePort:     20100,
+							Push: consuldp.PrometheusPushConfig{
+								URL:      "https://metrics.example.com/api/v1/write",
+								Protocol: "remote-write",
+								Interval: 15 * time.Second,
+								Job:      "batch",
+								Instance: "web-1",
+								Headers:  map[string]string{"X-Scope-OrgID": "tenant-1"},
+							},
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "able to configure local telemetry from the config file and flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts := &FlagOpts{}
+				opts.configFile = "test.json"
+				opts.dataplaneConfig.Telemetry.UseCentralConfig = boolReference(false)
+				opts.dataplaneConfig.Telemetry.Prometheus.BindAddr = strReference("0.0.0.0:20300")
+				opts.dataplaneConfig.Telemetry.StatsTags = []string{"team=payments"}
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1"
+					},
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
+					},
+					"telemetry": {
+					  "statsdURL": "udp://127.0.0.1:8125",
+					  "dogstatsdURL": "unix:///var/run/datadog/dsd.socket",
+					  "statsTags": ["env=prod"],
+					  "prometheus": {
+						"bindAddress": "0.0.0.0:20200"
+					  }
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
+						Credentials: &consuldp.CredentialsConfig{
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
+						},
+						TLS: &consuldp.TLSConfig{},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						ProxyID: "frontend-service-sidecar-proxy",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr: "127.0.0.1",
+						Port:     -1,
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.0.1",
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: false,
+						StatsdURL:        "udp://127.0.0.1:8125",
+						DogstatsdURL:     "unix:///var/run/datadog/dsd.socket",
+						StatsTags:        []string{"team=payments"},
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime: 60 * time.Second,
+							ScrapePath:    "/metrics",
+							MergePort:     20100,
+							BindAddr:      "0.0.0.0:20300",
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "able to configure the metrics servers from the config file and flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts := &FlagOpts{}
+				opts.configFile = "test.json"
+				opts.dataplaneConfig.Telemetry.Prometheus.DataplanePort = intReference(20102)
+				opts.dataplaneConfig.Telemetry.Prometheus.ServerBearerTokenPath = strReference("/var/run/metrics-token")
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1"
+					},
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
+					},
+					"telemetry": {
+					  "prometheus": {
+						"caCertsPath": "/ca.pem",
+						"certFile": "/cert.pem",
+						"keyFile": "/key.pem",
+						"mergeBindAddress": "unix:///var/run/merged-metrics.sock",
+						"dataplaneBindAddress": "::1",
+						"dataplanePort": 20101,
+						"serverTLS": true,
+						"serverVerifyIncoming": true
+					  }
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
+						Credentials: &consuldp.CredentialsConfig{
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
+						},
+						TLS: &consuldp.TLSConfig{},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						ProxyID: "frontend-service-sidecar-proxy",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr: "127.0.0.1",
+						Port:     -1,
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.0.1",
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: true,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime:         60 * time.Second,
+							CACertsPath:           "/ca.pem",
+							CertFile:              "/cert.pem",
+							KeyFile:               "/key.pem",
+							ScrapePath:            "/metrics",
+							MergePort:             20100,
+							MergeBindAddr:         "unix:///var/run/merged-metrics.sock",
+							DataplaneBindAddr:     "::1",
+							DataplanePort:         20102,
+							ServerTLS:             true,
+							ServerVerifyIncoming:  true,
+							ServerBearerTokenPath: "/var/run/metrics-token",
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "able to configure service metrics targets from the config file and flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts := &FlagOpts{}
+				opts.configFile = "test.json"
+				opts.dataplaneConfig.Telemetry.Prometheus.ServiceMetricsURL = strReference("http://127.0.0.1:8080/metrics")
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1"
+					},
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
+					},
+					"telemetry": {
+					  "prometheus": {
+						"serviceMetricsTargets": [
+						  {
+							"name": "app",
+							"url": "http://127.0.0.1:9090/metrics",
+							"headers": {
+							  "X-Api-Key": "secret"
+							},
+							"timeout": "2s",
+							"labels": {
+							  "team": "payments"
+							}
+						  },
+						  {
+							"name": "sidecar",
+							"url": "https://127.0.0.1:9443/metrics",
+							"bearerTokenFile": "/var/run/token",
+							"tls": {
+							  "caCertsPath": "/ca.pem",
+							  "serverName": "sidecar"
+							}
+						  }
+						]
+					  }
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
+						Credentials: &consuldp.CredentialsConfig{
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
+						},
+						TLS: &consuldp.TLSConfig{},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						ProxyID: "frontend-service-sidecar-proxy",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr: "127.0.0.1",
+						Port:     -1,
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.0.1",
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:      "127.0.0.1",
+						AdminBindPort:         19000,
+						EnvoyConcurrency:      2,
+						EnvoyConcurrencyMin:   1,
+						EnvoyConcurrencyRatio: 1,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: true,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime:     60 * time.Second,
+							ScrapePath:        "/metrics",
+							MergePort:         20100,
+							ServiceMetricsURL: "http://127.0.0.1:8080/metrics",
+							ServiceMetricsTargets: []consuldp.ServiceMetricsTarget{
+								{
+									Name:    "app",
+									URL:     "http://127.0.0.1:9090/metrics",
+									Headers: map[string]string{"X-Api-Key": "secret"},
+									Timeout: 2 * time.Second,
+									Labels:  map[string]string{"team": "payments"},
+								},
+								{
+									Name:            "sidecar",
+									URL:             "https://127.0.0.1:9443/metrics",
+									BearerTokenFile: "/var/run/token",
+									TLS: &consuldp.TLSConfig{
+										CACertsPath: "/ca.pem",
+										ServerName:  "sidecar",
+									},
+								},
+							},
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "able to configure automatic envoy concurrency from the config file and flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts := &FlagOpts{}
+				opts.configFile = "test.json"
+				opts.dataplaneConfig.Envoy.ConcurrencyMax = intReference(8)
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1"
+					},
+					"proxy": {
+					  "id": "frontend-service-sidecar-proxy"
+					},
+					"envoy": {
+					  "concurrency": "auto",
+					  "concurrencyMin": 2,
+					  "concurrencyMax": 4,
+					  "concurrencyRatio": 0.5
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses: "consul_server.dc1",
+						GRPCPort:  8502,
+						Credentials: &consuldp.CredentialsConfig{
+							Static: consuldp.StaticCredentialsConfig{},
+							Login:  consuldp.LoginCredentialsConfig{},
+						},
+						TLS: &consuldp.TLSConfig{},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						ProxyID: "frontend-service-sidecar-proxy",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr: "127.0.0.1",
+						Port:     -1,
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.0.1",
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:     "127.0.0.1",
+						AdminBindPort:        19000,
+						EnvoyConcurrencyAuto: true,
+						EnvoyConcurrencyMin:  2,
+						// CLI flags override the values from the config file.
+						EnvoyConcurrencyMax:   8,
+						EnvoyConcurrencyRatio: 0.5,
+						EnvoyDrainStrategy:    "immediate",
+						GracefulShutdownPath:  "/graceful_shutdown",
+						EnvoyDrainTimeSeconds: 30,
+						GracefulPort:          20300,
+						GracefulStartupPath:   "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: true,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime: 60 * time.Second,
+							ScrapePath:    "/metrics",
+							MergePort:     20100,
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "test whether CLI flag values override the file values with service flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts, err := generateFlagOptsWithServiceFlags()
+				if err != nil {
+					return nil, err
+				}
+				opts.configFile = "test.json"
+
+				opts.dataplaneConfig.Logging.LogLevel = strReference("info")
+				opts.dataplaneConfig.Logging.LogJSON = boolReference(false)
+				opts.dataplaneConfig.Consul.Credentials.Login.Meta = map[string]string{
+					"key1": "value1",
+				}
+
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1",
+					  "grpcPort": 8502,
+					  "serverWatchDisabled": false
+					},
+					"service": {
+					  "nodeName": "test-node-1",
+					  "serviceId": "frontend-service-sidecar-proxy",
+					  "namespace": "default",
+					  "partition": "default"
+					},
+					"envoy": {
+					  "adminBindAddress": "127.0.0.1",
+					  "adminBindPort": 19000
+					},
+					"logging": {
+					  "logLevel": "warn",
+					  "logJSON": true
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeSidecar,
+					Consul: &consuldp.ConsulConfig{
+						Addresses:           stringVal(flagOpts.dataplaneConfig.Consul.Addresses),
+						GRPCPort:            intVal(flagOpts.dataplaneConfig.Consul.GRPCPort),
+						ServerWatchDisabled: true,
+						Credentials: &consuldp.CredentialsConfig{
+							Type: "static",
+							Static: consuldp.StaticCredentialsConfig{
+								Token: "test-token-123",
+							},
+							Login: consuldp.LoginCredentialsConfig{
+								AuthMethod:  "test-iam-auth",
+								BearerToken: "bearer-login",
+								Meta: map[string]string{
+									"key1": "value1",
+								},
+							},
+						},
+						TLS: &consuldp.TLSConfig{
+							Disabled:           false,
+							CACertsPath:        "/consul/",
+							CertFile:           "ca-cert.pem",
+							KeyFile:            "key.pem",
+							ServerName:         "tls-server-name",
+							InsecureSkipVerify: true,
+						},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						NodeName:  "test-node-dc1",
+						NodeID:    "dc1.node.id",
+						Namespace: "default",
+						ProxyID:   "node1.service1",
+						Partition: "default",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogJSON:  false,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr: "127.0.0.1",
+						Port:     8604,
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.1.0",
+						BindPort:    0,
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:              "127.0.1.0",
+						AdminBindPort:                 18000,
+						ReadyBindAddress:              "127.0.1.0",
+						ReadyBindPort:                 18003,
+						EnvoyConcurrency:              4,
+						EnvoyConcurrencyMin:           1,
+						EnvoyConcurrencyRatio:         1,
+						EnvoyDrainStrategy:            "test-strategy",
+						ShutdownDrainListenersEnabled: true,
+						GracefulShutdownPath:          "/graceful_shutdown",
+						EnvoyDrainTimeSeconds:         30,
+						GracefulPort:                  20300,
+						DumpEnvoyConfigOnExitEnabled:  false,
+						GracefulStartupPath:           "/graceful_startup",
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: true,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime: 10 * time.Second,
+							ScrapePath:    "/metrics",
+							MergePort:     12000,
+							CACertsPath:   "/consul/",
+							CertFile:      "prom-ca-cert.pem",
+							KeyFile:       "prom-key.pem",
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+		{
+			desc: "test whether CLI flag values override the file values with proxy flags",
+			flagOpts: func() (*FlagOpts, error) {
+				opts, err := generateFlagOptsWithProxyFlags()
+				opts.dataplaneConfig.Mode = strReference("dns-proxy")
+				if err != nil {
+					return nil, err
+				}
+				opts.configFile = "test.json"
+
+				opts.dataplaneConfig.Logging.LogLevel = strReference("info")
+				opts.dataplaneConfig.Logging.LogJSON = boolReference(false)
+				opts.dataplaneConfig.Consul.Credentials.Login.Meta = map[string]string{
+					"key1": "value1",
+				}
+
+				return opts, nil
+			},
+			writeConfigFile: func(t *testing.T) error {
+				inputJson := `{
+					"consul": {
+					  "addresses": "consul_server.dc1",
+					  "grpcPort": 8502,
+					  "serverWatchDisabled": false
+					},
+					"proxy": {
+					  "nodeName": "test-node-1",
+					  "proxyId": "frontend-service-sidecar-proxy",
+					  "namespace": "default",
+					  "partition": "default"
+					},
+					"envoy": {
+					  "adminBindAddress": "127.0.0.1",
+					  "adminBindPort": 19000
+					},
+					"logging": {
+					  "logLevel": "warn",
+					  "logJSON": true
+					}
+				  }`
+
+				err := os.WriteFile("test.json", []byte(inputJson), 0600)
+				if err != nil {
+					return err
+				}
+
+				t.Cleanup(func() {
+					_ = os.Remove("test.json")
+				})
+				return nil
+			},
+			makeExpectedCfg: func(flagOpts *FlagOpts) *consuldp.Config {
+				return &consuldp.Config{
+					Mode: consuldp.ModeTypeDNSProxy,
+					Consul: &consuldp.ConsulConfig{
+						Addresses:           stringVal(flagOpts.dataplaneConfig.Consul.Addresses),
+						GRPCPort:            intVal(flagOpts.dataplaneConfig.Consul.GRPCPort),
+						ServerWatchDisabled: true,
+						Credentials: &consuldp.CredentialsConfig{
+							Type: "static",
+							Static: consuldp.StaticCredentialsConfig{
+								Token: "test-token-123",
+							},
+							Login: consuldp.LoginCredentialsConfig{
+								AuthMethod:  "test-iam-auth",
+								BearerToken: "bearer-login",
+								Meta: map[string]string{
+									"key1": "value1",
+								},
+							},
+						},
+						TLS: &consuldp.TLSConfig{
+							Disabled:           false,
+							CACertsPath:        "/consul/",
+							CertFile:           "ca-cert.pem",
+							KeyFile:            "key.pem",
+							ServerName:         "tls-server-name",
+							InsecureSkipVerify: true,
+						},
+					},
+					Proxy: &consuldp.ProxyConfig{
+						NodeName:  "test-node-dc1",
+						NodeID:    "dc1.node.id",
+						Namespace: "default",
+						ProxyID:   "node1.service1",
+						Partition: "default",
+					},
+					Logging: &consuldp.LoggingConfig{
+						Name:     DefaultLogName,
+						LogJSON:  false,
+						LogLevel: "INFO",
+					},
+					DNSServer: &consuldp.DNSServerConfig{
+						BindAddr: "127.0.0.1",
+						Port:     8604,
+					},
+					XDSServer: &consuldp.XDSServer{
+						BindAddress: "127.0.1.0",
+						BindPort:    0,
+					},
+					Envoy: &consuldp.EnvoyConfig{
+						AdminBindAddress:              "127.0.1.0",
+						AdminBindPort:                 18000,
+						ReadyBindAddress:              "127.0.1.0",
+						ReadyBindPort:                 18003,
+						EnvoyConcurrency:              4,
+						EnvoyConcurrencyMin:           1,
+						EnvoyConcurrencyRatio:         1,
+						EnvoyDrainStrategy:            "test-strategy",
+						ShutdownDrainListenersEnabled: true,
+						GracefulShutdownPath:          "/graceful_shutdown",
+						GracefulStartupPath:           "/graceful_startup",
+						EnvoyDrainTimeSeconds:         30,
+						GracefulPort:                  20300,
+						DumpEnvoyConfigOnExitEnabled:  false,
+						OverloadManager: consuldp.EnvoyOverloadManagerConfig{
+							ShrinkHeapThreshold:               0.95,
+							StopAcceptingRequestsThreshold:    0.98,
+							StopAcceptingConnectionsThreshold: 0.98,
+						},
+					},
+					Telemetry: &consuldp.TelemetryConfig{
+						UseCentralConfig: true,
+						Prometheus: consuldp.PrometheusTelemetryConfig{
+							RetentionTime: 10 * time.Second,
+							ScrapePath:    "/metrics",
+							MergePort:     12000,
+							CACertsPath:   "/consul/",
+							CertFile:      "prom-ca-cert.pem",
+							KeyFile:       "prom-key.pem",
+						},
+					},
+				}
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts, err := tc.flagOpts()
+			require.NoError(t, err)
+
+			if tc.writeConfigFile != nil {
+				require.NoError(t, tc.writeConfigFile(t))
+			}
+
+			cfg, err := opts.buildDataplaneConfig(nil)
+
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				expCfg := tc.makeExpectedCfg(opts)
+				require.Equal(t, expCfg, cfg)
+			}
+		})
+	}
+}
+
+func generateFlagOptsWithServiceFlags() (*FlagOpts, error) {
+	data := `
+	{
+		"consul": {
+			"addresses": "` + fmt.Sprintf("consul.address.server_%d", rand.Int()) + `",
+			"grpcPort": ` + fmt.Sprintf("%d", rand.Int()) + `,
+			"serverWatchDisabled": true,
+			"tls": {
+				"disabled": false,
+				"caCertsPath": "/consul/",
+				"certFile": "ca-cert.pem",
+				"keyFile": "key.pem",
+				"serverName": "tls-server-name",
+				"insecureSkipVerify": true
+			},
+			"credentials": {
+				"type": "static",
+				"static": {
+					"token": "test-token-123"
+				},
+				"login": {
+					"authMethod": "test-iam-auth",
+					"bearerToken": "bearer-login"
+				}
+			}
+		},
+		"service": {
+			"nodeName": "test-node-dc1",
+			"nodeID": "dc1.node.id",
+			"namespace": "default",
+			"serviceID": "node1.service1",
+			"partition": "default"
+		},
+		"logging": {
+			"logJSON": true,
+			"logLevel": "warn"
+		},
 		"telemetry": {
 			"useCentralConfig": true,
 			"prometheus": {
@@ -1025,3 +2490,7 @@ func boolReference(b bool) *bool {
 func intReference(i int) *int {
 	return &i
 }
+
+func float64Reference(f float64) *float64 {
+	return &f
+}
@@ -38,6 +38,32 @@ var (
 		return &b, nil
 	}
 
+	asFloat64 = func(s string) (*float64, error) {
+		if s == "" {
+			return nil, nil
+		}
+
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		return &f, nil
+	}
+
+	asConcurrency = func(s string) (*Concurrency, error) {
+		if s == "" {
+			return nil, nil
+		}
+
+		c, err := parseConcurrency(s)
+		if err != nil {
+			return nil, err
+		}
+
+		return &c, nil
+	}
+
 	asDuration = func(s string) (*Duration, error) {
 		if s == "" {
 			return nil, nil
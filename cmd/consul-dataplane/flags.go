@@ -43,11 +43,31 @@ func DurationVar(fs *flag.FlagSet, p **Duration, name, env, usage string) {
 	*p = parseEnv(env, asDuration)
 }
 
+func Float64Var(fs *flag.FlagSet, p **float64, name, env, usage string) {
+	usage = includeEnvUsage(env, usage)
+	fs.Var(newFloat64PtrValue(p), name, usage)
+	*p = parseEnv(env, asFloat64)
+}
+
+func ConcurrencyVar(fs *flag.FlagSet, p **Concurrency, name, env, usage string) {
+	usage = includeEnvUsage(env, usage)
+	fs.Var(newConcurrencyPtrValue(p), name, usage)
+	*p = parseEnv(env, asConcurrency)
+}
+
 // MapVar supports repeated flags and the environment variables numbered {1,9}.
+// The environment variables are applied in order, so that values accumulated
+// in a list keep their numbering.
 func MapVar(fs *flag.FlagSet, v flag.Value, name, env, usage string) {
 	usage = includeEnvUsage(fmt.Sprintf("%s{1,9}", env), usage)
 	fs.Var(v, name, usage)
-	for varName, value := range multiValueEnv(env) {
+	envVals := multiValueEnv(env)
+	for i := 1; i < 10; i++ {
+		varName := fmt.Sprintf("%s%d", env, i)
+		value, ok := envVals[varName]
+		if !ok {
+			continue
+		}
 		err := v.Set(value)
 		if err != nil {
 			log.Fatalf("error in environment variable %s: %s", varName, err)
@@ -55,6 +75,19 @@ func MapVar(fs *flag.FlagSet, v flag.Value, name, env, usage string) {
 	}
 }
 
+// SliceVar supports repeated flags and the environment variables numbered {1,9}.
+func SliceVar(fs *flag.FlagSet, p *[]string, name, env, usage string) {
+	usage = includeEnvUsage(fmt.Sprintf("%s{1,9}", env), usage)
+	v := (*FlagSliceValue)(p)
+	fs.Var(v, name, usage)
+	envVals := multiValueEnv(env)
+	for i := 1; i < 10; i++ {
+		if val, ok := envVals[fmt.Sprintf("%s%d", env, i)]; ok {
+			_ = v.Set(val)
+		}
+	}
+}
+
 func includeEnvUsage(env, usage string) string {
 	return fmt.Sprintf("%s Environment variable: %s.", usage, env)
 }
@@ -161,6 +194,76 @@ func (s *boolPtrValue) String() string {
 	return ""
 }
 
+// float64PtrValue is a flag.Value which stores the value in a *float64 if
+// it can be parsed with strconv.ParseFloat. If the value was not set the
+// pointer is nil.
+type float64PtrValue struct {
+	v **float64
+	b bool
+}
+
+func newFloat64PtrValue(p **float64) *float64PtrValue {
+	return &float64PtrValue{p, false}
+}
+
+func (s *float64PtrValue) Set(val string) error {
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return err
+	}
+	*s.v, s.b = &f, true
+	return nil
+}
+
+func (s *float64PtrValue) Get() interface{} {
+	if s.b {
+		return *s.v
+	}
+	return (*float64)(nil)
+}
+
+func (s *float64PtrValue) String() string {
+	if s.b {
+		return strconv.FormatFloat(**s.v, 'g', -1, 64)
+	}
+	return ""
+}
+
+// concurrencyPtrValue is a flag.Value which stores the value in a
+// *Concurrency if it is a number or "auto". If the value was not set the
+// pointer is nil.
+type concurrencyPtrValue struct {
+	v **Concurrency
+	b bool
+}
+
+func newConcurrencyPtrValue(p **Concurrency) *concurrencyPtrValue {
+	return &concurrencyPtrValue{p, false}
+}
+
+func (s *concurrencyPtrValue) Set(val string) error {
+	c, err := parseConcurrency(val)
+	if err != nil {
+		return err
+	}
+	*s.v, s.b = &c, true
+	return nil
+}
+
+func (s *concurrencyPtrValue) Get() interface{} {
+	if s.b {
+		return *s.v
+	}
+	return (*Concurrency)(nil)
+}
+
+func (s *concurrencyPtrValue) String() string {
+	if s.b {
+		return (**s.v).String()
+	}
+	return ""
+}
+
 // durationPtrValue is a flag.Value which stores the value in a
 // *time.Duration if it can be parsed with time.ParseDuration. If the
 // value was not set the pointer is nil.
@@ -225,3 +328,17 @@ func boolVal(v *bool) bool {
 	}
 	return *v
 }
+
+func float64Val(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func concurrencyVal(v *Concurrency) Concurrency {
+	if v == nil {
+		return Concurrency{}
+	}
+	return *v
+}
@@ -33,7 +33,8 @@ func init() {
 
 	StringVar(flags, &flagOpts.dataplaneConfig.Mode, "mode", "DP_MODE", "dataplane mode. Value can be:\n"+
 		"1. sidecar - used when running as a sidecar to Consul services with xDS Server, Envoy, and DNS Server running; OR\n"+
-		"2. dns-proxy - used when running as a standalone application where DNS Server runs, but Envoy and xDS Server are enabled.\n")
+		"2. dns-proxy - used when running as a standalone application where DNS Server runs, but Envoy and xDS Server are enabled; OR\n"+
+		"3. mesh-gateway, ingress-gateway, terminating-gateway or api-gateway - used when running the corresponding Consul gateway with xDS Server, Envoy, and DNS Server running.\n")
 
 	StringVar(flags, &flagOpts.dataplaneConfig.Consul.Addresses, "addresses", "DP_CONSUL_ADDRESSES", "Consul server gRPC addresses. Value can be:\n"+
 		"1. A DNS name that resolves to server addresses or the DNS name of a load balancer in front of the Consul servers; OR\n"+
@@ -88,22 +89,66 @@ func init() {
 	MapVar(flags, (*FlagMapValue)(&flagOpts.dataplaneConfig.Consul.Credentials.Login.Meta), "login-meta", "DP_CREDENTIAL_LOGIN_META", `A set of key/value pairs to attach to the ACL token. Each pair is formatted as "<key>=<value>". This flag may be passed multiple times.`)
 
 	BoolVar(flags, &flagOpts.dataplaneConfig.Telemetry.UseCentralConfig, "telemetry-use-central-config", "DP_TELEMETRY_USE_CENTRAL_CONFIG", "Controls whether the proxy applies the central telemetry configuration.")
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.StatsdURL, "telemetry-statsd-url", "DP_TELEMETRY_STATSD_URL", `The URL of a statsd server that Envoy and Consul Dataplane send metrics to, formatted as "udp://<host>:<port>". Takes precedence over envoy_statsd_url in the central telemetry configuration.`)
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.DogstatsdURL, "telemetry-dogstatsd-url", "DP_TELEMETRY_DOGSTATSD_URL", `The URL of a DogStatsD server that Envoy and Consul Dataplane send metrics to, formatted as "udp://<host>:<port>" or "unix://<path>". Takes precedence over envoy_dogstatsd_url in the central telemetry configuration.`)
+	SliceVar(flags, &flagOpts.dataplaneConfig.Telemetry.StatsTags, "telemetry-stats-tag", "DP_TELEMETRY_STATS_TAG", `A tag, formatted as "<name>=<value>", added to the metrics of Envoy and Consul Dataplane. Tags are merged with envoy_stats_tags in the central telemetry configuration, replacing tags of the same name. This flag may be passed multiple times.`)
+	IntVar(flags, &flagOpts.dataplaneConfig.Telemetry.MetricsCacheMaxSeries, "telemetry-metrics-cache-max-series", "DP_TELEMETRY_METRICS_CACHE_MAX_SERIES", "The maximum number of distinct metric series cached at startup until the metrics sinks are configured. Updates to further series are dropped and counted. Defaults to 10000.")
 
 	DurationVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.RetentionTime, "telemetry-prom-retention-time", "DP_TELEMETRY_PROM_RETENTION_TIME", "The duration for prometheus metrics aggregation.")
 	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.CACertsPath, "telemetry-prom-ca-certs-path", "DP_TELEMETRY_PROM_CA_CERTS_PATH", "The path to a file or directory containing CA certificates used to verify the Prometheus server's certificate.")
 	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.KeyFile, "telemetry-prom-key-file", "DP_TELEMETRY_PROM_KEY_FILE", "The path to the client private key used to serve Prometheus metrics.")
 	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.CertFile, "telemetry-prom-cert-file", "DP_TELEMETRY_PROM_CERT_FILE", "The path to the client certificate used to serve Prometheus metrics.")
 	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.ServiceMetricsURL, "telemetry-prom-service-metrics-url", "DP_TELEMETRY_PROM_SERVICE_METRICS_URL", "Prometheus metrics at this URL are scraped and included in Consul Dataplane's main Prometheus metrics.")
+	MapVar(flags, (*FlagMetricsTargetsValue)(&flagOpts.dataplaneConfig.Telemetry.Prometheus.ServiceMetricsTargets), "telemetry-prom-service-metrics-target", "DP_TELEMETRY_PROM_SERVICE_METRICS_TARGET", `An application endpoint whose Prometheus metrics are scraped and included in Consul Dataplane's main Prometheus metrics, formatted as a comma separated list of "<key>=<value>" pairs. Supported keys are name, url, timeout, header (as "<name>=<value>"), label (as "<name>=<value>"), bearer-token-file, basic-auth-username, basic-auth-password-file, tls-ca-certs-path, tls-cert-file, tls-key-file, tls-server-name and tls-insecure-skip-verify. The name and url keys are required. This flag may be passed multiple times.`)
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.BindAddr, "telemetry-prom-bind-addr", "DP_TELEMETRY_PROM_BIND_ADDR", "The <ip>:<port> on which Envoy serves the merged Prometheus metrics, or on which Consul Dataplane serves its own metrics in dns-proxy mode. Takes precedence over envoy_prometheus_bind_addr in the central telemetry configuration.")
 	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.ScrapePath, "telemetry-prom-scrape-path", "DP_TELEMETRY_PROM_SCRAPE_PATH", "The URL path where Envoy serves Prometheus metrics.")
 	IntVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.MergePort, "telemetry-prom-merge-port", "DP_TELEMETRY_PROM_MERGE_PORT", "The port to serve merged Prometheus metrics.")
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.MergeBindAddr, "telemetry-prom-merge-bind-addr", "DP_TELEMETRY_PROM_MERGE_BIND_ADDR", `The address to serve merged Prometheus metrics on, or a unix socket path prefixed with "unix://". Defaults to every interface.`)
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.DataplaneBindAddr, "telemetry-prom-dataplane-bind-addr", "DP_TELEMETRY_PROM_DATAPLANE_BIND_ADDR", `The address to serve Consul Dataplane's own Prometheus metrics on before they are merged, or a unix socket path prefixed with "unix://". Defaults to 127.0.0.1.`)
+	IntVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.DataplanePort, "telemetry-prom-dataplane-port", "DP_TELEMETRY_PROM_DATAPLANE_PORT", "The port to serve Consul Dataplane's own Prometheus metrics on before they are merged. Defaults to 20101.")
+	BoolVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.ServerTLS, "telemetry-prom-server-tls", "DP_TELEMETRY_PROM_SERVER_TLS", "Serve the merged and Consul Dataplane Prometheus metrics over TLS, using -telemetry-prom-cert-file and -telemetry-prom-key-file.")
+	BoolVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.ServerVerifyIncoming, "telemetry-prom-server-verify-incoming", "DP_TELEMETRY_PROM_SERVER_VERIFY_INCOMING", "Require clients of the merged and Consul Dataplane Prometheus metrics to present a certificate signed by the CA in -telemetry-prom-ca-certs-path.")
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.ServerBearerToken, "telemetry-prom-server-bearer-token", "DP_TELEMETRY_PROM_SERVER_BEARER_TOKEN", "A bearer token that clients of the merged and Consul Dataplane Prometheus metrics must present.")
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.ServerBearerTokenPath, "telemetry-prom-server-bearer-token-path", "DP_TELEMETRY_PROM_SERVER_BEARER_TOKEN_PATH", "The path to a file containing a bearer token that clients of the merged and Consul Dataplane Prometheus metrics must present.")
+	DurationVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.ScrapeTimeout, "telemetry-prom-scrape-timeout", "DP_TELEMETRY_PROM_SCRAPE_TIMEOUT", "How long each source of the merged Prometheus metrics is given to respond before it's omitted. Defaults to 5s.")
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.MergeCollisionMode, "telemetry-prom-merge-collision-mode", "DP_TELEMETRY_PROM_MERGE_COLLISION_MODE", `How a metric served by more than one source of the merged Prometheus metrics is resolved. "label" merges the metrics with a source label and "prefix" prefixes the metric name with the source. Defaults to "label".`)
+	MapVar(flags, (*FlagMapValue)(&flagOpts.dataplaneConfig.Telemetry.Prometheus.ConstLabels), "telemetry-prom-const-label", "DP_TELEMETRY_PROM_CONST_LABEL", `A constant label to add to the merged Prometheus metrics, formatted as "<name>=<value>". This flag may be passed multiple times.`)
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.Push.URL, "telemetry-prom-push-url", "DP_TELEMETRY_PROM_PUSH_URL", "The URL of a Pushgateway or Prometheus remote-write endpoint to periodically push the merged Prometheus metrics to, for workloads that Prometheus can't scrape.")
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.Push.Protocol, "telemetry-prom-push-protocol", "DP_TELEMETRY_PROM_PUSH_PROTOCOL", `The protocol used to push the merged Prometheus metrics, either "pushgateway" or "remote-write". Defaults to "pushgateway".`)
+	DurationVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.Push.Interval, "telemetry-prom-push-interval", "DP_TELEMETRY_PROM_PUSH_INTERVAL", "The interval between pushes of the merged Prometheus metrics. Defaults to 30s.")
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.Push.Job, "telemetry-prom-push-job", "DP_TELEMETRY_PROM_PUSH_JOB", `The job grouping key of the pushed Prometheus metrics. Defaults to "consul-dataplane".`)
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.Prometheus.Push.Instance, "telemetry-prom-push-instance", "DP_TELEMETRY_PROM_PUSH_INSTANCE", "The instance grouping key of the pushed Prometheus metrics. Defaults to the hostname.")
+	MapVar(flags, (*FlagMapValue)(&flagOpts.dataplaneConfig.Telemetry.Prometheus.Push.Headers), "telemetry-prom-push-header", "DP_TELEMETRY_PROM_PUSH_HEADER", `A header to send with every push of the merged Prometheus metrics, formatted as "<key>=<value>". This flag may be passed multiple times.`)
+
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.OTLP.Endpoint, "telemetry-otlp-endpoint", "DP_TELEMETRY_OTLP_ENDPOINT", "The OpenTelemetry collector endpoint to export metrics to over OTLP, either a host:port pair or a URL. Takes precedence over the envoy_otlp_metrics_endpoint proxy config.")
+	StringVar(flags, &flagOpts.dataplaneConfig.Telemetry.OTLP.Protocol, "telemetry-otlp-protocol", "DP_TELEMETRY_OTLP_PROTOCOL", `The OTLP transport used to export metrics, either "grpc" or "http/protobuf". Defaults to "grpc".`)
+	BoolVar(flags, &flagOpts.dataplaneConfig.Telemetry.OTLP.Insecure, "telemetry-otlp-insecure", "DP_TELEMETRY_OTLP_INSECURE", "Disables TLS when exporting metrics over OTLP.")
+	MapVar(flags, (*FlagMapValue)(&flagOpts.dataplaneConfig.Telemetry.OTLP.Headers), "telemetry-otlp-header", "DP_TELEMETRY_OTLP_HEADER", `A header to send with every OTLP export request, formatted as "<key>=<value>". This flag may be passed multiple times.`)
+	DurationVar(flags, &flagOpts.dataplaneConfig.Telemetry.OTLP.ExportInterval, "telemetry-otlp-export-interval", "DP_TELEMETRY_OTLP_EXPORT_INTERVAL", "The interval between OTLP metrics exports. Defaults to 60s.")
+	BoolVar(flags, &flagOpts.dataplaneConfig.Telemetry.OTLP.EnvoyStats, "telemetry-otlp-envoy-stats", "DP_TELEMETRY_OTLP_ENVOY_STATS", "Periodically reads Envoy's counters and gauges from its admin API and exports them over OTLP.")
 
 	StringVar(flags, &flagOpts.dataplaneConfig.Envoy.AdminBindAddr, "envoy-admin-bind-address", "DP_ENVOY_ADMIN_BIND_ADDRESS", "The address on which the Envoy admin server is available.")
 	IntVar(flags, &flagOpts.dataplaneConfig.Envoy.AdminBindPort, "envoy-admin-bind-port", "DP_ENVOY_ADMIN_BIND_PORT", "The port on which the Envoy admin server is available.")
-	StringVar(flags, &flagOpts.dataplaneConfig.Envoy.ReadyBindAddr, "envoy-ready-bind-address", "DP_ENVOY_READY_BIND_ADDRESS", "The address on which Envoy's readiness probe is available.")
-	IntVar(flags, &flagOpts.dataplaneConfig.Envoy.ReadyBindPort, "envoy-ready-bind-port", "DP_ENVOY_READY_BIND_PORT", "The port on which Envoy's readiness probe is available.")
-	IntVar(flags, &flagOpts.dataplaneConfig.Envoy.Concurrency, "envoy-concurrency", "DP_ENVOY_CONCURRENCY", "The number of worker threads that Envoy uses.")
+	StringVar(flags, &flagOpts.dataplaneConfig.Envoy.ReadyBindAddr, "envoy-ready-bind-address", "DP_ENVOY_READY_BIND_ADDRESS", "The address on which Envoy's readiness probe is available. When running as a gateway, it defaults to 0.0.0.0 so that the probe is reachable on the pod IP, as with consul connect envoy.")
+	IntVar(flags, &flagOpts.dataplaneConfig.Envoy.ReadyBindPort, "envoy-ready-bind-port", "DP_ENVOY_READY_BIND_PORT", "The port on which Envoy's readiness probe is available. When running as a gateway, it defaults to 21000. Set it to -1 to disable the readiness probe.")
+	ConcurrencyVar(flags, &flagOpts.dataplaneConfig.Envoy.Concurrency, "envoy-concurrency", "DP_ENVOY_CONCURRENCY", "The number of worker threads that Envoy uses. Set to \"auto\" to derive it from the cgroup CPU quota and cpuset, or the number of host CPUs.")
+	IntVar(flags, &flagOpts.dataplaneConfig.Envoy.ConcurrencyMin, "envoy-concurrency-min", "DP_ENVOY_CONCURRENCY_MIN", "The minimum number of worker threads when -envoy-concurrency is \"auto\".")
+	IntVar(flags, &flagOpts.dataplaneConfig.Envoy.ConcurrencyMax, "envoy-concurrency-max", "DP_ENVOY_CONCURRENCY_MAX", "The maximum number of worker threads when -envoy-concurrency is \"auto\". Set to 0 for no maximum.")
+	Float64Var(flags, &flagOpts.dataplaneConfig.Envoy.ConcurrencyRatio, "envoy-concurrency-ratio", "DP_ENVOY_CONCURRENCY_RATIO", "The number of worker threads per available CPU when -envoy-concurrency is \"auto\". The result is rounded up.")
 	IntVar(flags, &flagOpts.dataplaneConfig.Envoy.DrainTimeSeconds, "envoy-drain-time-seconds", "DP_ENVOY_DRAIN_TIME", "The time in seconds for which Envoy will drain connections.")
 	StringVar(flags, &flagOpts.dataplaneConfig.Envoy.DrainStrategy, "envoy-drain-strategy", "DP_ENVOY_DRAIN_STRATEGY", "The behaviour of Envoy during the drain sequence. Determines whether all open connections should be encouraged to drain immediately or to increase the percentage gradually as the drain time elapses.")
+	SliceVar(flags, &flagOpts.dataplaneConfig.Envoy.StatsMatcher.InclusionPrefixes, "envoy-stats-inclusion-prefix", "DP_ENVOY_STATS_INCLUSION_PREFIX", "Only instantiate Envoy stats whose names start with this prefix. This flag may be passed multiple times. Overridden by the envoy_stats_matcher_* central config keys.")
+	SliceVar(flags, &flagOpts.dataplaneConfig.Envoy.StatsMatcher.InclusionSuffixes, "envoy-stats-inclusion-suffix", "DP_ENVOY_STATS_INCLUSION_SUFFIX", "Only instantiate Envoy stats whose names end with this suffix. This flag may be passed multiple times. Overridden by the envoy_stats_matcher_* central config keys.")
+	SliceVar(flags, &flagOpts.dataplaneConfig.Envoy.StatsMatcher.InclusionRegexes, "envoy-stats-inclusion-regex", "DP_ENVOY_STATS_INCLUSION_REGEX", "Only instantiate Envoy stats whose names match this RE2 regular expression. This flag may be passed multiple times. Overridden by the envoy_stats_matcher_* central config keys.")
+	SliceVar(flags, &flagOpts.dataplaneConfig.Envoy.StatsMatcher.ExclusionPrefixes, "envoy-stats-exclusion-prefix", "DP_ENVOY_STATS_EXCLUSION_PREFIX", "Do not instantiate Envoy stats whose names start with this prefix. This flag may be passed multiple times. Overridden by the envoy_stats_matcher_* central config keys.")
+	SliceVar(flags, &flagOpts.dataplaneConfig.Envoy.StatsMatcher.ExclusionSuffixes, "envoy-stats-exclusion-suffix", "DP_ENVOY_STATS_EXCLUSION_SUFFIX", "Do not instantiate Envoy stats whose names end with this suffix. This flag may be passed multiple times. Overridden by the envoy_stats_matcher_* central config keys.")
+	SliceVar(flags, &flagOpts.dataplaneConfig.Envoy.StatsMatcher.ExclusionRegexes, "envoy-stats-exclusion-regex", "DP_ENVOY_STATS_EXCLUSION_REGEX", "Do not instantiate Envoy stats whose names match this RE2 regular expression. This flag may be passed multiple times. Overridden by the envoy_stats_matcher_* central config keys.")
+	BoolVar(flags, &flagOpts.dataplaneConfig.Envoy.OverloadManager.Enabled, "envoy-overload-manager-enabled", "DP_ENVOY_OVERLOAD_MANAGER_ENABLED", "Enables the Envoy overload manager. When no max heap size is given it is derived from the cgroup v2 memory limit, if one is present.")
+	IntVar(flags, &flagOpts.dataplaneConfig.Envoy.OverloadManager.MaxHeapSizeBytes, "envoy-overload-max-heap-size-bytes", "DP_ENVOY_OVERLOAD_MAX_HEAP_SIZE_BYTES", "The heap size in bytes at which Envoy is considered saturated by the overload manager. Defaults to 75% of the cgroup v2 memory limit.")
+	Float64Var(flags, &flagOpts.dataplaneConfig.Envoy.OverloadManager.ShrinkHeapThreshold, "envoy-overload-shrink-heap-threshold", "DP_ENVOY_OVERLOAD_SHRINK_HEAP_THRESHOLD", "The fraction of the max heap size at which Envoy will release free memory back to the system. Set to 0 to disable.")
+	Float64Var(flags, &flagOpts.dataplaneConfig.Envoy.OverloadManager.StopAcceptingRequestsThreshold, "envoy-overload-stop-accepting-requests-threshold", "DP_ENVOY_OVERLOAD_STOP_ACCEPTING_REQUESTS_THRESHOLD", "The fraction of the max heap size at which Envoy will reject new requests. Set to 0 to disable.")
+	Float64Var(flags, &flagOpts.dataplaneConfig.Envoy.OverloadManager.StopAcceptingConnectionsThreshold, "envoy-overload-stop-accepting-connections-threshold", "DP_ENVOY_OVERLOAD_STOP_ACCEPTING_CONNECTIONS_THRESHOLD", "The fraction of the max heap size at which Envoy will stop accepting new connections. Set to 0 to disable.")
+	IntVar(flags, &flagOpts.dataplaneConfig.Envoy.OverloadManager.MaxDownstreamConnections, "envoy-overload-max-downstream-connections", "DP_ENVOY_OVERLOAD_MAX_DOWNSTREAM_CONNECTIONS", "The maximum number of active downstream connections across all Envoy listeners. Set to 0 for no limit.")
 	StringVar(flags, &flagOpts.dataplaneConfig.Envoy.ExecutablePath, "envoy-executable-path", "DP_ENVOY_EXECUTABLE_PATH", "Path to the Envoy executable to run. Defaults to the ")
 
 	StringVar(flags, &flagOpts.dataplaneConfig.XDSServer.BindAddr, "xds-bind-addr", "DP_XDS_BIND_ADDR", "The address on which the Envoy xDS server is available.")
@@ -118,6 +163,39 @@ func init() {
 
 	StringVar(flags, &flagOpts.dataplaneConfig.DNSServer.BindAddr, "consul-dns-bind-addr", "DP_CONSUL_DNS_BIND_ADDR", "The address that will be bound to the consul dns listener.")
 	IntVar(flags, &flagOpts.dataplaneConfig.DNSServer.BindPort, "consul-dns-bind-port", "DP_CONSUL_DNS_BIND_PORT", "The port the consul dns listener will listen on. By default -1 disables the dns listener.")
+	BoolVar(flags, &flagOpts.dataplaneConfig.DNSServer.DisableCache, "consul-dns-disable-cache", "DP_CONSUL_DNS_DISABLE_CACHE", "Disables caching the responses of Consul to DNS queries.")
+	IntVar(flags, &flagOpts.dataplaneConfig.DNSServer.CacheSize, "consul-dns-cache-size", "DP_CONSUL_DNS_CACHE_SIZE", "The maximum number of cached DNS responses. The least recently used responses are evicted when the cache is full. Defaults to 10000.")
+	DurationVar(flags, &flagOpts.dataplaneConfig.DNSServer.CacheMaxTTL, "consul-dns-cache-max-ttl", "DP_CONSUL_DNS_CACHE_MAX_TTL", "The maximum duration DNS responses are cached for, regardless of their TTL. By default responses are cached for their TTL.")
+	DurationVar(flags, &flagOpts.dataplaneConfig.DNSServer.ServeStaleWindow, "consul-dns-serve-stale-window", "DP_CONSUL_DNS_SERVE_STALE_WINDOW", "How long after they expire cached DNS responses are served, with a short TTL, if Consul can't be reached. By default a SERVFAIL response is sent instead.")
+	StringVar(flags, &flagOpts.dataplaneConfig.DNSServer.Domain, "consul-dns-domain", "DP_CONSUL_DNS_DOMAIN", `The domain of the names resolved by Consul. Queries outside of it and the alternate domains are forwarded to the recursors, if any are configured. Defaults to "consul".`)
+	SliceVar(flags, &flagOpts.dataplaneConfig.DNSServer.AltDomains, "consul-dns-alt-domain", "DP_CONSUL_DNS_ALT_DOMAIN", "An alternate domain of the names resolved by Consul. This flag may be passed multiple times.")
+	SliceVar(flags, &flagOpts.dataplaneConfig.DNSServer.Recursors, "consul-dns-recursor", "DP_CONSUL_DNS_RECURSOR", `The address of a nameserver, formatted as "<host>" or "<host>:<port>", that DNS queries outside of the Consul domains are forwarded to. Recursors are tried in order, skipping those that recently failed. By default every query is forwarded to Consul. This flag may be passed multiple times.`)
+	StringVar(flags, &flagOpts.dataplaneConfig.DNSServer.ResolvConf, "consul-dns-resolv-conf", "DP_CONSUL_DNS_RESOLV_CONF", "The path of a resolv.conf file, such as /etc/resolv.conf, whose nameservers are used as the recursors if -consul-dns-recursor isn't set. Nameservers that are the DNS proxy itself are ignored.")
+	DurationVar(flags, &flagOpts.dataplaneConfig.DNSServer.RecursorTimeout, "consul-dns-recursor-timeout", "DP_CONSUL_DNS_RECURSOR_TIMEOUT", "The timeout of a DNS query to a recursor, after which the next recursor is tried. Defaults to 2s.")
+	StringVar(flags, &flagOpts.dataplaneConfig.DNSServer.DoTAddr, "consul-dns-dot-addr", "DP_CONSUL_DNS_DOT_ADDR", `The address, formatted as "<host>:<port>", of a DNS-over-TLS listener of the DNS proxy, such as "127.0.0.1:853". Requires -consul-dns-tls-cert-file and -consul-dns-tls-key-file. By default DoT is disabled.`)
+	StringVar(flags, &flagOpts.dataplaneConfig.DNSServer.DoHAddr, "consul-dns-doh-addr", "DP_CONSUL_DNS_DOH_ADDR", `The address, formatted as "<host>:<port>", of a DNS-over-HTTPS listener of the DNS proxy, such as "127.0.0.1:443". Requires -consul-dns-tls-cert-file and -consul-dns-tls-key-file. By default DoH is disabled.`)
+	StringVar(flags, &flagOpts.dataplaneConfig.DNSServer.DoHPath, "consul-dns-doh-path", "DP_CONSUL_DNS_DOH_PATH", `The path of the DNS-over-HTTPS endpoint. Defaults to "/dns-query".`)
+	StringVar(flags, &flagOpts.dataplaneConfig.DNSServer.TLSCertFile, "consul-dns-tls-cert-file", "DP_CONSUL_DNS_TLS_CERT_FILE", "The path of the certificate of the DNS-over-TLS and DNS-over-HTTPS listeners. It's reloaded when it changes.")
+	StringVar(flags, &flagOpts.dataplaneConfig.DNSServer.TLSKeyFile, "consul-dns-tls-key-file", "DP_CONSUL_DNS_TLS_KEY_FILE", "The path of the private key of the DNS-over-TLS and DNS-over-HTTPS listeners. It's reloaded when it changes.")
+	IntVar(flags, &flagOpts.dataplaneConfig.DNSServer.UDPWorkers, "consul-dns-udp-workers", "DP_CONSUL_DNS_UDP_WORKERS", "The number of UDP DNS queries resolved concurrently. Defaults to 100.")
+	IntVar(flags, &flagOpts.dataplaneConfig.DNSServer.UDPQueueSize, "consul-dns-udp-queue-size", "DP_CONSUL_DNS_UDP_QUEUE_SIZE", "The number of UDP DNS queries waiting for a worker. Defaults to 1000.")
+	StringVar(flags, &flagOpts.dataplaneConfig.DNSServer.UDPDropPolicy, "consul-dns-udp-drop-policy", "DP_CONSUL_DNS_UDP_DROP_POLICY", `What happens to UDP DNS queries when the queue is full: "drop-newest" drops the new query, "drop-oldest" drops the query that has been waiting the longest, and "servfail" answers the new query with SERVFAIL. Defaults to "drop-newest".`)
+	DurationVar(flags, &flagOpts.dataplaneConfig.DNSServer.TCPIdleTimeout, "consul-dns-tcp-idle-timeout", "DP_CONSUL_DNS_TCP_IDLE_TIMEOUT", "How long a TCP or DNS-over-TLS connection to the DNS proxy is kept open while the client sends no queries. Defaults to 5s.")
+	IntVar(flags, &flagOpts.dataplaneConfig.DNSServer.TCPMaxConns, "consul-dns-tcp-max-connections", "DP_CONSUL_DNS_TCP_MAX_CONNECTIONS", "The number of open TCP and DNS-over-TLS connections to the DNS proxy, above which new connections are closed. Defaults to 1000.")
+	BoolVar(flags, &flagOpts.dataplaneConfig.DNSServer.QueryLog, "consul-dns-query-log", "DP_CONSUL_DNS_QUERY_LOG", "Enables logging the DNS queries answered by the DNS proxy, with the client address, question, rcode, number of answers, latency and whether the answer came from the cache.")
+	StringVar(flags, &flagOpts.dataplaneConfig.DNSServer.QueryLogFile, "consul-dns-query-log-file", "DP_CONSUL_DNS_QUERY_LOG_FILE", "The path of a file the DNS queries are logged to as JSON lines, which is rotated once it reaches -consul-dns-query-log-max-size. By default queries are logged to the dataplane logger.")
+	IntVar(flags, &flagOpts.dataplaneConfig.DNSServer.QueryLogMaxSize, "consul-dns-query-log-max-size", "DP_CONSUL_DNS_QUERY_LOG_MAX_SIZE", "The size in megabytes of the DNS query log file, above which it's rotated. Defaults to 100.")
+	IntVar(flags, &flagOpts.dataplaneConfig.DNSServer.QueryLogMaxFiles, "consul-dns-query-log-max-files", "DP_CONSUL_DNS_QUERY_LOG_MAX_FILES", "The number of rotated DNS query log files kept. Defaults to 5.")
+	Float64Var(flags, &flagOpts.dataplaneConfig.DNSServer.QueryLogSampleRate, "consul-dns-query-log-sample-rate", "DP_CONSUL_DNS_QUERY_LOG_SAMPLE_RATE", "The share of the DNS queries logged, between 0 and 1. By default every query is logged.")
+	SliceVar(flags, &flagOpts.dataplaneConfig.DNSServer.QueryLogNames, "consul-dns-query-log-name", "DP_CONSUL_DNS_QUERY_LOG_NAME", `A domain, such as "service.consul", whose queries are logged. By default the queries of every name not excluded by -consul-dns-query-log-exclude-name are logged. This flag may be passed multiple times.`)
+	SliceVar(flags, &flagOpts.dataplaneConfig.DNSServer.QueryLogExcludeNames, "consul-dns-query-log-exclude-name", "DP_CONSUL_DNS_QUERY_LOG_EXCLUDE_NAME", "A domain whose queries aren't logged, even if included by -consul-dns-query-log-name. This flag may be passed multiple times.")
+	SliceVar(flags, &flagOpts.dataplaneConfig.DNSServer.AllowCIDRs, "consul-dns-allow-cidr", "DP_CONSUL_DNS_ALLOW_CIDR", `The CIDR, such as "10.0.0.0/8", of clients allowed to query the DNS proxy. Queries of other clients are ignored. By default every client not denied by -consul-dns-deny-cidr is allowed. This flag may be passed multiple times.`)
+	SliceVar(flags, &flagOpts.dataplaneConfig.DNSServer.DenyCIDRs, "consul-dns-deny-cidr", "DP_CONSUL_DNS_DENY_CIDR", "The CIDR of clients denied by the DNS proxy, even if allowed by -consul-dns-allow-cidr. Queries of denied clients are ignored. This flag may be passed multiple times.")
+	Float64Var(flags, &flagOpts.dataplaneConfig.DNSServer.RateLimit, "consul-dns-rate-limit", "DP_CONSUL_DNS_RATE_LIMIT", "The number of DNS queries per second allowed from each client IPv4 address or IPv6 /56 network. By default queries aren't rate limited.")
+	IntVar(flags, &flagOpts.dataplaneConfig.DNSServer.RateLimitBurst, "consul-dns-rate-limit-burst", "DP_CONSUL_DNS_RATE_LIMIT_BURST", "The number of DNS queries a client can make at once, above -consul-dns-rate-limit. Defaults to the rate limit.")
+	StringVar(flags, &flagOpts.dataplaneConfig.DNSServer.RateLimitAction, "consul-dns-rate-limit-action", "DP_CONSUL_DNS_RATE_LIMIT_ACTION", `What happens to the DNS queries of clients over their rate limit: "refuse" answers them with REFUSED and "drop" ignores them. Defaults to "refuse".`)
+	Float64Var(flags, &flagOpts.dataplaneConfig.DNSServer.RRLRate, "consul-dns-rrl-rate", "DP_CONSUL_DNS_RRL_RATE", "The number of identical UDP DNS responses per second sent to each client network, a /24 for IPv4 and a /56 for IPv6, to make the DNS proxy of little use for amplification attacks. By default responses aren't rate limited.")
+	IntVar(flags, &flagOpts.dataplaneConfig.DNSServer.RRLSlip, "consul-dns-rrl-slip", "DP_CONSUL_DNS_RRL_SLIP", "One in how many UDP DNS responses over -consul-dns-rrl-rate are sent truncated, so that legitimate clients retry over TCP, instead of being dropped. Defaults to 2.")
 
 	// Default is false because it will generally be configured appropriately by Helm
 	// configuration or pod annotation.
@@ -0,0 +1,88 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ flag.Value = (*FlagMetricsTargetsValue)(nil)
+
+// FlagMetricsTargetsValue is a flag implementation used to provide service
+// metrics targets multiple times. Each target is formatted as a comma
+// separated list of "<key>=<value>" pairs, e.g.
+// "name=app,url=http://127.0.0.1:9090/metrics,label=team=payments".
+type FlagMetricsTargetsValue []ServiceMetricsTargetFlags
+
+func (t *FlagMetricsTargetsValue) String() string {
+	return fmt.Sprintf("%v", *t)
+}
+
+func (t *FlagMetricsTargetsValue) Set(value string) error {
+	var target ServiceMetricsTargetFlags
+	for _, pair := range strings.Split(value, ",") {
+		idx := strings.Index(pair, "=")
+		if idx == -1 {
+			return fmt.Errorf("Missing \"=\" value in argument: %s", pair)
+		}
+		key, val := pair[0:idx], pair[idx+1:]
+
+		switch key {
+		case "name":
+			target.Name = &val
+		case "url":
+			target.URL = &val
+		case "timeout":
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return fmt.Errorf("invalid timeout %q: %w", val, err)
+			}
+			target.Timeout = &Duration{Duration: d}
+		case "header":
+			if err := (*FlagMapValue)(&target.Headers).Set(val); err != nil {
+				return err
+			}
+		case "label":
+			if err := (*FlagMapValue)(&target.Labels).Set(val); err != nil {
+				return err
+			}
+		case "bearer-token-file":
+			target.BearerTokenFile = &val
+		case "basic-auth-username":
+			target.BasicAuthUsername = &val
+		case "basic-auth-password-file":
+			target.BasicAuthPasswordFile = &val
+		case "tls-ca-certs-path":
+			target.tls().CACertsPath = &val
+		case "tls-cert-file":
+			target.tls().CertFile = &val
+		case "tls-key-file":
+			target.tls().KeyFile = &val
+		case "tls-server-name":
+			target.tls().ServerName = &val
+		case "tls-insecure-skip-verify":
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("invalid tls-insecure-skip-verify %q: %w", val, err)
+			}
+			target.tls().InsecureSkipVerify = &b
+		default:
+			return fmt.Errorf("unknown service metrics target key %q", key)
+		}
+	}
+
+	*t = append(*t, target)
+	return nil
+}
+
+func (t *ServiceMetricsTargetFlags) tls() *TLSFlags {
+	if t.TLS == nil {
+		t.TLS = &TLSFlags{}
+	}
+	return t.TLS
+}
@@ -0,0 +1,69 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagMetricsTargetsValueSet(t *testing.T) {
+	t.Parallel()
+
+	t.Run("sets multiple", func(t *testing.T) {
+		f := new(FlagMetricsTargetsValue)
+		require.NoError(t, f.Set("name=app,url=http://127.0.0.1:9090/metrics,timeout=2s,header=X-Api-Key=secret,label=team=payments,label=tier=web"))
+		require.NoError(t, f.Set("name=sidecar,url=https://127.0.0.1:9443/metrics,bearer-token-file=/var/run/token,tls-ca-certs-path=/ca.pem,tls-server-name=sidecar,tls-insecure-skip-verify=true"))
+		require.NoError(t, f.Set("name=db,url=http://127.0.0.1:9187/metrics,basic-auth-username=prom,basic-auth-password-file=/var/run/password,tls-cert-file=/cert.pem,tls-key-file=/key.pem"))
+
+		require.Equal(t, FlagMetricsTargetsValue{
+			{
+				Name:    strReference("app"),
+				URL:     strReference("http://127.0.0.1:9090/metrics"),
+				Timeout: &Duration{Duration: 2 * time.Second},
+				Headers: map[string]string{"X-Api-Key": "secret"},
+				Labels:  map[string]string{"team": "payments", "tier": "web"},
+			},
+			{
+				Name:            strReference("sidecar"),
+				URL:             strReference("https://127.0.0.1:9443/metrics"),
+				BearerTokenFile: strReference("/var/run/token"),
+				TLS: &TLSFlags{
+					CACertsPath:        strReference("/ca.pem"),
+					ServerName:         strReference("sidecar"),
+					InsecureSkipVerify: boolReference(true),
+				},
+			},
+			{
+				Name:                  strReference("db"),
+				URL:                   strReference("http://127.0.0.1:9187/metrics"),
+				BasicAuthUsername:     strReference("prom"),
+				BasicAuthPasswordFile: strReference("/var/run/password"),
+				TLS: &TLSFlags{
+					CertFile: strReference("/cert.pem"),
+					KeyFile:  strReference("/key.pem"),
+				},
+			},
+		}, *f)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := map[string]string{
+			"missing =":         "name=app,url",
+			"unknown key":       "name=app,path=/metrics",
+			"invalid timeout":   "name=app,timeout=soon",
+			"invalid header":    "name=app,header=X-Api-Key",
+			"invalid skip flag": "name=app,tls-insecure-skip-verify=maybe",
+		}
+		for name, value := range cases {
+			t.Run(name, func(t *testing.T) {
+				f := new(FlagMetricsTargetsValue)
+				require.Error(t, f.Set(value))
+				require.Empty(t, *f)
+			})
+		}
+	})
+}
@@ -0,0 +1,24 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+var _ flag.Value = (*FlagSliceValue)(nil)
+
+// FlagSliceValue is a flag implementation used to provide a value
+// multiple times.
+type FlagSliceValue []string
+
+func (s *FlagSliceValue) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *FlagSliceValue) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
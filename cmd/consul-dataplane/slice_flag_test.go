@@ -0,0 +1,28 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagSliceValueSet(t *testing.T) {
+	t.Parallel()
+
+	t.Run("sets", func(t *testing.T) {
+		f := new(FlagSliceValue)
+		require.NoError(t, f.Set("foo"))
+		require.Equal(t, FlagSliceValue{"foo"}, *f)
+	})
+
+	t.Run("appends multiple", func(t *testing.T) {
+		f := new(FlagSliceValue)
+		require.NoError(t, f.Set("foo"))
+		require.NoError(t, f.Set("bar"))
+		require.Equal(t, FlagSliceValue{"foo", "bar"}, *f)
+		require.Equal(t, "foo,bar", f.String())
+	})
+}
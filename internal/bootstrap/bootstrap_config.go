@@ -14,6 +14,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"regexp"
 	"strings"
 	"text/template"
 
@@ -48,6 +49,31 @@ type BootstrapConfig struct {
 	//									 				one of the supported forms above.
 	DogstatsdURL string `mapstructure:"envoy_dogstatsd_url"`
 
+	// OTLPMetricsEndpoint allows simple configuration of an OpenTelemetry
+	// (OTLP) metrics sink for consul-dataplane's own metrics. It is either a
+	// host:port pair or a URL such as https://collector:4317.
+	OTLPMetricsEndpoint string `mapstructure:"envoy_otlp_metrics_endpoint"`
+
+	// OTLPMetricsProtocol is the OTLP transport used to export metrics, either
+	// "grpc" (the default) or "http/protobuf".
+	OTLPMetricsProtocol string `mapstructure:"envoy_otlp_metrics_protocol"`
+
+	// OTLPMetricsInsecure disables TLS when exporting metrics over OTLP.
+	OTLPMetricsInsecure bool `mapstructure:"envoy_otlp_metrics_insecure"`
+
+	// OTLPMetricsHeaders are headers sent with every OTLP export request, for
+	// example to authenticate with the collector.
+	OTLPMetricsHeaders map[string]string `mapstructure:"envoy_otlp_metrics_headers"`
+
+	// OTLPMetricsExportInterval is the interval between OTLP exports, in Go
+	// duration format such as "30s".
+	OTLPMetricsExportInterval string `mapstructure:"envoy_otlp_metrics_export_interval"`
+
+	// OTLPMetricsEnvoyStats enables periodically reading Envoy's stats from its
+	// admin API and exporting them over OTLP alongside consul-dataplane's own
+	// metrics.
+	OTLPMetricsEnvoyStats bool `mapstructure:"envoy_otlp_metrics_envoy_stats"`
+
 	// StatsTags is a slice of string values that will be added as tags to
 	// metrics. They are used to configure
 	// https://www.envoyproxy.io/docs/envoy/v1.9.0/api-v2/config/metrics/v2/stats.proto#envoy-api-msg-config-metrics-v2-statsconfig
@@ -56,6 +82,32 @@ type BootstrapConfig struct {
 	// stats_config.stats_tags can be made by overriding envoy_stats_config_json.
 	StatsTags []string `mapstructure:"envoy_stats_tags"`
 
+	// StatsMatcherInclusionPrefixes, StatsMatcherInclusionSuffixes and
+	// StatsMatcherInclusionRegexes configure the inclusion list of the
+	// `stats_matcher` in the generated stats config. When any are set, Envoy
+	// will only instantiate stats whose names match at least one of the
+	// patterns. See
+	// https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/metrics/v3/stats.proto#envoy-v3-api-msg-config-metrics-v3-statsmatcher.
+	//
+	// The matcher is merged with the stats_tags generated from StatsTags and the
+	// Consul resource tag specifiers. It is ignored if StatsConfigJSON is set,
+	// and may not be combined with any of the exclusion keys.
+	StatsMatcherInclusionPrefixes []string `mapstructure:"envoy_stats_matcher_inclusion_prefixes"`
+	StatsMatcherInclusionSuffixes []string `mapstructure:"envoy_stats_matcher_inclusion_suffixes"`
+	StatsMatcherInclusionRegexes  []string `mapstructure:"envoy_stats_matcher_inclusion_regexes"`
+
+	// StatsMatcherExclusionPrefixes, StatsMatcherExclusionSuffixes and
+	// StatsMatcherExclusionRegexes configure the exclusion list of the
+	// `stats_matcher` in the generated stats config. When any are set, Envoy
+	// will not instantiate stats whose names match any of the patterns.
+	//
+	// The matcher is merged with the stats_tags generated from StatsTags and the
+	// Consul resource tag specifiers. It is ignored if StatsConfigJSON is set,
+	// and may not be combined with any of the inclusion keys.
+	StatsMatcherExclusionPrefixes []string `mapstructure:"envoy_stats_matcher_exclusion_prefixes"`
+	StatsMatcherExclusionSuffixes []string `mapstructure:"envoy_stats_matcher_exclusion_suffixes"`
+	StatsMatcherExclusionRegexes  []string `mapstructure:"envoy_stats_matcher_exclusion_regexes"`
+
 	// TelemetryCollectorBindSocketDir is a string that configures the directory for a
 	// unix socket where Envoy will forward metrics. These metrics get pushed to
 	// the telemetry collector.
@@ -92,6 +144,14 @@ type BootstrapConfig struct {
 	// definition config map currently.
 	ReadyBindAddr string `mapstructure:"-"`
 
+	// OverloadManager configures the Envoy overload manager with resource
+	// monitors and the actions to take as they approach saturation. The
+	// overload manager is not rendered if this is nil.
+	//
+	// Note that we do not allow this to be configured via the service
+	// definition config map currently.
+	OverloadManager *OverloadManagerConfig `mapstructure:"-"`
+
 	// OverrideJSONTpl allows replacing the base template used to render the
 	// bootstrap. This is an "escape hatch" allowing arbitrary control over the
 	// proxy's configuration but will the most effort to maintain and correctly
@@ -165,6 +225,116 @@ type BootstrapConfig struct {
 	Logger hclog.Logger
 }
 
+// OverloadManagerConfig is the set of overload manager resource monitors and
+// actions rendered into the bootstrap config. See
+// https://www.envoyproxy.io/docs/envoy/latest/configuration/operations/overload_manager/overload_manager.
+type OverloadManagerConfig struct {
+	// MaxHeapSizeBytes configures the fixed heap resource monitor. The heap
+	// actions below are only configured when this is non-zero.
+	MaxHeapSizeBytes uint64
+
+	// ShrinkHeapThreshold is the fraction of MaxHeapSizeBytes at which Envoy
+	// will periodically release free memory back to the system. Zero disables
+	// the action.
+	ShrinkHeapThreshold float64
+
+	// StopAcceptingRequestsThreshold is the fraction of MaxHeapSizeBytes at
+	// which Envoy will reject new requests with a 503. Zero disables the action.
+	StopAcceptingRequestsThreshold float64
+
+	// StopAcceptingConnectionsThreshold is the fraction of MaxHeapSizeBytes at
+	// which Envoy will stop accepting new downstream connections. Zero disables
+	// the action.
+	StopAcceptingConnectionsThreshold float64
+
+	// MaxDownstreamConnections configures the global downstream connections
+	// resource monitor, which proactively rejects connections above the limit.
+	MaxDownstreamConnections uint64
+}
+
+const (
+	fixedHeapMonitorName             = "envoy.resource_monitors.fixed_heap"
+	downstreamConnectionsMonitorName = "envoy.resource_monitors.global_downstream_max_connections"
+)
+
+// generateJSON returns the JSON body of the `overload_manager` field, or an
+// empty string if no resource monitors are configured.
+func (o *OverloadManagerConfig) generateJSON() (string, error) {
+	type trigger struct {
+		Name      string             `json:"name"`
+		Threshold map[string]float64 `json:"threshold"`
+	}
+	type action struct {
+		Name     string    `json:"name"`
+		Triggers []trigger `json:"triggers"`
+	}
+	type monitor struct {
+		Name        string         `json:"name"`
+		TypedConfig map[string]any `json:"typed_config"`
+	}
+
+	var (
+		monitors []monitor
+		actions  []action
+	)
+	if o.MaxHeapSizeBytes > 0 {
+		monitors = append(monitors, monitor{
+			Name: fixedHeapMonitorName,
+			TypedConfig: map[string]any{
+				"@type":               "type.googleapis.com/envoy.extensions.resource_monitors.fixed_heap.v3.FixedHeapConfig",
+				"max_heap_size_bytes": o.MaxHeapSizeBytes,
+			},
+		})
+
+		heapActions := []struct {
+			name      string
+			threshold float64
+		}{
+			{"envoy.overload_actions.shrink_heap", o.ShrinkHeapThreshold},
+			{"envoy.overload_actions.stop_accepting_requests", o.StopAcceptingRequestsThreshold},
+			{"envoy.overload_actions.stop_accepting_connections", o.StopAcceptingConnectionsThreshold},
+		}
+		for _, a := range heapActions {
+			if a.threshold == 0 {
+				continue
+			}
+			if a.threshold < 0 || a.threshold > 1 {
+				return "", fmt.Errorf("%s threshold must be between 0 and 1, got %v", a.name, a.threshold)
+			}
+			actions = append(actions, action{
+				Name: a.name,
+				Triggers: []trigger{{
+					Name:      fixedHeapMonitorName,
+					Threshold: map[string]float64{"value": a.threshold},
+				}},
+			})
+		}
+	}
+	if o.MaxDownstreamConnections > 0 {
+		monitors = append(monitors, monitor{
+			Name: downstreamConnectionsMonitorName,
+			TypedConfig: map[string]any{
+				"@type":                             "type.googleapis.com/envoy.extensions.resource_monitors.downstream_connections.v3.DownstreamConnectionsConfig",
+				"max_active_downstream_connections": o.MaxDownstreamConnections,
+			},
+		})
+	}
+
+	if len(monitors) == 0 {
+		return "", nil
+	}
+
+	d, err := json.Marshal(map[string]any{
+		"refresh_interval":  "0.25s",
+		"resource_monitors": monitors,
+		"actions":           actions,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(d), nil
+}
+
 // log returns the Logger for BootstrapConfig or a null Logger if none is configured.
 // This method is meant to support tests that do not configure a Logger.
 func (c *BootstrapConfig) log() hclog.Logger {
@@ -229,7 +399,11 @@ func (c *BootstrapConfig) ConfigureArgs(args *BootstrapTplArgs, omitDeprecatedTa
 		if err != nil {
 			return err
 		}
-		args.StatsConfigJSON = formatStatsTags(stats)
+		matcher, err := c.generateStatsMatcher()
+		if err != nil {
+			return err
+		}
+		args.StatsConfigJSON = formatStatsConfig(stats, matcher)
 	}
 
 	if c.StaticClustersJSON != "" {
@@ -265,6 +439,14 @@ func (c *BootstrapConfig) ConfigureArgs(args *BootstrapTplArgs, omitDeprecatedTa
 		args.StatsFlushInterval = c.StatsFlushInterval
 	}
 
+	if c.OverloadManager != nil {
+		overloadManagerJSON, err := c.OverloadManager.generateJSON()
+		if err != nil {
+			return err
+		}
+		args.OverloadManagerJSON = overloadManagerJSON
+	}
+
 	// Setup telemetry collector if needed. This MUST happen after the Static*JSON is set above
 	if c.TelemetryCollectorBindSocketDir != "" {
 		appendTelemetryCollectorConfig(args, c.TelemetryCollectorBindSocketDir)
@@ -532,19 +714,99 @@ func resourceTagSpecifiers(omitDeprecatedTags bool) ([]string, error) {
 }
 
 func formatStatsTags(tags []string) string {
+	return formatStatsConfig(tags, "")
+}
+
+// formatStatsConfig renders the body of the `stats_config` field from the
+// given stats_tags and (optional) stats_matcher JSON.
+func formatStatsConfig(tags []string, matcherJSON string) string {
 	var output string
 	if len(tags) > 0 {
+		var matcher string
+		if matcherJSON != "" {
+			matcher = `,
+			"stats_matcher": ` + matcherJSON
+		}
 		// use_all_default_tags is true by default but we'll make it explicit!
 		output = `{
 			"stats_tags": [
 				` + strings.Join(tags, ",\n") + `
 			],
-			"use_all_default_tags": true
+			"use_all_default_tags": true` + matcher + `
 		}`
 	}
 	return output
 }
 
+// HasStatsMatcher returns true if any of the stats_matcher inclusion or
+// exclusion keys are set.
+func (c *BootstrapConfig) HasStatsMatcher() bool {
+	return c.hasStatsMatcherInclusions() || c.hasStatsMatcherExclusions()
+}
+
+func (c *BootstrapConfig) hasStatsMatcherInclusions() bool {
+	return len(c.StatsMatcherInclusionPrefixes) > 0 ||
+		len(c.StatsMatcherInclusionSuffixes) > 0 ||
+		len(c.StatsMatcherInclusionRegexes) > 0
+}
+
+func (c *BootstrapConfig) hasStatsMatcherExclusions() bool {
+	return len(c.StatsMatcherExclusionPrefixes) > 0 ||
+		len(c.StatsMatcherExclusionSuffixes) > 0 ||
+		len(c.StatsMatcherExclusionRegexes) > 0
+}
+
+// generateStatsMatcher returns the JSON body of the `stats_matcher` field of
+// the stats config, or an empty string if no matcher is configured.
+func (c *BootstrapConfig) generateStatsMatcher() (string, error) {
+	var (
+		listName string
+		prefixes []string
+		suffixes []string
+		regexes  []string
+	)
+	switch {
+	case c.hasStatsMatcherInclusions() && c.hasStatsMatcherExclusions():
+		return "", fmt.Errorf("envoy stats matcher inclusion and exclusion lists are mutually exclusive")
+	case c.hasStatsMatcherInclusions():
+		listName = "inclusion_list"
+		prefixes = c.StatsMatcherInclusionPrefixes
+		suffixes = c.StatsMatcherInclusionSuffixes
+		regexes = c.StatsMatcherInclusionRegexes
+	case c.hasStatsMatcherExclusions():
+		listName = "exclusion_list"
+		prefixes = c.StatsMatcherExclusionPrefixes
+		suffixes = c.StatsMatcherExclusionSuffixes
+		regexes = c.StatsMatcherExclusionRegexes
+	default:
+		return "", nil
+	}
+
+	var patterns []map[string]any
+	for _, p := range prefixes {
+		patterns = append(patterns, map[string]any{"prefix": p})
+	}
+	for _, s := range suffixes {
+		patterns = append(patterns, map[string]any{"suffix": s})
+	}
+	for _, r := range regexes {
+		if _, err := regexp.Compile(r); err != nil {
+			return "", fmt.Errorf("invalid envoy stats matcher regex %q: %v", r, err)
+		}
+		patterns = append(patterns, map[string]any{
+			"safe_regex": map[string]string{"regex": r},
+		})
+	}
+
+	d, err := json.Marshal(map[string]any{
+		listName: map[string]any{"patterns": patterns},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(d), nil
+}
+
 func generateStatsTags(args *BootstrapTplArgs, initialTags []string, omitDeprecatedTags bool) ([]string, error) {
 	var (
 		// Track tags we are setting explicitly to exclude them from defaults
@@ -654,9 +916,16 @@ func (c *BootstrapConfig) generateListenerConfig(args *BootstrapTplArgs, bindAdd
 	clusterAddress := args.AdminBindAddress
 	clusterPort := args.AdminBindPort
 	clusterName := selfAdminName
+	var clusterSocket string
+	var clusterTLS bool
 	if prometheusBackendPort != "" {
 		clusterPort = prometheusBackendPort
 		clusterName = "prometheus_backend"
+		if args.PrometheusBackendAddress != "" {
+			clusterAddress = args.PrometheusBackendAddress
+		}
+		clusterSocket = args.PrometheusBackendSocket
+		clusterTLS = args.PrometheusBackendTLS
 	}
 
 	if !strings.HasPrefix(matchValue, "/") {
@@ -677,6 +946,38 @@ func (c *BootstrapConfig) generateListenerConfig(args *BootstrapTplArgs, bindAdd
 		matchValue = u.Path
 	}
 
+	clusterAddressJSON := `"socket_address": {
+										"address": "` + clusterAddress + `",
+										"port_value": ` + clusterPort + `
+									}`
+	if clusterSocket != "" {
+		clusterAddressJSON = `"pipe": {
+										"path": "` + clusterSocket + `"
+									}`
+	}
+
+	// Connect to the merged metrics backend over TLS if it serves TLS.
+	var clusterTLSConfig string
+	if clusterTLS {
+		clusterTLSConfig = `,
+		"transportSocket": {
+			"name": "tls",
+			"typedConfig": {
+				"@type": "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext",
+				"commonTlsContext": {
+					"tlsCertificateSdsSecretConfigs": [
+						{
+							"name": "prometheus_cert"
+						}
+					],
+					"validationContextSdsSecretConfig": {
+						"name": "prometheus_validation_context"
+					}
+				}
+			}
+		}`
+	}
+
 	clusterJSON := `{
 		"name": "` + clusterName + `",
 		"ignore_health_on_host_removal": false,
@@ -691,17 +992,14 @@ func (c *BootstrapConfig) generateListenerConfig(args *BootstrapTplArgs, bindAdd
 						{
 							"endpoint": {
 								"address": {
-									"socket_address": {
-										"address": "` + clusterAddress + `",
-										"port_value": ` + clusterPort + `
-									}
+									` + clusterAddressJSON + `
 								}
 							}
 						}
 					]
 				}
 			]
-		}
+		}` + clusterTLSConfig + `
 	}`
 
 	// Enable TLS on the prometheus listener if cert/private key are provided.
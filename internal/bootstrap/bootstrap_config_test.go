@@ -880,6 +880,157 @@ func TestBootstrapConfig_ConfigureArgs(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "stats-matcher-inclusions",
+			input: BootstrapConfig{
+				StatsMatcherInclusionPrefixes: []string{"cluster.outbound", "http.public_listener"},
+				StatsMatcherInclusionSuffixes: []string{".upstream_rq_total"},
+				StatsMatcherInclusionRegexes:  []string{`^server\..*`},
+			},
+			wantArgs: BootstrapTplArgs{
+				StatsConfigJSON: `{
+					"stats_tags": [
+						` + defaultTagsJSON + `
+					],
+					"use_all_default_tags": true,
+					"stats_matcher": {
+						"inclusion_list": {
+							"patterns": [
+								{"prefix": "cluster.outbound"},
+								{"prefix": "http.public_listener"},
+								{"suffix": ".upstream_rq_total"},
+								{"safe_regex": {"regex": "^server\\..*"}}
+							]
+						}
+					}
+				}`,
+			},
+			wantErr: false,
+		},
+		{
+			name: "stats-matcher-exclusions-with-tags",
+			input: BootstrapConfig{
+				StatsTags:                     []string{"canary"},
+				StatsMatcherExclusionPrefixes: []string{"cluster.passthrough~"},
+			},
+			wantArgs: BootstrapTplArgs{
+				StatsConfigJSON: `{
+					"stats_tags": [
+						{
+							"tag_name": "canary",
+							"fixed_value": "1"
+						},
+						` + defaultTagsJSON + `
+					],
+					"use_all_default_tags": true,
+					"stats_matcher": {
+						"exclusion_list": {
+							"patterns": [
+								{"prefix": "cluster.passthrough~"}
+							]
+						}
+					}
+				}`,
+			},
+			wantErr: false,
+		},
+		{
+			name: "stats-matcher-ignored-with-stats-config-override",
+			input: BootstrapConfig{
+				StatsConfigJSON: `{
+					"use_all_default_tags": true
+				}`,
+				StatsMatcherExclusionPrefixes: []string{"cluster."},
+			},
+			wantArgs: BootstrapTplArgs{
+				StatsConfigJSON: `{
+					"use_all_default_tags": true
+				}`,
+			},
+			wantErr: false,
+		},
+		{
+			name: "err-stats-matcher-inclusions-and-exclusions",
+			input: BootstrapConfig{
+				StatsMatcherInclusionPrefixes: []string{"cluster."},
+				StatsMatcherExclusionSuffixes: []string{".bytes"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "err-stats-matcher-bad-regex",
+			input: BootstrapConfig{
+				StatsMatcherExclusionRegexes: []string{"cluster.("},
+			},
+			wantErr: true,
+		},
+		{
+			name: "overload-manager",
+			input: BootstrapConfig{
+				OverloadManager: &OverloadManagerConfig{
+					MaxHeapSizeBytes:                  1073741824,
+					ShrinkHeapThreshold:               0.95,
+					StopAcceptingRequestsThreshold:    0.98,
+					StopAcceptingConnectionsThreshold: 0,
+					MaxDownstreamConnections:          50000,
+				},
+			},
+			wantArgs: BootstrapTplArgs{
+				StatsConfigJSON: defaultStatsConfigJSON,
+				OverloadManagerJSON: `{
+					"refresh_interval": "0.25s",
+					"resource_monitors": [
+						{
+							"name": "envoy.resource_monitors.fixed_heap",
+							"typed_config": {
+								"@type": "type.googleapis.com/envoy.extensions.resource_monitors.fixed_heap.v3.FixedHeapConfig",
+								"max_heap_size_bytes": 1073741824
+							}
+						},
+						{
+							"name": "envoy.resource_monitors.global_downstream_max_connections",
+							"typed_config": {
+								"@type": "type.googleapis.com/envoy.extensions.resource_monitors.downstream_connections.v3.DownstreamConnectionsConfig",
+								"max_active_downstream_connections": 50000
+							}
+						}
+					],
+					"actions": [
+						{
+							"name": "envoy.overload_actions.shrink_heap",
+							"triggers": [{"name": "envoy.resource_monitors.fixed_heap", "threshold": {"value": 0.95}}]
+						},
+						{
+							"name": "envoy.overload_actions.stop_accepting_requests",
+							"triggers": [{"name": "envoy.resource_monitors.fixed_heap", "threshold": {"value": 0.98}}]
+						}
+					]
+				}`,
+			},
+			wantErr: false,
+		},
+		{
+			name: "overload-manager-no-monitors",
+			input: BootstrapConfig{
+				OverloadManager: &OverloadManagerConfig{
+					ShrinkHeapThreshold: 0.95,
+				},
+			},
+			wantArgs: BootstrapTplArgs{
+				StatsConfigJSON: defaultStatsConfigJSON,
+			},
+			wantErr: false,
+		},
+		{
+			name: "err-overload-manager-bad-threshold",
+			input: BootstrapConfig{
+				OverloadManager: &OverloadManagerConfig{
+					MaxHeapSizeBytes:    1073741824,
+					ShrinkHeapThreshold: 1.5,
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "prometheus-bind-addr",
 			input: BootstrapConfig{
@@ -102,6 +102,12 @@ type BootstrapTplArgs struct {
 	// See https://www.envoyproxy.io/docs/envoy/v1.9.0/api-v2/config/trace/v2/trace.proto.
 	TracingConfigJSON string
 
+	// OverloadManagerJSON is a JSON string containing an object in the right
+	// format to be rendered as the body of the `overload_manager` field at the
+	// top level of the bootstrap config. See
+	// https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/overload/v3/overload.proto.
+	OverloadManagerJSON string
+
 	// Namespace is the Consul Enterprise Namespace of the proxy service instance
 	// as registered with the Consul agent.
 	Namespace string
@@ -117,6 +123,20 @@ type BootstrapTplArgs struct {
 	// envoy_prometheus_bind_addr will point to.
 	PrometheusBackendPort string
 
+	// PrometheusBackendAddress is the IP address of the "prometheus_backend"
+	// cluster. If empty, AdminBindAddress is used.
+	PrometheusBackendAddress string
+
+	// PrometheusBackendSocket is the path to a unix socket for the
+	// "prometheus_backend" cluster. It takes precedence over
+	// PrometheusBackendAddress and PrometheusBackendPort.
+	PrometheusBackendSocket string
+
+	// PrometheusBackendTLS configures the "prometheus_backend" cluster to
+	// connect over TLS, presenting PrometheusCertFile and verifying the backend
+	// against the Prometheus CA.
+	PrometheusBackendTLS bool
+
 	// PrometheusScrapePath will configure the path where metrics are exposed on
 	// the envoy_prometheus_bind_addr listener.
 	PrometheusScrapePath string
@@ -279,6 +299,9 @@ const bootstrapTemplate = `{
   {{- if .TracingConfigJSON }}
   "tracing": {{ .TracingConfigJSON }},
   {{- end }}
+  {{- if .OverloadManagerJSON }}
+  "overload_manager": {{ .OverloadManagerJSON }},
+  {{- end }}
   "dynamic_resources": {
     "lds_config": {
       "ads": {},
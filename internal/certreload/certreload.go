@@ -0,0 +1,119 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+// Package certreload serves TLS certificates that are reloaded when their
+// files change, so that rotated certificates are picked up without
+// restarting.
+package certreload
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// checkInterval is how often the certificate and key files are checked for
+// changes.
+const checkInterval = 10 * time.Second
+
+// Reloader serves a certificate, reloading it when its files change.
+type Reloader struct {
+	name     string
+	certFile string
+	keyFile  string
+	logger   hclog.Logger
+	now      func() time.Time
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time // of the certificate and key files
+	checked  time.Time
+}
+
+// New loads the certificate and key files. The name describes the
+// certificate in errors and logs, e.g. "dns proxy".
+func New(name, certFile, keyFile string, logger hclog.Logger) (*Reloader, error) {
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+	r := &Reloader{
+		name:     name,
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+		now:      time.Now,
+	}
+	modTimes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTimes); err != nil {
+		return nil, err
+	}
+	r.checked = r.now()
+	return r, nil
+}
+
+// stat returns the modification times of the certificate and key files.
+func (r *Reloader) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, fmt.Errorf("failed to load %s certificate: %w", r.name, err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// load loads the certificate. The lock must be held, unless the reloader
+// isn't in use yet.
+func (r *Reloader) load(modTimes [2]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load %s certificate: %w", r.name, err)
+	}
+	r.cert = &cert
+	r.modTimes = modTimes
+	return nil
+}
+
+// Certificate returns the certificate, reloading it first if its files
+// changed since they were last checked. If reloading fails, the previous
+// certificate is kept.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if now.Sub(r.checked) < checkInterval {
+		return r.cert
+	}
+	r.checked = now
+	modTimes, err := r.stat()
+	if err == nil && modTimes != r.modTimes {
+		err = r.load(modTimes)
+		if err == nil {
+			r.logger.Info(fmt.Sprintf("reloaded %s certificate", r.name), "cert_file", r.certFile)
+		}
+	}
+	if err != nil {
+		r.logger.Error(fmt.Sprintf("failed to reload %s certificate, using the previous one", r.name), "error", err)
+	}
+	return r.cert
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
@@ -0,0 +1,96 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package certreload
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert writes a self-signed certificate with the given common name,
+// and its key, to dir.
+func writeTestCert(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+// commonName returns the common name of a certificate.
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "first")
+
+	r, err := New("test", certFile, keyFile, hclog.NewNullLogger())
+	require.NoError(t, err)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "first", commonName(t, cert))
+
+	// The files are only checked for changes every checkInterval.
+	writeTestCert(t, dir, "second")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "first", commonName(t, cert))
+
+	now = now.Add(checkInterval)
+	cert, err = r.GetClientCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "second", commonName(t, cert))
+
+	// An invalid certificate isn't loaded.
+	require.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0600))
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	now = now.Add(checkInterval)
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "second", commonName(t, cert))
+
+	_, err = New("test", filepath.Join(dir, "missing.pem"), keyFile, nil)
+	require.ErrorContains(t, err, "failed to load test certificate")
+}
@@ -0,0 +1,259 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+// Package cgroup reads the resource limits that apply to the current process
+// from the cgroup filesystem.
+package cgroup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultMountPoint = "/sys/fs/cgroup"
+	procSelfCgroup    = "/proc/self/cgroup"
+
+	// unlimited is the value cgroup v2 interface files use to indicate that no
+	// limit is set.
+	unlimited = "max"
+)
+
+// MemoryLimit returns the cgroup v2 memory limit (memory.max) in bytes for the
+// current process. The returned bool is false if cgroup v2 is not available or
+// no limit is set.
+func MemoryLimit() (uint64, bool, error) {
+	return memoryLimit(defaultMountPoint, procSelfCgroup)
+}
+
+func memoryLimit(mountPoint, procCgroup string) (uint64, bool, error) {
+	data, ok, err := readV2File(mountPoint, procCgroup, "memory.max")
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	if data == unlimited {
+		return 0, false, nil
+	}
+	limit, err := strconv.ParseUint(data, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse cgroup memory.max %q: %w", data, err)
+	}
+	return limit, true, nil
+}
+
+// CPULimit returns the number of CPUs available to the current process
+// according to its cgroup CPU quota and cpuset, whichever is lower. Both
+// cgroup v1 and v2 are supported. The returned bool is false if neither a
+// quota nor a cpuset applies.
+func CPULimit() (float64, bool, error) {
+	return cpuLimit(defaultMountPoint, procSelfCgroup)
+}
+
+func cpuLimit(mountPoint, procCgroup string) (float64, bool, error) {
+	quota, quotaOK, err := cpuQuota(mountPoint, procCgroup)
+	if err != nil {
+		return 0, false, err
+	}
+	cpus, cpusetOK, err := cpusetCount(mountPoint, procCgroup)
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch {
+	case quotaOK && cpusetOK:
+		return min(quota, float64(cpus)), true, nil
+	case quotaOK:
+		return quota, true, nil
+	case cpusetOK:
+		return float64(cpus), true, nil
+	}
+	return 0, false, nil
+}
+
+// cpuQuota returns the CFS quota divided by its period, from cpu.max on
+// cgroup v2 or cpu.cfs_quota_us and cpu.cfs_period_us on cgroup v1.
+func cpuQuota(mountPoint, procCgroup string) (float64, bool, error) {
+	data, ok, err := readV2File(mountPoint, procCgroup, "cpu.max")
+	if err != nil {
+		return 0, false, err
+	}
+	if ok {
+		fields := strings.Fields(data)
+		if len(fields) != 2 {
+			return 0, false, fmt.Errorf("failed to parse cgroup cpu.max %q", data)
+		}
+		if fields[0] == unlimited {
+			return 0, false, nil
+		}
+		return parseQuota(fields[0], fields[1])
+	}
+
+	quota, ok, err := readV1File(mountPoint, procCgroup, "cpu", "cpu.cfs_quota_us")
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	// A quota of -1 indicates that no limit is set.
+	if quota == "-1" {
+		return 0, false, nil
+	}
+	period, ok, err := readV1File(mountPoint, procCgroup, "cpu", "cpu.cfs_period_us")
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	return parseQuota(quota, period)
+}
+
+func parseQuota(quotaStr, periodStr string) (float64, bool, error) {
+	quota, err := strconv.ParseUint(quotaStr, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse cgroup cpu quota %q: %w", quotaStr, err)
+	}
+	period, err := strconv.ParseUint(periodStr, 10, 64)
+	if err != nil || period == 0 {
+		return 0, false, fmt.Errorf("failed to parse cgroup cpu period %q", periodStr)
+	}
+	return float64(quota) / float64(period), true, nil
+}
+
+// cpusetCount returns the number of CPUs in the cpuset, from
+// cpuset.cpus.effective on cgroup v2 or cpuset.cpus on cgroup v1.
+func cpusetCount(mountPoint, procCgroup string) (int, bool, error) {
+	data, ok, err := readV2File(mountPoint, procCgroup, "cpuset.cpus.effective")
+	if err != nil {
+		return 0, false, err
+	}
+	if !ok {
+		data, ok, err = readV1File(mountPoint, procCgroup, "cpuset", "cpuset.cpus")
+		if err != nil || !ok {
+			return 0, false, err
+		}
+	}
+	// An empty cpuset means the group inherits all of the CPUs of its parent.
+	if data == "" {
+		return 0, false, nil
+	}
+	n, err := parseCPUList(data)
+	if err != nil {
+		return 0, false, err
+	}
+	return n, true, nil
+}
+
+// parseCPUList counts the CPUs in a list such as "0-3,8,10-11".
+func parseCPUList(list string) (int, error) {
+	var n int
+	for _, r := range strings.Split(list, ",") {
+		lo, hi, isRange := strings.Cut(r, "-")
+		start, err := strconv.Atoi(lo)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse cgroup cpu list %q: %w", list, err)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(hi); err != nil || end < start {
+				return 0, fmt.Errorf("failed to parse cgroup cpu list %q", list)
+			}
+		}
+		n += end - start + 1
+	}
+	return n, nil
+}
+
+// readV2File reads the named interface file of the cgroup v2 group the current
+// process belongs to. Inside a container with a private cgroup namespace the
+// group is the root of the mount point, so that is used as a fallback.
+func readV2File(mountPoint, procCgroup, name string) (string, bool, error) {
+	candidates := []string{mountPoint}
+	if group, ok := v2Group(procCgroup); ok && group != "/" {
+		candidates = append([]string{filepath.Join(mountPoint, group)}, candidates...)
+	}
+
+	return readFirst(candidates, name)
+}
+
+// readV1File reads the named file of the cgroup v1 controller hierarchy the
+// current process belongs to, falling back to the root of the controller's
+// mount point as readV2File does.
+func readV1File(mountPoint, procCgroup, controller, name string) (string, bool, error) {
+	controllers, group, ok := v1Group(procCgroup, controller)
+	if !ok {
+		return "", false, nil
+	}
+
+	// The hierarchy may be mounted under the name of the controller alone or
+	// of all the controllers it is co-mounted with, e.g. "cpu,cpuacct".
+	var candidates []string
+	for _, dir := range []string{controllers, controller} {
+		base := filepath.Join(mountPoint, dir)
+		if group != "/" {
+			candidates = append(candidates, filepath.Join(base, group))
+		}
+		candidates = append(candidates, base)
+	}
+
+	return readFirst(candidates, name)
+}
+
+// readFirst reads the named file from the first of dirs that contains it.
+func readFirst(dirs []string, name string) (string, bool, error) {
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return strings.TrimSpace(string(data)), true, nil
+	}
+	return "", false, nil
+}
+
+// v1Group returns the comma separated controller list and group path of the
+// cgroup v1 hierarchy containing controller from /proc/self/cgroup, whose
+// entries have the form "<id>:<controllers>:<path>".
+func v1Group(procCgroup, controller string) (string, string, bool) {
+	f, err := os.Open(procCgroup)
+	if err != nil {
+		return "", "", false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, c := range strings.Split(parts[1], ",") {
+			if c == controller {
+				return parts[1], parts[2], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// v2Group returns the path of the unified (v2) hierarchy group from
+// /proc/self/cgroup, whose entry has the form "0::<path>".
+func v2Group(procCgroup string) (string, bool) {
+	f, err := os.Open(procCgroup)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if group, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return group, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,187 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestMemoryLimit(t *testing.T) {
+	cases := map[string]struct {
+		files     map[string]string
+		procGroup string
+		limit     uint64
+		ok        bool
+		wantErr   bool
+	}{
+		"no cgroup v2": {
+			files: map[string]string{},
+		},
+		"unlimited": {
+			files: map[string]string{"memory.max": "max\n"},
+		},
+		"namespace root": {
+			files: map[string]string{"memory.max": "536870912\n"},
+			limit: 536870912,
+			ok:    true,
+		},
+		"nested group": {
+			files: map[string]string{
+				"memory.max":                "max\n",
+				"kubepods/pod-1/memory.max": "268435456\n",
+			},
+			procGroup: "0::/kubepods/pod-1\n",
+			limit:     268435456,
+			ok:        true,
+		},
+		"nested group not mounted": {
+			files:     map[string]string{"memory.max": "1073741824\n"},
+			procGroup: "0::/kubepods/pod-1\n",
+			limit:     1073741824,
+			ok:        true,
+		},
+		"invalid": {
+			files:   map[string]string{"memory.max": "lots\n"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			for path, content := range tc.files {
+				writeFile(t, filepath.Join(root, path), content)
+			}
+			procCgroup := filepath.Join(t.TempDir(), "cgroup")
+			writeFile(t, procCgroup, tc.procGroup)
+
+			limit, ok, err := memoryLimit(root, procCgroup)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.limit, limit)
+		})
+	}
+}
+
+func TestCPULimit(t *testing.T) {
+	cases := map[string]struct {
+		files     map[string]string
+		procGroup string
+		limit     float64
+		ok        bool
+		wantErr   bool
+	}{
+		"no cgroup": {
+			files: map[string]string{},
+		},
+		"v2 unlimited": {
+			files: map[string]string{"cpu.max": "max 100000\n"},
+		},
+		"v2 quota": {
+			files: map[string]string{"cpu.max": "25000 100000\n"},
+			limit: 0.25,
+			ok:    true,
+		},
+		"v2 nested group": {
+			files: map[string]string{
+				"cpu.max":                "max 100000\n",
+				"kubepods/pod-1/cpu.max": "400000 100000\n",
+			},
+			procGroup: "0::/kubepods/pod-1\n",
+			limit:     4,
+			ok:        true,
+		},
+		"v2 cpuset lower than quota": {
+			files: map[string]string{
+				"cpu.max":               "800000 100000\n",
+				"cpuset.cpus.effective": "0-1,4\n",
+			},
+			limit: 3,
+			ok:    true,
+		},
+		"v2 cpuset only": {
+			files: map[string]string{"cpuset.cpus.effective": "0-7\n"},
+			limit: 8,
+			ok:    true,
+		},
+		"v2 invalid quota": {
+			files:   map[string]string{"cpu.max": "lots 100000\n"},
+			wantErr: true,
+		},
+		"v1 unlimited": {
+			files: map[string]string{
+				"cpu,cpuacct/cpu.cfs_quota_us":  "-1\n",
+				"cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+			},
+			procGroup: "4:cpu,cpuacct:/\n",
+		},
+		"v1 quota": {
+			files: map[string]string{
+				"cpu,cpuacct/kubepods/pod-1/cpu.cfs_quota_us":  "150000\n",
+				"cpu,cpuacct/kubepods/pod-1/cpu.cfs_period_us": "100000\n",
+			},
+			procGroup: "5:cpuset:/kubepods/pod-1\n4:cpu,cpuacct:/kubepods/pod-1\n",
+			limit:     1.5,
+			ok:        true,
+		},
+		"v1 quota mounted by controller name": {
+			files: map[string]string{
+				"cpu/cpu.cfs_quota_us":  "200000\n",
+				"cpu/cpu.cfs_period_us": "100000\n",
+			},
+			procGroup: "4:cpu,cpuacct:/kubepods/pod-1\n",
+			limit:     2,
+			ok:        true,
+		},
+		"v1 cpuset": {
+			files: map[string]string{
+				"cpuset/cpuset.cpus": "2-3\n",
+			},
+			procGroup: "5:cpuset:/\n",
+			limit:     2,
+			ok:        true,
+		},
+		"v1 invalid cpuset": {
+			files: map[string]string{
+				"cpuset/cpuset.cpus": "3-2\n",
+			},
+			procGroup: "5:cpuset:/\n",
+			wantErr:   true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			for path, content := range tc.files {
+				writeFile(t, filepath.Join(root, path), content)
+			}
+			procCgroup := filepath.Join(t.TempDir(), "cgroup")
+			writeFile(t, procCgroup, tc.procGroup)
+
+			limit, ok, err := cpuLimit(root, procCgroup)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.limit, limit)
+		})
+	}
+}
@@ -9,11 +9,13 @@ import (
 	"net"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/hashicorp/consul/proto-public/pbdataplane"
 	"github.com/mitchellh/mapstructure"
 
 	"github.com/hashicorp/consul-dataplane/internal/bootstrap"
+	"github.com/hashicorp/consul-dataplane/internal/cgroup"
 )
 
 const (
@@ -23,8 +25,16 @@ const (
 
 	// By default we send logs from Envoy's admin interface to /dev/null.
 	defaultAdminAccessLogsPath = os.DevNull
+
+	// cgroupHeapFraction is the fraction of the cgroup memory limit used as
+	// the Envoy max heap size when one isn't configured, leaving headroom for
+	// memory that isn't tracked by the heap monitor.
+	cgroupHeapFraction = 0.75
 )
 
+// cgroupMemoryLimit is a var so that it can be overridden in tests.
+var cgroupMemoryLimit = cgroup.MemoryLimit
+
 // getBootstrapParams makes a call using the service client to get the bootstrap params for eventually getting the Envoy bootstrap config.
 func (cdp *ConsulDataplane) getBootstrapParams(ctx context.Context) (*pbdataplane.GetEnvoyBootstrapParamsResponse, error) {
 	svc := cdp.cfg.Proxy
@@ -96,6 +106,13 @@ func (cdp *ConsulDataplane) bootstrapConfig(
 		if err != nil {
 			cdp.logger.Error("error splitting listenerAddress to host and port with error", err)
 		}
+		// A gateway's xDS server may listen on a wildcard address, which
+		// Envoy connects to over loopback.
+		if ip := net.ParseIP(h); ip.To4() != nil && ip.IsUnspecified() {
+			h = "127.0.0.1"
+		} else if ip.IsUnspecified() {
+			h = "::1"
+		}
 		args.AgentAddress = h
 		args.AgentPort = p
 	}
@@ -113,22 +130,63 @@ func (cdp *ConsulDataplane) bootstrapConfig(
 	}
 
 	var bootstrapConfig bootstrap.BootstrapConfig
-	if envoy.ReadyBindAddress != "" && envoy.ReadyBindPort != 0 {
-		bootstrapConfig.ReadyBindAddr = net.JoinHostPort(envoy.ReadyBindAddress, strconv.Itoa(envoy.ReadyBindPort))
+	readyBindAddress, readyBindPort := envoy.ReadyBindAddress, envoy.ReadyBindPort
+	if cdp.cfg.Mode.IsGateway() {
+		// Gateways are probed from outside the pod, so the readiness listener
+		// is enabled by default unless its port is set to -1.
+		if readyBindAddress == "" {
+			readyBindAddress = defaultGatewayReadyBindAddress
+		}
+		if readyBindPort == 0 {
+			readyBindPort = defaultGatewayReadyBindPort
+		}
+	}
+	if readyBindAddress != "" && readyBindPort > 0 {
+		bootstrapConfig.ReadyBindAddr = net.JoinHostPort(readyBindAddress, strconv.Itoa(readyBindPort))
+		cdp.logger.Info("envoy readiness probe listener enabled", "address", bootstrapConfig.ReadyBindAddr)
 	}
 
 	if cdp.cfg.Telemetry.UseCentralConfig {
 		if err := mapstructure.WeakDecode(bootstrapParams.Config.AsMap(), &bootstrapConfig); err != nil {
 			return nil, nil, fmt.Errorf("failed parsing Proxy.Config: %w", err)
 		}
+	}
+	// Telemetry configured on the dataplane is applied whether or not central
+	// config is enabled, and takes precedence over it.
+	applyLocalTelemetryConfig(&bootstrapConfig, cdp.cfg.Telemetry)
 
+	if bootstrapConfig.PrometheusBindAddr != "" {
 		// Envoy is configured with a listener that proxies metrics from its
-		// own admin endpoint (localhost:19000/stats/prometheus). When central
-		// config is enabled, we set the PrometheusBackendPort to instead have
-		// Envoy proxy metrics from Consul Dataplane which serves merged
-		// metrics (Envoy + Dataplane + service metrics).
+		// own admin endpoint (localhost:19000/stats/prometheus). We set the
+		// PrometheusBackendPort to instead have Envoy proxy metrics from
+		// Consul Dataplane which serves merged metrics (Envoy + Dataplane +
+		// service metrics).
 		// Documentation: https://www.consul.io/commands/connect/envoy#prometheus-backend-port
 		args.PrometheusBackendPort = strconv.Itoa(prom.MergePort)
+		args.PrometheusBackendTLS = prom.ServerTLS
+		if path, ok := strings.CutPrefix(prom.MergeBindAddr, unixSocketPrefix); ok {
+			args.PrometheusBackendSocket = path
+		} else if ip := net.ParseIP(prom.MergeBindAddr); ip != nil && !ip.IsUnspecified() {
+			// The merged metrics server isn't reachable over loopback when
+			// bound to a specific address.
+			args.PrometheusBackendAddress = prom.MergeBindAddr
+		}
+	}
+
+	// The stats matcher configured on the dataplane is a node-local default,
+	// so only apply it when central config doesn't set one.
+	if !bootstrapConfig.HasStatsMatcher() {
+		sm := envoy.StatsMatcher
+		bootstrapConfig.StatsMatcherInclusionPrefixes = sm.InclusionPrefixes
+		bootstrapConfig.StatsMatcherInclusionSuffixes = sm.InclusionSuffixes
+		bootstrapConfig.StatsMatcherInclusionRegexes = sm.InclusionRegexes
+		bootstrapConfig.StatsMatcherExclusionPrefixes = sm.ExclusionPrefixes
+		bootstrapConfig.StatsMatcherExclusionSuffixes = sm.ExclusionSuffixes
+		bootstrapConfig.StatsMatcherExclusionRegexes = sm.ExclusionRegexes
+	}
+
+	if envoy.OverloadManager.Enabled {
+		bootstrapConfig.OverloadManager = cdp.overloadManagerConfig()
 	}
 
 	bootstrapConfig.Logger = cdp.logger.Named("bootstrap-config")
@@ -138,3 +196,74 @@ func (cdp *ConsulDataplane) bootstrapConfig(
 	cfg, err := bootstrapConfig.GenerateJSON(args, true)
 	return &bootstrapConfig, cfg, err
 }
+
+// applyLocalTelemetryConfig overrides the telemetry of the bootstrap config
+// with the telemetry configured on the dataplane. Stats tags are merged, with
+// local tags replacing central tags of the same name.
+func applyLocalTelemetryConfig(bcfg *bootstrap.BootstrapConfig, telemetry *TelemetryConfig) {
+	if telemetry.Prometheus.BindAddr != "" {
+		bcfg.PrometheusBindAddr = telemetry.Prometheus.BindAddr
+	}
+	if telemetry.StatsdURL != "" {
+		bcfg.StatsdURL = telemetry.StatsdURL
+	}
+	if telemetry.DogstatsdURL != "" {
+		bcfg.DogstatsdURL = telemetry.DogstatsdURL
+	}
+	if len(telemetry.StatsTags) > 0 {
+		bcfg.StatsTags = mergeStatsTags(bcfg.StatsTags, telemetry.StatsTags)
+	}
+}
+
+// mergeStatsTags returns the central tags that aren't overridden by a local tag
+// of the same name, followed by the local tags.
+func mergeStatsTags(central, local []string) []string {
+	statsTagName := func(tag string) string {
+		name, _, _ := strings.Cut(tag, "=")
+		return strings.TrimSpace(name)
+	}
+	overridden := make(map[string]bool, len(local))
+	for _, tag := range local {
+		overridden[statsTagName(tag)] = true
+	}
+	merged := make([]string, 0, len(central)+len(local))
+	for _, tag := range central {
+		if !overridden[statsTagName(tag)] {
+			merged = append(merged, tag)
+		}
+	}
+	return append(merged, local...)
+}
+
+// overloadManagerConfig builds the Envoy overload manager config, deriving
+// the heap limit from the cgroup memory limit when one isn't configured.
+// It returns nil if there is nothing for the overload manager to monitor.
+func (cdp *ConsulDataplane) overloadManagerConfig() *bootstrap.OverloadManagerConfig {
+	om := cdp.cfg.Envoy.OverloadManager
+
+	maxHeap := uint64(om.MaxHeapSizeBytes)
+	if maxHeap == 0 {
+		limit, ok, err := cgroupMemoryLimit()
+		switch {
+		case err != nil:
+			cdp.logger.Warn("failed to read cgroup memory limit", "error", err)
+		case ok:
+			maxHeap = uint64(float64(limit) * cgroupHeapFraction)
+			cdp.logger.Info("derived envoy max heap size from cgroup memory limit",
+				"memory_limit_bytes", limit, "max_heap_size_bytes", maxHeap)
+		}
+	}
+
+	if maxHeap == 0 && om.MaxDownstreamConnections == 0 {
+		cdp.logger.Warn("envoy overload manager is enabled but no heap size or downstream connection limit is available; skipping")
+		return nil
+	}
+
+	return &bootstrap.OverloadManagerConfig{
+		MaxHeapSizeBytes:                  maxHeap,
+		ShrinkHeapThreshold:               om.ShrinkHeapThreshold,
+		StopAcceptingRequestsThreshold:    om.StopAcceptingRequestsThreshold,
+		StopAcceptingConnectionsThreshold: om.StopAcceptingConnectionsThreshold,
+		MaxDownstreamConnections:          uint64(om.MaxDownstreamConnections),
+	}
+}
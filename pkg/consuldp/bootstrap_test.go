@@ -8,9 +8,11 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -33,6 +35,11 @@ func TestBootstrapConfig(t *testing.T) {
 		socketPath  = "/var/run/xds.sock"
 	)
 
+	// Pretend the dataplane is running in a cgroup with a 512MiB memory limit.
+	origCgroupMemoryLimit := cgroupMemoryLimit
+	cgroupMemoryLimit = func() (uint64, bool, error) { return 512 * 1024 * 1024, true, nil }
+	t.Cleanup(func() { cgroupMemoryLimit = origCgroupMemoryLimit })
+
 	makeStruct := func(kv map[string]any) *structpb.Struct {
 		s, err := structpb.NewStruct(kv)
 		require.NoError(t, err)
@@ -194,6 +201,128 @@ func TestBootstrapConfig(t *testing.T) {
 				}),
 			},
 		},
+		"local-telemetry-config": {
+			cfg: &Config{
+				Proxy: &ProxyConfig{
+					ProxyID:  "web-proxy",
+					NodeName: nodeName,
+				},
+				Envoy: &EnvoyConfig{
+					AdminBindAddress: "127.0.0.1",
+					AdminBindPort:    19000,
+				},
+				Telemetry: &TelemetryConfig{
+					UseCentralConfig: false,
+					Prometheus: PrometheusTelemetryConfig{
+						BindAddr:   "0.0.0.0:20200",
+						MergePort:  20100,
+						ScrapePath: "/metrics",
+					},
+					DogstatsdURL: "udp://127.0.0.1:9125",
+					StatsTags:    []string{"team=payments"},
+				},
+				XDSServer: &XDSServer{BindAddress: "127.0.0.1", BindPort: xdsBindPort},
+			},
+			rsp: &pbdataplane.GetEnvoyBootstrapParamsResponse{
+				Service:  "web",
+				NodeName: nodeName,
+				Config: makeStruct(map[string]any{
+					"envoy_dogstatsd_url": "this-should-not-appear-in-generated-config",
+				}),
+			},
+		},
+		"local-telemetry-overrides-central": {
+			cfg: &Config{
+				Proxy: &ProxyConfig{
+					ProxyID:  "web-proxy",
+					NodeName: nodeName,
+				},
+				Envoy: &EnvoyConfig{
+					AdminBindAddress: "127.0.0.1",
+					AdminBindPort:    19000,
+				},
+				Telemetry: &TelemetryConfig{
+					UseCentralConfig: true,
+					Prometheus: PrometheusTelemetryConfig{
+						BindAddr:   "0.0.0.0:20300",
+						MergePort:  20100,
+						ScrapePath: "/metrics",
+					},
+					StatsdURL: "udp://127.0.0.1:8125",
+					StatsTags: []string{"team=payments"},
+				},
+				XDSServer: &XDSServer{BindAddress: "127.0.0.1", BindPort: xdsBindPort},
+			},
+			rsp: &pbdataplane.GetEnvoyBootstrapParamsResponse{
+				Service:  "web",
+				NodeName: nodeName,
+				Config: makeStruct(map[string]any{
+					"envoy_prometheus_bind_addr": "0.0.0.0:20200",
+					"envoy_statsd_url":           "udp://127.0.0.1:9125",
+					"envoy_stats_tags":           []any{"team=infra", "env=prod"},
+				}),
+			},
+		},
+		"prometheus-backend-tls": {
+			cfg: &Config{
+				Proxy: &ProxyConfig{
+					ProxyID:  "web-proxy",
+					NodeName: nodeName,
+				},
+				Envoy: &EnvoyConfig{
+					AdminBindAddress: "127.0.0.1",
+					AdminBindPort:    19000,
+				},
+				Telemetry: &TelemetryConfig{
+					UseCentralConfig: true,
+					Prometheus: PrometheusTelemetryConfig{
+						MergePort:     20100,
+						MergeBindAddr: "10.0.0.5",
+						ScrapePath:    "/metrics",
+						CACertsPath:   "testdata/certs/ca/cert.pem",
+						CertFile:      "testdata/certs/server/cert.pem",
+						KeyFile:       "testdata/certs/server/key.pem",
+						ServerTLS:     true,
+					},
+				},
+				XDSServer: &XDSServer{BindAddress: "127.0.0.1", BindPort: xdsBindPort},
+			},
+			rsp: &pbdataplane.GetEnvoyBootstrapParamsResponse{
+				Service:  "web",
+				NodeName: nodeName,
+				Config: makeStruct(map[string]any{
+					"envoy_prometheus_bind_addr": "0.0.0.0:20200",
+				}),
+			},
+		},
+		"prometheus-backend-unix-socket": {
+			cfg: &Config{
+				Proxy: &ProxyConfig{
+					ProxyID:  "web-proxy",
+					NodeName: nodeName,
+				},
+				Envoy: &EnvoyConfig{
+					AdminBindAddress: "127.0.0.1",
+					AdminBindPort:    19000,
+				},
+				Telemetry: &TelemetryConfig{
+					UseCentralConfig: true,
+					Prometheus: PrometheusTelemetryConfig{
+						MergePort:     20100,
+						MergeBindAddr: "unix:///var/run/consul-dataplane/metrics.sock",
+						ScrapePath:    "/metrics",
+					},
+				},
+				XDSServer: &XDSServer{BindAddress: "127.0.0.1", BindPort: xdsBindPort},
+			},
+			rsp: &pbdataplane.GetEnvoyBootstrapParamsResponse{
+				Service:  "web",
+				NodeName: nodeName,
+				Config: makeStruct(map[string]any{
+					"envoy_prometheus_bind_addr": "0.0.0.0:20200",
+				}),
+			},
+		},
 		"non-default tenancy": {
 			cfg: &Config{
 				Proxy: &ProxyConfig{
@@ -249,6 +378,200 @@ func TestBootstrapConfig(t *testing.T) {
 				NodeName: nodeName,
 			},
 		},
+		"stats-matcher": {
+			cfg: &Config{
+				Proxy: &ProxyConfig{
+					ProxyID:  "web-proxy",
+					NodeName: nodeName,
+				},
+				Envoy: &EnvoyConfig{
+					AdminBindAddress: "127.0.0.1",
+					AdminBindPort:    19000,
+					StatsMatcher: StatsMatcherConfig{
+						ExclusionPrefixes: []string{"cluster.passthrough~"},
+						ExclusionSuffixes: []string{".upstream_cx_length_ms"},
+					},
+				},
+				Telemetry: &TelemetryConfig{
+					UseCentralConfig: false,
+				},
+				XDSServer: &XDSServer{BindAddress: "127.0.0.1", BindPort: xdsBindPort},
+			},
+			rsp: &pbdataplane.GetEnvoyBootstrapParamsResponse{
+				Service:  "web",
+				NodeName: nodeName,
+			},
+		},
+		"stats-matcher-central-config": {
+			cfg: &Config{
+				Proxy: &ProxyConfig{
+					ProxyID:  "web-proxy",
+					NodeName: nodeName,
+				},
+				Envoy: &EnvoyConfig{
+					AdminBindAddress: "127.0.0.1",
+					AdminBindPort:    19000,
+					// Expect the node-local default to be replaced by central config.
+					StatsMatcher: StatsMatcherConfig{
+						ExclusionPrefixes: []string{"cluster.passthrough~"},
+					},
+				},
+				Telemetry: &TelemetryConfig{
+					UseCentralConfig: true,
+				},
+				XDSServer: &XDSServer{BindAddress: "127.0.0.1", BindPort: xdsBindPort},
+			},
+			rsp: &pbdataplane.GetEnvoyBootstrapParamsResponse{
+				Service:  "web",
+				NodeName: nodeName,
+				Config: makeStruct(map[string]any{
+					"envoy_stats_matcher_inclusion_prefixes": []any{"cluster.", "http."},
+					"envoy_stats_matcher_inclusion_regexes":  []any{`^server\.`},
+				}),
+			},
+		},
+		"overload-manager": {
+			cfg: &Config{
+				Proxy: &ProxyConfig{
+					ProxyID:  "web-proxy",
+					NodeName: nodeName,
+				},
+				Envoy: &EnvoyConfig{
+					AdminBindAddress: "127.0.0.1",
+					AdminBindPort:    19000,
+					OverloadManager: EnvoyOverloadManagerConfig{
+						Enabled:                           true,
+						MaxHeapSizeBytes:                  1073741824,
+						ShrinkHeapThreshold:               0.95,
+						StopAcceptingRequestsThreshold:    0.98,
+						StopAcceptingConnectionsThreshold: 0.98,
+						MaxDownstreamConnections:          10000,
+					},
+				},
+				Telemetry: &TelemetryConfig{
+					UseCentralConfig: false,
+				},
+				XDSServer: &XDSServer{BindAddress: "127.0.0.1", BindPort: xdsBindPort},
+			},
+			rsp: &pbdataplane.GetEnvoyBootstrapParamsResponse{
+				Service:  "web",
+				NodeName: nodeName,
+			},
+		},
+		"overload-manager-cgroup-memory-limit": {
+			cfg: &Config{
+				Proxy: &ProxyConfig{
+					ProxyID:  "web-proxy",
+					NodeName: nodeName,
+				},
+				Envoy: &EnvoyConfig{
+					AdminBindAddress: "127.0.0.1",
+					AdminBindPort:    19000,
+					// Expect the max heap size to be derived from the cgroup memory limit.
+					OverloadManager: EnvoyOverloadManagerConfig{
+						Enabled:                           true,
+						ShrinkHeapThreshold:               0.95,
+						StopAcceptingRequestsThreshold:    0.98,
+						StopAcceptingConnectionsThreshold: 0.98,
+					},
+				},
+				Telemetry: &TelemetryConfig{
+					UseCentralConfig: false,
+				},
+				XDSServer: &XDSServer{BindAddress: "127.0.0.1", BindPort: xdsBindPort},
+			},
+			rsp: &pbdataplane.GetEnvoyBootstrapParamsResponse{
+				Service:  "web",
+				NodeName: nodeName,
+			},
+		},
+		"gateway-ready-listener-default": {
+			cfg: &Config{
+				Mode: ModeTypeMeshGateway,
+				Proxy: &ProxyConfig{
+					ProxyID:  "mesh-gateway",
+					NodeName: nodeName,
+				},
+				Envoy: &EnvoyConfig{
+					AdminBindAddress: "127.0.0.1",
+					AdminBindPort:    19000,
+				},
+				Telemetry: &TelemetryConfig{
+					UseCentralConfig: false,
+				},
+				XDSServer: &XDSServer{BindAddress: "127.0.0.1", BindPort: xdsBindPort},
+			},
+			rsp: &pbdataplane.GetEnvoyBootstrapParamsResponse{
+				Service:  "mesh-gateway",
+				NodeName: nodeName,
+			},
+		},
+		"gateway-ready-listener-disabled": {
+			cfg: &Config{
+				Mode: ModeTypeIngressGateway,
+				Proxy: &ProxyConfig{
+					ProxyID:  "ingress-gateway",
+					NodeName: nodeName,
+				},
+				Envoy: &EnvoyConfig{
+					AdminBindAddress: "127.0.0.1",
+					AdminBindPort:    19000,
+					ReadyBindPort:    -1,
+				},
+				Telemetry: &TelemetryConfig{
+					UseCentralConfig: false,
+				},
+				XDSServer: &XDSServer{BindAddress: "127.0.0.1", BindPort: xdsBindPort},
+			},
+			rsp: &pbdataplane.GetEnvoyBootstrapParamsResponse{
+				Service:  "ingress-gateway",
+				NodeName: nodeName,
+			},
+		},
+		"gateway-wildcard-xds-bind-address": {
+			cfg: &Config{
+				Mode: ModeTypeTerminatingGateway,
+				Proxy: &ProxyConfig{
+					ProxyID:  "terminating-gateway",
+					NodeName: nodeName,
+				},
+				Envoy: &EnvoyConfig{
+					AdminBindAddress: "127.0.0.1",
+					AdminBindPort:    19000,
+				},
+				Telemetry: &TelemetryConfig{
+					UseCentralConfig: false,
+				},
+				XDSServer: &XDSServer{BindAddress: "0.0.0.0", BindPort: xdsBindPort},
+			},
+			rsp: &pbdataplane.GetEnvoyBootstrapParamsResponse{
+				Service:  "terminating-gateway",
+				NodeName: nodeName,
+			},
+		},
+		"gateway-ready-listener-configured": {
+			cfg: &Config{
+				Mode: ModeTypeAPIGateway,
+				Proxy: &ProxyConfig{
+					ProxyID:  "api-gateway",
+					NodeName: nodeName,
+				},
+				Envoy: &EnvoyConfig{
+					AdminBindAddress: "127.0.0.1",
+					AdminBindPort:    19000,
+					ReadyBindAddress: "10.0.0.5",
+					ReadyBindPort:    22000,
+				},
+				Telemetry: &TelemetryConfig{
+					UseCentralConfig: false,
+				},
+				XDSServer: &XDSServer{BindAddress: "127.0.0.1", BindPort: xdsBindPort},
+			},
+			rsp: &pbdataplane.GetEnvoyBootstrapParamsResponse{
+				Service:  "api-gateway",
+				NodeName: nodeName,
+			},
+		},
 		"unix-socket-xds-server": {
 			cfg: &Config{
 				Proxy: &ProxyConfig{
@@ -297,7 +620,7 @@ func TestBootstrapConfig(t *testing.T) {
 			if strings.HasPrefix(tc.cfg.XDSServer.BindAddress, "unix://") {
 				dp.xdsServer = &xdsServer{listenerAddress: socketPath, listenerNetwork: "unix"}
 			} else {
-				dp.xdsServer = &xdsServer{listenerAddress: fmt.Sprintf("127.0.0.1:%d", xdsBindPort)}
+				dp.xdsServer = &xdsServer{listenerAddress: net.JoinHostPort(tc.cfg.XDSServer.BindAddress, strconv.Itoa(xdsBindPort))}
 			}
 
 			params, err := dp.getBootstrapParams(ctx)
@@ -359,3 +682,11 @@ func validateBootstrapConfig(t *testing.T, cfg []byte) {
 		}
 	})
 }
+
+func TestMergeStatsTags(t *testing.T) {
+	require.Equal(t,
+		[]string{"env=prod", "team=payments", "zone"},
+		mergeStatsTags([]string{"team=infra", "env=prod"}, []string{"team=payments", "zone"}),
+	)
+	require.Equal(t, []string{"team=payments"}, mergeStatsTags(nil, []string{"team=payments"}))
+}
@@ -0,0 +1,71 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package consuldp
+
+import (
+	"math"
+	"runtime"
+
+	"github.com/hashicorp/go-metrics"
+
+	"github.com/hashicorp/consul-dataplane/internal/cgroup"
+	"github.com/hashicorp/consul-dataplane/pkg/envoy"
+)
+
+// These are vars so that they can be overridden in tests.
+var (
+	cgroupCPULimit = cgroup.CPULimit
+	numCPU         = runtime.NumCPU
+)
+
+// envoyConcurrency returns the number of worker threads Envoy should be
+// started with. A --concurrency passed through the extra args takes
+// precedence, as it does when the options are merged. Otherwise, when
+// automatic concurrency is enabled it is derived from the CPUs available to
+// the dataplane, and the configured value is used if not.
+func (cdp *ConsulDataplane) envoyConcurrency() int {
+	cfg := cdp.cfg.Envoy
+
+	concurrency := cfg.EnvoyConcurrency
+	if opts, _, err := envoy.ParseArgs(cfg.ExtraArgs); err == nil && opts.Concurrency != nil {
+		concurrency = *opts.Concurrency
+		cdp.logger.Info("envoy concurrency set by extra args", "concurrency", concurrency)
+	} else if cfg.EnvoyConcurrencyAuto {
+		cpus, source := cdp.availableCPUs()
+		concurrency = autoConcurrency(cpus, cfg.EnvoyConcurrencyRatio, cfg.EnvoyConcurrencyMin, cfg.EnvoyConcurrencyMax)
+		cdp.logger.Info("derived envoy concurrency from available CPUs",
+			"concurrency", concurrency, "cpus", cpus, "source", source)
+	}
+
+	metrics.SetGauge([]string{"envoy_concurrency"}, float32(concurrency))
+	return concurrency
+}
+
+// availableCPUs returns the CPUs available according to the cgroup CPU quota
+// and cpuset, or the number of host CPUs when no cgroup limit applies, along
+// with which of the two was used.
+func (cdp *ConsulDataplane) availableCPUs() (float64, string) {
+	cpus, ok, err := cgroupCPULimit()
+	if err != nil {
+		cdp.logger.Warn("failed to read cgroup CPU limit", "error", err)
+	}
+	if ok {
+		return cpus, "cgroup"
+	}
+	return float64(numCPU()), "host"
+}
+
+// autoConcurrency scales cpus by ratio, rounding up so that fractional CPU
+// quotas still get a worker, and clamps the result to [minimum, maximum]. A
+// maximum of zero means no upper bound.
+func autoConcurrency(cpus, ratio float64, minimum, maximum int) int {
+	n := int(math.Ceil(cpus * ratio))
+	if maximum > 0 && n > maximum {
+		n = maximum
+	}
+	if n < minimum {
+		n = minimum
+	}
+	return n
+}
@@ -0,0 +1,90 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package consuldp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoConcurrency(t *testing.T) {
+	cases := map[string]struct {
+		cpus     float64
+		ratio    float64
+		min      int
+		max      int
+		expected int
+	}{
+		"fractional quota rounds up": {cpus: 0.25, ratio: 1, min: 1, expected: 1},
+		"whole cpus":                 {cpus: 4, ratio: 1, min: 1, expected: 4},
+		"ratio":                      {cpus: 4, ratio: 0.5, min: 1, expected: 2},
+		"ratio rounds up":            {cpus: 1.5, ratio: 2, min: 1, expected: 3},
+		"clamped to minimum":         {cpus: 0.25, ratio: 1, min: 2, expected: 2},
+		"clamped to maximum":         {cpus: 64, ratio: 1, min: 1, max: 16, expected: 16},
+		"no maximum":                 {cpus: 64, ratio: 1, min: 1, expected: 64},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, autoConcurrency(tc.cpus, tc.ratio, tc.min, tc.max))
+		})
+	}
+}
+
+func TestEnvoyConcurrency(t *testing.T) {
+	origCgroupCPULimit, origNumCPU := cgroupCPULimit, numCPU
+	t.Cleanup(func() { cgroupCPULimit, numCPU = origCgroupCPULimit, origNumCPU })
+	numCPU = func() int { return 8 }
+
+	cases := map[string]struct {
+		envoy    EnvoyConfig
+		cgroup   func() (float64, bool, error)
+		expected int
+	}{
+		"fixed": {
+			envoy:    EnvoyConfig{EnvoyConcurrency: 2},
+			cgroup:   func() (float64, bool, error) { return 4, true, nil },
+			expected: 2,
+		},
+		"auto from cgroup": {
+			envoy:    EnvoyConfig{EnvoyConcurrency: 2, EnvoyConcurrencyAuto: true, EnvoyConcurrencyMin: 1, EnvoyConcurrencyRatio: 1},
+			cgroup:   func() (float64, bool, error) { return 0.25, true, nil },
+			expected: 1,
+		},
+		"auto from host cpus": {
+			envoy:    EnvoyConfig{EnvoyConcurrencyAuto: true, EnvoyConcurrencyMin: 1, EnvoyConcurrencyMax: 6, EnvoyConcurrencyRatio: 1},
+			cgroup:   func() (float64, bool, error) { return 0, false, nil },
+			expected: 6,
+		},
+		"overridden by extra args": {
+			envoy:    EnvoyConfig{EnvoyConcurrencyAuto: true, EnvoyConcurrencyMin: 1, EnvoyConcurrencyRatio: 1, ExtraArgs: []string{"--concurrency=3"}},
+			cgroup:   func() (float64, bool, error) { return 0.25, true, nil },
+			expected: 3,
+		},
+		"fixed overridden by extra args": {
+			envoy:    EnvoyConfig{EnvoyConcurrency: 2, ExtraArgs: []string{"--concurrency", "5"}},
+			cgroup:   func() (float64, bool, error) { return 4, true, nil },
+			expected: 5,
+		},
+		"auto falls back to host cpus on error": {
+			envoy:    EnvoyConfig{EnvoyConcurrencyAuto: true, EnvoyConcurrencyMin: 1, EnvoyConcurrencyRatio: 0.5},
+			cgroup:   func() (float64, bool, error) { return 0, false, errors.New("boom") },
+			expected: 4,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cgroupCPULimit = tc.cgroup
+			cdp := &ConsulDataplane{
+				cfg:    &Config{Envoy: &tc.envoy},
+				logger: hclog.NewNullLogger(),
+			}
+			require.Equal(t, tc.expected, cdp.envoyConcurrency())
+		})
+	}
+}
@@ -38,6 +38,105 @@ type DNSServerConfig struct {
 	BindAddr string
 	// Port is the port which the DNS server will bind to.
 	Port int
+	// DisableCache disables caching the responses of Consul to DNS queries.
+	DisableCache bool
+	// CacheSize is the maximum number of cached DNS responses. If zero, a
+	// default of 10000 is used.
+	CacheSize int
+	// CacheMaxTTL caps how long DNS responses are cached. If zero, responses
+	// are cached for their TTL.
+	CacheMaxTTL time.Duration
+	// ServeStaleWindow is how long after they expire cached DNS responses are
+	// served if Consul can't be reached. If zero, a SERVFAIL response is sent
+	// instead.
+	ServeStaleWindow time.Duration
+	// Domain is the domain of the names resolved by Consul. If empty, the
+	// "consul" domain is used.
+	Domain string
+	// AltDomains are additional domains of the names resolved by Consul.
+	AltDomains []string
+	// Recursors are the addresses of the nameservers that DNS queries outside
+	// of Domain and AltDomains are forwarded to. If empty, every DNS query is
+	// forwarded to Consul.
+	Recursors []string
+	// ResolvConf is the path of a resolv.conf file that the recursors are read
+	// from if Recursors is empty.
+	ResolvConf string
+	// RecursorTimeout is the timeout of a DNS query to a recursor. If zero, a
+	// default of 2 seconds is used.
+	RecursorTimeout time.Duration
+	// DoTAddr is the host:port address of the DNS-over-TLS listener. If empty,
+	// DoT is disabled.
+	DoTAddr string
+	// DoHAddr is the host:port address of the DNS-over-HTTPS listener. If
+	// empty, DoH is disabled.
+	DoHAddr string
+	// DoHPath is the path of the DoH endpoint. If empty, "/dns-query" is used.
+	DoHPath string
+	// TLSCertFile is the path of the certificate of the DoT and DoH listeners.
+	// It's reloaded when it changes.
+	TLSCertFile string
+	// TLSKeyFile is the path of the private key of the DoT and DoH listeners.
+	// It's reloaded when it changes.
+	TLSKeyFile string
+	// UDPWorkers is the number of UDP DNS queries resolved concurrently. If
+	// zero, a default of 100 is used.
+	UDPWorkers int
+	// UDPQueueSize is the number of UDP DNS queries waiting for a worker. If
+	// zero, a default of 1000 is used.
+	UDPQueueSize int
+	// UDPDropPolicy decides what happens to UDP DNS queries when the queue is
+	// full: "drop-newest", "drop-oldest" or "servfail". If empty,
+	// "drop-newest" is used.
+	UDPDropPolicy string
+	// TCPIdleTimeout is the time a TCP DNS connection is kept open while the
+	// client sends no queries. If zero, a default of 5s is used.
+	TCPIdleTimeout time.Duration
+	// TCPMaxConns is the number of open TCP DNS connections, above which new
+	// connections are closed. If zero, a default of 1000 is used.
+	TCPMaxConns int
+	// QueryLog enables logging the DNS queries answered by the proxy.
+	QueryLog bool
+	// QueryLogFile is the path of the file the DNS queries are logged to as
+	// JSON lines. If empty, they're logged to the dataplane logger.
+	QueryLogFile string
+	// QueryLogMaxSize is the size in megabytes of the query log file, above
+	// which it's rotated. If zero, a default of 100 is used.
+	QueryLogMaxSize int
+	// QueryLogMaxFiles is the number of rotated query log files kept. If
+	// zero, a default of 5 is used.
+	QueryLogMaxFiles int
+	// QueryLogSampleRate is the share of the DNS queries logged, between 0
+	// and 1. If zero, every query is logged.
+	QueryLogSampleRate float64
+	// QueryLogNames are the domains of the names whose queries are logged. If
+	// empty, the queries of every name not in QueryLogExcludeNames are logged.
+	QueryLogNames []string
+	// QueryLogExcludeNames are the domains of the names whose queries aren't
+	// logged, which takes precedence over QueryLogNames.
+	QueryLogExcludeNames []string
+	// AllowCIDRs are the CIDRs of the clients allowed to query the DNS proxy.
+	// If empty, every client not in DenyCIDRs is allowed.
+	AllowCIDRs []string
+	// DenyCIDRs are the CIDRs of the clients denied by the DNS proxy, which
+	// takes precedence over AllowCIDRs.
+	DenyCIDRs []string
+	// RateLimit is the number of DNS queries per second allowed from each
+	// client IPv4 address or IPv6 /56 network. If zero, queries aren't rate
+	// limited.
+	RateLimit float64
+	// RateLimitBurst is the number of DNS queries a client can make at once.
+	// If zero, RateLimit rounded up is used.
+	RateLimitBurst int
+	// RateLimitAction decides what happens to the DNS queries of clients over
+	// their rate limit: "refuse" or "drop". If empty, "refuse" is used.
+	RateLimitAction string
+	// RRLRate is the number of identical UDP DNS responses per second sent to
+	// each client network. If zero, response rate limiting is disabled.
+	RRLRate float64
+	// RRLSlip is one in how many rate limited responses are sent truncated
+	// rather than dropped. If zero, a default of 2 is used.
+	RRLSlip int
 }
 
 // TLSConfig contains the TLS settings for communicating with Consul servers.
@@ -145,8 +244,46 @@ const (
 	// ModeTypeDNSProxy indicates that consul-dataplane is running in DNS Proxy
 	// mode where DNS Server is running but xDSServer and Envoy are disabled.
 	ModeTypeDNSProxy ModeType = "dns-proxy"
+	// ModeTypeMeshGateway indicates that consul-dataplane is running a mesh
+	// gateway, with the xDS Server, Envoy and DNS Server enabled.
+	ModeTypeMeshGateway ModeType = "mesh-gateway"
+	// ModeTypeIngressGateway indicates that consul-dataplane is running an
+	// ingress gateway, with the xDS Server, Envoy and DNS Server enabled.
+	ModeTypeIngressGateway ModeType = "ingress-gateway"
+	// ModeTypeTerminatingGateway indicates that consul-dataplane is running a
+	// terminating gateway, with the xDS Server, Envoy and DNS Server enabled.
+	ModeTypeTerminatingGateway ModeType = "terminating-gateway"
+	// ModeTypeAPIGateway indicates that consul-dataplane is running an API
+	// gateway, with the xDS Server, Envoy and DNS Server enabled.
+	ModeTypeAPIGateway ModeType = "api-gateway"
 )
 
+const (
+	// defaultGatewayReadyBindAddress and defaultGatewayReadyBindPort are where
+	// the Envoy readiness probe is served for gateways when not configured, so
+	// that it can be probed from outside the pod.
+	defaultGatewayReadyBindAddress = "0.0.0.0"
+	defaultGatewayReadyBindPort    = 21000
+)
+
+// IsGateway returns true if the mode runs one of the Consul gateways.
+func (m ModeType) IsGateway() bool {
+	switch m {
+	case ModeTypeMeshGateway, ModeTypeIngressGateway, ModeTypeTerminatingGateway, ModeTypeAPIGateway:
+		return true
+	}
+	return false
+}
+
+// runsEnvoy returns true if the mode runs the xDS Server and Envoy.
+func (m ModeType) runsEnvoy() bool {
+	return m == ModeTypeSidecar || m.IsGateway()
+}
+
+func (m ModeType) valid() bool {
+	return m == ModeTypeDNSProxy || m.runsEnvoy()
+}
+
 // StaticCredentialsConfig contains the static ACL token that will be used to
 // authenticate requests and streams to the Consul servers.
 type StaticCredentialsConfig struct {
@@ -247,6 +384,43 @@ type TelemetryConfig struct {
 	// Prometheus contains Prometheus-specific configuration that cannot be
 	// determined from central telemetry configuration.
 	Prometheus PrometheusTelemetryConfig
+	// OTLP contains configuration for exporting metrics over the OpenTelemetry
+	// protocol. Fields that are set take precedence over the equivalent central
+	// configuration.
+	OTLP OTLPTelemetryConfig
+	// StatsdURL is the URL of a statsd server that Envoy and Consul Dataplane
+	// send metrics to. It takes precedence over envoy_statsd_url in the
+	// central configuration.
+	StatsdURL string
+	// DogstatsdURL is the URL of a DogStatsD server that Envoy and Consul
+	// Dataplane send metrics to. It takes precedence over envoy_dogstatsd_url
+	// in the central configuration.
+	DogstatsdURL string
+	// StatsTags are "<name>=<value>" tags added to the metrics of Envoy and
+	// Consul Dataplane. They're merged with envoy_stats_tags in the central
+	// configuration, taking precedence for tags of the same name.
+	StatsTags []string
+	// MetricsCacheMaxSeries is the maximum number of distinct series cached
+	// until the metrics sinks are configured. If zero, a default is used.
+	MetricsCacheMaxSeries int
+}
+
+// OTLPTelemetryConfig contains OpenTelemetry (OTLP) metrics export config.
+type OTLPTelemetryConfig struct {
+	// Endpoint is the collector endpoint, either a host:port pair or a URL.
+	// Metrics are only exported over OTLP when an endpoint is configured.
+	Endpoint string
+	// Protocol is the OTLP transport, either "grpc" or "http/protobuf".
+	Protocol string
+	// Insecure disables TLS when connecting to the collector.
+	Insecure bool
+	// Headers are sent with every export request.
+	Headers map[string]string
+	// ExportInterval is the interval between exports.
+	ExportInterval time.Duration
+	// EnvoyStats enables periodically reading Envoy's stats from its admin API
+	// and exporting them over OTLP.
+	EnvoyStats bool
 }
 
 // PrometheusTelemetryConfig contains Prometheus-specific telemetry config.
@@ -268,10 +442,109 @@ type PrometheusTelemetryConfig struct {
 	// The metrics at this URL are scraped and merged into Consul Dataplane's
 	// main Prometheus metrics.
 	ServiceMetricsURL string
+	// ServiceMetricsTargets are additional application endpoints that serve
+	// Prometheus metrics. The metrics of every target are scraped and merged
+	// into Consul Dataplane's main Prometheus metrics.
+	ServiceMetricsTargets []ServiceMetricsTarget
 	// ScrapePath is the URL path where Envoy serves Prometheus metrics.
 	ScrapePath string
+	// BindAddr is the <ip>:<port> on which Envoy serves the merged Prometheus
+	// metrics, or on which Consul Dataplane serves its own metrics in
+	// dns-proxy mode. It takes precedence over envoy_prometheus_bind_addr in
+	// the central configuration.
+	BindAddr string
 	// MergePort is the port to server merged metrics.
 	MergePort int
+	// MergeBindAddr is the address to serve merged metrics on. If it has a
+	// "unix://" prefix, merged metrics are served on a unix socket at the
+	// given path and MergePort is ignored. If empty, merged metrics are served
+	// on every interface.
+	MergeBindAddr string
+	// DataplaneBindAddr is the address to serve Consul Dataplane's own metrics
+	// on before they're merged. It may also be a "unix://" socket path. If
+	// empty, they're served on the loopback address 127.0.0.1.
+	DataplaneBindAddr string
+	// DataplanePort is the port to serve Consul Dataplane's own metrics on. If
+	// zero, port 20101 is used.
+	DataplanePort int
+	// ServerTLS enables TLS on the merged and Consul Dataplane metrics servers,
+	// using CertFile and KeyFile.
+	ServerTLS bool
+	// ServerVerifyIncoming requires clients of the metrics servers to present
+	// a certificate signed by the CA in CACertsPath.
+	ServerVerifyIncoming bool
+	// ServerBearerToken is a bearer token that clients of the metrics servers
+	// must present.
+	ServerBearerToken string
+	// ServerBearerTokenPath is a path to a file containing the bearer token
+	// that clients of the metrics servers must present. The file is read on
+	// every request so that rotated tokens are picked up.
+	ServerBearerTokenPath string
+	// ScrapeTimeout is how long each source of the merged metrics is given to
+	// respond before it's omitted from the merged metrics. If zero, a default
+	// of 5s is used.
+	ScrapeTimeout time.Duration
+	// MergeCollisionMode controls how a metric family served by more than one
+	// source is merged, either "label" or "prefix". If empty, "label" is used.
+	MergeCollisionMode string
+	// ConstLabels are added to every merged metric that doesn't already have
+	// a label of the same name.
+	ConstLabels map[string]string
+	// Push configures periodically pushing the merged metrics, for workloads
+	// that Prometheus can't scrape.
+	Push PrometheusPushConfig
+}
+
+// PrometheusPushConfig configures pushing the merged metrics to a Pushgateway
+// or a Prometheus remote-write endpoint.
+type PrometheusPushConfig struct {
+	// URL is the base URL of the Pushgateway or the remote-write endpoint.
+	// Metrics are only pushed when a URL is configured.
+	URL string
+	// Protocol is either "pushgateway" or "remote-write". If empty,
+	// "pushgateway" is used.
+	Protocol string
+	// Interval is the interval between pushes. If zero, a default of 30s is
+	// used.
+	Interval time.Duration
+	// Job is the job grouping key of the pushed metrics. If empty,
+	// "consul-dataplane" is used.
+	Job string
+	// Instance is the instance grouping key of the pushed metrics. If empty,
+	// the hostname is used.
+	Instance string
+	// Headers are sent with every push request.
+	Headers map[string]string
+}
+
+// ServiceMetricsTarget is an application endpoint serving Prometheus metrics.
+type ServiceMetricsTarget struct {
+	// Name identifies the target in the source label of the merged metrics,
+	// and prefixes its metric families when they collide in "prefix" mode.
+	Name string
+	// URL is where the target serves Prometheus metrics.
+	URL string
+	// Headers are sent with every scrape request.
+	Headers map[string]string
+	// BearerTokenFile is a path to a file containing a bearer token to send
+	// with every scrape request. The file is read on every scrape so that
+	// rotated tokens are picked up.
+	BearerTokenFile string
+	// BasicAuthUsername is the username used to authenticate scrape requests
+	// with HTTP basic authentication.
+	BasicAuthUsername string
+	// BasicAuthPasswordFile is a path to a file containing the password used
+	// with BasicAuthUsername. The file is read on every scrape.
+	BasicAuthPasswordFile string
+	// TLS configures the client used to scrape the target. If nil, targets
+	// served over HTTPS are verified using the system CA certificates.
+	TLS *TLSConfig
+	// Timeout is how long the target is given to respond. If zero, the
+	// scrape timeout of the merged metrics is used.
+	Timeout time.Duration
+	// Labels are added to every metric scraped from the target that doesn't
+	// already have a label of the same name.
+	Labels map[string]string
 }
 
 // EnvoyConfig contains configuration for the Envoy process.
@@ -284,9 +557,24 @@ type EnvoyConfig struct {
 	// ReadyBindAddress is the address on which the Envoy readiness probe will be available.
 	ReadyBindAddress string
 	// ReadyBindPort is the port on which the Envoy readiness probe will be available.
+	// If -1, the readiness probe is disabled, including for gateways.
 	ReadyBindPort int
 	// EnvoyConcurrency is the envoy concurrency https://www.envoyproxy.io/docs/envoy/latest/operations/cli#cmdoption-concurrency
 	EnvoyConcurrency int
+	// EnvoyConcurrencyAuto derives the envoy concurrency from the CPUs
+	// available to the dataplane according to its cgroup CPU quota and cpuset,
+	// falling back to the number of host CPUs. EnvoyConcurrency is ignored
+	// when this is set.
+	EnvoyConcurrencyAuto bool
+	// EnvoyConcurrencyMin is the lower bound of the automatically derived
+	// envoy concurrency.
+	EnvoyConcurrencyMin int
+	// EnvoyConcurrencyMax is the upper bound of the automatically derived
+	// envoy concurrency. Zero means no upper bound.
+	EnvoyConcurrencyMax int
+	// EnvoyConcurrencyRatio is the number of worker threads per available CPU
+	// used to derive the envoy concurrency. The result is rounded up.
+	EnvoyConcurrencyRatio float64
 	// EnvoyDrainTime is the time in seconds for which Envoy will drain connections
 	// during a hot restart, when listeners are modified or removed via LDS, or when
 	// initiated manually via a request to the Envoy admin API.
@@ -318,6 +606,73 @@ type EnvoyConfig struct {
 	DumpEnvoyConfigOnExitEnabled bool
 	// ExtraArgs are the extra arguments passed to envoy at startup of the proxy
 	ExtraArgs []string
+	// StatsMatcher is the node-local default for the Envoy stats_matcher. It is
+	// only applied when central config does not set any of the
+	// envoy_stats_matcher_* keys.
+	StatsMatcher StatsMatcherConfig
+	// OverloadManager configures the Envoy overload manager.
+	OverloadManager EnvoyOverloadManagerConfig
+}
+
+// StatsMatcherConfig configures which Envoy stats are instantiated. Inclusion
+// and exclusion lists are mutually exclusive.
+// https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/metrics/v3/stats.proto#envoy-v3-api-msg-config-metrics-v3-statsmatcher
+type StatsMatcherConfig struct {
+	// InclusionPrefixes are stat name prefixes that will be included.
+	InclusionPrefixes []string
+	// InclusionSuffixes are stat name suffixes that will be included.
+	InclusionSuffixes []string
+	// InclusionRegexes are RE2 regular expressions for stat names that will be
+	// included.
+	InclusionRegexes []string
+	// ExclusionPrefixes are stat name prefixes that will be excluded.
+	ExclusionPrefixes []string
+	// ExclusionSuffixes are stat name suffixes that will be excluded.
+	ExclusionSuffixes []string
+	// ExclusionRegexes are RE2 regular expressions for stat names that will be
+	// excluded.
+	ExclusionRegexes []string
+}
+
+func (s StatsMatcherConfig) hasInclusions() bool {
+	return len(s.InclusionPrefixes) > 0 || len(s.InclusionSuffixes) > 0 || len(s.InclusionRegexes) > 0
+}
+
+func (s StatsMatcherConfig) hasExclusions() bool {
+	return len(s.ExclusionPrefixes) > 0 || len(s.ExclusionSuffixes) > 0 || len(s.ExclusionRegexes) > 0
+}
+
+// EnvoyOverloadManagerConfig configures the resource monitors and actions of
+// the Envoy overload manager.
+// https://www.envoyproxy.io/docs/envoy/latest/configuration/operations/overload_manager/overload_manager
+type EnvoyOverloadManagerConfig struct {
+	// Enabled renders the overload manager into the Envoy bootstrap config.
+	Enabled bool
+	// MaxHeapSizeBytes is the heap size at which Envoy is considered
+	// saturated. When zero it is derived from the cgroup v2 memory limit of
+	// the dataplane, if one is present.
+	MaxHeapSizeBytes int
+	// ShrinkHeapThreshold is the fraction of MaxHeapSizeBytes at which Envoy
+	// will release free memory back to the system. Zero disables the action.
+	ShrinkHeapThreshold float64
+	// StopAcceptingRequestsThreshold is the fraction of MaxHeapSizeBytes at
+	// which Envoy will reject new requests. Zero disables the action.
+	StopAcceptingRequestsThreshold float64
+	// StopAcceptingConnectionsThreshold is the fraction of MaxHeapSizeBytes at
+	// which Envoy will stop accepting new connections. Zero disables the action.
+	StopAcceptingConnectionsThreshold float64
+	// MaxDownstreamConnections is the maximum number of active downstream
+	// connections across all listeners. Zero means no limit.
+	MaxDownstreamConnections int
+}
+
+func (o EnvoyOverloadManagerConfig) validThresholds() bool {
+	for _, t := range []float64{o.ShrinkHeapThreshold, o.StopAcceptingRequestsThreshold, o.StopAcceptingConnectionsThreshold} {
+		if t < 0 || t > 1 {
+			return false
+		}
+	}
+	return true
 }
 
 // XDSServer contains the configuration of the xDS server.
@@ -10,15 +10,18 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/netip"
 	"strings"
+	"sync"
 
-	"github.com/hashicorp/go-metrics"
 	"github.com/hashicorp/consul-server-connection-manager/discovery"
 	"github.com/hashicorp/consul/proto-public/pbdataplane"
 	"github.com/hashicorp/consul/proto-public/pbdns"
 	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-metrics"
 	"google.golang.org/grpc"
 
+	"github.com/hashicorp/consul-dataplane/internal/bootstrap"
 	"github.com/hashicorp/consul-dataplane/pkg/dns"
 	"github.com/hashicorp/consul-dataplane/pkg/envoy"
 	metricscache "github.com/hashicorp/consul-dataplane/pkg/metrics-cache"
@@ -33,6 +36,7 @@ type xdsServer struct {
 }
 
 type httpClient interface {
+	Do(*http.Request) (*http.Response, error)
 	Get(string) (*http.Response, error)
 	Post(string, string, io.Reader) (*http.Response, error)
 }
@@ -45,6 +49,10 @@ type ConsulDataplane struct {
 	dpServiceClient pbdataplane.DataplaneServiceClient
 	xdsServer       *xdsServer
 	aclToken        string
+
+	// mu guards metricsConfig and lifecycleConfig, which are set by Run and
+	// read by GracefulShutdown when a shutdown signal arrives.
+	mu              sync.Mutex
 	metricsConfig   *metricsConfig
 	lifecycleConfig *lifecycleConfig
 }
@@ -77,26 +85,89 @@ func validateConfig(cfg *Config) error {
 		return errors.New("consul addresses not specified")
 	case cfg.Consul.GRPCPort == 0:
 		return errors.New("consul server gRPC port not specified")
-	case cfg.Mode == ModeTypeSidecar && cfg.Proxy == nil:
+	case !cfg.Mode.valid():
+		return fmt.Errorf("unsupported mode %q", cfg.Mode)
+	case cfg.Mode.runsEnvoy() && cfg.Proxy == nil:
 		return errors.New("proxy details not specified")
-	case cfg.Mode == ModeTypeSidecar && cfg.Proxy.ProxyID == "":
+	case cfg.Mode.runsEnvoy() && cfg.Proxy.ProxyID == "":
 		return errors.New("proxy ID not specified")
-	case cfg.Mode == ModeTypeSidecar && cfg.Envoy == nil:
+	case cfg.Mode.runsEnvoy() && cfg.Envoy == nil:
 		return errors.New("envoy settings not specified")
-	case cfg.Mode == ModeTypeSidecar && cfg.Envoy.AdminBindAddress == "":
+	case cfg.Mode.runsEnvoy() && cfg.Envoy.AdminBindAddress == "":
 		return errors.New("envoy admin bind address not specified")
-	case cfg.Mode == ModeTypeSidecar && cfg.Envoy.AdminBindPort == 0:
+	case cfg.Mode.runsEnvoy() && cfg.Envoy.AdminBindPort == 0:
 		return errors.New("envoy admin bind port not specified")
 	case cfg.Logging == nil:
 		return errors.New("logging settings not specified")
-	case cfg.Mode == ModeTypeSidecar && cfg.XDSServer.BindAddress == "":
+	case cfg.Mode.runsEnvoy() && cfg.XDSServer.BindAddress == "":
 		return errors.New("envoy xDS bind address not specified")
-	case cfg.Mode == ModeTypeSidecar && !strings.HasPrefix(cfg.XDSServer.BindAddress, "unix://") && !net.ParseIP(cfg.XDSServer.BindAddress).IsLoopback():
+	case cfg.Mode.IsGateway() && !strings.HasPrefix(cfg.XDSServer.BindAddress, "unix://") && !isLoopbackOrUnspecified(cfg.XDSServer.BindAddress):
+		return errors.New("xDS bind address must be a loopback or wildcard address when running as a gateway")
+	case !cfg.Mode.IsGateway() && cfg.Mode.runsEnvoy() && !strings.HasPrefix(cfg.XDSServer.BindAddress, "unix://") && !net.ParseIP(cfg.XDSServer.BindAddress).IsLoopback():
 		return errors.New("non-local xDS bind address not allowed")
+	case cfg.Mode.runsEnvoy() && cfg.Envoy.StatsMatcher.hasInclusions() && cfg.Envoy.StatsMatcher.hasExclusions():
+		return errors.New("envoy stats matcher inclusions and exclusions are mutually exclusive")
+	case cfg.Mode.runsEnvoy() && cfg.Envoy.EnvoyConcurrencyAuto && cfg.Envoy.EnvoyConcurrencyMin < 1:
+		return errors.New("envoy concurrency minimum must be at least 1")
+	case cfg.Mode.runsEnvoy() && cfg.Envoy.EnvoyConcurrencyAuto && cfg.Envoy.EnvoyConcurrencyMax != 0 && cfg.Envoy.EnvoyConcurrencyMax < cfg.Envoy.EnvoyConcurrencyMin:
+		return errors.New("envoy concurrency maximum must not be less than the minimum")
+	case cfg.Mode.runsEnvoy() && cfg.Envoy.EnvoyConcurrencyAuto && cfg.Envoy.EnvoyConcurrencyRatio <= 0:
+		return errors.New("envoy concurrency ratio must be greater than 0")
+	case cfg.Mode.runsEnvoy() && cfg.Envoy.OverloadManager.Enabled && !cfg.Envoy.OverloadManager.validThresholds():
+		return errors.New("envoy overload manager thresholds must be between 0 and 1")
+	case cfg.Mode.runsEnvoy() && cfg.Envoy.OverloadManager.Enabled && (cfg.Envoy.OverloadManager.MaxHeapSizeBytes < 0 || cfg.Envoy.OverloadManager.MaxDownstreamConnections < 0):
+		return errors.New("envoy overload manager limits must not be negative")
 	case cfg.Mode == ModeTypeSidecar && cfg.DNSServer.Port != -1 && !net.ParseIP(cfg.DNSServer.BindAddr).IsLoopback():
 		return errors.New("non-local DNS proxy bind address not allowed when running as a sidecar")
+	case cfg.Mode.IsGateway() && cfg.DNSServer.Port != -1 && !isLoopbackOrUnspecified(cfg.DNSServer.BindAddr):
+		return errors.New("DNS proxy bind address must be a loopback or wildcard address when running as a gateway")
 	case cfg.Mode == ModeTypeDNSProxy && cfg.Proxy != nil && (cfg.Proxy.Namespace != "" && cfg.Proxy.Namespace != "default"):
 		return errors.New("namespace must be empty or set to 'default' when running in dns-proxy mode")
+	case cfg.DNSServer.CacheSize < 0:
+		return errors.New("-consul-dns-cache-size must not be negative")
+	case cfg.DNSServer.CacheMaxTTL < 0:
+		return errors.New("-consul-dns-cache-max-ttl must not be negative")
+	case cfg.DNSServer.ServeStaleWindow < 0:
+		return errors.New("-consul-dns-serve-stale-window must not be negative")
+	case cfg.DNSServer.ServeStaleWindow > 0 && cfg.DNSServer.DisableCache:
+		return errors.New("-consul-dns-serve-stale-window requires the DNS cache, which is disabled by -consul-dns-disable-cache")
+	case cfg.DNSServer.RecursorTimeout < 0:
+		return errors.New("-consul-dns-recursor-timeout must not be negative")
+	case cfg.DNSServer.UDPWorkers < 0:
+		return errors.New("-consul-dns-udp-workers must not be negative")
+	case cfg.DNSServer.UDPQueueSize < 0:
+		return errors.New("-consul-dns-udp-queue-size must not be negative")
+	case !validUDPDropPolicy(cfg.DNSServer.UDPDropPolicy):
+		return fmt.Errorf("-consul-dns-udp-drop-policy must be one of %q, %q or %q",
+			dns.DropPolicyNewest, dns.DropPolicyOldest, dns.DropPolicyServfail)
+	case cfg.DNSServer.TCPIdleTimeout < 0:
+		return errors.New("-consul-dns-tcp-idle-timeout must not be negative")
+	case cfg.DNSServer.TCPMaxConns < 0:
+		return errors.New("-consul-dns-tcp-max-connections must not be negative")
+	case cfg.DNSServer.QueryLogMaxSize < 0:
+		return errors.New("-consul-dns-query-log-max-size must not be negative")
+	case cfg.DNSServer.QueryLogMaxFiles < 0:
+		return errors.New("-consul-dns-query-log-max-files must not be negative")
+	case cfg.DNSServer.QueryLogSampleRate < 0 || cfg.DNSServer.QueryLogSampleRate > 1:
+		return errors.New("-consul-dns-query-log-sample-rate must be between 0 and 1")
+	case cfg.DNSServer.RateLimit < 0:
+		return errors.New("-consul-dns-rate-limit must not be negative")
+	case cfg.DNSServer.RateLimitBurst < 0:
+		return errors.New("-consul-dns-rate-limit-burst must not be negative")
+	case !validRateLimitAction(cfg.DNSServer.RateLimitAction):
+		return fmt.Errorf("-consul-dns-rate-limit-action must be one of %q or %q",
+			dns.RateLimitActionRefuse, dns.RateLimitActionDrop)
+	case cfg.DNSServer.RRLRate < 0:
+		return errors.New("-consul-dns-rrl-rate must not be negative")
+	case cfg.DNSServer.RRLSlip < 0:
+		return errors.New("-consul-dns-rrl-slip must not be negative")
+	}
+
+	if err := validateDNSClientCIDRs(cfg.DNSServer); err != nil {
+		return err
+	}
+	if err := validateEncryptedDNSConfig(cfg); err != nil {
+		return err
 	}
 
 	creds := cfg.Consul.Credentials
@@ -114,6 +185,36 @@ func validateConfig(cfg *Config) error {
 			}
 		}
 
+		if prom.ServerTLS && (prom.CertFile == "" || prom.KeyFile == "") {
+			return errors.New("-telemetry-prom-server-tls requires -telemetry-prom-cert-file and -telemetry-prom-key-file")
+		}
+
+		if prom.ServerVerifyIncoming && !prom.ServerTLS {
+			return errors.New("-telemetry-prom-server-verify-incoming requires -telemetry-prom-server-tls")
+		}
+
+		if prom.ServerBearerToken != "" && prom.ServerBearerTokenPath != "" {
+			return errors.New("only one of -telemetry-prom-server-bearer-token or -telemetry-prom-server-bearer-token-path may be set")
+		}
+
+		if !validMetricsBindAddr(prom.MergeBindAddr) {
+			return fmt.Errorf("invalid -telemetry-prom-merge-bind-addr %q", prom.MergeBindAddr)
+		}
+
+		if !validMetricsBindAddr(prom.DataplaneBindAddr) {
+			return fmt.Errorf("invalid -telemetry-prom-dataplane-bind-addr %q", prom.DataplaneBindAddr)
+		}
+
+		if prom.DataplanePort < 0 || prom.DataplanePort > 65535 {
+			return errors.New("-telemetry-prom-dataplane-port must be between 0 and 65535")
+		}
+
+		if prom.BindAddr != "" {
+			if _, _, err := net.SplitHostPort(prom.BindAddr); err != nil {
+				return fmt.Errorf("invalid -telemetry-prom-bind-addr %q: %w", prom.BindAddr, err)
+			}
+		}
+
 		if prom.RetentionTime <= 0 {
 			return errors.New("-telemetry-prom-retention-time must be greater than zero")
 		}
@@ -121,11 +222,144 @@ func validateConfig(cfg *Config) error {
 		if prom.ScrapePath == "" {
 			return errors.New("-telemetry-prom-scrape-path must not be empty")
 		}
+
+		if prom.ScrapeTimeout < 0 {
+			return errors.New("-telemetry-prom-scrape-timeout must not be negative")
+		}
+
+		if prom.MergeCollisionMode != "" && !validMergeCollisionMode(prom.MergeCollisionMode) {
+			return fmt.Errorf("-telemetry-prom-merge-collision-mode must be one of %q or %q", MergeCollisionModeLabel, MergeCollisionModePrefix)
+		}
+
+		for name := range prom.ConstLabels {
+			if !validConstLabelName(name) {
+				return fmt.Errorf("invalid -telemetry-prom-const-label name %q", name)
+			}
+		}
+
+		// Gateways don't run alongside an application whose metrics could be
+		// merged.
+		if cfg.Mode.IsGateway() && prom.ServiceMetricsURL != "" {
+			return errors.New("-telemetry-prom-service-metrics-url is not supported when running as a gateway")
+		}
+		if cfg.Mode.IsGateway() && len(prom.ServiceMetricsTargets) > 0 {
+			return errors.New("-telemetry-prom-service-metrics-target is not supported when running as a gateway")
+		}
+
+		if err := validateServiceMetricsTargets(prom); err != nil {
+			return err
+		}
+
+		if err := validatePushConfig(prom.Push); err != nil {
+			return err
+		}
+
+		otlp := cfg.Telemetry.OTLP
+		if otlp.Protocol != "" && !validOTLPProtocol(otlp.Protocol) {
+			return fmt.Errorf("-telemetry-otlp-protocol must be one of %q or %q", OTLPProtocolGRPC, OTLPProtocolHTTP)
+		}
+
+		if otlp.ExportInterval < 0 {
+			return errors.New("-telemetry-otlp-export-interval must not be negative")
+		}
+
+		if url := cfg.Telemetry.StatsdURL; url != "" {
+			if _, err := parseSinkAddr(url, Statsd); err != nil {
+				return fmt.Errorf("invalid -telemetry-statsd-url: %w", err)
+			}
+		}
+
+		if url := cfg.Telemetry.DogstatsdURL; url != "" {
+			if _, err := parseSinkAddr(url, Dogstatsd); err != nil {
+				return fmt.Errorf("invalid -telemetry-dogstatsd-url: %w", err)
+			}
+		}
+
+		if cfg.Telemetry.MetricsCacheMaxSeries < 0 {
+			return errors.New("-telemetry-metrics-cache-max-series must not be negative")
+		}
+	}
+
+	return nil
+}
+
+// validUDPDropPolicy returns whether a drop policy of the DNS proxy is
+// valid, which it is if empty.
+func validUDPDropPolicy(policy string) bool {
+	switch policy {
+	case "", dns.DropPolicyNewest, dns.DropPolicyOldest, dns.DropPolicyServfail:
+		return true
+	}
+	return false
+}
+
+// validRateLimitAction returns whether a rate limit action of the DNS proxy
+// is valid, which it is if empty.
+func validRateLimitAction(action string) bool {
+	switch action {
+	case "", dns.RateLimitActionRefuse, dns.RateLimitActionDrop:
+		return true
+	}
+	return false
+}
+
+// validateDNSClientCIDRs validates the CIDRs of the clients allowed and
+// denied by the DNS proxy.
+func validateDNSClientCIDRs(dnsCfg *DNSServerConfig) error {
+	lists := []struct {
+		flag  string
+		cidrs []string
+	}{
+		{"-consul-dns-allow-cidr", dnsCfg.AllowCIDRs},
+		{"-consul-dns-deny-cidr", dnsCfg.DenyCIDRs},
+	}
+	for _, l := range lists {
+		for _, cidr := range l.cidrs {
+			if _, err := netip.ParsePrefix(cidr); err != nil {
+				return fmt.Errorf("%s %q is not a valid CIDR: %w", l.flag, cidr, err)
+			}
+		}
 	}
+	return nil
+}
 
+// validateEncryptedDNSConfig validates the DoT and DoH listeners of the DNS
+// proxy, whose addresses are restricted like the address of the DNS proxy.
+func validateEncryptedDNSConfig(cfg *Config) error {
+	dnsCfg := cfg.DNSServer
+	listeners := []struct{ flag, addr string }{
+		{"-consul-dns-dot-addr", dnsCfg.DoTAddr},
+		{"-consul-dns-doh-addr", dnsCfg.DoHAddr},
+	}
+	for _, l := range listeners {
+		if l.addr == "" {
+			continue
+		}
+		host, _, err := net.SplitHostPort(l.addr)
+		if err != nil {
+			return fmt.Errorf("%s must be formatted as <host>:<port>: %w", l.flag, err)
+		}
+		switch {
+		case dnsCfg.Port == -1:
+			return fmt.Errorf("%s requires the DNS proxy, which is disabled by -consul-dns-bind-port", l.flag)
+		case dnsCfg.TLSCertFile == "" || dnsCfg.TLSKeyFile == "":
+			return fmt.Errorf("%s requires -consul-dns-tls-cert-file and -consul-dns-tls-key-file", l.flag)
+		case cfg.Mode == ModeTypeSidecar && !net.ParseIP(host).IsLoopback():
+			return fmt.Errorf("non-local %s not allowed when running as a sidecar", l.flag)
+		case cfg.Mode.IsGateway() && host != "" && !isLoopbackOrUnspecified(host):
+			return fmt.Errorf("%s must be a loopback or wildcard address when running as a gateway", l.flag)
+		}
+	}
 	return nil
 }
 
+// isLoopbackOrUnspecified returns true if addr is a loopback address or a
+// wildcard address such as 0.0.0.0 or ::.
+func isLoopbackOrUnspecified(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip.IsLoopback() || ip.IsUnspecified()
+}
+
 func (cdp *ConsulDataplane) Run(ctx context.Context) error {
 	ctx = hclog.WithContext(ctx, cdp.logger)
 	cdp.logger.Info("started consul-dataplane process")
@@ -135,13 +369,19 @@ func (cdp *ConsulDataplane) Run(ctx context.Context) error {
 	// that the consumer wants metrics enabled. Until then we will set our own light weight metrics
 	// sink. If consumer doesn't enable the metrics the sink will set a blackhole sink. Otherwise
 	// it will swap to the newly configured prometheus/dogstatsD/statsD sink.
-	cacheSink := metricscache.NewSink()
+	var maxSeries int
+	if cdp.cfg.Telemetry != nil {
+		maxSeries = cdp.cfg.Telemetry.MetricsCacheMaxSeries
+	}
+	cacheSink := metricscache.NewSinkWithMaxSeries(maxSeries)
 	conf := metrics.DefaultConfig("")
 	conf.EnableHostname = false
 	_, err := metrics.NewGlobal(conf, cacheSink)
 	if err != nil {
 		return err
 	}
+	// Flush the configured sinks, or drop the cache if they were never set.
+	defer cacheSink.Shutdown()
 
 	tls, err := cdp.cfg.Consul.TLS.Load()
 	if err != nil {
@@ -190,15 +430,23 @@ func (cdp *ConsulDataplane) Run(ctx context.Context) error {
 			cdp.logger.Error("failed to start the dns proxy", "error", err)
 			return err
 		}
+		if err = cdp.startDNSProxyMetrics(ctx, cacheSink); err != nil {
+			cdp.logger.Error("failed to start metrics", "error", err)
+			return err
+		}
 		// Wait for context to be done in a more simplified goroutine dns-proxy mode.
 		go func() {
-			<-ctx.Done()
-			doneCh <- nil
+			select {
+			case <-ctx.Done():
+				doneCh <- nil
+			case <-cdp.metricsConfig.metricsServerExited():
+				doneCh <- errors.New("metrics server exited unexpectedly")
+			}
 		}()
 		return <-doneCh
 	}
 
-	// Configure xDS and Envoy configuration continues here when running in sidecar mode.
+	// Configure xDS and Envoy configuration continues here when running in sidecar or gateway mode.
 	cdp.logger.Info("configuring xDS and Envoy")
 	err = cdp.setupXDSServer()
 	if err != nil {
@@ -238,13 +486,18 @@ func (cdp *ConsulDataplane) Run(ctx context.Context) error {
 		return fmt.Errorf("failed to run proxy: %w", err)
 	}
 
-	cdp.metricsConfig = NewMetricsConfig(cdp.cfg, cacheSink)
+	cdp.setMetricsConfig(NewMetricsConfig(cdp.cfg, cacheSink))
+	cdp.metricsConfig.otlpResource = otlpResource(bootstrapParams)
 	err = cdp.metricsConfig.startMetrics(ctx, bootstrapCfg)
 	if err != nil {
 		return err
 	}
 
-	cdp.lifecycleConfig = NewLifecycleConfig(cdp.cfg, proxy)
+	lifecycleConfig := NewLifecycleConfig(cdp.cfg, proxy)
+	lifecycleConfig.flushMetrics = cdp.metricsConfig.flushPushedMetrics
+	cdp.mu.Lock()
+	cdp.lifecycleConfig = lifecycleConfig
+	cdp.mu.Unlock()
 	if err = cdp.lifecycleConfig.startLifecycleManager(ctx); err != nil {
 		cdp.logger.Error("failed to start lifecycle manager", "error", err)
 		return err
@@ -298,6 +551,48 @@ func (cdp *ConsulDataplane) startDNSProxy(ctx context.Context,
 		Partition: partition,
 		Namespace: namespace,
 		Token:     cdp.aclToken,
+
+		DisableCache: dnsConfig.DisableCache,
+		CacheSize:    dnsConfig.CacheSize,
+		CacheMaxTTL:  dnsConfig.CacheMaxTTL,
+
+		ServeStaleWindow: dnsConfig.ServeStaleWindow,
+
+		Domains:         dnsDomains(dnsConfig),
+		Recursors:       dnsConfig.Recursors,
+		ResolvConf:      dnsConfig.ResolvConf,
+		RecursorTimeout: dnsConfig.RecursorTimeout,
+
+		DoTAddr:     dnsConfig.DoTAddr,
+		DoHAddr:     dnsConfig.DoHAddr,
+		DoHPath:     dnsConfig.DoHPath,
+		TLSCertFile: dnsConfig.TLSCertFile,
+		TLSKeyFile:  dnsConfig.TLSKeyFile,
+
+		UDPWorkers:    dnsConfig.UDPWorkers,
+		UDPQueueSize:  dnsConfig.UDPQueueSize,
+		UDPDropPolicy: dnsConfig.UDPDropPolicy,
+
+		TCPIdleTimeout: dnsConfig.TCPIdleTimeout,
+		TCPMaxConns:    dnsConfig.TCPMaxConns,
+
+		QueryLog: dns.QueryLogParams{
+			Enabled:      dnsConfig.QueryLog,
+			File:         dnsConfig.QueryLogFile,
+			MaxSize:      dnsConfig.QueryLogMaxSize,
+			MaxFiles:     dnsConfig.QueryLogMaxFiles,
+			SampleRate:   dnsConfig.QueryLogSampleRate,
+			Names:        dnsConfig.QueryLogNames,
+			ExcludeNames: dnsConfig.QueryLogExcludeNames,
+		},
+
+		AllowCIDRs:      dnsConfig.AllowCIDRs,
+		DenyCIDRs:       dnsConfig.DenyCIDRs,
+		RateLimit:       dnsConfig.RateLimit,
+		RateLimitBurst:  dnsConfig.RateLimitBurst,
+		RateLimitAction: dnsConfig.RateLimitAction,
+		RRLRate:         dnsConfig.RRLRate,
+		RRLSlip:         dnsConfig.RRLSlip,
 	})
 	if err == dns.ErrServerDisabled {
 		cdp.logger.Info("dns server disabled: configure the Consul DNS port to enable")
@@ -311,29 +606,45 @@ func (cdp *ConsulDataplane) startDNSProxy(ctx context.Context,
 	return nil
 }
 
-func (cdp *ConsulDataplane) envoyProxyConfig(cfg []byte) envoy.ProxyConfig {
-	extraArgs := cdp.cfg.Envoy.ExtraArgs
-
-	envoyArgs := map[string]interface{}{
-		"--concurrency":    cdp.cfg.Envoy.EnvoyConcurrency,
-		"--drain-time-s":   cdp.cfg.Envoy.EnvoyDrainTimeSeconds,
-		"--drain-strategy": cdp.cfg.Envoy.EnvoyDrainStrategy,
-	}
-
-	// Users could set the Envoy concurrency, drain time, or drain strategy as
-	// extra args. Prioritize values set in that way over passthrough or defaults
-	// from consul-dataplane.
-	for envoyArg, cdpEnvoyValue := range envoyArgs {
-		for _, v := range extraArgs {
-			// If found in extraArgs, skip setting value from consul-dataplane Envoy
-			// config
-			if v == envoyArg {
-				break
-			}
-		}
+// dnsDomains returns the domains of the names resolved by Consul.
+func dnsDomains(cfg *DNSServerConfig) []string {
+	domain := cfg.Domain
+	if domain == "" {
+		domain = dns.DefaultDomain
+	}
+	return append([]string{domain}, cfg.AltDomains...)
+}
 
-		// If not found, append value from consul-dataplane Envoy config to extraArgs
-		extraArgs = append(extraArgs, fmt.Sprintf("%s %v", envoyArg, cdpEnvoyValue))
+// startDNSProxyMetrics starts the metrics of a DNS proxy. There's no Envoy
+// bootstrap config in dns-proxy mode, so metrics are only configured locally.
+func (cdp *ConsulDataplane) startDNSProxyMetrics(ctx context.Context, cacheSink *metricscache.Sink) error {
+	cdp.setMetricsConfig(NewMetricsConfig(cdp.cfg, cacheSink))
+	if cdp.cfg.Telemetry == nil {
+		cdp.metricsConfig.cacheSink.SetSink(&metrics.BlackholeSink{})
+		return nil
+	}
+
+	cdp.metricsConfig.otlpResource = otlpResource(&pbdataplane.GetEnvoyBootstrapParamsResponse{
+		Service:   dnsProxyServiceName,
+		NodeName:  cdp.cfg.Proxy.NodeName,
+		Namespace: cdp.cfg.Proxy.Namespace,
+		Partition: cdp.cfg.Proxy.Partition,
+	})
+	var bcfg bootstrap.BootstrapConfig
+	applyLocalTelemetryConfig(&bcfg, cdp.cfg.Telemetry)
+	return cdp.metricsConfig.startMetrics(ctx, &bcfg)
+}
+
+func (cdp *ConsulDataplane) envoyProxyConfig(cfg []byte) envoy.ProxyConfig {
+	concurrency := cdp.envoyConcurrency()
+	drainTimeSeconds := cdp.cfg.Envoy.EnvoyDrainTimeSeconds
+
+	// Users could also set these options as extra args, in which case the
+	// envoy package gives precedence to the extra args.
+	opts := envoy.Options{
+		Concurrency:      &concurrency,
+		DrainTimeSeconds: &drainTimeSeconds,
+		DrainStrategy:    cdp.cfg.Envoy.EnvoyDrainStrategy,
 	}
 
 	return envoy.ProxyConfig{
@@ -343,16 +654,37 @@ func (cdp *ConsulDataplane) envoyProxyConfig(cfg []byte) envoy.ProxyConfig {
 		LogJSON:         cdp.cfg.Logging.LogJSON,
 		BootstrapConfig: cfg,
 		ExecutablePath:  cdp.cfg.Envoy.ExecutablePath,
-		ExtraArgs:       extraArgs,
+		Options:         opts,
+		ExtraArgs:       cdp.cfg.Envoy.ExtraArgs,
+
+		// Gateway listeners aren't marked as inbound, and a gateway may not
+		// have any listeners until routes or services are bound to it.
+		DrainAllListeners:     cdp.cfg.Mode.IsGateway(),
+		ReadyWithoutListeners: cdp.cfg.Mode.IsGateway(),
 	}
 }
 
+// setMetricsConfig sets the metrics config, which GracefulShutdown may read
+// concurrently.
+func (cdp *ConsulDataplane) setMetricsConfig(m *metricsConfig) {
+	cdp.mu.Lock()
+	defer cdp.mu.Unlock()
+	cdp.metricsConfig = m
+}
+
 func (cdp *ConsulDataplane) GracefulShutdown(cancel context.CancelFunc) {
+	cdp.mu.Lock()
+	metricsConfig, lifecycleConfig := cdp.metricsConfig, cdp.lifecycleConfig
+	cdp.mu.Unlock()
+
 	// If proxy lifecycle manager has not been initialized, cancel parent context and
 	// proceed to exit rather than attempting graceful shutdown
-	if cdp.lifecycleConfig != nil {
-		cdp.lifecycleConfig.gracefulShutdown()
+	if lifecycleConfig != nil {
+		lifecycleConfig.gracefulShutdown()
 	} else {
+		if metricsConfig != nil {
+			metricsConfig.flushPushedMetrics()
+		}
 		cancel()
 	}
 }
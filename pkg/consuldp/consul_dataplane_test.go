@@ -4,6 +4,7 @@
 package consuldp
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -153,6 +154,354 @@ func TestNewConsulDPError(t *testing.T) {
 			modFn:     func(c *Config) { c.Telemetry.Prometheus.RetentionTime = 0 },
 			expectErr: "-telemetry-prom-retention-time must be greater than zero",
 		},
+		{
+			name: "sidecar mode - metrics server tls without cert",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.CACertsPath = ""
+				c.Telemetry.Prometheus.CertFile = ""
+				c.Telemetry.Prometheus.KeyFile = ""
+				c.Telemetry.Prometheus.ServerTLS = true
+			},
+			expectErr: "-telemetry-prom-server-tls requires -telemetry-prom-cert-file and -telemetry-prom-key-file",
+		},
+		{
+			name: "sidecar mode - metrics server verify incoming without tls",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ServerVerifyIncoming = true
+			},
+			expectErr: "-telemetry-prom-server-verify-incoming requires -telemetry-prom-server-tls",
+		},
+		{
+			name: "sidecar mode - metrics server bearer token and path",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ServerBearerToken = "token"
+				c.Telemetry.Prometheus.ServerBearerTokenPath = "/token"
+			},
+			expectErr: "only one of -telemetry-prom-server-bearer-token or -telemetry-prom-server-bearer-token-path may be set",
+		},
+		{
+			name: "sidecar mode - invalid merge bind address",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.MergeBindAddr = "localhost:20100"
+			},
+			expectErr: `invalid -telemetry-prom-merge-bind-addr "localhost:20100"`,
+		},
+		{
+			name: "sidecar mode - invalid dataplane metrics bind address",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.DataplaneBindAddr = "unix://"
+			},
+			expectErr: `invalid -telemetry-prom-dataplane-bind-addr "unix://"`,
+		},
+		{
+			name: "sidecar mode - invalid dataplane metrics port",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.DataplanePort = 70000
+			},
+			expectErr: "-telemetry-prom-dataplane-port must be between 0 and 65535",
+		},
+		{
+			name:      "sidecar mode - invalid otlp protocol",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.Telemetry.OTLP.Protocol = "http/json" },
+			expectErr: `-telemetry-otlp-protocol must be one of "grpc" or "http/protobuf"`,
+		},
+		{
+			name:      "sidecar mode - negative otlp export interval",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.Telemetry.OTLP.ExportInterval = -time.Second },
+			expectErr: "-telemetry-otlp-export-interval must not be negative",
+		},
+		{
+			name:      "sidecar mode - invalid prometheus bind addr",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.Telemetry.Prometheus.BindAddr = "0.0.0.0" },
+			expectErr: `invalid -telemetry-prom-bind-addr "0.0.0.0": address 0.0.0.0: missing port in address`,
+		},
+		{
+			name:      "sidecar mode - invalid statsd url",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.Telemetry.StatsdURL = "unix:///var/run/statsd.sock" },
+			expectErr: "invalid -telemetry-statsd-url: unsupported addr: unix:///var/run/statsd.sock for sink type: statsD",
+		},
+		{
+			name:      "sidecar mode - invalid dogstatsd url",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.Telemetry.DogstatsdURL = "tcp://127.0.0.1:8125" },
+			expectErr: "invalid -telemetry-dogstatsd-url: unsupported addr: tcp://127.0.0.1:8125 for sink type: dogstatsD",
+		},
+		{
+			name:      "sidecar mode - negative metrics cache max series",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.Telemetry.MetricsCacheMaxSeries = -1 },
+			expectErr: "-telemetry-metrics-cache-max-series must not be negative",
+		},
+		{
+			name:      "sidecar mode - negative dns cache size",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.DNSServer.CacheSize = -1 },
+			expectErr: "-consul-dns-cache-size must not be negative",
+		},
+		{
+			name:      "sidecar mode - negative dns cache max ttl",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.DNSServer.CacheMaxTTL = -time.Second },
+			expectErr: "-consul-dns-cache-max-ttl must not be negative",
+		},
+		{
+			name:      "sidecar mode - negative dns serve stale window",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.DNSServer.ServeStaleWindow = -time.Second },
+			expectErr: "-consul-dns-serve-stale-window must not be negative",
+		},
+		{
+			name: "sidecar mode - dns serve stale without cache",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.DNSServer.ServeStaleWindow = time.Minute
+				c.DNSServer.DisableCache = true
+			},
+			expectErr: "-consul-dns-serve-stale-window requires the DNS cache, which is disabled by -consul-dns-disable-cache",
+		},
+		{
+			name:      "sidecar mode - negative dns recursor timeout",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.DNSServer.RecursorTimeout = -time.Second },
+			expectErr: "-consul-dns-recursor-timeout must not be negative",
+		},
+		{
+			name:      "sidecar mode - negative dns udp workers",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.DNSServer.UDPWorkers = -1 },
+			expectErr: "-consul-dns-udp-workers must not be negative",
+		},
+		{
+			name:      "sidecar mode - negative dns udp queue size",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.DNSServer.UDPQueueSize = -1 },
+			expectErr: "-consul-dns-udp-queue-size must not be negative",
+		},
+		{
+			name:      "sidecar mode - invalid dns udp drop policy",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.DNSServer.UDPDropPolicy = "drop-all" },
+			expectErr: `-consul-dns-udp-drop-policy must be one of "drop-newest", "drop-oldest" or "servfail"`,
+		},
+		{
+			name:      "dns-proxy mode - negative dns tcp idle timeout",
+			mode:      ModeTypeDNSProxy,
+			modFn:     func(c *Config) { c.DNSServer.TCPIdleTimeout = -time.Second },
+			expectErr: "-consul-dns-tcp-idle-timeout must not be negative",
+		},
+		{
+			name:      "dns-proxy mode - negative dns tcp max connections",
+			mode:      ModeTypeDNSProxy,
+			modFn:     func(c *Config) { c.DNSServer.TCPMaxConns = -1 },
+			expectErr: "-consul-dns-tcp-max-connections must not be negative",
+		},
+		{
+			name:      "dns-proxy mode - negative dns query log max size",
+			mode:      ModeTypeDNSProxy,
+			modFn:     func(c *Config) { c.DNSServer.QueryLogMaxSize = -1 },
+			expectErr: "-consul-dns-query-log-max-size must not be negative",
+		},
+		{
+			name:      "dns-proxy mode - negative dns query log max files",
+			mode:      ModeTypeDNSProxy,
+			modFn:     func(c *Config) { c.DNSServer.QueryLogMaxFiles = -1 },
+			expectErr: "-consul-dns-query-log-max-files must not be negative",
+		},
+		{
+			name:      "dns-proxy mode - dns query log sample rate above 1",
+			mode:      ModeTypeDNSProxy,
+			modFn:     func(c *Config) { c.DNSServer.QueryLogSampleRate = 1.5 },
+			expectErr: "-consul-dns-query-log-sample-rate must be between 0 and 1",
+		},
+		{
+			name:      "dns-proxy mode - invalid dns allow cidr",
+			mode:      ModeTypeDNSProxy,
+			modFn:     func(c *Config) { c.DNSServer.AllowCIDRs = []string{"10.0.0.0/8", "10.0.0.1"} },
+			expectErr: `-consul-dns-allow-cidr "10.0.0.1" is not a valid CIDR: netip.ParsePrefix("10.0.0.1"): no '/'`,
+		},
+		{
+			name:      "dns-proxy mode - invalid dns deny cidr",
+			mode:      ModeTypeDNSProxy,
+			modFn:     func(c *Config) { c.DNSServer.DenyCIDRs = []string{"10.0.0.0/33"} },
+			expectErr: `-consul-dns-deny-cidr "10.0.0.0/33" is not a valid CIDR: netip.ParsePrefix("10.0.0.0/33"): prefix length out of range`,
+		},
+		{
+			name:      "dns-proxy mode - negative dns rate limit",
+			mode:      ModeTypeDNSProxy,
+			modFn:     func(c *Config) { c.DNSServer.RateLimit = -1 },
+			expectErr: "-consul-dns-rate-limit must not be negative",
+		},
+		{
+			name:      "dns-proxy mode - negative dns rate limit burst",
+			mode:      ModeTypeDNSProxy,
+			modFn:     func(c *Config) { c.DNSServer.RateLimitBurst = -1 },
+			expectErr: "-consul-dns-rate-limit-burst must not be negative",
+		},
+		{
+			name:      "dns-proxy mode - invalid dns rate limit action",
+			mode:      ModeTypeDNSProxy,
+			modFn:     func(c *Config) { c.DNSServer.RateLimitAction = "servfail" },
+			expectErr: `-consul-dns-rate-limit-action must be one of "refuse" or "drop"`,
+		},
+		{
+			name:      "dns-proxy mode - negative dns rrl rate",
+			mode:      ModeTypeDNSProxy,
+			modFn:     func(c *Config) { c.DNSServer.RRLRate = -1 },
+			expectErr: "-consul-dns-rrl-rate must not be negative",
+		},
+		{
+			name:      "dns-proxy mode - negative dns rrl slip",
+			mode:      ModeTypeDNSProxy,
+			modFn:     func(c *Config) { c.DNSServer.RRLSlip = -1 },
+			expectErr: "-consul-dns-rrl-slip must not be negative",
+		},
+		{
+			name: "sidecar mode - dns dot without certificate",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.DNSServer.Port = 8600
+				c.DNSServer.DoTAddr = "127.0.0.1:853"
+			},
+			expectErr: "-consul-dns-dot-addr requires -consul-dns-tls-cert-file and -consul-dns-tls-key-file",
+		},
+		{
+			name: "sidecar mode - invalid dns doh address",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.DNSServer.Port = 8600
+				c.DNSServer.DoHAddr = "127.0.0.1"
+			},
+			expectErr: "-consul-dns-doh-addr must be formatted as <host>:<port>: address 127.0.0.1: missing port in address",
+		},
+		{
+			name: "sidecar mode - dns doh without the dns proxy",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.DNSServer.Port = -1
+				c.DNSServer.DoHAddr = "127.0.0.1:443"
+			},
+			expectErr: "-consul-dns-doh-addr requires the DNS proxy, which is disabled by -consul-dns-bind-port",
+		},
+		{
+			name: "sidecar mode - non-local dns dot address",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.DNSServer.Port = 8600
+				c.DNSServer.DoTAddr = "0.0.0.0:853"
+				c.DNSServer.TLSCertFile = "cert.pem"
+				c.DNSServer.TLSKeyFile = "key.pem"
+			},
+			expectErr: "non-local -consul-dns-dot-addr not allowed when running as a sidecar",
+		},
+		{
+			name: "api-gateway mode - dns doh address",
+			mode: ModeTypeAPIGateway,
+			modFn: func(c *Config) {
+				c.DNSServer.Port = 8600
+				c.DNSServer.DoHAddr = "10.0.0.1:443"
+				c.DNSServer.TLSCertFile = "cert.pem"
+				c.DNSServer.TLSKeyFile = "key.pem"
+			},
+			expectErr: "-consul-dns-doh-addr must be a loopback or wildcard address when running as a gateway",
+		},
+		{
+			name:      "sidecar mode - invalid prometheus push protocol",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.Telemetry.Prometheus.Push.Protocol = "otlp" },
+			expectErr: `-telemetry-prom-push-protocol must be one of "pushgateway" or "remote-write"`,
+		},
+		{
+			name:      "sidecar mode - negative prometheus push interval",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.Telemetry.Prometheus.Push.Interval = -time.Second },
+			expectErr: "-telemetry-prom-push-interval must not be negative",
+		},
+		{
+			name:      "sidecar mode - invalid prometheus push url",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.Telemetry.Prometheus.Push.URL = "pushgateway:9091" },
+			expectErr: `invalid -telemetry-prom-push-url "pushgateway:9091": scheme must be http or https`,
+		},
+		{
+			name:      "sidecar mode - invalid prometheus merge collision mode",
+			mode:      ModeTypeSidecar,
+			modFn:     func(c *Config) { c.Telemetry.Prometheus.MergeCollisionMode = "drop" },
+			expectErr: `-telemetry-prom-merge-collision-mode must be one of "label" or "prefix"`,
+		},
+		{
+			name: "sidecar mode - reserved prometheus const label",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ConstLabels = map[string]string{"source": "web"}
+			},
+			expectErr: `invalid -telemetry-prom-const-label name "source"`,
+		},
+		{
+			name: "sidecar mode - service metrics target without name",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ServiceMetricsTargets = []ServiceMetricsTarget{{URL: "http://127.0.0.1:9090/metrics"}}
+			},
+			expectErr: "-telemetry-prom-service-metrics-target name must not be empty",
+		},
+		{
+			name: "sidecar mode - service metrics target with invalid name",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ServiceMetricsTargets = []ServiceMetricsTarget{{Name: "my-app", URL: "http://127.0.0.1:9090/metrics"}}
+			},
+			expectErr: `invalid -telemetry-prom-service-metrics-target name "my-app"`,
+		},
+		{
+			name: "sidecar mode - service metrics target with reserved name",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ServiceMetricsTargets = []ServiceMetricsTarget{{Name: "envoy", URL: "http://127.0.0.1:9090/metrics"}}
+			},
+			expectErr: `-telemetry-prom-service-metrics-target name "envoy" is already in use`,
+		},
+		{
+			name: "sidecar mode - service metrics target without url",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ServiceMetricsTargets = []ServiceMetricsTarget{{Name: "app"}}
+			},
+			expectErr: `-telemetry-prom-service-metrics-target "app" must have a url`,
+		},
+		{
+			name: "sidecar mode - service metrics target with negative timeout",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ServiceMetricsTargets = []ServiceMetricsTarget{{Name: "app", URL: "http://127.0.0.1:9090/metrics", Timeout: -time.Second}}
+			},
+			expectErr: `-telemetry-prom-service-metrics-target "app" timeout must not be negative`,
+		},
+		{
+			name: "sidecar mode - service metrics target with bearer token and basic auth",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ServiceMetricsTargets = []ServiceMetricsTarget{{Name: "app", URL: "http://127.0.0.1:9090/metrics", BearerTokenFile: "/token", BasicAuthUsername: "prom"}}
+			},
+			expectErr: `-telemetry-prom-service-metrics-target "app" must not use both bearer token and basic auth`,
+		},
+		{
+			name: "sidecar mode - service metrics target with invalid label",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ServiceMetricsTargets = []ServiceMetricsTarget{{Name: "app", URL: "http://127.0.0.1:9090/metrics", Labels: map[string]string{"source": "app"}}}
+			},
+			expectErr: `invalid -telemetry-prom-service-metrics-target "app" label name "source"`,
+		},
 		{
 			name:      "sidecar mode - missing prometheus scrape path",
 			mode:      ModeTypeSidecar,
@@ -173,6 +522,14 @@ func TestNewConsulDPError(t *testing.T) {
 			},
 			expectErr: "non-local xDS bind address not allowed",
 		},
+		{
+			name: "sidecar mode - wildcard xds bind address",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.XDSServer.BindAddress = "0.0.0.0"
+			},
+			expectErr: "non-local xDS bind address not allowed",
+		},
 		{
 			name: "sidecar mode - non-local xds bind address",
 			mode: ModeTypeSidecar,
@@ -182,6 +539,62 @@ func TestNewConsulDPError(t *testing.T) {
 			},
 			expectErr: "non-local DNS proxy bind address not allowed when running as a sidecar",
 		},
+		{
+			name: "sidecar mode - stats matcher inclusions and exclusions",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Envoy.StatsMatcher.InclusionPrefixes = []string{"cluster."}
+				c.Envoy.StatsMatcher.ExclusionRegexes = []string{"^http\\."}
+			},
+			expectErr: "envoy stats matcher inclusions and exclusions are mutually exclusive",
+		},
+		{
+			name: "sidecar mode - auto envoy concurrency minimum less than 1",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Envoy.EnvoyConcurrencyAuto = true
+				c.Envoy.EnvoyConcurrencyRatio = 1
+			},
+			expectErr: "envoy concurrency minimum must be at least 1",
+		},
+		{
+			name: "sidecar mode - auto envoy concurrency maximum less than minimum",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Envoy.EnvoyConcurrencyAuto = true
+				c.Envoy.EnvoyConcurrencyMin = 4
+				c.Envoy.EnvoyConcurrencyMax = 2
+				c.Envoy.EnvoyConcurrencyRatio = 1
+			},
+			expectErr: "envoy concurrency maximum must not be less than the minimum",
+		},
+		{
+			name: "sidecar mode - auto envoy concurrency ratio not positive",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Envoy.EnvoyConcurrencyAuto = true
+				c.Envoy.EnvoyConcurrencyMin = 1
+			},
+			expectErr: "envoy concurrency ratio must be greater than 0",
+		},
+		{
+			name: "sidecar mode - overload manager threshold out of range",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Envoy.OverloadManager.Enabled = true
+				c.Envoy.OverloadManager.StopAcceptingRequestsThreshold = 1.2
+			},
+			expectErr: "envoy overload manager thresholds must be between 0 and 1",
+		},
+		{
+			name: "sidecar mode - overload manager negative limit",
+			mode: ModeTypeSidecar,
+			modFn: func(c *Config) {
+				c.Envoy.OverloadManager.Enabled = true
+				c.Envoy.OverloadManager.MaxDownstreamConnections = -1
+			},
+			expectErr: "envoy overload manager limits must not be negative",
+		},
 		{
 			name: "sidecar mode - no bearer token or path given",
 			mode: ModeTypeSidecar,
@@ -323,6 +736,78 @@ func TestNewConsulDPError(t *testing.T) {
 
 	testCases = append(testCases, dnsProxyTestCases...)
 
+	gatewayTestCases := []testCase{
+		{
+			name:      "unsupported mode",
+			mode:      ModeType("egress-gateway"),
+			modFn:     func(c *Config) {},
+			expectErr: `unsupported mode "egress-gateway"`,
+		},
+		{
+			name:      "mesh-gateway mode - valid",
+			mode:      ModeTypeMeshGateway,
+			modFn:     func(c *Config) { c.Telemetry.Prometheus.ServiceMetricsURL = "" },
+			expectErr: "",
+		},
+		{
+			name:      "ingress-gateway mode - missing proxy id",
+			mode:      ModeTypeIngressGateway,
+			modFn:     func(c *Config) { c.Proxy.ProxyID = "" },
+			expectErr: "proxy ID not specified",
+		},
+		{
+			name:      "terminating-gateway mode - non-wildcard xds bind address",
+			mode:      ModeTypeTerminatingGateway,
+			modFn:     func(c *Config) { c.XDSServer.BindAddress = "1.2.3.4" },
+			expectErr: "xDS bind address must be a loopback or wildcard address when running as a gateway",
+		},
+		{
+			name: "terminating-gateway mode - wildcard xds bind address",
+			mode: ModeTypeTerminatingGateway,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ServiceMetricsURL = ""
+				c.XDSServer.BindAddress = "0.0.0.0"
+			},
+			expectErr: "",
+		},
+		{
+			name: "api-gateway mode - wildcard DNS bind address",
+			mode: ModeTypeAPIGateway,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ServiceMetricsURL = ""
+				c.DNSServer.BindAddr = "0.0.0.0"
+				c.DNSServer.Port = 8600
+			},
+			expectErr: "",
+		},
+		{
+			name: "api-gateway mode - non-wildcard DNS bind address",
+			mode: ModeTypeAPIGateway,
+			modFn: func(c *Config) {
+				c.DNSServer.BindAddr = "1.2.3.4"
+				c.DNSServer.Port = 8600
+			},
+			expectErr: "DNS proxy bind address must be a loopback or wildcard address when running as a gateway",
+		},
+		{
+			name:      "mesh-gateway mode - service metrics url",
+			mode:      ModeTypeMeshGateway,
+			modFn:     func(c *Config) {},
+			expectErr: "-telemetry-prom-service-metrics-url is not supported when running as a gateway",
+		},
+		{
+			name: "mesh-gateway mode - service metrics target",
+			mode: ModeTypeMeshGateway,
+			modFn: func(c *Config) {
+				c.Telemetry.Prometheus.ServiceMetricsURL = ""
+				c.Telemetry.Prometheus.ServiceMetricsTargets = []ServiceMetricsTarget{{Name: "app", URL: "http://127.0.0.1:9090/metrics"}}
+			},
+			expectErr: "-telemetry-prom-service-metrics-target is not supported when running as a gateway",
+		},
+	}
+
+	testCases = append(testCases, gatewayTestCases...)
+
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			cfg := validConfig(tc.mode)
@@ -337,3 +822,57 @@ func TestNewConsulDPError(t *testing.T) {
 		})
 	}
 }
+
+func TestEnvoyProxyConfig(t *testing.T) {
+	cfg := validConfig(ModeTypeSidecar)
+	cfg.Envoy.EnvoyConcurrency = 2
+	cfg.Envoy.EnvoyDrainTimeSeconds = 30
+	cfg.Envoy.EnvoyDrainStrategy = "immediate"
+	cfg.Envoy.ExtraArgs = []string{"--concurrency", "4", "--disable-extensions", "foo"}
+
+	consulDP, err := NewConsulDP(cfg)
+	require.NoError(t, err)
+
+	proxyCfg := consulDP.envoyProxyConfig([]byte("hello world"))
+
+	// The dataplane config is passed as typed options, and extra args are
+	// passed through untouched so that the envoy package can give them
+	// precedence. The concurrency option already reflects the override.
+	require.Equal(t, 4, *proxyCfg.Options.Concurrency)
+	require.Equal(t, 30, *proxyCfg.Options.DrainTimeSeconds)
+	require.Equal(t, "immediate", proxyCfg.Options.DrainStrategy)
+	require.Equal(t, []string{"--concurrency", "4", "--disable-extensions", "foo"}, proxyCfg.ExtraArgs)
+}
+
+func TestEnvoyProxyConfig_Gateway(t *testing.T) {
+	for _, mode := range []ModeType{ModeTypeSidecar, ModeTypeMeshGateway, ModeTypeIngressGateway, ModeTypeTerminatingGateway, ModeTypeAPIGateway} {
+		t.Run(string(mode), func(t *testing.T) {
+			cfg := validConfig(mode)
+			cfg.Telemetry.Prometheus.ServiceMetricsURL = ""
+
+			consulDP, err := NewConsulDP(cfg)
+			require.NoError(t, err)
+
+			proxyCfg := consulDP.envoyProxyConfig([]byte("hello world"))
+			require.Equal(t, mode.IsGateway(), proxyCfg.DrainAllListeners)
+			require.Equal(t, mode.IsGateway(), proxyCfg.ReadyWithoutListeners)
+		})
+	}
+}
+
+func TestGracefulShutdown_ConcurrentWithStart(t *testing.T) {
+	cfg := validConfig(ModeTypeDNSProxy)
+	cfg.Telemetry = nil
+	consulDP, err := NewConsulDP(cfg)
+	require.NoError(t, err)
+
+	// A shutdown signal can arrive while Run is still setting up metrics;
+	// run with -race to check that this doesn't race.
+	started := make(chan error, 1)
+	go func() { started <- consulDP.startDNSProxyMetrics(context.Background(), nil) }()
+
+	canceled := false
+	consulDP.GracefulShutdown(func() { canceled = true })
+	require.True(t, canceled)
+	require.NoError(t, <-started)
+}
@@ -47,6 +47,10 @@ type lifecycleConfig struct {
 	// manager for controlling the Envoy proxy process
 	proxy envoy.ProxyManager
 
+	// flushMetrics is called at the end of a graceful shutdown, before Envoy
+	// quits, to push the final values of the metrics.
+	flushMetrics func()
+
 	// consuldp proxy lifecycle management server
 	lifecycleServer *http.Server
 
@@ -203,6 +207,9 @@ func (m *lifecycleConfig) gracefulShutdown() {
 
 		// Finish graceful shutdown, quit Envoy proxy
 		m.logger.Info("shutdown grace period timeout reached")
+		if m.flushMetrics != nil {
+			m.flushMetrics()
+		}
 		err := m.proxy.Quit()
 		if err != nil {
 			m.logger.Warn("error while shutting down Envoy", "error", err)
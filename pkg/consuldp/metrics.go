@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,8 +25,14 @@ import (
 	prom "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
 
 	"github.com/hashicorp/consul-dataplane/internal/bootstrap"
+	"github.com/hashicorp/consul-dataplane/pkg/dns"
 	metricscache "github.com/hashicorp/consul-dataplane/pkg/metrics-cache"
 )
 
@@ -39,6 +46,8 @@ func (s Stats) String() string {
 		return "dogstatsD"
 	case Statsd:
 		return "statsD"
+	case OTLP:
+		return "otlp"
 	default:
 		return "default"
 	}
@@ -52,18 +61,41 @@ const (
 	mergedMetricsBackendBindHost        = "[::]:"
 
 	// The consul dataplane specific metrics will be exposed on this port on the loopback
-	cdpMetricsBindPort = "20101"
-	cdpMetricsBindAddr = "[::]:" + cdpMetricsBindPort
-	cdpMetricsUrl      = "http://" + cdpMetricsBindAddr
+	defaultCDPMetricsBindHost = "127.0.0.1"
+	defaultCDPMetricsBindPort = 20101
+
+	// defaultScrapeTimeout is how long each source of the merged metrics is
+	// given to respond if no timeout is configured.
+	defaultScrapeTimeout = 5 * time.Second
+
+	// The names of the sources of the merged metrics, reported in the source
+	// label of the scrape series.
+	cdpMetricsSource     = "consul_dataplane"
+	envoyMetricsSource   = "envoy"
+	serviceMetricsSource = "service"
 
 	// Distinguishing values for the type of sinks that are being used
 	Prometheus Stats = iota
 	Dogstatsd
 	Statsd
+	OTLP
 )
 
 type urlFn func(*http.Request) string
 
+// metricsSource is an endpoint serving Prometheus metrics that are merged into
+// the metrics served by the merged metrics server.
+type metricsSource struct {
+	name string
+	url  urlFn
+
+	// The following are optional and only set for application targets.
+	client  httpClient              // overrides the default scrape client
+	timeout time.Duration           // overrides the scrape timeout
+	labels  map[string]string       // added to every metric of the source
+	header  func(http.Header) error // adds headers to each scrape request
+}
+
 // staticUrlFn returns a urlFn that redirects to the given URL (not validated) unmodified.
 func staticUrlFn(redirectUrl string) urlFn {
 	return func(_ *http.Request) string {
@@ -104,19 +136,29 @@ type metricsConfig struct {
 	envoyAdminAddr     string
 	envoyAdminBindPort int
 
+	// dnsProxy is set when running in dns-proxy mode, without Envoy.
+	dnsProxy bool
+
 	statsDAddr string
 
 	dogstatsDAddr string
 	dogstatsTags  []string
 
+	otlp          OTLPTelemetryConfig
+	otlpResource  *resource.Resource       // describes the proxy in exported metrics
+	meterProvider *sdkmetric.MeterProvider // exports the OTLP sink's metrics
+
 	// merged metrics config
-	promScrapeServer *http.Server // the server that will serve all the merged metrics
-	client           httpClient   // the client that will scrape the urls
-	urls             []urlFn      // the urls that will be scraped
+	promScrapeServer *http.Server    // the server that will serve all the merged metrics
+	client           httpClient      // the client that will scrape the urls
+	sources          []metricsSource // the sources that will be scraped
 
 	// consuldp metrics server
 	cdpMetricsServer *http.Server // cdp metrics prometheus scrape server
 
+	// pushes the merged metrics, if configured
+	pusher *metricsPusher
+
 	// lifecycle control
 	errorExitCh chan struct{}
 	running     bool
@@ -127,18 +169,22 @@ func NewMetricsConfig(cfg *Config, cacheSink *metricscache.Sink) *metricsConfig
 	if cacheSink == nil {
 		cacheSink = metricscache.NewSink()
 	}
-	return &metricsConfig{
-		mu:                 sync.Mutex{},
-		cfg:                cfg.Telemetry,
-		errorExitCh:        make(chan struct{}),
-		envoyAdminAddr:     cfg.Envoy.AdminBindAddress,
-		envoyAdminBindPort: cfg.Envoy.AdminBindPort,
-		cacheSink:          cacheSink,
-
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+	m := &metricsConfig{
+		mu:          sync.Mutex{},
+		cfg:         cfg.Telemetry,
+		errorExitCh: make(chan struct{}),
+		dnsProxy:    cfg.Mode == ModeTypeDNSProxy,
+		cacheSink:   cacheSink,
+
+		// Requests are bounded by their context rather than by a client
+		// timeout, so that scrape timeouts longer than any default apply.
+		client: &http.Client{},
+	}
+	if cfg.Envoy != nil {
+		m.envoyAdminAddr = cfg.Envoy.AdminBindAddress
+		m.envoyAdminBindPort = cfg.Envoy.AdminBindPort
 	}
+	return m
 }
 
 func statsSinkEnvMapping(s string) string {
@@ -160,78 +206,128 @@ func (m *metricsConfig) startMetrics(ctx context.Context, bcfg *bootstrap.Bootst
 		return nil
 	}
 
-	if m.cfg.UseCentralConfig {
-		m.logger = hclog.FromContext(ctx).Named("metrics")
-		m.running = true
-		go func() {
-			<-ctx.Done()
-			m.stopMetricsServers()
-		}()
+	m.logger = hclog.FromContext(ctx).Named("metrics")
+	m.running = true
+	go func() {
+		<-ctx.Done()
+		m.stopMetricsServers()
+	}()
 
-		if bcfg.PrometheusBindAddr != "" {
-			// 1. start consul dataplane metric sinks of type Prometheus
-			err := m.configureCDPMetricSinks(Prometheus)
-			if err != nil {
-				return fmt.Errorf("failure enabling consul dataplane metrics for prometheus: %w", err)
-			}
+	// The bootstrap config contains the central telemetry config, if enabled,
+	// overridden by the telemetry configured on the dataplane.
+	if bcfg.PrometheusBindAddr != "" && m.dnsProxy {
+		// There's no Envoy to proxy the merged metrics in dns-proxy mode, so
+		// consul dataplane metrics are served on the bind address directly.
+		err := m.configureCDPMetricSinks(Prometheus)
+		if err != nil {
+			return fmt.Errorf("failure enabling consul dataplane metrics for prometheus: %w", err)
+		}
+		// They're still scraped to be pushed, if configured.
+		cdpSource, err := m.cdpMetricsSourceFor(m.cdpMetricsAddr())
+		if err != nil {
+			return fmt.Errorf("failure configuring consul dataplane metrics source: %w", err)
+		}
+		m.sources = []metricsSource{cdpSource}
+	} else if bcfg.PrometheusBindAddr != "" {
+		// 1. start consul dataplane metric sinks of type Prometheus
+		err := m.configureCDPMetricSinks(Prometheus)
+		if err != nil {
+			return fmt.Errorf("failure enabling consul dataplane metrics for prometheus: %w", err)
+		}
 
-			// 2. Setup prometheus handler for the merged metrics endpoint that prometheus
-			// will actually scrape.
-			mux := http.NewServeMux()
-			mux.HandleFunc("/stats/prometheus", m.mergedMetricsHandler)
-			// Retain request query for Envoy endpoint to enable customizing response (see
-			// https://www.envoyproxy.io/docs/envoy/latest/operations/admin#get--stats?format=prometheus&usedonly).
-			envoyUrlFn, err := retainQueryUrlFn(fmt.Sprintf("http://%s/stats/prometheus", net.JoinHostPort(m.envoyAdminAddr, strconv.Itoa(m.envoyAdminBindPort))))
+		// 2. Setup prometheus handler for the merged metrics endpoint that prometheus
+		// will actually scrape.
+		mux := http.NewServeMux()
+		mux.HandleFunc("/stats/prometheus", m.mergedMetricsHandler)
+		// Retain request query for Envoy endpoint to enable customizing response (see
+		// https://www.envoyproxy.io/docs/envoy/latest/operations/admin#get--stats?format=prometheus&usedonly).
+		envoyUrlFn, err := retainQueryUrlFn(fmt.Sprintf("http://%s/stats/prometheus", net.JoinHostPort(m.envoyAdminAddr, strconv.Itoa(m.envoyAdminBindPort))))
+		if err != nil {
+			return err
+		}
+		cdpSource, err := m.cdpMetricsSourceFor(m.cdpMetricsAddr())
+		if err != nil {
+			return fmt.Errorf("failure configuring consul dataplane metrics source: %w", err)
+		}
+		m.sources = []metricsSource{
+			cdpSource,
+			{name: envoyMetricsSource, url: envoyUrlFn},
+		}
+		if m.cfg != nil {
+			serviceSources, err := serviceMetricsSources(m.cfg.Prometheus)
 			if err != nil {
 				return err
 			}
-			m.urls = []urlFn{staticUrlFn(cdpMetricsUrl), envoyUrlFn}
-			if m.cfg != nil && m.cfg.Prometheus.ServiceMetricsURL != "" {
-				m.urls = append(m.urls, staticUrlFn(m.cfg.Prometheus.ServiceMetricsURL))
-			}
+			m.sources = append(m.sources, serviceSources...)
+		}
 
-			// 3. Determine what the merged metrics bind port is. It can be set as a flag.
-			mergedMetricsBackendBindPort := defaultMergedMetricsBackendBindPort
-			if m.cfg.Prometheus.MergePort != 0 {
-				mergedMetricsBackendBindPort = strconv.Itoa(m.cfg.Prometheus.MergePort)
-			}
-			m.promScrapeServer = &http.Server{
-				Addr:    mergedMetricsBackendBindHost + mergedMetricsBackendBindPort,
-				Handler: mux,
-			}
-			// 4. Start prometheus metrics sink
-			go m.startPrometheusMergedMetricsSink()
+		// 3. Determine what the merged metrics bind address and port are. They can be set as flags.
+		mergedMetricsBackendBindPort := defaultMergedMetricsBackendBindPort
+		if m.cfg.Prometheus.MergePort != 0 {
+			mergedMetricsBackendBindPort = strconv.Itoa(m.cfg.Prometheus.MergePort)
 		}
-		if bcfg.StatsdURL != "" {
-			addr, err := parseSinkAddr(bcfg.StatsdURL, Statsd)
-			if err != nil {
-				return err
-			}
-			m.statsDAddr = addr
-			err = m.configureCDPMetricSinks(Statsd)
-			if err != nil {
-				return fmt.Errorf("failure enabling consul dataplane metrics for statsd: %w", err)
-			}
+		mergedMetricsAddr := mergedMetricsBackendBindHost + mergedMetricsBackendBindPort
+		if m.cfg.Prometheus.MergeBindAddr != "" {
+			port, _ := strconv.Atoi(mergedMetricsBackendBindPort)
+			mergedMetricsAddr = metricsListenAddr(m.cfg.Prometheus.MergeBindAddr, port)
 		}
-		if bcfg.DogstatsdURL != "" {
-			dogstatsDAddr, err := parseSinkAddr(bcfg.DogstatsdURL, Dogstatsd)
-			if err != nil {
-				return err
-			}
-			m.dogstatsDAddr = dogstatsDAddr
-			m.dogstatsTags = bcfg.StatsTags
+		m.promScrapeServer, err = m.newMetricsServer(mergedMetricsAddr, mux)
+		if err != nil {
+			return fmt.Errorf("failure configuring merged metrics server: %w", err)
+		}
+		// 4. Start prometheus metrics sink
+		go m.startPrometheusMergedMetricsSink()
+	}
+	if bcfg.StatsdURL != "" {
+		addr, err := parseSinkAddr(bcfg.StatsdURL, Statsd)
+		if err != nil {
+			return err
+		}
+		m.statsDAddr = addr
+		err = m.configureCDPMetricSinks(Statsd)
+		if err != nil {
+			return fmt.Errorf("failure enabling consul dataplane metrics for statsd: %w", err)
+		}
+	}
+	if bcfg.DogstatsdURL != "" {
+		dogstatsDAddr, err := parseSinkAddr(bcfg.DogstatsdURL, Dogstatsd)
+		if err != nil {
+			return err
+		}
+		m.dogstatsDAddr = dogstatsDAddr
+		m.dogstatsTags = bcfg.StatsTags
 
-			err = m.configureCDPMetricSinks(Dogstatsd)
-			if err != nil {
-				return fmt.Errorf("failure enabling consul dataplane metrics for dogstatsD: %w", err)
-			}
+		err = m.configureCDPMetricSinks(Dogstatsd)
+		if err != nil {
+			return fmt.Errorf("failure enabling consul dataplane metrics for dogstatsD: %w", err)
 		}
-		// Set the cache sink with the fanout sinks which will trigger a replay to all of the children sinks
-		m.cacheSink.SetSink(m.sinks)
-	} else {
-		// send metrics to black hole if they aren't being configured.
-		m.cacheSink.SetSink(&metrics.BlackholeSink{})
 	}
+	otlpCfg, err := resolveOTLPConfig(m.cfg.OTLP, bcfg)
+	if err != nil {
+		return err
+	}
+	if otlpCfg.Endpoint != "" {
+		m.otlp = otlpCfg
+		err = m.configureCDPMetricSinks(OTLP)
+		if err != nil {
+			return fmt.Errorf("failure enabling consul dataplane metrics for otlp: %w", err)
+		}
+		if otlpCfg.EnvoyStats && !m.dnsProxy {
+			bridge := newEnvoyStatsBridge(m.logger, m.client, m.meterProvider.Meter(otlpMeterName),
+				m.envoyAdminAddr, m.envoyAdminBindPort, otlpCfg.ExportInterval)
+			go bridge.run(ctx)
+		}
+	}
+	if m.cfg != nil && m.cfg.Prometheus.Push.URL != "" {
+		if len(m.sources) == 0 {
+			m.logger.Warn("not pushing metrics because prometheus metrics are disabled")
+		} else {
+			m.pusher = newMetricsPusher(m.logger, m.cfg.Prometheus.Push, m.client, m.gatherMergedMetrics)
+			go m.pusher.run(ctx)
+		}
+	}
+	// Set the cache sink with the fanout sinks which will trigger a replay to all of the children sinks
+	m.cacheSink.SetSink(m.sinks)
 
 	return nil
 }
@@ -240,7 +336,7 @@ func (m *metricsConfig) startMetrics(ctx context.Context, bcfg *bootstrap.Bootst
 // will actually be scraping.
 func (m *metricsConfig) startPrometheusMergedMetricsSink() {
 	m.logger.Info("starting merged metrics server", "address", m.promScrapeServer.Addr)
-	err := m.promScrapeServer.ListenAndServe()
+	err := m.serveMetrics(m.promScrapeServer)
 	if err != nil && err != http.ErrServerClosed {
 		m.logger.Error("failed to serve metrics requests", "error", err)
 		close(m.errorExitCh)
@@ -271,12 +367,33 @@ func (m *metricsConfig) stopMetricsServers() {
 			errs = multierror.Append(err, errs)
 		}
 	}
+	if m.meterProvider != nil {
+		m.logger.Info("stopping the otlp metrics exporter")
+		// Shutting down the provider flushes any metrics not yet exported.
+		ctx, cancel := context.WithTimeout(context.Background(), otlpShutdownTimeout)
+		err := m.meterProvider.Shutdown(ctx)
+		cancel()
+		if err != nil {
+			m.logger.Warn("error while shutting down otlp metrics exporter", "error", err)
+		}
+	}
 	// Check if there were errors and then close the error channel
 	if errs != nil {
 		close(m.errorExitCh)
 	}
 }
 
+// flushPushedMetrics pushes the current values of the merged metrics, if
+// pushing is configured, so that they aren't lost when the dataplane exits.
+func (m *metricsConfig) flushPushedMetrics() {
+	m.mu.Lock()
+	pusher := m.pusher
+	m.mu.Unlock()
+	if pusher != nil {
+		pusher.flush()
+	}
+}
+
 // metricsServerExited is used to signal that the metrics server
 // exited unexpectedely.
 func (m *metricsConfig) metricsServerExited() <-chan struct{} {
@@ -284,25 +401,113 @@ func (m *metricsConfig) metricsServerExited() <-chan struct{} {
 }
 
 // mergedMetricsHandler responds with merged metrics from multiple sources:
-// Consul Dataplane, Envoy and (optionally) the service/application. The Envoy
-// and service metrics are scraped synchronously during the handling of this
-// request.
+// Consul Dataplane, Envoy and (optionally) the application targets. The sources
+// are scraped concurrently during the handling of this request, each with its
+// own timeout. The metric families of every source that could be scraped are
+// merged, along with scrape_up and scrape_duration_seconds series for each
+// source, so that a failing source doesn't prevent the others from being
+// collected. The merged metrics are encoded in the format negotiated with the
+// scraper, including OpenMetrics.
 func (m *metricsConfig) mergedMetricsHandler(rw http.ResponseWriter, req *http.Request) {
-	for _, urlFn := range m.urls {
-		urlStr := urlFn(req)
-		m.logger.Debug("scraping url for merging", "url", urlStr)
-		if err := m.scrapeMetrics(rw, urlStr); err != nil {
-			m.scrapeError(rw, urlStr, err)
+	families := m.gatherMergedMetrics(req)
+
+	format := expfmt.NegotiateIncludingOpenMetrics(req.Header)
+	rw.Header().Set("Content-Type", string(format))
+	enc := expfmt.NewEncoder(rw, format)
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			m.logger.Warn("failed to write merged metrics", "error", err)
 			return
 		}
 	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			m.logger.Warn("failed to write merged metrics", "error", err)
+		}
+	}
 }
 
-// scrapeMetrics fetches metrics from the given url and copies them to the response.
-func (m *metricsConfig) scrapeMetrics(rw http.ResponseWriter, url string) error {
-	resp, err := m.client.Get(url)
+// gatherMergedMetrics scrapes every source concurrently and returns their
+// merged metric families, which are served by the merged metrics server and
+// pushed by the metrics pusher.
+func (m *metricsConfig) gatherMergedMetrics(req *http.Request) []*dto.MetricFamily {
+	results := make([]scrapeResult, len(m.sources))
+	var wg sync.WaitGroup
+	for i, source := range m.sources {
+		wg.Add(1)
+		go func(i int, source metricsSource) {
+			defer wg.Done()
+			results[i] = m.scrapeSource(req, source)
+		}(i, source)
+	}
+	wg.Wait()
+
+	families, dropped := mergeMetricFamilies(results, m.mergeCollisionMode())
+	if len(dropped) > 0 {
+		m.logger.Warn("dropped colliding metric families", "families", dropped)
+	}
+	families = append(families, scrapeFamilies(results)...)
+	var constLabels map[string]string
+	if m.cfg != nil {
+		constLabels = m.cfg.Prometheus.ConstLabels
+	}
+	addConstLabels(families, constLabels)
+	return families
+}
+
+// scrapeResult is the outcome of scraping a single metrics source.
+type scrapeResult struct {
+	source   string
+	families map[string]*dto.MetricFamily
+	duration time.Duration
+	err      error
+}
+
+// scrapeSource scrapes the metrics of a single source, logging any failure.
+func (m *metricsConfig) scrapeSource(req *http.Request, source metricsSource) scrapeResult {
+	url := source.url(req)
+	m.logger.Debug("scraping url for merging", "source", source.name, "url", url)
+
+	start := time.Now()
+	families, err := m.scrapeMetrics(req.Context(), source, url)
 	if err != nil {
-		return err
+		m.logger.Error("failed to scrape metrics", "source", source.name, "url", url, "error", err)
+	}
+	return scrapeResult{
+		source:   source.name,
+		families: families,
+		duration: time.Since(start),
+		err:      err,
+	}
+}
+
+// scrapeMetrics fetches metrics in the Prometheus text format from the given
+// url of the source and parses them, giving up after the scrape timeout.
+func (m *metricsConfig) scrapeMetrics(ctx context.Context, source metricsSource, url string) (map[string]*dto.MetricFamily, error) {
+	timeout := m.scrapeTimeout()
+	if source.timeout > 0 {
+		timeout = source.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", string(expfmt.NewFormat(expfmt.TypeTextPlain)))
+	if source.header != nil {
+		if err := source.header(req.Header); err != nil {
+			return nil, err
+		}
+	}
+	client := m.client
+	if source.client != nil {
+		client = source.client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
 	}
 	defer func() {
 		err := resp.Body.Close()
@@ -312,20 +517,38 @@ func (m *metricsConfig) scrapeMetrics(rw http.ResponseWriter, url string) error
 	}()
 
 	if non2xxCode(resp.StatusCode) {
-		return fmt.Errorf("status code %d", resp.StatusCode)
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
 	}
 
-	// Prometheus metrics are joined by newlines, so when merging metrics
-	// metrics we simply write all lines from each source to the response.
-	_, err = io.Copy(rw, resp.Body)
-	return err
+	// The text parser rejects input without a trailing newline, which some
+	// applications omit from their last line.
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(io.MultiReader(resp.Body, strings.NewReader("\n")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %w", err)
+	}
+	if len(source.labels) > 0 {
+		list := make([]*dto.MetricFamily, 0, len(families))
+		for _, mf := range families {
+			list = append(list, mf)
+		}
+		addConstLabels(list, source.labels)
+	}
+	return families, nil
 }
 
-// scrapeError logs an error and responds to the http request with an error.
-func (m *metricsConfig) scrapeError(rw http.ResponseWriter, url string, err error) {
-	m.logger.Error("failed to scrape metrics", "url", url, "error", err)
-	msg := fmt.Sprintf("failed to scrape metrics at url %q", url)
-	http.Error(rw, msg, http.StatusInternalServerError)
+func (m *metricsConfig) scrapeTimeout() time.Duration {
+	if m.cfg != nil && m.cfg.Prometheus.ScrapeTimeout > 0 {
+		return m.cfg.Prometheus.ScrapeTimeout
+	}
+	return defaultScrapeTimeout
+}
+
+func (m *metricsConfig) mergeCollisionMode() string {
+	if m.cfg != nil && m.cfg.Prometheus.MergeCollisionMode != "" {
+		return m.cfg.Prometheus.MergeCollisionMode
+	}
+	return MergeCollisionModeLabel
 }
 
 // non2xxCode returns true if code is not in the range of 200-299 inclusive.
@@ -355,9 +578,9 @@ func (m *metricsConfig) getPromDefaults() (*prom.Registry, *prometheus.Prometheu
 	opts := &prometheus.PrometheusOpts{
 		Expiration:         m.cfg.Prometheus.RetentionTime,
 		Registerer:         reg,
-		GaugeDefinitions:   append(gauges, discGauges...),
-		// CounterDefinitions: ,
-		SummaryDefinitions: discSummaries,
+		GaugeDefinitions:   append(append(gauges, discGauges...), dns.Gauges...),
+		CounterDefinitions: dns.Counters,
+		SummaryDefinitions: append(discSummaries, dns.Summaries...),
 	}
 	return r, opts, nil
 }
@@ -380,7 +603,13 @@ func (m *metricsConfig) configureCDPMetricSinks(s Stats) error {
 		// Append the prometheus sink to the fanout sink
 		m.sinks = append(m.sinks, sink)
 
-		go m.runPrometheusCDPServer(r)
+		m.cdpMetricsServer, err = m.newMetricsServer(m.cdpMetricsAddr(), promhttp.HandlerFor(r, promhttp.HandlerOpts{
+			ErrorHandling: promhttp.ContinueOnError,
+		}))
+		if err != nil {
+			return err
+		}
+		go m.runPrometheusCDPServer()
 	case Statsd:
 		sink, err := metrics.NewStatsdSink(m.statsDAddr)
 		if err != nil {
@@ -397,22 +626,30 @@ func (m *metricsConfig) configureCDPMetricSinks(s Stats) error {
 		sink.SetTags(m.dogstatsTags)
 		// Append the dogstatsd sink to the fanout sink
 		m.sinks = append(m.sinks, sink)
+	case OTLP:
+		exporter, err := newOTLPExporter(context.Background(), m.otlp)
+		if err != nil {
+			return err
+		}
+		opts := []sdkmetric.Option{
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(m.otlp.ExportInterval))),
+		}
+		if m.otlpResource != nil {
+			opts = append(opts, sdkmetric.WithResource(m.otlpResource))
+		}
+		m.meterProvider = sdkmetric.NewMeterProvider(opts...)
+		// Append the otlp sink to the fanout sink
+		m.sinks = append(m.sinks, newOTLPSink(m.logger, m.meterProvider.Meter(otlpMeterName)))
 	}
 	return nil
 
 }
 
-// runPrometheusCDPServer takes a prom.Gatherer that will create a handler
-// for http calls to the metrics endpoint and return prometheus style metrics.
-// Eventually these metrics will be scraped and merged.
-func (m *metricsConfig) runPrometheusCDPServer(gather prom.Gatherer) {
-	m.cdpMetricsServer = &http.Server{
-		Addr: cdpMetricsBindAddr,
-		Handler: promhttp.HandlerFor(gather, promhttp.HandlerOpts{
-			ErrorHandling: promhttp.ContinueOnError,
-		}),
-	}
-	err := m.cdpMetricsServer.ListenAndServe()
+// runPrometheusCDPServer serves the consul dataplane metrics server, which
+// returns prometheus style metrics. Eventually these metrics will be scraped
+// and merged.
+func (m *metricsConfig) runPrometheusCDPServer() {
+	err := m.serveMetrics(m.cdpMetricsServer)
 	if err != nil && err != http.ErrServerClosed {
 		m.logger.Error("failed to serve metrics requests", "error", err)
 		close(m.errorExitCh)
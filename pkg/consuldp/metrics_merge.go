@@ -0,0 +1,193 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package consuldp
+
+import (
+	"sort"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// MergeCollisionModeLabel resolves a metric family served by more than
+	// one source by merging it into a single family, with a source label
+	// identifying where each metric came from.
+	MergeCollisionModeLabel = "label"
+	// MergeCollisionModePrefix resolves a metric family served by more than
+	// one source by prefixing the family name with the name of each source.
+	MergeCollisionModePrefix = "prefix"
+
+	// sourceLabel is the label identifying the source of a metric in the
+	// merged metrics.
+	sourceLabel = "source"
+)
+
+func validMergeCollisionMode(mode string) bool {
+	return mode == MergeCollisionModeLabel || mode == MergeCollisionModePrefix
+}
+
+// mergeMetricFamilies merges the metric families of each successfully scraped
+// source. Families served by a single source are returned unmodified. Families
+// served by multiple sources are resolved according to mode. Families that
+// can't be merged by labelling, because their types differ or they already
+// have a source label, are prefixed instead. The merged families are returned
+// sorted by name, along with the names of any prefixed families that were
+// dropped because they would collide with another family.
+func mergeMetricFamilies(results []scrapeResult, mode string) ([]*dto.MetricFamily, []string) {
+	owners := make(map[string][]int)
+	for i, result := range results {
+		if result.err != nil {
+			continue
+		}
+		for name := range result.families {
+			owners[name] = append(owners[name], i)
+		}
+	}
+
+	merged := make(map[string]*dto.MetricFamily)
+	var collisions []string
+	for name, idxs := range owners {
+		if len(idxs) == 1 {
+			merged[name] = results[idxs[0]].families[name]
+			continue
+		}
+		collisions = append(collisions, name)
+	}
+	// Resolve collisions in a deterministic order, so it's consistent which
+	// family is dropped if a prefixed name is already taken.
+	sort.Strings(collisions)
+
+	var dropped []string
+	for _, name := range collisions {
+		idxs := owners[name]
+		if mode == MergeCollisionModeLabel && canMergeWithSourceLabel(results, idxs, name) {
+			mf := proto.Clone(results[idxs[0]].families[name]).(*dto.MetricFamily)
+			mf.Metric = nil
+			for _, i := range idxs {
+				for _, m := range results[i].families[name].Metric {
+					m.Label = append(m.Label, labelPair(sourceLabel, results[i].source))
+					mf.Metric = append(mf.Metric, m)
+				}
+			}
+			merged[name] = mf
+			continue
+		}
+
+		for _, i := range idxs {
+			mf := results[i].families[name]
+			prefixed := results[i].source + "_" + name
+			if _, ok := merged[prefixed]; ok {
+				dropped = append(dropped, prefixed)
+				continue
+			}
+			mf.Name = proto.String(prefixed)
+			merged[prefixed] = mf
+		}
+	}
+
+	families := make([]*dto.MetricFamily, 0, len(merged))
+	for _, mf := range merged {
+		families = append(families, mf)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+	return families, dropped
+}
+
+// canMergeWithSourceLabel returns true if the named family has the same type
+// in every source and none of its metrics already has a source label.
+func canMergeWithSourceLabel(results []scrapeResult, idxs []int, name string) bool {
+	typ := results[idxs[0]].families[name].GetType()
+	for _, i := range idxs {
+		mf := results[i].families[name]
+		if mf.GetType() != typ {
+			return false
+		}
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == sourceLabel {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// addConstLabels adds the constant labels to every metric that doesn't
+// already have a label of the same name, and sorts the labels of every
+// metric by name.
+func addConstLabels(families []*dto.MetricFamily, constLabels map[string]string) {
+	names := make([]string, 0, len(constLabels))
+	for name := range constLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, mf := range families {
+		for _, m := range mf.Metric {
+			for _, name := range names {
+				if !hasLabel(m, name) {
+					m.Label = append(m.Label, labelPair(name, constLabels[name]))
+				}
+			}
+			sort.Slice(m.Label, func(i, j int) bool {
+				return m.Label[i].GetName() < m.Label[j].GetName()
+			})
+		}
+	}
+}
+
+func hasLabel(m *dto.Metric, name string) bool {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func labelPair(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)}
+}
+
+// scrapeFamilies returns the consul_dataplane_scrape_up and
+// consul_dataplane_scrape_duration_seconds gauges for each scraped source.
+func scrapeFamilies(results []scrapeResult) []*dto.MetricFamily {
+	up := &dto.MetricFamily{
+		Name: proto.String("consul_dataplane_scrape_up"),
+		Help: proto.String("Whether the metrics source was scraped successfully."),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	duration := &dto.MetricFamily{
+		Name: proto.String("consul_dataplane_scrape_duration_seconds"),
+		Help: proto.String("How long scraping the metrics source took."),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	for _, result := range results {
+		var value float64 = 1
+		if result.err != nil {
+			value = 0
+		}
+		up.Metric = append(up.Metric, gaugeMetric(result.source, value))
+		duration.Metric = append(duration.Metric, gaugeMetric(result.source, result.duration.Seconds()))
+	}
+	return []*dto.MetricFamily{duration, up}
+}
+
+func gaugeMetric(source string, value float64) *dto.Metric {
+	return &dto.Metric{
+		Label: []*dto.LabelPair{labelPair(sourceLabel, source)},
+		Gauge: &dto.Gauge{Value: proto.Float64(value)},
+	}
+}
+
+// validConstLabelName returns true if name can be used as a constant label
+// on the merged metrics.
+func validConstLabelName(name string) bool {
+	return name != sourceLabel && model.LegacyValidation.IsValidLabelName(name)
+}
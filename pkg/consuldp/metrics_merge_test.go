@@ -0,0 +1,162 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package consuldp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func parseFamilies(t *testing.T, text string) map[string]*dto.MetricFamily {
+	t.Helper()
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(strings.NewReader(text))
+	require.NoError(t, err)
+	return families
+}
+
+func familyNames(families []*dto.MetricFamily) []string {
+	var names []string
+	for _, mf := range families {
+		names = append(names, mf.GetName())
+	}
+	return names
+}
+
+func metricLabels(m *dto.Metric) map[string]string {
+	labels := make(map[string]string)
+	for _, l := range m.Label {
+		labels[l.GetName()] = l.GetValue()
+	}
+	return labels
+}
+
+func TestMergeMetricFamilies(t *testing.T) {
+	cases := map[string]struct {
+		mode       string
+		envoy      string
+		service    string
+		expNames   []string
+		expDropped []string
+	}{
+		"label mode merges colliding families": {
+			mode:     MergeCollisionModeLabel,
+			envoy:    "# TYPE requests_total counter\nrequests_total 1\n# TYPE envoy_only gauge\nenvoy_only 1\n",
+			service:  "# TYPE requests_total counter\nrequests_total 2\n",
+			expNames: []string{"envoy_only", "requests_total"},
+		},
+		"prefix mode prefixes colliding families": {
+			mode:     MergeCollisionModePrefix,
+			envoy:    "# TYPE requests_total counter\nrequests_total 1\n",
+			service:  "# TYPE requests_total counter\nrequests_total 2\n",
+			expNames: []string{"envoy_requests_total", "service_requests_total"},
+		},
+		"label mode falls back to prefix for conflicting types": {
+			mode:     MergeCollisionModeLabel,
+			envoy:    "# TYPE requests_total counter\nrequests_total 1\n",
+			service:  "# TYPE requests_total gauge\nrequests_total 2\n",
+			expNames: []string{"envoy_requests_total", "service_requests_total"},
+		},
+		"label mode falls back to prefix for existing source labels": {
+			mode:     MergeCollisionModeLabel,
+			envoy:    "# TYPE requests_total counter\nrequests_total 1\n",
+			service:  "# TYPE requests_total counter\nrequests_total{source=\"db\"} 2\n",
+			expNames: []string{"envoy_requests_total", "service_requests_total"},
+		},
+		"prefixed families that collide are dropped": {
+			mode:       MergeCollisionModePrefix,
+			envoy:      "# TYPE requests_total counter\nrequests_total 1\n",
+			service:    "# TYPE requests_total counter\nrequests_total 2\n# TYPE envoy_requests_total counter\nenvoy_requests_total 3\n",
+			expNames:   []string{"envoy_requests_total", "service_requests_total"},
+			expDropped: []string{"envoy_requests_total"},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			results := []scrapeResult{
+				{source: cdpMetricsSource, err: errors.New("scrape failed")},
+				{source: envoyMetricsSource, families: parseFamilies(t, c.envoy)},
+				{source: serviceMetricsSource, families: parseFamilies(t, c.service)},
+			}
+
+			families, dropped := mergeMetricFamilies(results, c.mode)
+			require.Equal(t, c.expNames, familyNames(families))
+			require.Equal(t, c.expDropped, dropped)
+		})
+	}
+}
+
+func TestMergeMetricFamiliesSourceLabel(t *testing.T) {
+	results := []scrapeResult{
+		{source: envoyMetricsSource, families: parseFamilies(t, "# TYPE requests_total counter\nrequests_total{code=\"200\"} 1\n")},
+		{source: serviceMetricsSource, families: parseFamilies(t, "# TYPE requests_total counter\nrequests_total{code=\"500\"} 2\n")},
+	}
+
+	families, dropped := mergeMetricFamilies(results, MergeCollisionModeLabel)
+	require.Empty(t, dropped)
+	require.Len(t, families, 1)
+	require.Equal(t, dto.MetricType_COUNTER, families[0].GetType())
+	require.Len(t, families[0].Metric, 2)
+	require.Equal(t, map[string]string{"code": "200", "source": "envoy"}, metricLabels(families[0].Metric[0]))
+	require.Equal(t, map[string]string{"code": "500", "source": "service"}, metricLabels(families[0].Metric[1]))
+}
+
+func TestAddConstLabels(t *testing.T) {
+	families := parseFamilies(t, "requests_total{zone=\"local\",code=\"200\"} 1\n")
+	mf := families["requests_total"]
+
+	addConstLabels([]*dto.MetricFamily{mf}, map[string]string{"zone": "us-east-1a", "cluster": "prod"})
+
+	require.Equal(t, []*dto.LabelPair{
+		labelPair("cluster", "prod"),
+		labelPair("code", "200"),
+		labelPair("zone", "local"),
+	}, mf.Metric[0].Label)
+}
+
+func TestValidConstLabelName(t *testing.T) {
+	require.True(t, validConstLabelName("cluster"))
+	require.False(t, validConstLabelName(sourceLabel))
+	require.False(t, validConstLabelName("not-valid"))
+	require.False(t, validConstLabelName(""))
+}
+
+func TestMergedMetricsHandlerOpenMetrics(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Write([]byte("# TYPE requests_total counter\nrequests_total 1\n"))
+	}))
+	t.Cleanup(source.Close)
+
+	m := &metricsConfig{
+		logger: hclog.NewNullLogger(),
+		cfg: &TelemetryConfig{
+			Prometheus: PrometheusTelemetryConfig{
+				ConstLabels: map[string]string{"cluster": "prod"},
+			},
+		},
+		client:  &http.Client{},
+		sources: []metricsSource{{name: envoyMetricsSource, url: staticUrlFn(source.URL)}},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/stats/prometheus", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+	m.mergedMetricsHandler(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "application/openmetrics-text"))
+	body := rec.Body.String()
+	require.Contains(t, body, `requests_total{cluster="prod"} 1`)
+	require.True(t, strings.HasSuffix(body, "# EOF\n"), "missing EOF trailer: %s", body)
+}
@@ -0,0 +1,404 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package consuldp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// PrometheusPushProtocolPushgateway pushes metrics to a Prometheus
+	// Pushgateway, replacing the metrics of the job and instance.
+	PrometheusPushProtocolPushgateway = "pushgateway"
+	// PrometheusPushProtocolRemoteWrite pushes metrics to an endpoint
+	// implementing the Prometheus remote-write protocol.
+	PrometheusPushProtocolRemoteWrite = "remote-write"
+
+	defaultPushInterval = 30 * time.Second
+	defaultPushJob      = "consul-dataplane"
+
+	// pushFlushTimeout bounds the final push during a graceful shutdown,
+	// including its retries.
+	pushFlushTimeout = 10 * time.Second
+
+	// pushTimeout bounds each push attempt.
+	pushTimeout = 10 * time.Second
+
+	// A failed push is retried up to pushMaxAttempts times in total, backing
+	// off exponentially from pushInitialBackoff to pushMaxBackoff.
+	pushMaxAttempts    = 4
+	pushInitialBackoff = time.Second
+	pushMaxBackoff     = 10 * time.Second
+
+	// The labels identifying the pushed metrics.
+	pushJobLabel      = "job"
+	pushInstanceLabel = "instance"
+)
+
+func validPushProtocol(protocol string) bool {
+	return protocol == PrometheusPushProtocolPushgateway || protocol == PrometheusPushProtocolRemoteWrite
+}
+
+func validatePushConfig(cfg PrometheusPushConfig) error {
+	if cfg.Protocol != "" && !validPushProtocol(cfg.Protocol) {
+		return fmt.Errorf("-telemetry-prom-push-protocol must be one of %q or %q", PrometheusPushProtocolPushgateway, PrometheusPushProtocolRemoteWrite)
+	}
+	if cfg.Interval < 0 {
+		return errors.New("-telemetry-prom-push-interval must not be negative")
+	}
+	if cfg.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("invalid -telemetry-prom-push-url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid -telemetry-prom-push-url %q: scheme must be http or https", cfg.URL)
+	}
+	return nil
+}
+
+// pushError is a failed push, which is only retried if it may succeed later.
+type pushError struct {
+	err       error
+	retryable bool
+}
+
+func (e *pushError) Error() string { return e.err.Error() }
+func (e *pushError) Unwrap() error { return e.err }
+
+// metricsPusher periodically pushes the merged metrics to a Pushgateway or a
+// remote-write endpoint, for workloads that Prometheus can't scrape.
+type metricsPusher struct {
+	logger hclog.Logger
+	client httpClient
+	gather func(*http.Request) []*dto.MetricFamily
+
+	url      string
+	protocol string
+	interval time.Duration
+	job      string
+	instance string
+	headers  map[string]string
+
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	// mu serializes pushes, so that the final push isn't overwritten by a
+	// periodic push of older values.
+	mu sync.Mutex
+}
+
+func newMetricsPusher(logger hclog.Logger, cfg PrometheusPushConfig, client httpClient, gather func(*http.Request) []*dto.MetricFamily) *metricsPusher {
+	p := &metricsPusher{
+		logger:   logger.Named("push"),
+		client:   client,
+		gather:   gather,
+		url:      cfg.URL,
+		protocol: cfg.Protocol,
+		interval: cfg.Interval,
+		job:      cfg.Job,
+		instance: cfg.Instance,
+		headers:  cfg.Headers,
+
+		maxAttempts:    pushMaxAttempts,
+		initialBackoff: pushInitialBackoff,
+		maxBackoff:     pushMaxBackoff,
+	}
+	if p.protocol == "" {
+		p.protocol = PrometheusPushProtocolPushgateway
+	}
+	if p.interval == 0 {
+		p.interval = defaultPushInterval
+	}
+	if p.job == "" {
+		p.job = defaultPushJob
+	}
+	if p.instance == "" {
+		p.instance, _ = os.Hostname()
+	}
+	return p
+}
+
+// run pushes the merged metrics every interval until the context is done.
+func (p *metricsPusher) run(ctx context.Context) {
+	p.logger.Info("pushing merged metrics", "url", p.url, "protocol", p.protocol, "interval", p.interval)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.push(ctx); err != nil {
+				p.logger.Error("failed to push metrics", "error", err)
+			}
+		}
+	}
+}
+
+// flush pushes the current values of the merged metrics, so that they aren't
+// lost when the dataplane exits.
+func (p *metricsPusher) flush() {
+	p.logger.Info("pushing final metrics")
+	ctx, cancel := context.WithTimeout(context.Background(), pushFlushTimeout)
+	defer cancel()
+	if err := p.push(ctx); err != nil {
+		p.logger.Error("failed to push final metrics", "error", err)
+	}
+}
+
+// push gathers and pushes the merged metrics, retrying with exponential
+// backoff while the push fails with a retryable error.
+func (p *metricsPusher) push(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/stats/prometheus", nil)
+	if err != nil {
+		return err
+	}
+	families := p.gather(req)
+
+	var body []byte
+	var contentType string
+	switch p.protocol {
+	case PrometheusPushProtocolRemoteWrite:
+		body = snappy.Encode(nil, encodeRemoteWrite(families, p.groupingLabels(), time.Now()))
+		contentType = "application/x-protobuf"
+	default:
+		body, err = encodePushgateway(families)
+		if err != nil {
+			return err
+		}
+		contentType = string(expfmt.NewFormat(expfmt.TypeProtoDelim))
+	}
+
+	backoff := p.initialBackoff
+	for attempt := 1; ; attempt++ {
+		err = p.send(ctx, body, contentType)
+		var perr *pushError
+		if err == nil || !errors.As(err, &perr) || !perr.retryable || attempt >= p.maxAttempts {
+			return err
+		}
+		p.logger.Warn("failed to push metrics, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, p.maxBackoff)
+	}
+}
+
+// send makes a single push request.
+func (p *metricsPusher) send(ctx context.Context, body []byte, contentType string) error {
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	method, target := http.MethodPost, p.url
+	if p.protocol == PrometheusPushProtocolPushgateway {
+		// PUT replaces every metric of the grouping key, so that series that
+		// are no longer reported don't linger.
+		method, target = http.MethodPut, pushgatewayURL(p.url, p.job, p.instance)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if p.protocol == PrometheusPushProtocolRemoteWrite {
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return &pushError{err: err, retryable: true}
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if non2xxCode(resp.StatusCode) {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &pushError{
+			err: fmt.Errorf("status code %d: %s", resp.StatusCode, strings.TrimSpace(string(msg))),
+			// Other client errors won't succeed if the same push is retried.
+			retryable: resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		}
+	}
+	return nil
+}
+
+// groupingLabels are added to every series pushed with remote-write, which
+// has no other way to identify where the series came from.
+func (p *metricsPusher) groupingLabels() map[string]string {
+	return map[string]string{
+		pushJobLabel:      p.job,
+		pushInstanceLabel: p.instance,
+	}
+}
+
+// pushgatewayURL returns the URL of the Pushgateway group of the job and
+// instance. Values that can't be used as a path segment are base64 encoded.
+func pushgatewayURL(base, job, instance string) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSuffix(base, "/"))
+	b.WriteString("/metrics")
+	for _, kv := range [][2]string{{pushJobLabel, job}, {pushInstanceLabel, instance}} {
+		name, value := kv[0], kv[1]
+		if value == "" || strings.Contains(value, "/") {
+			name += "@base64"
+			value = base64.RawURLEncoding.EncodeToString([]byte(value))
+			if value == "" {
+				value = "="
+			}
+		}
+		b.WriteString("/" + name + "/" + url.PathEscape(value))
+	}
+	return b.String()
+}
+
+// encodePushgateway encodes the metric families in the delimited protobuf
+// format accepted by the Pushgateway.
+func encodePushgateway(families []*dto.MetricFamily) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.NewFormat(expfmt.TypeProtoDelim))
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			return nil, fmt.Errorf("failed to encode metrics: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeRemoteWrite encodes the metric families as an uncompressed
+// remote-write WriteRequest. Summaries and histograms are flattened into
+// their _sum, _count and quantile or _bucket series, as Prometheus does when
+// scraping. Samples without a timestamp are given the time now.
+func encodeRemoteWrite(families []*dto.MetricFamily, extraLabels map[string]string, now time.Time) []byte {
+	var buf []byte
+	for _, mf := range families {
+		for _, metric := range mf.GetMetric() {
+			ts := now.UnixMilli()
+			if metric.TimestampMs != nil {
+				ts = metric.GetTimestampMs()
+			}
+			add := func(name string, value float64, extra ...string) {
+				buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+				buf = protowire.AppendBytes(buf, encodeTimeSeries(name, metric.GetLabel(), extraLabels, extra, value, ts))
+			}
+
+			name := mf.GetName()
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, metric.GetGauge().GetValue())
+			case dto.MetricType_SUMMARY:
+				s := metric.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, q.GetValue(), "quantile", formatFloat(q.GetQuantile()))
+				}
+				add(name+"_sum", s.GetSampleSum())
+				add(name+"_count", float64(s.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				h := metric.GetHistogram()
+				inf := false
+				for _, bucket := range h.GetBucket() {
+					inf = inf || math.IsInf(bucket.GetUpperBound(), 1)
+					add(name+"_bucket", float64(bucket.GetCumulativeCount()), "le", formatFloat(bucket.GetUpperBound()))
+				}
+				if !inf {
+					add(name+"_bucket", float64(h.GetSampleCount()), "le", "+Inf")
+				}
+				add(name+"_sum", h.GetSampleSum())
+				add(name+"_count", float64(h.GetSampleCount()))
+			default:
+				add(name, metric.GetUntyped().GetValue())
+			}
+		}
+	}
+	return buf
+}
+
+// encodeTimeSeries encodes a remote-write TimeSeries with a single sample.
+// The labels of the metric take precedence over the extra labels, and are
+// sorted by name as remote-write requires.
+func encodeTimeSeries(name string, labels []*dto.LabelPair, extraLabels map[string]string, extra []string, value float64, ts int64) []byte {
+	all := make(map[string]string, len(labels)+len(extraLabels)+2)
+	for k, v := range extraLabels {
+		all[k] = v
+	}
+	for _, l := range labels {
+		all[l.GetName()] = l.GetValue()
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		all[extra[i]] = extra[i+1]
+	}
+	all["__name__"] = name
+
+	names := make([]string, 0, len(all))
+	for k := range all {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var series []byte
+	for _, k := range names {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, k)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, all[k])
+		series = protowire.AppendTag(series, 1, protowire.BytesType)
+		series = protowire.AppendBytes(series, label)
+	}
+
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(ts))
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+	return series
+}
+
+// formatFloat formats the value of a quantile or le label as Prometheus does.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
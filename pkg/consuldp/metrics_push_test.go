@@ -0,0 +1,299 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package consuldp
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// pushTestFamilies parses metric families from the Prometheus text format.
+func pushTestFamilies(t *testing.T, text string) []*dto.MetricFamily {
+	t.Helper()
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	byName, err := parser.TextToMetricFamilies(strings.NewReader(text))
+	require.NoError(t, err)
+	families := make([]*dto.MetricFamily, 0, len(byName))
+	for _, mf := range byName {
+		families = append(families, mf)
+	}
+	return families
+}
+
+// remoteWriteSeries is a decoded remote-write series with a single sample.
+type remoteWriteSeries struct {
+	labels map[string]string
+	value  float64
+	ts     int64
+}
+
+// decodeRemoteWrite decodes an uncompressed remote-write WriteRequest.
+func decodeRemoteWrite(t *testing.T, buf []byte) []remoteWriteSeries {
+	t.Helper()
+	var out []remoteWriteSeries
+	fields(t, buf, func(_ protowire.Number, ts []byte) {
+		s := remoteWriteSeries{labels: map[string]string{}}
+		fields(t, ts, func(num protowire.Number, v []byte) {
+			switch num {
+			case 1:
+				var name, value string
+				fields(t, v, func(num protowire.Number, v []byte) {
+					if num == 1 {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+				})
+				s.labels[name] = value
+			case 2:
+				_, _, n := protowire.ConsumeTag(v)
+				bits, m := protowire.ConsumeFixed64(v[n:])
+				s.value = math.Float64frombits(bits)
+				_, _, n2 := protowire.ConsumeTag(v[n+m:])
+				ts, _ := protowire.ConsumeVarint(v[n+m+n2:])
+				s.ts = int64(ts)
+			}
+		})
+		out = append(out, s)
+	})
+	return out
+}
+
+// fields calls fn with every length-delimited field of a message.
+func fields(t *testing.T, buf []byte, fn func(protowire.Number, []byte)) {
+	t.Helper()
+	for len(buf) > 0 {
+		num, typ, n := protowire.ConsumeTag(buf)
+		require.GreaterOrEqual(t, n, 0)
+		require.Equal(t, protowire.BytesType, typ)
+		v, m := protowire.ConsumeBytes(buf[n:])
+		require.GreaterOrEqual(t, m, 0)
+		fn(num, v)
+		buf = buf[n+m:]
+	}
+}
+
+func TestPushgatewayURL(t *testing.T) {
+	require.Equal(t, "http://pgw:9091/metrics/job/consul-dataplane/instance/web-1",
+		pushgatewayURL("http://pgw:9091/", "consul-dataplane", "web-1"))
+	require.Equal(t, "http://pgw:9091/metrics/job/dp/instance@base64/YS9i",
+		pushgatewayURL("http://pgw:9091", "dp", "a/b"))
+	require.Equal(t, "http://pgw:9091/metrics/job/dp/instance@base64/=",
+		pushgatewayURL("http://pgw:9091", "dp", ""))
+}
+
+func TestPushgateway(t *testing.T) {
+	type request struct {
+		method, path, contentType, tenant string
+		families                          map[string]*dto.MetricFamily
+	}
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		r := request{
+			method:      req.Method,
+			path:        req.URL.Path,
+			contentType: req.Header.Get("Content-Type"),
+			tenant:      req.Header.Get("X-Tenant"),
+			families:    map[string]*dto.MetricFamily{},
+		}
+		dec := expfmt.NewDecoder(req.Body, expfmt.NewFormat(expfmt.TypeProtoDelim))
+		for {
+			mf := &dto.MetricFamily{}
+			if err := dec.Decode(mf); err != nil {
+				break
+			}
+			r.families[mf.GetName()] = mf
+		}
+		requests <- r
+	}))
+	t.Cleanup(server.Close)
+
+	families := pushTestFamilies(t, "# TYPE envoy_requests counter\nenvoy_requests{route=\"a\"} 7\n")
+	p := newMetricsPusher(hclog.NewNullLogger(), PrometheusPushConfig{
+		URL:      server.URL,
+		Interval: 10 * time.Millisecond,
+		Instance: "web-1",
+		Headers:  map[string]string{"X-Tenant": "a"},
+	}, server.Client(), func(*http.Request) []*dto.MetricFamily { return families })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go p.run(ctx)
+
+	var r request
+	select {
+	case r = <-requests:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "metrics were not pushed")
+	}
+	require.Equal(t, http.MethodPut, r.method)
+	require.Equal(t, "/metrics/job/consul-dataplane/instance/web-1", r.path)
+	require.Contains(t, r.contentType, "application/vnd.google.protobuf")
+	require.Equal(t, "a", r.tenant)
+	require.Contains(t, r.families, "envoy_requests")
+	require.Equal(t, 7.0, r.families["envoy_requests"].GetMetric()[0].GetCounter().GetValue())
+}
+
+func TestRemoteWrite(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		series []remoteWriteSeries
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost ||
+			req.Header.Get("Content-Encoding") != "snappy" ||
+			req.Header.Get("Content-Type") != "application/x-protobuf" ||
+			req.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		decoded, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		mu.Lock()
+		series = decodeRemoteWrite(t, decoded)
+		mu.Unlock()
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	families := pushTestFamilies(t, `# TYPE up gauge
+up{instance="override"} 1
+# TYPE latency histogram
+latency_bucket{le="0.5"} 2
+latency_bucket{le="+Inf"} 3
+latency_sum 1.5
+latency_count 3
+`)
+	p := newMetricsPusher(hclog.NewNullLogger(), PrometheusPushConfig{
+		URL:      server.URL + "/api/v1/write",
+		Protocol: PrometheusPushProtocolRemoteWrite,
+		Job:      "jobs",
+		Instance: "web-1",
+	}, server.Client(), func(*http.Request) []*dto.MetricFamily { return families })
+	require.NoError(t, p.push(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	byName := map[string][]remoteWriteSeries{}
+	for _, s := range series {
+		byName[s.labels["__name__"]] = append(byName[s.labels["__name__"]], s)
+		require.Equal(t, "jobs", s.labels["job"])
+		require.NotZero(t, s.ts)
+	}
+	require.Len(t, byName["up"], 1)
+	require.Equal(t, "override", byName["up"][0].labels["instance"], "the labels of the metric take precedence")
+	require.Equal(t, 1.0, byName["up"][0].value)
+
+	require.Len(t, byName["latency_bucket"], 2)
+	require.Equal(t, "0.5", byName["latency_bucket"][0].labels["le"])
+	require.Equal(t, "+Inf", byName["latency_bucket"][1].labels["le"])
+	require.Equal(t, 3.0, byName["latency_bucket"][1].value)
+	require.Equal(t, "web-1", byName["latency_bucket"][1].labels["instance"])
+	require.Equal(t, 1.5, byName["latency_sum"][0].value)
+	require.Equal(t, 3.0, byName["latency_count"][0].value)
+}
+
+func TestPushRetry(t *testing.T) {
+	cases := map[string]struct {
+		statuses     []int
+		wantAttempts int32
+		wantErr      string
+	}{
+		"retries server errors": {
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			wantAttempts: 3,
+		},
+		"gives up after max attempts": {
+			statuses:     []int{500, 500, 500, 500, 500},
+			wantAttempts: 3,
+			wantErr:      "status code 500: unavailable",
+		},
+		"doesn't retry client errors": {
+			statuses:     []int{http.StatusBadRequest, http.StatusOK},
+			wantAttempts: 1,
+			wantErr:      "status code 400: unavailable",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				status := c.statuses[attempts.Add(1)-1]
+				rw.WriteHeader(status)
+				if status != http.StatusOK {
+					io.WriteString(rw, "unavailable\n")
+				}
+			}))
+			t.Cleanup(server.Close)
+
+			p := newMetricsPusher(hclog.NewNullLogger(), PrometheusPushConfig{URL: server.URL}, server.Client(),
+				func(*http.Request) []*dto.MetricFamily { return nil })
+			p.maxAttempts = 3
+			p.initialBackoff = time.Millisecond
+			p.maxBackoff = 2 * time.Millisecond
+
+			err := p.push(context.Background())
+			if c.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, c.wantErr)
+			}
+			require.Equal(t, c.wantAttempts, attempts.Load())
+		})
+	}
+}
+
+func TestGracefulShutdownFlushesMetrics(t *testing.T) {
+	proxy := &mockProxy{}
+	var quitBeforeFlush atomic.Bool
+	m := &lifecycleConfig{
+		shutdownGracePeriodSeconds: 0,
+		proxy:                      proxy,
+		flushMetrics: func() {
+			quitBeforeFlush.Store(proxy.quitCalled.Load() > 0)
+		},
+		errorExitCh: make(chan struct{}, 1),
+		mu:          sync.Mutex{},
+		logger:      hclog.NewNullLogger(),
+	}
+	m.gracefulShutdown()
+
+	require.EqualValues(t, 1, proxy.quitCalled.Load())
+	require.False(t, quitBeforeFlush.Load(), "metrics must be flushed before Envoy quits")
+}
+
+func TestFlushPushedMetrics(t *testing.T) {
+	var pushes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		pushes.Add(1)
+	}))
+	t.Cleanup(server.Close)
+
+	m := &metricsConfig{}
+	// Without a pusher, flushing does nothing.
+	m.flushPushedMetrics()
+
+	m.pusher = newMetricsPusher(hclog.NewNullLogger(), PrometheusPushConfig{URL: server.URL}, server.Client(),
+		func(*http.Request) []*dto.MetricFamily { return nil })
+	m.flushPushedMetrics()
+	require.EqualValues(t, 1, pushes.Load())
+}
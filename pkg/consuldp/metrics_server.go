@@ -0,0 +1,281 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package consuldp
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-rootcerts"
+
+	"github.com/hashicorp/consul-dataplane/internal/certreload"
+)
+
+const unixSocketPrefix = "unix://"
+
+// metricsListenAddr returns the address a metrics server listens on: either
+// a host:port pair or, if bindAddr has a "unix://" prefix, a unix socket.
+func metricsListenAddr(bindAddr string, port int) string {
+	if strings.HasPrefix(bindAddr, unixSocketPrefix) {
+		return bindAddr
+	}
+	return net.JoinHostPort(bindAddr, strconv.Itoa(port))
+}
+
+// validMetricsBindAddr returns true if addr is empty, an IP address or a
+// "unix://" socket path.
+func validMetricsBindAddr(addr string) bool {
+	if addr == "" {
+		return true
+	}
+	if path, ok := strings.CutPrefix(addr, unixSocketPrefix); ok {
+		return path != ""
+	}
+	return net.ParseIP(addr) != nil
+}
+
+// listenMetrics listens on an address returned by metricsListenAddr. A stale
+// unix socket left behind by a previous run is removed first.
+func listenMetrics(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, unixSocketPrefix); ok {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove stale metrics socket: %w", err)
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// serveMetrics serves srv on its address, over TLS if the metrics servers are
+// configured to use TLS.
+func (m *metricsConfig) serveMetrics(srv *http.Server) error {
+	lis, err := listenMetrics(srv.Addr)
+	if err != nil {
+		return err
+	}
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(lis, "", "")
+	}
+	return srv.Serve(lis)
+}
+
+// newMetricsServer returns a server for the handler on addr, with the TLS and
+// bearer token authentication of the metrics servers.
+func (m *metricsConfig) newMetricsServer(addr string, handler http.Handler) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           m.authenticate(handler),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if m.cfg != nil && m.cfg.Prometheus.ServerTLS {
+		tlsCfg, err := m.serverTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = tlsCfg
+	}
+	return srv, nil
+}
+
+// serverTLSConfig returns the TLS config of the metrics servers, which reuses
+// the certificate, key and CA used by Envoy to serve Prometheus metrics. The
+// certificate is reloaded when its files change. Client certificates are
+// required if ServerVerifyIncoming is set.
+func (m *metricsConfig) serverTLSConfig() (*tls.Config, error) {
+	prom := m.cfg.Prometheus
+	certs, err := certreload.New("metrics server", prom.CertFile, prom.KeyFile, m.logger)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg := &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if prom.ServerVerifyIncoming {
+		pool, err := loadCACertPool(prom.CACertsPath)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsCfg, nil
+}
+
+// serverBearerToken returns the bearer token required by the metrics servers,
+// or an empty string if no token is required. A token file is read on every
+// call so that rotated tokens are picked up.
+func (m *metricsConfig) serverBearerToken() (string, error) {
+	if m.cfg == nil {
+		return "", nil
+	}
+	if path := m.cfg.Prometheus.ServerBearerTokenPath; path != "" {
+		return readCredentialFile(path)
+	}
+	return m.cfg.Prometheus.ServerBearerToken, nil
+}
+
+// authenticate wraps a metrics server handler to require the bearer token, if
+// one is configured.
+func (m *metricsConfig) authenticate(next http.Handler) http.Handler {
+	if m.cfg == nil || (m.cfg.Prometheus.ServerBearerToken == "" && m.cfg.Prometheus.ServerBearerTokenPath == "") {
+		return next
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		token, err := m.serverBearerToken()
+		if err != nil {
+			m.logger.Error("failed to read metrics bearer token", "error", err)
+			http.Error(rw, "failed to read bearer token", http.StatusInternalServerError)
+			return
+		}
+		got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// cdpMetricsAddr returns the address the consul dataplane metrics server
+// listens on, which is only reachable over loopback by default. In dns-proxy
+// mode, the server listens on the Prometheus bind address instead.
+func (m *metricsConfig) cdpMetricsAddr() string {
+	if m.dnsProxy && m.cfg != nil && m.cfg.Prometheus.BindAddr != "" {
+		return m.cfg.Prometheus.BindAddr
+	}
+	bindAddr, port := defaultCDPMetricsBindHost, defaultCDPMetricsBindPort
+	if m.cfg != nil && m.cfg.Prometheus.DataplaneBindAddr != "" {
+		bindAddr = m.cfg.Prometheus.DataplaneBindAddr
+	}
+	if m.cfg != nil && m.cfg.Prometheus.DataplanePort != 0 {
+		port = m.cfg.Prometheus.DataplanePort
+	}
+	return metricsListenAddr(bindAddr, port)
+}
+
+// cdpMetricsSourceFor returns the source for the consul dataplane metrics,
+// with a client that can reach the server over a unix socket or TLS and
+// present the bearer token it requires.
+func (m *metricsConfig) cdpMetricsSourceFor(addr string) (metricsSource, error) {
+	source := metricsSource{name: cdpMetricsSource}
+	if m.cfg != nil && (m.cfg.Prometheus.ServerBearerToken != "" || m.cfg.Prometheus.ServerBearerTokenPath != "") {
+		source.header = func(h http.Header) error {
+			token, err := m.serverBearerToken()
+			if err != nil {
+				return fmt.Errorf("failed to read bearer token: %w", err)
+			}
+			h.Set("Authorization", "Bearer "+token)
+			return nil
+		}
+	}
+
+	scheme := "http"
+	var transport *http.Transport
+	if m.cfg != nil && m.cfg.Prometheus.ServerTLS {
+		tlsCfg, err := m.cdpMetricsClientTLSConfig()
+		if err != nil {
+			return metricsSource{}, err
+		}
+		scheme = "https"
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsCfg
+	}
+
+	host := addr
+	if path, ok := strings.CutPrefix(addr, unixSocketPrefix); ok {
+		if transport == nil {
+			transport = http.DefaultTransport.(*http.Transport).Clone()
+		}
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		// The host is only used for the Host header when dialing a socket.
+		host = "localhost"
+	} else if h, p, err := net.SplitHostPort(addr); err == nil {
+		// Dial the server over loopback if it listens on every interface.
+		if ip := net.ParseIP(h); ip != nil && ip.IsUnspecified() {
+			h = "127.0.0.1"
+			if ip.To4() == nil {
+				h = "::1"
+			}
+		}
+		host = net.JoinHostPort(h, p)
+	}
+
+	source.url = staticUrlFn(scheme + "://" + host)
+	if transport != nil {
+		source.client = &http.Client{Transport: transport}
+	}
+	return source, nil
+}
+
+// cdpMetricsClientTLSConfig returns the TLS config used to scrape the consul
+// dataplane metrics server. The server presents the dataplane's own
+// certificate, which is verified against the configured CA without checking
+// the host name, since it's dialed over loopback or a unix socket. The same
+// certificate is presented as a client certificate, and reloaded when its
+// files change.
+func (m *metricsConfig) cdpMetricsClientTLSConfig() (*tls.Config, error) {
+	prom := m.cfg.Prometheus
+	certs, err := certreload.New("metrics server", prom.CertFile, prom.KeyFile, m.logger)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := loadCACertPool(prom.CACertsPath)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		GetClientCertificate: certs.GetClientCertificate,
+		MinVersion:           tls.VersionTLS12,
+		// Host name verification is replaced by VerifyConnection.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("no server certificate")
+			}
+			opts := x509.VerifyOptions{
+				Roots:         pool,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, c := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(c)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}, nil
+}
+
+// loadCACertPool loads the CA certificates from a file or directory.
+func loadCACertPool(path string) (*x509.CertPool, error) {
+	var rootCfg rootcerts.Config
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certs: %w", err)
+	}
+	if fi.IsDir() {
+		rootCfg.CAPath = path
+	} else {
+		rootCfg.CAFile = path
+	}
+	pool, err := rootcerts.LoadCACerts(&rootCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA certs: %w", err)
+	}
+	return pool, nil
+}
@@ -0,0 +1,196 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package consuldp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsListenAddr(t *testing.T) {
+	require.Equal(t, "127.0.0.1:20101", metricsListenAddr("127.0.0.1", 20101))
+	require.Equal(t, "[::]:20100", metricsListenAddr("::", 20100))
+	require.Equal(t, "unix:///tmp/metrics.sock", metricsListenAddr("unix:///tmp/metrics.sock", 20100))
+}
+
+func TestValidMetricsBindAddr(t *testing.T) {
+	require.True(t, validMetricsBindAddr(""))
+	require.True(t, validMetricsBindAddr("127.0.0.1"))
+	require.True(t, validMetricsBindAddr("::"))
+	require.True(t, validMetricsBindAddr("unix:///tmp/metrics.sock"))
+	require.False(t, validMetricsBindAddr("unix://"))
+	require.False(t, validMetricsBindAddr("localhost"))
+	require.False(t, validMetricsBindAddr("127.0.0.1:20101"))
+}
+
+func TestCDPMetricsAddr(t *testing.T) {
+	m := &metricsConfig{cfg: &TelemetryConfig{}}
+	require.Equal(t, "127.0.0.1:20101", m.cdpMetricsAddr())
+
+	m.cfg.Prometheus.DataplaneBindAddr = "::"
+	m.cfg.Prometheus.DataplanePort = 1234
+	require.Equal(t, "[::]:1234", m.cdpMetricsAddr())
+
+	m.cfg.Prometheus.DataplaneBindAddr = "unix:///tmp/metrics.sock"
+	require.Equal(t, "unix:///tmp/metrics.sock", m.cdpMetricsAddr())
+}
+
+func TestCDPMetricsSourceURL(t *testing.T) {
+	cases := map[string]string{
+		"127.0.0.1:20101":          "http://127.0.0.1:20101",
+		"0.0.0.0:20101":            "http://127.0.0.1:20101",
+		"[::]:20101":               "http://[::1]:20101",
+		"unix:///tmp/metrics.sock": "http://localhost",
+	}
+	for addr, expURL := range cases {
+		t.Run(addr, func(t *testing.T) {
+			m := &metricsConfig{cfg: &TelemetryConfig{}}
+			source, err := m.cdpMetricsSourceFor(addr)
+			require.NoError(t, err)
+			require.Equal(t, cdpMetricsSource, source.name)
+			require.Equal(t, expURL, source.url(nil))
+		})
+	}
+}
+
+func TestMetricsServerTLSAndAuth(t *testing.T) {
+	dir := t.TempDir()
+	caFile, certFile, keyFile := writeTestCerts(t, dir)
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cr3t\n"), 0600))
+
+	m := &metricsConfig{
+		logger: hclog.NewNullLogger(),
+		cfg: &TelemetryConfig{
+			Prometheus: PrometheusTelemetryConfig{
+				CACertsPath:           caFile,
+				CertFile:              certFile,
+				KeyFile:               keyFile,
+				ServerTLS:             true,
+				ServerVerifyIncoming:  true,
+				ServerBearerTokenPath: tokenFile,
+			},
+		},
+		client: &http.Client{},
+	}
+
+	// Serve the metrics on a unix socket, over TLS and requiring the token.
+	addr := "unix://" + filepath.Join(dir, "metrics.sock")
+	srv, err := m.newMetricsServer(addr, http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(rw, "test_metric 1\n")
+	}))
+	require.NoError(t, err)
+	// The certificate is reloaded when it's rotated.
+	require.Empty(t, srv.TLSConfig.Certificates)
+	require.NotNil(t, srv.TLSConfig.GetCertificate)
+	go func() { _ = m.serveMetrics(srv) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	source, err := m.cdpMetricsSourceFor(addr)
+	require.NoError(t, err)
+	require.Equal(t, "https://localhost", source.url(nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/stats/prometheus", nil)
+	var result scrapeResult
+	require.Eventually(t, func() bool {
+		result = m.scrapeSource(req, source)
+		return result.err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Contains(t, result.families, "test_metric")
+
+	// Requests without the bearer token are rejected.
+	source.header = nil
+	result = m.scrapeSource(req, source)
+	require.ErrorContains(t, result.err, "status code 401")
+
+	// Clients without a certificate are rejected.
+	transport := source.client.(*http.Client).Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.GetClientCertificate = nil
+	resp, err := (&http.Client{Transport: transport}).Get("https://localhost")
+	if err == nil {
+		resp.Body.Close()
+	}
+	require.Error(t, err)
+}
+
+func TestMetricsServerTLSMissingCert(t *testing.T) {
+	m := &metricsConfig{
+		cfg: &TelemetryConfig{
+			Prometheus: PrometheusTelemetryConfig{
+				CertFile:  "does-not-exist.pem",
+				KeyFile:   "does-not-exist.pem",
+				ServerTLS: true,
+			},
+		},
+	}
+	_, err := m.newMetricsServer("127.0.0.1:0", http.NotFoundHandler())
+	require.ErrorContains(t, err, "failed to load metrics server certificate")
+}
+
+// writeTestCerts writes a CA certificate and a certificate signed by it, for
+// both server and client authentication, to dir.
+func writeTestCerts(t *testing.T, dir string) (caFile, certFile, keyFile string) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "consul-dataplane"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.5")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	caFile = filepath.Join(dir, "ca.pem")
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600))
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	// Make sure the certificates are usable.
+	_, err = tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	return caFile, certFile, keyFile
+}
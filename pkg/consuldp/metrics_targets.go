@@ -0,0 +1,138 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package consuldp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// serviceMetricsSources returns the sources for the application metrics: the
+// ServiceMetricsURL, if set, followed by each of the ServiceMetricsTargets.
+func serviceMetricsSources(cfg PrometheusTelemetryConfig) ([]metricsSource, error) {
+	var sources []metricsSource
+	if cfg.ServiceMetricsURL != "" {
+		sources = append(sources, metricsSource{name: serviceMetricsSource, url: staticUrlFn(cfg.ServiceMetricsURL)})
+	}
+	for _, target := range cfg.ServiceMetricsTargets {
+		source, err := newServiceMetricsSource(target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure service metrics target %q: %w", target.Name, err)
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// newServiceMetricsSource returns the source for an application metrics
+// target, with a dedicated client if the target has TLS configuration.
+func newServiceMetricsSource(target ServiceMetricsTarget) (metricsSource, error) {
+	source := metricsSource{
+		name:    target.Name,
+		url:     staticUrlFn(target.URL),
+		timeout: target.Timeout,
+		labels:  target.Labels,
+		header:  serviceMetricsHeaderFn(target),
+	}
+
+	if target.TLS != nil {
+		tlsCfg, err := target.TLS.Load()
+		if err != nil {
+			return metricsSource{}, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsCfg
+		source.client = &http.Client{Transport: transport}
+	}
+	return source, nil
+}
+
+// serviceMetricsHeaderFn returns a function that adds the target's headers
+// and credentials to a scrape request. Credential files are read on every
+// call so that rotated credentials are picked up.
+func serviceMetricsHeaderFn(target ServiceMetricsTarget) func(http.Header) error {
+	return func(h http.Header) error {
+		for k, v := range target.Headers {
+			h.Set(k, v)
+		}
+		if target.BearerTokenFile != "" {
+			token, err := readCredentialFile(target.BearerTokenFile)
+			if err != nil {
+				return fmt.Errorf("failed to read bearer token: %w", err)
+			}
+			h.Set("Authorization", "Bearer "+token)
+		}
+		if target.BasicAuthUsername != "" {
+			var password string
+			if target.BasicAuthPasswordFile != "" {
+				var err error
+				password, err = readCredentialFile(target.BasicAuthPasswordFile)
+				if err != nil {
+					return fmt.Errorf("failed to read basic auth password: %w", err)
+				}
+			}
+			req := http.Request{Header: h}
+			req.SetBasicAuth(target.BasicAuthUsername, password)
+		}
+		return nil
+	}
+}
+
+func readCredentialFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// validateServiceMetricsTargets checks that every application metrics target
+// has a URL and a unique name that can be used as a metric name prefix.
+func validateServiceMetricsTargets(cfg PrometheusTelemetryConfig) error {
+	names := map[string]bool{
+		cdpMetricsSource:     true,
+		envoyMetricsSource:   true,
+		serviceMetricsSource: cfg.ServiceMetricsURL != "",
+	}
+	for _, target := range cfg.ServiceMetricsTargets {
+		if target.Name == "" {
+			return errors.New("-telemetry-prom-service-metrics-target name must not be empty")
+		}
+		if !model.LegacyValidation.IsValidLabelName(target.Name) {
+			return fmt.Errorf("invalid -telemetry-prom-service-metrics-target name %q", target.Name)
+		}
+		if names[target.Name] {
+			return fmt.Errorf("-telemetry-prom-service-metrics-target name %q is already in use", target.Name)
+		}
+		names[target.Name] = true
+
+		if target.URL == "" {
+			return fmt.Errorf("-telemetry-prom-service-metrics-target %q must have a url", target.Name)
+		}
+		if _, err := url.Parse(target.URL); err != nil {
+			return fmt.Errorf("invalid -telemetry-prom-service-metrics-target %q url: %w", target.Name, err)
+		}
+		if target.Timeout < 0 {
+			return fmt.Errorf("-telemetry-prom-service-metrics-target %q timeout must not be negative", target.Name)
+		}
+		if target.BearerTokenFile != "" && target.BasicAuthUsername != "" {
+			return fmt.Errorf("-telemetry-prom-service-metrics-target %q must not use both bearer token and basic auth", target.Name)
+		}
+		if target.BasicAuthPasswordFile != "" && target.BasicAuthUsername == "" {
+			return fmt.Errorf("-telemetry-prom-service-metrics-target %q basic auth password requires a username", target.Name)
+		}
+		for name := range target.Labels {
+			if !validConstLabelName(name) {
+				return fmt.Errorf("invalid -telemetry-prom-service-metrics-target %q label name %q", target.Name, name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package consuldp
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceMetricsTargets(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cr3t\n"), 0600))
+	passwordFile := filepath.Join(dir, "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("hunter2"), 0600))
+
+	bearer := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer s3cr3t" || req.Header.Get("X-Tenant") != "a" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(rw, "bearer_metric 1\n")
+	}))
+	t.Cleanup(bearer.Close)
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: bearer.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0600))
+
+	basic := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if user, pass, ok := req.BasicAuth(); !ok || user != "prom" || pass != "hunter2" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(rw, "basic_metric{team=\"db\"} 1\n")
+	}))
+	t.Cleanup(basic.Close)
+
+	unblock := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		select {
+		case <-unblock:
+		case <-req.Context().Done():
+		}
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(unblock) })
+
+	prom := PrometheusTelemetryConfig{
+		ScrapeTimeout: 10 * time.Second,
+		ServiceMetricsTargets: []ServiceMetricsTarget{
+			{
+				Name:            "bearer",
+				URL:             bearer.URL,
+				Headers:         map[string]string{"X-Tenant": "a"},
+				BearerTokenFile: tokenFile,
+				TLS:             &TLSConfig{CACertsPath: caFile},
+			},
+			{
+				Name:                  "basic",
+				URL:                   basic.URL,
+				BasicAuthUsername:     "prom",
+				BasicAuthPasswordFile: passwordFile,
+				Labels:                map[string]string{"team": "payments", "tier": "db"},
+			},
+			{
+				Name:    "slow",
+				URL:     slow.URL,
+				Timeout: 100 * time.Millisecond,
+			},
+		},
+	}
+	require.NoError(t, validateServiceMetricsTargets(prom))
+	sources, err := serviceMetricsSources(prom)
+	require.NoError(t, err)
+	// Scrapes are bounded by their timeout rather than by the client's.
+	require.Zero(t, sources[0].client.(*http.Client).Timeout)
+	require.Zero(t, NewMetricsConfig(&Config{Telemetry: &TelemetryConfig{}}, nil).client.(*http.Client).Timeout)
+
+	m := &metricsConfig{
+		logger:  hclog.NewNullLogger(),
+		cfg:     &TelemetryConfig{Prometheus: prom},
+		client:  &http.Client{},
+		sources: sources,
+	}
+
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	m.mergedMetricsHandler(rec, httptest.NewRequest(http.MethodGet, "/stats/prometheus", nil))
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	body := rec.Body.String()
+	require.Contains(t, body, "bearer_metric 1\n")
+	// Target labels don't override the labels of the scraped metrics.
+	require.Contains(t, body, `basic_metric{team="db",tier="db"} 1`)
+	require.Contains(t, body, `consul_dataplane_scrape_up{source="bearer"} 1`)
+	require.Contains(t, body, `consul_dataplane_scrape_up{source="basic"} 1`)
+	require.Contains(t, body, `consul_dataplane_scrape_up{source="slow"} 0`)
+}
+
+func TestServiceMetricsSourcesLegacyURL(t *testing.T) {
+	sources, err := serviceMetricsSources(PrometheusTelemetryConfig{
+		ServiceMetricsURL:     "http://127.0.0.1:8080/metrics",
+		ServiceMetricsTargets: []ServiceMetricsTarget{{Name: "app", URL: "http://127.0.0.1:9090/metrics"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+	require.Equal(t, serviceMetricsSource, sources[0].name)
+	require.Equal(t, "app", sources[1].name)
+	require.Nil(t, sources[1].client)
+}
+
+func TestServiceMetricsSourcesBadTLS(t *testing.T) {
+	_, err := serviceMetricsSources(PrometheusTelemetryConfig{
+		ServiceMetricsTargets: []ServiceMetricsTarget{{
+			Name: "app",
+			URL:  "https://127.0.0.1:9090/metrics",
+			TLS:  &TLSConfig{CACertsPath: "/does/not/exist"},
+		}},
+	})
+	require.ErrorContains(t, err, `failed to configure service metrics target "app"`)
+}
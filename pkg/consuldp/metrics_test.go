@@ -12,11 +12,13 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-metrics"
 	"github.com/stretchr/testify/require"
 
@@ -31,6 +33,7 @@ var (
 
 	// net/url encodes value-less query params with an '='
 	envoyMetricsUrl = fmt.Sprintf("http://%s:%v/stats/prometheus?usedonly=", envoyMetricsAddr, envoyMetricsPort)
+	cdpMetricsUrl   = fmt.Sprintf("http://%s:%d", defaultCDPMetricsBindHost, defaultCDPMetricsBindPort)
 
 	emptyTags = []metrics.Label{}
 )
@@ -96,8 +99,16 @@ func TestMetricsServerEnabled(t *testing.T) {
 			telemetry: &TelemetryConfig{UseCentralConfig: true},
 			bindAddr:  mergedMetricsBackendBindAddr,
 			expMetrics: []string{
-				makeFakeMetric(cdpMetricsUrl),
-				makeFakeMetric(envoyMetricsUrl),
+				makeMergedFakeMetric(cdpMetricsSource, cdpMetricsUrl),
+				makeMergedFakeMetric(envoyMetricsSource, envoyMetricsUrl),
+			},
+		},
+		"without central config": {
+			telemetry: &TelemetryConfig{UseCentralConfig: false},
+			bindAddr:  mergedMetricsBackendBindAddr,
+			expMetrics: []string{
+				makeMergedFakeMetric(cdpMetricsSource, cdpMetricsUrl),
+				makeMergedFakeMetric(envoyMetricsSource, envoyMetricsUrl),
 			},
 		},
 		"with service metrics": {
@@ -109,9 +120,9 @@ func TestMetricsServerEnabled(t *testing.T) {
 			},
 			bindAddr: mergedMetricsBackendBindAddr,
 			expMetrics: []string{
-				makeFakeMetric(cdpMetricsUrl),
-				makeFakeMetric(envoyMetricsUrl),
-				makeFakeMetric("fake-service-metrics-url"),
+				makeMergedFakeMetric(cdpMetricsSource, cdpMetricsUrl),
+				makeMergedFakeMetric(envoyMetricsSource, envoyMetricsUrl),
+				makeMergedFakeMetric(serviceMetricsSource, "fake-service-metrics-url"),
 			},
 		},
 		"custom scrape path": {
@@ -126,9 +137,9 @@ func TestMetricsServerEnabled(t *testing.T) {
 			},
 			bindAddr: mergedMetricsBackendBindAddr,
 			expMetrics: []string{
-				makeFakeMetric(cdpMetricsUrl),
-				makeFakeMetric(envoyMetricsUrl),
-				makeFakeMetric("fake-service-metrics-url"),
+				makeMergedFakeMetric(cdpMetricsSource, cdpMetricsUrl),
+				makeMergedFakeMetric(envoyMetricsSource, envoyMetricsUrl),
+				makeMergedFakeMetric(serviceMetricsSource, "fake-service-metrics-url"),
 			},
 		},
 		"custom merge port": {
@@ -144,9 +155,9 @@ func TestMetricsServerEnabled(t *testing.T) {
 			},
 			bindAddr: mergedMetricsBackendBindHost + "1234",
 			expMetrics: []string{
-				makeFakeMetric(cdpMetricsUrl),
-				makeFakeMetric(envoyMetricsUrl),
-				makeFakeMetric("fake-service-metrics-url"),
+				makeMergedFakeMetric(cdpMetricsSource, cdpMetricsUrl),
+				makeMergedFakeMetric(envoyMetricsSource, envoyMetricsUrl),
+				makeMergedFakeMetric(serviceMetricsSource, "fake-service-metrics-url"),
 			},
 		},
 	}
@@ -210,15 +221,129 @@ func TestMetricsServerEnabled(t *testing.T) {
 
 			body, err := io.ReadAll(resp.Body)
 			require.NoError(t, err)
-			expMetrics := strings.Join(c.expMetrics, "")
-			require.Equal(t, expMetrics, string(body))
+			// Every source serves the same metric family, so the metrics are
+			// merged into one family labelled by source, followed by the
+			// scrape series for every source.
+			expMetrics := "# TYPE fake_metric untyped\n" + strings.Join(c.expMetrics, "")
+			require.Contains(t, string(body), expMetrics)
+			require.Contains(t, string(body), `consul_dataplane_scrape_up{source="consul_dataplane"} 1`)
+			require.Contains(t, string(body), `consul_dataplane_scrape_up{source="envoy"} 1`)
+			if c.telemetry.Prometheus.ServiceMetricsURL != "" {
+				require.Contains(t, string(body), `consul_dataplane_scrape_up{source="service"} 1`)
+			}
 
 		})
 	}
 }
 
+func TestDNSProxyMetrics(t *testing.T) {
+	// Find a free port for the metrics server.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	bindAddr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	statsd, buf := setupTestServerAndBuffer(t)
+	t.Cleanup(func() { _ = statsd.Close() })
+
+	telemetry := &TelemetryConfig{
+		Prometheus: PrometheusTelemetryConfig{BindAddr: bindAddr},
+		StatsdURL:  "udp://" + statsd.LocalAddr().String(),
+	}
+	m := NewMetricsConfig(&Config{Mode: ModeTypeDNSProxy, Telemetry: telemetry}, nil)
+
+	var bcfg bootstrap.BootstrapConfig
+	applyLocalTelemetryConfig(&bcfg, telemetry)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	require.NoError(t, m.startMetrics(ctx, &bcfg))
+
+	// Consul Dataplane's metrics are served directly, without being merged
+	// with Envoy's.
+	require.Nil(t, m.promScrapeServer)
+	require.Equal(t, bindAddr, m.cdpMetricsServer.Addr)
+	require.Len(t, m.sinks, 2)
+
+	m.cacheSink.IncrCounter([]string{"dns", "test"}, 1)
+	var body string
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + bindAddr + "/metrics")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		body = string(b)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Contains(t, body, "consul_dataplane_go_goroutines")
+	require.Contains(t, body, "consul_dataplane_dns_test 1")
+	// DNS metrics are defined up front, so they're served before any query.
+	require.Contains(t, body, "consul_dataplane_dns_inflight_queries")
+
+	// The statsd sink flushes on an interval.
+	require.NoError(t, statsd.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := statsd.Read(buf)
+	require.NoError(t, err)
+	require.Contains(t, string(buf[:n]), "dns.test:1")
+}
+
+func TestMergedMetricsHandlerPartialResults(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(rw, "healthy_metric 1")
+	}))
+	t.Cleanup(healthy.Close)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+
+	unblock := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		select {
+		case <-unblock:
+		case <-req.Context().Done():
+		}
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(unblock) })
+
+	m := &metricsConfig{
+		logger: hclog.NewNullLogger(),
+		cfg: &TelemetryConfig{
+			Prometheus: PrometheusTelemetryConfig{ScrapeTimeout: 100 * time.Millisecond},
+		},
+		client: &http.Client{Timeout: 10 * time.Second},
+		sources: []metricsSource{
+			{name: cdpMetricsSource, url: staticUrlFn(healthy.URL)},
+			{name: envoyMetricsSource, url: staticUrlFn(failing.URL)},
+			{name: serviceMetricsSource, url: staticUrlFn(slow.URL)},
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	m.mergedMetricsHandler(rec, httptest.NewRequest(http.MethodGet, "/stats/prometheus", nil))
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	require.Contains(t, body, "healthy_metric 1\n")
+	require.Contains(t, body, `consul_dataplane_scrape_up{source="consul_dataplane"} 1`)
+	require.Contains(t, body, `consul_dataplane_scrape_up{source="envoy"} 0`)
+	require.Contains(t, body, `consul_dataplane_scrape_up{source="service"} 0`)
+	for _, source := range []string{cdpMetricsSource, envoyMetricsSource, serviceMetricsSource} {
+		require.Contains(t, body, fmt.Sprintf("consul_dataplane_scrape_duration_seconds{source=%q} ", source))
+	}
+}
+
 type mockClient struct{}
 
+func (c *mockClient) Do(req *http.Request) (*http.Response, error) {
+	return c.Get(req.URL.String())
+}
+
 func (c *mockClient) Get(url string) (*http.Response, error) {
 	buf := bytes.NewBufferString(makeFakeMetric(url))
 	return &http.Response{
@@ -234,7 +359,11 @@ func (c *mockClient) Post(url string, contentType string, body io.Reader) (*http
 }
 
 func makeFakeMetric(url string) string {
-	return fmt.Sprintf(`fake_metric{url="%s"} 1\n`, url)
+	return fmt.Sprintf("fake_metric{url=%q} 1\n", url)
+}
+
+func makeMergedFakeMetric(source, url string) string {
+	return fmt.Sprintf("fake_metric{source=%q,url=%q} 1\n", source, url)
 }
 
 func TestMetricsStatsD(t *testing.T) {
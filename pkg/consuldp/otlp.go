@@ -0,0 +1,459 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package consuldp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/proto-public/pbdataplane"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	"github.com/hashicorp/consul-dataplane/internal/bootstrap"
+)
+
+const (
+	// OTLPProtocolGRPC exports metrics using OTLP over gRPC.
+	OTLPProtocolGRPC = "grpc"
+	// OTLPProtocolHTTP exports metrics using OTLP over HTTP with protobuf
+	// encoded payloads.
+	OTLPProtocolHTTP = "http/protobuf"
+
+	defaultOTLPExportInterval = 60 * time.Second
+	otlpShutdownTimeout       = 5 * time.Second
+	envoyStatsTimeout         = 10 * time.Second
+
+	otlpMeterName         = "github.com/hashicorp/consul-dataplane"
+	otlpMetricPrefix      = "consul_dataplane"
+	otlpEnvoyMetricPrefix = "envoy."
+
+	// dnsProxyServiceName is the service.name of the metrics exported by a
+	// DNS proxy, which doesn't belong to a service.
+	dnsProxyServiceName = "consul-dataplane-dns-proxy"
+)
+
+func validOTLPProtocol(protocol string) bool {
+	return protocol == OTLPProtocolGRPC || protocol == OTLPProtocolHTTP
+}
+
+// resolveOTLPConfig merges the OTLP configuration from the proxy's central
+// configuration with the dataplane's own. Fields set on the dataplane take
+// precedence, and headers are merged per key.
+func resolveOTLPConfig(local OTLPTelemetryConfig, bcfg *bootstrap.BootstrapConfig) (OTLPTelemetryConfig, error) {
+	cfg := OTLPTelemetryConfig{
+		Endpoint:   bcfg.OTLPMetricsEndpoint,
+		Protocol:   bcfg.OTLPMetricsProtocol,
+		Insecure:   bcfg.OTLPMetricsInsecure,
+		EnvoyStats: bcfg.OTLPMetricsEnvoyStats,
+	}
+	if bcfg.OTLPMetricsExportInterval != "" {
+		interval, err := time.ParseDuration(bcfg.OTLPMetricsExportInterval)
+		if err != nil {
+			return OTLPTelemetryConfig{}, fmt.Errorf("failed to parse envoy_otlp_metrics_export_interval: %w", err)
+		}
+		cfg.ExportInterval = interval
+	}
+
+	if local.Endpoint != "" {
+		cfg.Endpoint = local.Endpoint
+	}
+	if local.Protocol != "" {
+		cfg.Protocol = local.Protocol
+	}
+	if local.ExportInterval > 0 {
+		cfg.ExportInterval = local.ExportInterval
+	}
+	cfg.Insecure = cfg.Insecure || local.Insecure
+	cfg.EnvoyStats = cfg.EnvoyStats || local.EnvoyStats
+
+	if len(bcfg.OTLPMetricsHeaders)+len(local.Headers) > 0 {
+		cfg.Headers = make(map[string]string, len(bcfg.OTLPMetricsHeaders)+len(local.Headers))
+		for k, v := range bcfg.OTLPMetricsHeaders {
+			cfg.Headers[k] = v
+		}
+		for k, v := range local.Headers {
+			cfg.Headers[k] = v
+		}
+	}
+
+	if cfg.Protocol == "" {
+		cfg.Protocol = OTLPProtocolGRPC
+	}
+	if !validOTLPProtocol(cfg.Protocol) {
+		return OTLPTelemetryConfig{}, fmt.Errorf("unsupported OTLP protocol %q", cfg.Protocol)
+	}
+	if cfg.ExportInterval <= 0 {
+		cfg.ExportInterval = defaultOTLPExportInterval
+	}
+	return cfg, nil
+}
+
+// newOTLPExporter returns an exporter for the configured protocol. The
+// endpoint may be given either as a host:port pair or as a URL.
+func newOTLPExporter(ctx context.Context, cfg OTLPTelemetryConfig) (sdkmetric.Exporter, error) {
+	isURL := strings.Contains(cfg.Endpoint, "://")
+
+	switch cfg.Protocol {
+	case OTLPProtocolHTTP:
+		var opts []otlpmetrichttp.Option
+		if isURL {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlpmetrichttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(cfg.Headers))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	default:
+		var opts []otlpmetricgrpc.Option
+		if isURL {
+			opts = append(opts, otlpmetricgrpc.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(cfg.Headers))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	}
+}
+
+// otlpResource describes the proxy that metrics exported over OTLP are
+// reported for.
+func otlpResource(params *pbdataplane.GetEnvoyBootstrapParamsResponse) *resource.Resource {
+	service := params.Service
+	if params.Identity != "" {
+		service = params.Identity
+	}
+
+	var attrs []attribute.KeyValue
+	for _, attr := range []struct{ key, value string }{
+		{"service.name", service},
+		{"consul.namespace", params.Namespace},
+		{"consul.partition", params.Partition},
+		{"consul.datacenter", params.Datacenter},
+		{"consul.node", params.NodeName},
+	} {
+		if attr.value != "" {
+			attrs = append(attrs, attribute.String(attr.key, attr.value))
+		}
+	}
+	return resource.NewSchemaless(attrs...)
+}
+
+// otlpSink is a go-metrics sink that records consul-dataplane's metrics with
+// OpenTelemetry instruments. Gauges, counters and samples are recorded as
+// gauges, counters and histograms respectively.
+type otlpSink struct {
+	logger hclog.Logger
+	meter  otelmetric.Meter
+
+	mu         sync.Mutex
+	gauges     map[string]otelmetric.Float64Gauge
+	counters   map[string]otelmetric.Float64Counter
+	histograms map[string]otelmetric.Float64Histogram
+}
+
+var _ metrics.MetricSink = (*otlpSink)(nil)
+
+func newOTLPSink(logger hclog.Logger, meter otelmetric.Meter) *otlpSink {
+	return &otlpSink{
+		logger:     logger,
+		meter:      meter,
+		gauges:     make(map[string]otelmetric.Float64Gauge),
+		counters:   make(map[string]otelmetric.Float64Counter),
+		histograms: make(map[string]otelmetric.Float64Histogram),
+	}
+}
+
+// SetGauge defaults to SetGaugeWithLabels
+func (s *otlpSink) SetGauge(key []string, val float32) {
+	s.SetGaugeWithLabels(key, val, nil)
+}
+
+// SetGaugeWithLabels records the value of a gauge.
+func (s *otlpSink) SetGaugeWithLabels(key []string, val float32, labels []metrics.Label) {
+	name := otlpMetricName(key)
+
+	s.mu.Lock()
+	gauge, ok := s.gauges[name]
+	if !ok {
+		var err error
+		gauge, err = s.meter.Float64Gauge(name)
+		s.instrumentError(name, err)
+		s.gauges[name] = gauge
+	}
+	s.mu.Unlock()
+
+	gauge.Record(context.Background(), float64(val), otelmetric.WithAttributes(otlpAttributes(labels)...))
+}
+
+// EmitKey is not supported over OTLP, matching the Prometheus sink.
+func (s *otlpSink) EmitKey(key []string, val float32) {}
+
+// IncrCounter defaults to IncrCounterWithLabels
+func (s *otlpSink) IncrCounter(key []string, val float32) {
+	s.IncrCounterWithLabels(key, val, nil)
+}
+
+// IncrCounterWithLabels increments a counter.
+func (s *otlpSink) IncrCounterWithLabels(key []string, val float32, labels []metrics.Label) {
+	name := otlpMetricName(key)
+
+	s.mu.Lock()
+	counter, ok := s.counters[name]
+	if !ok {
+		var err error
+		counter, err = s.meter.Float64Counter(name)
+		s.instrumentError(name, err)
+		s.counters[name] = counter
+	}
+	s.mu.Unlock()
+
+	counter.Add(context.Background(), float64(val), otelmetric.WithAttributes(otlpAttributes(labels)...))
+}
+
+// AddSample defaults to AddSampleWithLabels
+func (s *otlpSink) AddSample(key []string, val float32) {
+	s.AddSampleWithLabels(key, val, nil)
+}
+
+// AddSampleWithLabels records a sample in a histogram.
+func (s *otlpSink) AddSampleWithLabels(key []string, val float32, labels []metrics.Label) {
+	name := otlpMetricName(key)
+
+	s.mu.Lock()
+	histogram, ok := s.histograms[name]
+	if !ok {
+		var err error
+		histogram, err = s.meter.Float64Histogram(name)
+		s.instrumentError(name, err)
+		s.histograms[name] = histogram
+	}
+	s.mu.Unlock()
+
+	histogram.Record(context.Background(), float64(val), otelmetric.WithAttributes(otlpAttributes(labels)...))
+}
+
+// instrumentError logs a failure to create an instrument. The meter still
+// returns a usable instrument, so it's cached to only log once per metric.
+func (s *otlpSink) instrumentError(name string, err error) {
+	if err != nil {
+		s.logger.Warn("failed to create OTLP instrument", "name", name, "error", err)
+	}
+}
+
+// otlpMetricName flattens a go-metrics key using the same naming as the
+// Prometheus sink, e.g. consul_dataplane_envoy_connected.
+func otlpMetricName(key []string) string {
+	return sanitizeOTLPName(strings.Join(append([]string{otlpMetricPrefix}, key...), "_"))
+}
+
+// sanitizeOTLPName replaces the characters that aren't permitted in an
+// OpenTelemetry instrument name with underscores.
+func sanitizeOTLPName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '_', r == '.', r == '-', r == '/':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+func otlpAttributes(labels []metrics.Label) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, len(labels))
+	for i, l := range labels {
+		attrs[i] = attribute.String(l.Name, l.Value)
+	}
+	return attrs
+}
+
+// envoyStatsBridge periodically reads Envoy's counters and gauges from its
+// admin API and reports them through observable OpenTelemetry instruments, so
+// they're exported over OTLP without a Prometheus scrape. Instruments are named
+// after the Envoy stat with an "envoy." prefix. Histograms are not bridged.
+type envoyStatsBridge struct {
+	logger   hclog.Logger
+	client   httpClient
+	meter    otelmetric.Meter
+	adminURL string
+	interval time.Duration
+
+	mu          sync.Mutex
+	values      map[string]float64
+	instruments map[string]struct{}
+}
+
+// envoyStatsTypes maps the stat types requested from Envoy to whether they
+// are monotonic counters.
+var envoyStatsTypes = []struct {
+	name    string
+	counter bool
+}{
+	{"Counters", true},
+	{"Gauges", false},
+}
+
+func newEnvoyStatsBridge(logger hclog.Logger, client httpClient, meter otelmetric.Meter, adminAddr string, adminPort int, interval time.Duration) *envoyStatsBridge {
+	return &envoyStatsBridge{
+		logger:      logger,
+		client:      client,
+		meter:       meter,
+		adminURL:    fmt.Sprintf("http://%s/stats", net.JoinHostPort(adminAddr, strconv.Itoa(adminPort))),
+		interval:    interval,
+		values:      make(map[string]float64),
+		instruments: make(map[string]struct{}),
+	}
+}
+
+// run polls Envoy's stats until the context is cancelled.
+func (b *envoyStatsBridge) run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.poll(ctx); err != nil {
+			b.logger.Warn("failed to read envoy stats", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll reads the current value of Envoy's counters and gauges, registering
+// instruments for any stats that haven't been seen before.
+func (b *envoyStatsBridge) poll(ctx context.Context) error {
+	values := make(map[string]float64)
+	var newInstruments []string
+	counters := make(map[string]bool)
+
+	for _, typ := range envoyStatsTypes {
+		stats, err := b.fetch(ctx, typ.name)
+		if err != nil {
+			return err
+		}
+		for _, stat := range stats {
+			name := otlpEnvoyMetricPrefix + sanitizeOTLPName(stat.Name)
+			values[name] = stat.Value
+			counters[name] = typ.counter
+		}
+	}
+
+	b.mu.Lock()
+	b.values = values
+	for name := range values {
+		if _, ok := b.instruments[name]; !ok {
+			b.instruments[name] = struct{}{}
+			newInstruments = append(newInstruments, name)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, name := range newInstruments {
+		b.register(name, counters[name])
+	}
+	return nil
+}
+
+// register creates an observable instrument that reports the last polled
+// value of the named stat.
+func (b *envoyStatsBridge) register(name string, counter bool) {
+	callback := func(_ context.Context, o otelmetric.Float64Observer) error {
+		b.mu.Lock()
+		v, ok := b.values[name]
+		b.mu.Unlock()
+		if ok {
+			o.Observe(v)
+		}
+		return nil
+	}
+
+	var err error
+	if counter {
+		_, err = b.meter.Float64ObservableCounter(name, otelmetric.WithFloat64Callback(callback))
+	} else {
+		_, err = b.meter.Float64ObservableGauge(name, otelmetric.WithFloat64Callback(callback))
+	}
+	if err != nil {
+		b.logger.Warn("failed to create OTLP instrument", "name", name, "error", err)
+	}
+}
+
+type envoyStat struct {
+	Name  string
+	Value float64
+}
+
+// fetch reads stats of the given type from Envoy. Only stats that have been
+// updated are requested, to avoid exporting every stat Envoy has allocated.
+func (b *envoyStatsBridge) fetch(ctx context.Context, typ string) ([]envoyStat, error) {
+	ctx, cancel := context.WithTimeout(ctx, envoyStatsTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.adminURL+"?format=json&usedonly&type="+typ, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			b.logger.Warn("failed to close envoy stats request", "error", err)
+		}
+	}()
+
+	if non2xxCode(resp.StatusCode) {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Stats []struct {
+			Name  string   `json:"name"`
+			Value *float64 `json:"value"`
+		} `json:"stats"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode envoy stats: %w", err)
+	}
+
+	stats := make([]envoyStat, 0, len(body.Stats))
+	for _, s := range body.Stats {
+		// Entries without a value, such as histograms, are skipped.
+		if s.Name == "" || s.Value == nil {
+			continue
+		}
+		stats = append(stats, envoyStat{Name: s.Name, Value: *s.Value})
+	}
+	return stats, nil
+}
@@ -0,0 +1,300 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package consuldp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/proto-public/pbdataplane"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-metrics"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/hashicorp/consul-dataplane/internal/bootstrap"
+	metricscache "github.com/hashicorp/consul-dataplane/pkg/metrics-cache"
+)
+
+func TestResolveOTLPConfig(t *testing.T) {
+	cases := map[string]struct {
+		local  OTLPTelemetryConfig
+		bcfg   *bootstrap.BootstrapConfig
+		exp    OTLPTelemetryConfig
+		expErr string
+	}{
+		"not configured": {
+			bcfg: &bootstrap.BootstrapConfig{},
+			exp: OTLPTelemetryConfig{
+				Protocol:       OTLPProtocolGRPC,
+				ExportInterval: defaultOTLPExportInterval,
+			},
+		},
+		"central config": {
+			bcfg: &bootstrap.BootstrapConfig{
+				OTLPMetricsEndpoint:       "https://collector:4318",
+				OTLPMetricsProtocol:       OTLPProtocolHTTP,
+				OTLPMetricsInsecure:       true,
+				OTLPMetricsHeaders:        map[string]string{"x-api-key": "secret"},
+				OTLPMetricsExportInterval: "10s",
+				OTLPMetricsEnvoyStats:     true,
+			},
+			exp: OTLPTelemetryConfig{
+				Endpoint:       "https://collector:4318",
+				Protocol:       OTLPProtocolHTTP,
+				Insecure:       true,
+				Headers:        map[string]string{"x-api-key": "secret"},
+				ExportInterval: 10 * time.Second,
+				EnvoyStats:     true,
+			},
+		},
+		"dataplane config takes precedence": {
+			local: OTLPTelemetryConfig{
+				Endpoint:       "localhost:4317",
+				Protocol:       OTLPProtocolGRPC,
+				Headers:        map[string]string{"x-api-key": "override", "x-tenant": "a"},
+				ExportInterval: 5 * time.Second,
+			},
+			bcfg: &bootstrap.BootstrapConfig{
+				OTLPMetricsEndpoint:       "https://collector:4318",
+				OTLPMetricsProtocol:       OTLPProtocolHTTP,
+				OTLPMetricsHeaders:        map[string]string{"x-api-key": "secret", "x-region": "us"},
+				OTLPMetricsExportInterval: "10s",
+			},
+			exp: OTLPTelemetryConfig{
+				Endpoint:       "localhost:4317",
+				Protocol:       OTLPProtocolGRPC,
+				Headers:        map[string]string{"x-api-key": "override", "x-region": "us", "x-tenant": "a"},
+				ExportInterval: 5 * time.Second,
+			},
+		},
+		"invalid central protocol": {
+			bcfg:   &bootstrap.BootstrapConfig{OTLPMetricsProtocol: "http/json"},
+			expErr: `unsupported OTLP protocol "http/json"`,
+		},
+		"invalid central export interval": {
+			bcfg:   &bootstrap.BootstrapConfig{OTLPMetricsExportInterval: "soon"},
+			expErr: "failed to parse envoy_otlp_metrics_export_interval",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := resolveOTLPConfig(tc.local, tc.bcfg)
+			if tc.expErr != "" {
+				require.ErrorContains(t, err, tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.exp, cfg)
+		})
+	}
+}
+
+func TestNewOTLPExporter(t *testing.T) {
+	for _, cfg := range []OTLPTelemetryConfig{
+		{Endpoint: "localhost:4317", Protocol: OTLPProtocolGRPC, Insecure: true},
+		{Endpoint: "https://collector:4317", Protocol: OTLPProtocolGRPC, Headers: map[string]string{"a": "b"}},
+		{Endpoint: "localhost:4318", Protocol: OTLPProtocolHTTP, Insecure: true},
+		{Endpoint: "https://collector:4318/v1/metrics", Protocol: OTLPProtocolHTTP, Headers: map[string]string{"a": "b"}},
+	} {
+		t.Run(cfg.Protocol+" "+cfg.Endpoint, func(t *testing.T) {
+			exporter, err := newOTLPExporter(context.Background(), cfg)
+			require.NoError(t, err)
+			require.NoError(t, exporter.Shutdown(context.Background()))
+		})
+	}
+}
+
+func TestOTLPResource(t *testing.T) {
+	res := otlpResource(&pbdataplane.GetEnvoyBootstrapParamsResponse{
+		Service:    "web",
+		Namespace:  "ns",
+		Partition:  "ap",
+		Datacenter: "dc1",
+		NodeName:   "node-1",
+	})
+	require.ElementsMatch(t, []attribute.KeyValue{
+		attribute.String("service.name", "web"),
+		attribute.String("consul.namespace", "ns"),
+		attribute.String("consul.partition", "ap"),
+		attribute.String("consul.datacenter", "dc1"),
+		attribute.String("consul.node", "node-1"),
+	}, res.Attributes())
+
+	// The workload identity is preferred and empty values are omitted.
+	res = otlpResource(&pbdataplane.GetEnvoyBootstrapParamsResponse{
+		Service:  "web",
+		Identity: "web-identity",
+	})
+	require.Equal(t, []attribute.KeyValue{
+		attribute.String("service.name", "web-identity"),
+	}, res.Attributes())
+}
+
+func TestOTLPSink(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	sink := newOTLPSink(hclog.NewNullLogger(), provider.Meter(otlpMeterName))
+
+	labels := []metrics.Label{{Name: "source", Value: "test"}}
+	sink.SetGauge([]string{"envoy_connected"}, 1)
+	sink.SetGaugeWithLabels([]string{"envoy_connected"}, 0, nil)
+	sink.IncrCounterWithLabels([]string{"requests"}, 2, labels)
+	sink.IncrCounterWithLabels([]string{"requests"}, 3, labels)
+	sink.AddSample([]string{"dns", "latency"}, 1.5)
+	sink.EmitKey([]string{"ignored"}, 1)
+
+	collected := collectMetrics(t, reader)
+	require.Len(t, collected, 3)
+
+	gauge := collected["consul_dataplane_envoy_connected"].Data.(metricdata.Gauge[float64])
+	require.Len(t, gauge.DataPoints, 1)
+	require.Equal(t, float64(0), gauge.DataPoints[0].Value)
+
+	counter := collected["consul_dataplane_requests"].Data.(metricdata.Sum[float64])
+	require.True(t, counter.IsMonotonic)
+	require.Len(t, counter.DataPoints, 1)
+	require.Equal(t, float64(5), counter.DataPoints[0].Value)
+	require.Equal(t, attribute.NewSet(attribute.String("source", "test")), counter.DataPoints[0].Attributes)
+
+	histogram := collected["consul_dataplane_dns_latency"].Data.(metricdata.Histogram[float64])
+	require.Len(t, histogram.DataPoints, 1)
+	require.Equal(t, uint64(1), histogram.DataPoints[0].Count)
+	require.Equal(t, 1.5, histogram.DataPoints[0].Sum)
+}
+
+func TestSanitizeOTLPName(t *testing.T) {
+	require.Equal(t, "cluster.local_app.upstream_rq_2xx", sanitizeOTLPName("cluster.local_app.upstream_rq_2xx"))
+	require.Equal(t, "listener.0.0.0.0_20000.downstream_cx_total", sanitizeOTLPName("listener.0.0.0.0_20000.downstream_cx_total"))
+	require.Equal(t, "cluster.web_dc1_internal.upstream_cx_total", sanitizeOTLPName("cluster.web|dc1:internal.upstream_cx_total"))
+}
+
+func TestEnvoyStatsBridge(t *testing.T) {
+	var gaugeValue float64 = 3
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/stats", req.URL.Path)
+		require.Equal(t, "json", req.URL.Query().Get("format"))
+		require.True(t, req.URL.Query().Has("usedonly"))
+
+		switch req.URL.Query().Get("type") {
+		case "Counters":
+			fmt.Fprint(rw, `{"stats":[{"name":"cluster.web|dc1.upstream_cx_total","value":7}]}`)
+		case "Gauges":
+			fmt.Fprintf(rw, `{"stats":[{"name":"server.live","value":%v},{"histograms":{"supported_quantiles":[0,50]}}]}`, gaugeValue)
+		default:
+			rw.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	adminPort, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	bridge := newEnvoyStatsBridge(hclog.NewNullLogger(), server.Client(), provider.Meter(otlpMeterName), host, adminPort, time.Minute)
+
+	require.NoError(t, bridge.poll(context.Background()))
+	collected := collectMetrics(t, reader)
+	require.Len(t, collected, 2)
+
+	counter := collected["envoy.cluster.web_dc1.upstream_cx_total"].Data.(metricdata.Sum[float64])
+	require.True(t, counter.IsMonotonic)
+	require.Equal(t, float64(7), counter.DataPoints[0].Value)
+
+	gauge := collected["envoy.server.live"].Data.(metricdata.Gauge[float64])
+	require.Equal(t, float64(3), gauge.DataPoints[0].Value)
+
+	// Subsequent polls update the reported values.
+	gaugeValue = 1
+	require.NoError(t, bridge.poll(context.Background()))
+	collected = collectMetrics(t, reader)
+	gauge = collected["envoy.server.live"].Data.(metricdata.Gauge[float64])
+	require.Equal(t, float64(1), gauge.DataPoints[0].Value)
+}
+
+func TestEnvoyStatsBridgeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	adminPort, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	bridge := newEnvoyStatsBridge(hclog.NewNullLogger(), server.Client(), provider.Meter(otlpMeterName), host, adminPort, time.Minute)
+
+	require.EqualError(t, bridge.poll(context.Background()), "status code 503")
+	require.Empty(t, collectMetrics(t, reader))
+}
+
+// collectMetrics collects from the reader and returns the metrics by name.
+func collectMetrics(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Metrics {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	collected := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			collected[m.Name] = m
+		}
+	}
+	return collected
+}
+
+func TestMetricsOTLPSink(t *testing.T) {
+	exports := make(chan string, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		exports <- req.Header.Get("x-api-key")
+	}))
+	t.Cleanup(collector.Close)
+
+	m := &metricsConfig{
+		cfg: &TelemetryConfig{
+			UseCentralConfig: true,
+			OTLP: OTLPTelemetryConfig{
+				Headers: map[string]string{"x-api-key": "secret"},
+			},
+		},
+		errorExitCh: make(chan struct{}),
+		cacheSink:   metricscache.NewSink(),
+		client:      &http.Client{Timeout: time.Second},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, m.startMetrics(ctx, &bootstrap.BootstrapConfig{
+		OTLPMetricsEndpoint: collector.URL + "/v1/metrics",
+		OTLPMetricsProtocol: OTLPProtocolHTTP,
+	}))
+	require.Len(t, m.sinks, 1)
+	require.NotNil(t, m.meterProvider)
+
+	m.cacheSink.IncrCounter([]string{"requests"}, 1)
+
+	// Stopping the metrics servers flushes the OTLP sink.
+	cancel()
+	select {
+	case key := <-exports:
+		require.Equal(t, "secret", key)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for metrics to be exported")
+	}
+}
@@ -10,4 +10,8 @@ var gauges = []prometheus.GaugeDefinition{
 		Name: []string{"envoy_connected"},
 		Help: "This will either be 0 or 1 depending on whether Envoy is currently running and connected to the local xDS listeners.",
 	},
+	{
+		Name: []string{"envoy_concurrency"},
+		Help: "The number of worker threads Envoy was started with.",
+	},
 }
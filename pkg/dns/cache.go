@@ -0,0 +1,335 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-metrics"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultCacheSize is the default maximum number of responses cached by the
+// DNS proxy.
+const DefaultCacheSize = 10000
+
+// staleAnswerTTL is the TTL of the records of stale answers, as recommended
+// by RFC 8767, so that clients soon retry once Consul is reachable again.
+const staleAnswerTTL = 30
+
+// cacheKey identifies the cached response to a question. Names are case
+// insensitive, so they're lowercased.
+type cacheKey struct {
+	name      string
+	qtype     dnsmessage.Type
+	qclass    dnsmessage.Class
+	transport string // UDP responses may be truncated
+	edns      bool   // whether the response has an OPT record
+	namespace string
+	partition string
+}
+
+// cacheQuery is a query that can be answered from the cache.
+type cacheQuery struct {
+	key      cacheKey
+	id       uint16
+	rd       bool
+	question dnsmessage.Question
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	msg     []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// responseCache is an LRU cache of the responses of Consul to DNS queries.
+// Responses are cached for the lowest TTL of their records, or for negative
+// responses the TTL of the SOA record capped by its minimum, as in RFC 2308.
+// Expired responses are kept for the stale window, to be served if Consul
+// can't be reached, as in RFC 8767. A nil *responseCache caches nothing.
+type responseCache struct {
+	maxEntries  int
+	maxTTL      time.Duration // caps the TTL of cached responses if positive
+	staleWindow time.Duration // how long expired responses may be served
+	now         func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[cacheKey]*list.Element
+}
+
+// newResponseCache returns a cache of up to maxEntries responses, which keeps
+// expired responses for the stale window. If maxEntries isn't positive,
+// DefaultCacheSize is used.
+func newResponseCache(maxEntries int, maxTTL, staleWindow time.Duration) *responseCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheSize
+	}
+	return &responseCache{
+		maxEntries:  maxEntries,
+		maxTTL:      maxTTL,
+		staleWindow: staleWindow,
+		now:         time.Now,
+		lru:         list.New(),
+		entries:     make(map[cacheKey]*list.Element),
+	}
+}
+
+// query parses a DNS query, returning false if it can't be answered from
+// the cache because it isn't a standard query with a single question.
+func (c *responseCache) query(transport, namespace, partition string, msg []byte) (cacheQuery, bool) {
+	if c == nil {
+		return cacheQuery{}, false
+	}
+	return parseCacheQuery(transport, namespace, partition, msg)
+}
+
+// parseCacheQuery parses a DNS query, returning false if it isn't a standard
+// query with a single question.
+func parseCacheQuery(transport, namespace, partition string, msg []byte) (cacheQuery, bool) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil || h.Response || h.OpCode != 0 {
+		return cacheQuery{}, false
+	}
+	questions, err := p.AllQuestions()
+	if err != nil || len(questions) != 1 {
+		return cacheQuery{}, false
+	}
+	if err := p.SkipAllAnswers(); err != nil {
+		return cacheQuery{}, false
+	}
+	if err := p.SkipAllAuthorities(); err != nil {
+		return cacheQuery{}, false
+	}
+	edns := false
+	for {
+		ah, err := p.AdditionalHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return cacheQuery{}, false
+		}
+		edns = edns || ah.Type == dnsmessage.TypeOPT
+		if err := p.SkipAdditional(); err != nil {
+			return cacheQuery{}, false
+		}
+	}
+	q := questions[0]
+	return cacheQuery{
+		key: cacheKey{
+			name:      strings.ToLower(q.Name.String()),
+			qtype:     q.Type,
+			qclass:    q.Class,
+			transport: transport,
+			edns:      edns,
+			namespace: namespace,
+			partition: partition,
+		},
+		id:       h.ID,
+		rd:       h.RecursionDesired,
+		question: q,
+	}, true
+}
+
+// get returns the cached response to the query, with its ID and question
+// rewritten to match the query and its TTLs reduced by the time it has been
+// cached, or nil if there's no fresh response.
+func (c *responseCache) get(q cacheQuery) []byte {
+	return c.lookup(q, false)
+}
+
+// getStale returns the cached response to the query like get, also
+// returning an expired response within the stale window with the TTLs of its
+// records set to staleAnswerTTL. It returns nil if there's no such response.
+func (c *responseCache) getStale(q cacheQuery) []byte {
+	return c.lookup(q, true)
+}
+
+func (c *responseCache) lookup(q cacheQuery, allowStale bool) []byte {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	elem, ok := c.entries[q.key]
+	if !ok {
+		c.mu.Unlock()
+		return nil
+	}
+	entry := elem.Value.(*cacheEntry)
+	now := c.now()
+	stale := !now.Before(entry.expires)
+	if stale && !now.Before(entry.expires.Add(c.staleWindow)) {
+		c.remove(elem)
+		c.mu.Unlock()
+		return nil
+	}
+	if stale && !allowStale {
+		c.mu.Unlock()
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	c.mu.Unlock()
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(entry.msg); err != nil {
+		return nil
+	}
+	msg.ID = q.id
+	msg.RecursionDesired = q.rd
+	msg.Questions = []dnsmessage.Question{q.question}
+	age := uint32(now.Sub(entry.stored) / time.Second)
+	for _, section := range [][]dnsmessage.Resource{msg.Answers, msg.Authorities, msg.Additionals} {
+		for i := range section {
+			h := &section[i].Header
+			switch {
+			case h.Type == dnsmessage.TypeOPT:
+			case stale:
+				h.TTL = staleAnswerTTL
+			default:
+				h.TTL -= min(age, h.TTL)
+			}
+		}
+	}
+	resp, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+// put caches the response to the query, if it's cacheable, evicting the
+// least recently used responses to stay within the size bound.
+func (c *responseCache) put(q cacheQuery, resp []byte) {
+	if c == nil {
+		return
+	}
+	ttl, ok := responseTTL(resp)
+	if !ok {
+		return
+	}
+	if c.maxTTL > 0 && ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+	now := c.now()
+	entry := &cacheEntry{
+		key:     q.key,
+		msg:     append([]byte(nil), resp...),
+		stored:  now,
+		expires: now.Add(ttl),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[q.key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[q.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		metrics.IncrCounter(cacheEvictionsKey, 1)
+	}
+	metrics.SetGauge(cacheEntriesKey, float32(c.lru.Len()))
+}
+
+// remove removes an entry. The lock must be held.
+func (c *responseCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+	metrics.SetGauge(cacheEntriesKey, float32(c.lru.Len()))
+}
+
+// responseTTL returns how long a response may be cached: the lowest TTL of
+// its records or, for a negative response, of its SOA record and the SOA
+// minimum. Only successful and NXDOMAIN responses that aren't truncated are
+// cacheable, and negative responses only if they have an SOA record.
+func responseTTL(msg []byte) (time.Duration, bool) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil || !h.Response || h.Truncated {
+		return 0, false
+	}
+	if h.RCode != dnsmessage.RCodeSuccess && h.RCode != dnsmessage.RCodeNameError {
+		return 0, false
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return 0, false
+	}
+
+	var (
+		ttl     uint32
+		records int
+	)
+	observe := func(t uint32) {
+		if records == 0 || t < ttl {
+			ttl = t
+		}
+		records++
+	}
+
+	answers, err := p.AllAnswers()
+	if err != nil {
+		return 0, false
+	}
+	negative := h.RCode == dnsmessage.RCodeNameError || len(answers) == 0
+	for _, rr := range answers {
+		observe(rr.Header.TTL)
+	}
+
+	soa := false
+	for {
+		ah, err := p.AuthorityHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return 0, false
+		}
+		if ah.Type != dnsmessage.TypeSOA {
+			observe(ah.TTL)
+			if err := p.SkipAuthority(); err != nil {
+				return 0, false
+			}
+			continue
+		}
+		r, err := p.SOAResource()
+		if err != nil {
+			return 0, false
+		}
+		soa = true
+		observe(min(ah.TTL, r.MinTTL))
+	}
+	if negative && !soa {
+		return 0, false
+	}
+
+	for {
+		ah, err := p.AdditionalHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return 0, false
+		}
+		if ah.Type != dnsmessage.TypeOPT {
+			observe(ah.TTL)
+		}
+		if err := p.SkipAdditional(); err != nil {
+			return 0, false
+		}
+	}
+
+	if records == 0 || ttl == 0 {
+		return 0, false
+	}
+	return time.Duration(ttl) * time.Second, true
+}
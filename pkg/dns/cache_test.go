@@ -0,0 +1,335 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/proto-public/pbdns"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-metrics"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/hashicorp/consul-dataplane/pkg/dns/mocks"
+)
+
+// buildResponse builds a response to a question for name with the given
+// answers and authorities.
+func buildResponse(t *testing.T, h dnsmessage.Header, name string, answers, authorities []dnsmessage.Resource) []byte {
+	t.Helper()
+	h.Response = true
+	msg := dnsmessage.Message{
+		Header: h,
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}},
+		Answers:     answers,
+		Authorities: authorities,
+	}
+	b, err := msg.Pack()
+	require.NoError(t, err)
+	return b
+}
+
+func aRecord(name string, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}},
+	}
+}
+
+func soaRecord(ttl, minTTL uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("consul."), Class: dnsmessage.ClassINET, TTL: ttl},
+		Body: &dnsmessage.SOAResource{
+			NS:     dnsmessage.MustNewName("ns.consul."),
+			MBox:   dnsmessage.MustNewName("hostmaster.consul."),
+			MinTTL: minTTL,
+		},
+	}
+}
+
+func buildQuery(t *testing.T, id uint16, name string) []byte {
+	t.Helper()
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	b, err := msg.Pack()
+	require.NoError(t, err)
+	return b
+}
+
+func TestResponseTTL(t *testing.T) {
+	const name = "web.service.consul."
+	cases := map[string]struct {
+		resp      []byte
+		wantTTL   time.Duration
+		cacheable bool
+	}{
+		"lowest answer ttl": {
+			resp:      buildResponse(t, dnsmessage.Header{}, name, []dnsmessage.Resource{aRecord(name, 30), aRecord(name, 10)}, nil),
+			wantTTL:   10 * time.Second,
+			cacheable: true,
+		},
+		"nxdomain capped by soa minimum": {
+			resp:      buildResponse(t, dnsmessage.Header{RCode: dnsmessage.RCodeNameError}, name, nil, []dnsmessage.Resource{soaRecord(60, 5)}),
+			wantTTL:   5 * time.Second,
+			cacheable: true,
+		},
+		"nodata uses soa ttl": {
+			resp:      buildResponse(t, dnsmessage.Header{}, name, nil, []dnsmessage.Resource{soaRecord(3, 30)}),
+			wantTTL:   3 * time.Second,
+			cacheable: true,
+		},
+		"negative without soa": {
+			resp: buildResponse(t, dnsmessage.Header{RCode: dnsmessage.RCodeNameError}, name, nil, nil),
+		},
+		"zero ttl": {
+			resp: buildResponse(t, dnsmessage.Header{}, name, []dnsmessage.Resource{aRecord(name, 0)}, nil),
+		},
+		"truncated": {
+			resp: buildResponse(t, dnsmessage.Header{Truncated: true}, name, []dnsmessage.Resource{aRecord(name, 30)}, nil),
+		},
+		"server failure": {
+			resp: buildResponse(t, dnsmessage.Header{RCode: dnsmessage.RCodeServerFailure}, name, nil, []dnsmessage.Resource{soaRecord(60, 60)}),
+		},
+		"unparseable": {
+			resp: []byte{0x01, 0x02},
+		},
+	}
+	for desc, c := range cases {
+		t.Run(desc, func(t *testing.T) {
+			ttl, ok := responseTTL(c.resp)
+			require.Equal(t, c.cacheable, ok)
+			require.Equal(t, c.wantTTL, ttl)
+		})
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	now := time.Now()
+	cache := newResponseCache(2, 0, 0)
+	cache.now = func() time.Time { return now }
+
+	q, ok := cache.query(transportUDP, "ns", "ap", buildQuery(t, 1, "web.service.consul."))
+	require.True(t, ok)
+	require.Nil(t, cache.get(q))
+	cache.put(q, buildResponse(t, dnsmessage.Header{ID: 1}, "web.service.consul.", []dnsmessage.Resource{aRecord("web.service.consul.", 30)}, nil))
+
+	// Names are case insensitive, and the response has the ID and question
+	// of the query, with its TTL reduced by the time it has been cached.
+	now = now.Add(10 * time.Second)
+	q, ok = cache.query(transportUDP, "ns", "ap", buildQuery(t, 2, "WEB.service.consul."))
+	require.True(t, ok)
+	resp := cache.get(q)
+	require.NotNil(t, resp)
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(resp))
+	require.EqualValues(t, 2, msg.ID)
+	require.Equal(t, "WEB.service.consul.", msg.Questions[0].Name.String())
+	require.EqualValues(t, 20, msg.Answers[0].Header.TTL)
+
+	// Responses are cached per transport, namespace and partition.
+	other, ok := cache.query(transportTCP, "ns", "ap", buildQuery(t, 2, "web.service.consul."))
+	require.True(t, ok)
+	require.Nil(t, cache.get(other))
+	other, ok = cache.query(transportUDP, "default", "ap", buildQuery(t, 2, "web.service.consul."))
+	require.True(t, ok)
+	require.Nil(t, cache.get(other))
+
+	// Responses expire after their TTL.
+	now = now.Add(20 * time.Second)
+	require.Nil(t, cache.get(q))
+	require.Equal(t, 0, cache.lru.Len())
+}
+
+func TestResponseCacheMaxTTL(t *testing.T) {
+	now := time.Now()
+	cache := newResponseCache(10, 5*time.Second, 0)
+	cache.now = func() time.Time { return now }
+
+	q, ok := cache.query(transportUDP, "", "", buildQuery(t, 1, "web.service.consul."))
+	require.True(t, ok)
+	cache.put(q, buildResponse(t, dnsmessage.Header{ID: 1}, "web.service.consul.", []dnsmessage.Resource{aRecord("web.service.consul.", 300)}, nil))
+	now = now.Add(4 * time.Second)
+	require.NotNil(t, cache.get(q))
+	now = now.Add(time.Second)
+	require.Nil(t, cache.get(q))
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	cache := newResponseCache(2, 0, 0)
+	put := func(name string) cacheQuery {
+		q, ok := cache.query(transportUDP, "", "", buildQuery(t, 1, name))
+		require.True(t, ok)
+		cache.put(q, buildResponse(t, dnsmessage.Header{ID: 1}, name, []dnsmessage.Resource{aRecord(name, 30)}, nil))
+		return q
+	}
+	a := put("a.service.consul.")
+	b := put("b.service.consul.")
+	// Using a makes b the least recently used response.
+	require.NotNil(t, cache.get(a))
+	c := put("c.service.consul.")
+
+	require.NotNil(t, cache.get(a))
+	require.Nil(t, cache.get(b))
+	require.NotNil(t, cache.get(c))
+	require.Equal(t, 2, cache.lru.Len())
+}
+
+func TestResponseCacheUncacheableQueries(t *testing.T) {
+	cache := newResponseCache(10, 0, 0)
+	_, ok := cache.query(transportUDP, "", "", []byte{0x01})
+	require.False(t, ok)
+	_, ok = cache.query(transportUDP, "", "", buildResponse(t, dnsmessage.Header{}, "web.service.consul.", nil, nil))
+	require.False(t, ok, "responses aren't queries")
+
+	var disabled *responseCache
+	_, ok = disabled.query(transportUDP, "", "", buildQuery(t, 1, "web.service.consul."))
+	require.False(t, ok)
+}
+
+func TestCachedQueries(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	cfg := metrics.DefaultConfig("")
+	cfg.EnableHostname = false
+	cfg.EnableRuntimeMetrics = false
+	_, err := metrics.NewGlobal(cfg, sink)
+	require.NoError(t, err)
+	t.Cleanup(func() { metrics.Shutdown() })
+
+	answer := buildResponse(t, dnsmessage.Header{ID: 1}, "web.service.consul.", []dnsmessage.Resource{aRecord("web.service.consul.", 30)}, nil)
+	client := mocks.NewDNSServiceClient(t)
+	client.On("Query", mock.Anything, mock.Anything).Return(&pbdns.QueryResponse{Msg: answer}, nil).Once()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	server := &DNSServer{
+		client:  client,
+		connUDP: conn,
+		logger:  hclog.NewNullLogger(),
+		cache:   newResponseCache(10, 0, 0),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go server.proxyUDP(ctx)
+
+	c, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	for id := uint16(1); id <= 2; id++ {
+		_, err = c.Write(buildQuery(t, id, "web.service.consul."))
+		require.NoError(t, err)
+		buf := make([]byte, 512)
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, err := c.Read(buf)
+		require.NoError(t, err)
+		var msg dnsmessage.Message
+		require.NoError(t, msg.Unpack(buf[:n]))
+		require.Equal(t, id, msg.ID)
+		require.Len(t, msg.Answers, 1)
+	}
+
+	data := sink.Data()
+	require.EqualValues(t, 1, data[0].Counters["dns_cache_misses;transport=udp"].Count)
+	require.EqualValues(t, 1, data[0].Counters["dns_cache_hits;transport=udp"].Count)
+	require.EqualValues(t, 1, data[0].Counters["dns_queries;transport=udp;qtype=A;rcode=NOERROR"].Count)
+	require.EqualValues(t, 1, data[0].Gauges["dns_cache_entries"].Value)
+}
+
+func TestResponseCacheServeStale(t *testing.T) {
+	now := time.Now()
+	cache := newResponseCache(10, 0, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	q, ok := cache.query(transportUDP, "", "", buildQuery(t, 1, "web.service.consul."))
+	require.True(t, ok)
+	cache.put(q, buildResponse(t, dnsmessage.Header{ID: 1}, "web.service.consul.", []dnsmessage.Resource{aRecord("web.service.consul.", 300)}, nil))
+
+	// Fresh responses are served with their remaining TTL.
+	now = now.Add(100 * time.Second)
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(cache.getStale(q)))
+	require.EqualValues(t, 200, msg.Answers[0].Header.TTL)
+
+	// Expired responses are only served stale, with a short TTL.
+	now = now.Add(230 * time.Second)
+	require.Nil(t, cache.get(q))
+	require.NoError(t, msg.Unpack(cache.getStale(q)))
+	require.EqualValues(t, staleAnswerTTL, msg.Answers[0].Header.TTL)
+
+	// Until the stale window has passed.
+	now = now.Add(30 * time.Second)
+	require.Nil(t, cache.getStale(q))
+	require.Equal(t, 0, cache.lru.Len())
+}
+
+func TestResolveFallback(t *testing.T) {
+	query := buildQuery(t, 7, "web.service.consul.")
+	answer := buildResponse(t, dnsmessage.Header{ID: 7}, "web.service.consul.", []dnsmessage.Resource{aRecord("web.service.consul.", 5)}, nil)
+	unavailable := status.Error(codes.Unavailable, "no servers")
+
+	cases := map[string]struct {
+		staleWindow time.Duration
+		wantRCode   string
+		wantTTL     uint32
+	}{
+		"serves stale answer": {
+			staleWindow: time.Minute,
+			wantRCode:   "NOERROR",
+			wantTTL:     staleAnswerTTL,
+		},
+		"servfail without stale window": {
+			wantRCode: "SERVFAIL",
+		},
+	}
+	for desc, c := range cases {
+		t.Run(desc, func(t *testing.T) {
+			client := mocks.NewDNSServiceClient(t)
+			client.On("Query", mock.Anything, mock.Anything).Return(&pbdns.QueryResponse{Msg: answer}, nil).Once()
+			client.On("Query", mock.Anything, mock.Anything).Return(nil, unavailable).Once()
+
+			now := time.Now()
+			server := &DNSServer{
+				client: client,
+				logger: hclog.NewNullLogger(),
+				cache:  newResponseCache(10, 0, c.staleWindow),
+			}
+			server.cache.now = func() time.Time { return now }
+
+			resp, cached, err := server.resolve(context.Background(), transportUDP, query)
+			require.NoError(t, err)
+			require.False(t, cached)
+			require.Equal(t, answer, resp)
+
+			now = now.Add(10 * time.Second)
+			resp, cached, err = server.resolve(context.Background(), transportUDP, query)
+			require.ErrorIs(t, err, unavailable)
+			require.Equal(t, c.wantTTL != 0, cached, "stale responses come from the cache")
+			require.Equal(t, c.wantRCode, responseRCode(resp))
+			var msg dnsmessage.Message
+			require.NoError(t, msg.Unpack(resp))
+			require.EqualValues(t, 7, msg.ID)
+			if c.wantTTL != 0 {
+				require.EqualValues(t, c.wantTTL, msg.Answers[0].Header.TTL)
+			} else {
+				require.Empty(t, msg.Answers)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// queryTimeout bounds how long a query to Consul or the recursors can take.
+const queryTimeout = time.Minute
+
+// coalesce forwards a query with forward, sharing the response with the
+// identical queries in flight, so that they result in a single query to
+// Consul or the recursors. Queries are identical if they'd be answered by the
+// same cached response. The shared response is rewritten with the ID and
+// question of each query.
+//
+// The query is forwarded with a context detached from the cancellation of
+// the first query, so that the identical queries are still answered if its
+// client goes away.
+func (d *DNSServer) coalesce(ctx context.Context, transport string, q cacheQuery, msg []byte,
+	forward func(context.Context, string, []byte) ([]byte, error)) ([]byte, error) {
+	leader := false
+	v, err, shared := d.inflightQueries.Do(fmt.Sprintf("%+v", q.key), func() (any, error) {
+		leader = true
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), queryTimeout)
+		defer cancel()
+		return forward(ctx, transport, msg)
+	})
+	if leader {
+		return v.([]byte), err
+	}
+	if shared {
+		recordCoalescedQuery(transport)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return q.answer(v.([]byte)), nil
+}
+
+// answer returns a copy of the response to an identical query, with the ID,
+// RD bit and question of the query. Only the ID is rewritten if the response
+// can't be parsed.
+func (q cacheQuery) answer(resp []byte) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err == nil {
+		msg.ID = q.id
+		msg.RecursionDesired = q.rd
+		msg.Questions = []dnsmessage.Question{q.question}
+		if b, err := msg.Pack(); err == nil {
+			return b
+		}
+	}
+	b := append([]byte(nil), resp...)
+	if len(b) >= 2 {
+		binary.BigEndian.PutUint16(b, q.id)
+	}
+	return b
+}
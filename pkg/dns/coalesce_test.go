@@ -0,0 +1,143 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestCacheQueryAnswer(t *testing.T) {
+	q, ok := parseCacheQuery(transportUDP, "", "", buildQuery(t, 7, "WEB.service.consul."))
+	require.True(t, ok)
+
+	resp := buildResponse(t, dnsmessage.Header{ID: 1}, "web.service.consul.", []dnsmessage.Resource{aRecord("web.service.consul.", 30)}, nil)
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(q.answer(resp)))
+	require.EqualValues(t, 7, msg.ID)
+	require.True(t, msg.RecursionDesired)
+	require.Equal(t, "WEB.service.consul.", msg.Questions[0].Name.String())
+	require.Len(t, msg.Answers, 1)
+
+	// Only the ID of unparseable responses is rewritten.
+	garbage := []byte{0, 1, 0xff}
+	require.Equal(t, []byte{0, 7, 0xff}, q.answer(garbage))
+	require.Equal(t, []byte{0, 1, 0xff}, garbage)
+}
+
+func TestCoalesce(t *testing.T) {
+	sink := testMetrics(t)
+	const (
+		name    = "web.service.consul."
+		queries = 5
+	)
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	forward := func(_ context.Context, _ string, msg []byte) ([]byte, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return answer(t, msg, false), nil
+	}
+	server := &DNSServer{logger: hclog.NewNullLogger()}
+
+	var wg sync.WaitGroup
+	resps := make([][]byte, queries)
+	run := func(i int) {
+		defer wg.Done()
+		msg := buildQuery(t, uint16(i+1), name)
+		q, ok := parseCacheQuery(transportUDP, "", "", msg)
+		require.True(t, ok)
+		resp, err := server.coalesce(context.Background(), transportUDP, q, msg, forward)
+		require.NoError(t, err)
+		resps[i] = resp
+	}
+	wg.Add(1)
+	go run(0)
+	<-started
+	for i := 1; i < queries; i++ {
+		wg.Add(1)
+		go run(i)
+	}
+	// Give the identical queries time to join the one in flight.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.EqualValues(t, 1, calls.Load(), "identical queries are forwarded once")
+	for i, resp := range resps {
+		var msg dnsmessage.Message
+		require.NoError(t, msg.Unpack(resp))
+		require.EqualValues(t, i+1, msg.ID, "each query gets a response with its ID")
+		require.Len(t, msg.Answers, 1)
+	}
+	require.EqualValues(t, queries-1, sink.Data()[0].Counters["dns_coalesced_queries;transport=udp"].Count)
+
+	// Errors are returned as is.
+	fail := func(context.Context, string, []byte) ([]byte, error) { return nil, errors.New("no servers") }
+	msg := buildQuery(t, 1, name)
+	q, _ := parseCacheQuery(transportUDP, "", "", msg)
+	_, err := server.coalesce(context.Background(), transportUDP, q, msg, fail)
+	require.EqualError(t, err, "no servers")
+}
+
+func TestCoalesceLeaderCanceled(t *testing.T) {
+	const name = "web.service.consul."
+	started := make(chan struct{})
+	forward := func(ctx context.Context, _ string, msg []byte) ([]byte, error) {
+		close(started)
+		// Wait until the first query's context is canceled, then give the
+		// forward a chance to fail with it.
+		time.Sleep(200 * time.Millisecond)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return answer(t, msg, false), nil
+	}
+	server := &DNSServer{logger: hclog.NewNullLogger()}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		msg := buildQuery(t, 1, name)
+		q, _ := parseCacheQuery(transportTCP, "", "", msg)
+		server.coalesce(leaderCtx, transportTCP, q, msg, forward)
+	}()
+	<-started
+
+	msg := buildQuery(t, 2, name)
+	q, _ := parseCacheQuery(transportTCP, "", "", msg)
+	followerDone := make(chan struct{})
+	var (
+		resp []byte
+		err  error
+	)
+	go func() {
+		defer close(followerDone)
+		resp, err = server.coalesce(context.Background(), transportTCP, q, msg, forward)
+	}()
+	// Give the follower time to join the query in flight, then disconnect
+	// the leader's client.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-followerDone
+	<-leaderDone
+
+	require.NoError(t, err, "the follower isn't failed by the leader's cancellation")
+	var m dnsmessage.Message
+	require.NoError(t, m.Unpack(resp))
+	require.EqualValues(t, 2, m.ID)
+	require.Len(t, m.Answers, 1)
+}
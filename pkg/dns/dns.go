@@ -5,18 +5,27 @@ package dns
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/consul/proto-public/pbdns"
 	"github.com/hashicorp/go-hclog"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/hashicorp/consul-dataplane/internal/certreload"
 )
 
 // ErrServerDisabled is returned when the server is disabled
@@ -35,6 +44,89 @@ type DNSServerParams struct {
 	Partition string
 	Namespace string
 	Token     string
+
+	// DisableCache disables caching the responses of Consul.
+	DisableCache bool
+	// CacheSize is the maximum number of cached responses. If zero,
+	// DefaultCacheSize is used.
+	CacheSize int
+	// CacheMaxTTL caps how long responses are cached, if positive.
+	CacheMaxTTL time.Duration
+	// ServeStaleWindow is how long after they expire cached responses are
+	// served if Consul can't be reached. Zero disables serving stale
+	// responses.
+	ServeStaleWindow time.Duration
+
+	// Domains are the domains of the names resolved by Consul. If empty,
+	// DefaultDomain is used. Only used if there are recursors.
+	Domains []string
+	// Recursors are the addresses of the nameservers that the queries
+	// outside of Domains are forwarded to, with an optional port that
+	// defaults to 53. If empty, every query is forwarded to Consul.
+	Recursors []string
+	// ResolvConf is the path of a resolv.conf file that the recursors are
+	// read from if Recursors is empty.
+	ResolvConf string
+	// RecursorTimeout is the timeout of a query to a recursor. If zero,
+	// DefaultRecursorTimeout is used.
+	RecursorTimeout time.Duration
+
+	// DoTAddr is the host:port address of the DNS-over-TLS listener. If
+	// empty, DoT is disabled.
+	DoTAddr string
+	// DoHAddr is the host:port address of the DNS-over-HTTPS listener. If
+	// empty, DoH is disabled.
+	DoHAddr string
+	// DoHPath is the path of the DoH endpoint. If empty, DefaultDoHPath is
+	// used.
+	DoHPath string
+	// TLSCertFile and TLSKeyFile are the paths of the certificate and key of
+	// the DoT and DoH listeners, which are reloaded when they change.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// UDPWorkers is the number of UDP queries resolved concurrently. If
+	// zero, DefaultUDPWorkers is used.
+	UDPWorkers int
+	// UDPQueueSize is the number of UDP queries waiting for a worker. If
+	// zero, DefaultUDPQueueSize is used.
+	UDPQueueSize int
+	// UDPDropPolicy decides what happens to UDP queries when the queue is
+	// full. If empty, DropPolicyNewest is used.
+	UDPDropPolicy string
+
+	// TCPIdleTimeout is the time a TCP or DoT connection is kept open while
+	// the client sends no queries. If zero, DefaultTCPIdleTimeout is used.
+	TCPIdleTimeout time.Duration
+	// TCPMaxConns is the number of open TCP and DoT connections, above which
+	// new connections are closed. If zero, DefaultTCPMaxConns is used.
+	TCPMaxConns int
+
+	// QueryLog configures the log of the queries answered by the proxy,
+	// which is disabled by default.
+	QueryLog QueryLogParams
+
+	// AllowCIDRs are the CIDRs of the clients allowed to query the proxy. If
+	// empty, every client not in DenyCIDRs is allowed.
+	AllowCIDRs []string
+	// DenyCIDRs are the CIDRs of the clients denied, which takes precedence
+	// over AllowCIDRs.
+	DenyCIDRs []string
+	// RateLimit is the number of queries per second allowed from each client
+	// IPv4 address or IPv6 /56 network. If zero, queries aren't rate limited.
+	RateLimit float64
+	// RateLimitBurst is the number of queries a client can make at once. If
+	// zero, RateLimit rounded up is used.
+	RateLimitBurst int
+	// RateLimitAction decides what happens to the queries of clients over
+	// their rate limit. If empty, RateLimitActionRefuse is used.
+	RateLimitAction string
+	// RRLRate is the number of identical UDP responses per second sent to
+	// each client network. If zero, response rate limiting is disabled.
+	RRLRate float64
+	// RRLSlip is one in how many rate limited responses are sent truncated
+	// rather than dropped. If zero, DefaultRRLSlip is used.
+	RRLSlip int
 }
 
 // DNSServerInterface is the interface for athe DNSServer
@@ -58,10 +150,41 @@ type DNSServer struct {
 	client      pbdns.DNSServiceClient
 	connUDP     net.PacketConn
 	listenerTCP net.Listener
+	listenerDoT net.Listener // nil if disabled
+	listenerDoH net.Listener // nil if disabled
+
+	dotAddr string
+	dohAddr string
+	dohPath string
+	certs   *certreload.Reloader // nil if DoT and DoH are disabled
 
 	partition string
 	namespace string
 	token     string
+
+	cache *responseCache // nil if disabled
+
+	domains   []string      // normalized
+	recursors *recursorPool // nil if every query is forwarded to Consul
+
+	udpWorkers    int
+	udpQueueSize  int
+	udpDropPolicy string
+
+	tcpIdle     time.Duration
+	tcpMaxConns int
+
+	acl             *clientACL    // nil if every client is allowed
+	rateLimits      *tokenBuckets // nil if queries aren't rate limited
+	rateLimitAction string
+	rrl             *responseRateLimiter // nil if disabled
+
+	queryLog *queryLog // nil if disabled
+
+	inflightQueries singleflight.Group // coalesces identical queries
+
+	inflight atomic.Int64 // queries being resolved by Consul
+	tcpConns atomic.Int64 // open TCP connections
 }
 
 // NewDNSServer creates a new DNS proxy server
@@ -80,9 +203,96 @@ func NewDNSServer(p DNSServerParams) (DNSServerInterface, error) {
 	s.partition = p.Partition
 	s.namespace = p.Namespace
 	s.token = p.Token
+	if !p.DisableCache {
+		s.cache = newResponseCache(p.CacheSize, p.CacheMaxTTL, p.ServeStaleWindow)
+	}
+	s.udpWorkers = p.UDPWorkers
+	s.udpQueueSize = p.UDPQueueSize
+	s.udpDropPolicy = p.UDPDropPolicy
+	s.tcpIdle = p.TCPIdleTimeout
+	s.tcpMaxConns = p.TCPMaxConns
+
+	acl, err := newClientACL(p.AllowCIDRs, p.DenyCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	s.acl = acl
+	s.rateLimits = newTokenBuckets(p.RateLimit, p.RateLimitBurst)
+	s.rateLimitAction = p.RateLimitAction
+	s.rrl = newResponseRateLimiter(p.RRLRate, p.RRLSlip)
+
+	queryLog, err := newQueryLog(p.QueryLog, s.logger.Named("query-log"))
+	if err != nil {
+		return nil, err
+	}
+	s.queryLog = queryLog
+
+	if p.DoTAddr != "" || p.DoHAddr != "" {
+		if p.TLSCertFile == "" || p.TLSKeyFile == "" {
+			return nil, errors.New("a certificate and key are required for the dns proxy DoT and DoH listeners")
+		}
+		certs, err := certreload.New("dns proxy", p.TLSCertFile, p.TLSKeyFile, s.logger)
+		if err != nil {
+			return nil, err
+		}
+		s.certs = certs
+		s.dotAddr = p.DoTAddr
+		s.dohAddr = p.DoHAddr
+		s.dohPath = p.DoHPath
+		if s.dohPath == "" {
+			s.dohPath = DefaultDoHPath
+		}
+	}
+
+	recursors := p.Recursors
+	if len(recursors) == 0 && p.ResolvConf != "" {
+		nameservers, err := readResolvConf(p.ResolvConf)
+		if err != nil {
+			return nil, fmt.Errorf("error reading dns recursors from '%s': %w", p.ResolvConf, err)
+		}
+		recursors = nameservers
+	}
+	var addrs []string
+	for _, r := range recursors {
+		addr, err := recursorAddr(r)
+		if err != nil {
+			return nil, err
+		}
+		// Forwarding queries to the proxy itself would loop, which happens if
+		// the resolv.conf file lists the proxy as a nameserver.
+		if isProxyAddr(addr, s.bindAddr, s.port) {
+			s.logger.Warn("ignoring dns recursor that is the dns proxy itself", "recursor", addr)
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) > 0 {
+		s.recursors = newRecursorPool(addrs, p.RecursorTimeout, s.logger.Named("recursor"))
+		domains := p.Domains
+		if len(domains) == 0 {
+			domains = []string{DefaultDomain}
+		}
+		for _, domain := range domains {
+			s.domains = append(s.domains, normalizeDomain(domain))
+		}
+	}
 	return s, nil
 }
 
+// isProxyAddr returns whether a host:port address is the address the proxy
+// listens on.
+func isProxyAddr(addr string, bindAddr net.IP, port int) bool {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil || portStr != strconv.Itoa(port) {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ip.Equal(bindAddr) || (bindAddr.IsUnspecified() && (ip.IsLoopback() || ip.IsUnspecified()))
+}
+
 // TcpPort is a helper func for the purpose of returning the port
 // that the OS chose if the user specified 0
 func (d *DNSServer) TcpPort() int {
@@ -137,6 +347,29 @@ func (d *DNSServer) Start(ctx context.Context) error {
 	}
 	d.listenerTCP = listenerTCP
 
+	// 3. Setup the DoT and DoH listeners, if enabled
+	if d.dotAddr != "" {
+		listenerDoT, err := tls.Listen("tcp", d.dotAddr, tlsConfig(d.certs, "dot"))
+		if err != nil {
+			connUDP.Close()
+			listenerTCP.Close()
+			return fmt.Errorf("error listening for dot: %w", err)
+		}
+		d.listenerDoT = listenerDoT
+	}
+	if d.dohAddr != "" {
+		listenerDoH, err := net.Listen("tcp", d.dohAddr)
+		if err != nil {
+			connUDP.Close()
+			listenerTCP.Close()
+			if d.listenerDoT != nil {
+				d.listenerDoT.Close()
+			}
+			return fmt.Errorf("error listening for doh: %w", err)
+		}
+		d.listenerDoH = listenerDoH
+	}
+
 	runCtx, cancel := context.WithCancel(ctx)
 	go d.run(runCtx)
 
@@ -159,10 +392,37 @@ func (d *DNSServer) run(ctx context.Context) {
 		defer wg.Done()
 		d.proxyTCP(ctx)
 	}()
+
+	if d.listenerDoT != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.proxyDoT(ctx)
+		}()
+	}
+	if d.listenerDoH != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.serveDoH(ctx)
+		}()
+	}
+
+	if d.recursors != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.recursors.runHealthChecks(ctx)
+		}()
+	}
 	d.logger.Info("running dns proxy", " udp port", d.UdpPort(), "tcp port", d.TcpPort())
 
 	wg.Wait()
 
+	if err := d.queryLog.close(); err != nil {
+		d.logger.Warn("error closing dns query log", "error", err)
+	}
+
 	d.lock.Lock()
 	d.running = false
 	d.lock.Unlock()
@@ -171,6 +431,12 @@ func (d *DNSServer) run(ctx context.Context) {
 
 func (d *DNSServer) proxyUDP(ctx context.Context) {
 	logger := d.logger.Named("udp")
+	// EDNS0 queries may be larger than 512 bytes, so read up to the largest
+	// datagram, and copy each query to hand it off.
+	buf := make([]byte, maxUDPPayloadSize)
+	// Queries are resolved by a bounded number of workers, so that a flood
+	// of queries degrades predictably.
+	queue := d.startUDPWorkers(ctx)
 	for {
 		select {
 		case <-ctx.Done():
@@ -178,7 +444,6 @@ func (d *DNSServer) proxyUDP(ctx context.Context) {
 			return
 		default:
 		}
-		buf := make([]byte, 512)
 		err := d.connUDP.SetReadDeadline(time.Now().Add(time.Second * 10))
 		if err != nil {
 			logger.Error("failure to set read deadline on connection", "error", err)
@@ -196,37 +461,65 @@ func (d *DNSServer) proxyUDP(ctx context.Context) {
 			}
 			continue
 		}
-		// Parallelize responses
-		go d.queryConsulAndRespondUDP(buf[0:bytesRead], addr)
+		// Queries of denied or rate limited clients are rejected before they
+		// take up room in the queue.
+		ip := clientIP(addr)
+		if !d.allowedClient(transportUDP, ip) {
+			continue
+		}
+		query := make([]byte, bytesRead)
+		copy(query, buf)
+		if d.rateLimited(transportUDP, ip) {
+			if resp := d.rateLimitResponse(query); resp != nil {
+				if _, err := d.connUDP.WriteTo(resp, addr); err != nil {
+					recordError(transportUDP, errClassWrite)
+				}
+			}
+			continue
+		}
+		d.enqueueUDP(queue, udpQuery{msg: query, addr: addr})
 	}
 }
 
 func (d *DNSServer) queryConsulAndRespondUDP(buf []byte, addr net.Addr) {
 	logger := d.logger.Named("udp")
-	req := &pbdns.QueryRequest{
-		Msg:      buf,
-		Protocol: pbdns.Protocol_PROTOCOL_UDP,
-	}
 
-	ctx, done := context.WithTimeout(context.Background(), time.Minute*1)
+	ctx, done := d.consulContext(context.Background())
 	defer done()
 
-	ctx = metadata.AppendToOutgoingContext(ctx,
-		"x-consul-partition", d.partition,
-		"x-consul-namespace", d.namespace,
-		"x-consul-token", d.token,
-	)
-
 	logger.Debug("querying through udp", "partition", d.partition, "namespace", d.namespace)
 
-	resp, err := d.client.Query(ctx, req)
+	start := time.Now()
+	resp, cached, err := d.resolve(ctx, transportUDP, buf)
 	if err != nil {
 		logger.Error("error resolving consul request", "error", err)
+	}
+	if resp == nil {
+		d.queryLog.record(transportUDP, addr.String(), buf, nil, false, start)
 		return
 	}
-	logger.Debug("dns messaged received from consul", "length", len(resp.Msg))
-	_, err = d.connUDP.WriteTo(resp.Msg, addr)
+	logger.Debug("dns messaged received from consul", "length", len(resp))
+
+	// The response must fit the UDP payload size of the client, which
+	// retries over TCP if it's truncated.
+	size := udpPayloadSize(buf)
+	if truncated, ok := truncateResponse(resp, size); ok {
+		recordTruncatedResponse()
+		logger.Debug("truncated dns response", "length", len(resp), "udp_payload_size", size)
+		resp = truncated
+	}
+
+	// Identical responses are rate limited, so that the proxy is of little
+	// use to amplify attacks on spoofed addresses.
+	resp = d.limitUDPResponse(clientIP(addr), resp)
+	d.queryLog.record(transportUDP, addr.String(), buf, resp, cached, start)
+	if resp == nil {
+		return
+	}
+
+	_, err = d.connUDP.WriteTo(resp, addr)
 	if err != nil {
+		recordError(transportUDP, errClassWrite)
 		logger.Error("error sending response", "error", err)
 		return
 	}
@@ -243,21 +536,73 @@ func (d *DNSServer) proxyTCP(ctx context.Context) {
 		c, err := d.listenerTCP.Accept()
 		if err != nil {
 			d.logger.Warn("failure to accept tcp connection", "error", err)
+			continue
+		}
+		go d.proxyTCPAcceptedConn(ctx, c, d.client, transportTCP)
+	}
+}
+
+// proxyDoT accepts DoT connections until the context is canceled.
+func (d *DNSServer) proxyDoT(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		d.listenerDoT.Close()
+	}()
+	for {
+		c, err := d.listenerDoT.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			d.logger.Warn("failure to accept dot connection", "error", err)
+			continue
 		}
-		go d.proxyTCPAcceptedConn(ctx, c, d.client)
+		go d.proxyTCPAcceptedConn(ctx, c, d.client, transportDoT)
 	}
 }
 
-func (d *DNSServer) proxyTCPAcceptedConn(ctx context.Context, conn net.Conn, client pbdns.DNSServiceClient) {
+// consulContext returns the context of a query to Consul, which carries the
+// tenancy and token of the proxy.
+func (d *DNSServer) consulContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, done := context.WithTimeout(ctx, queryTimeout)
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		"x-consul-partition", d.partition,
+		"x-consul-namespace", d.namespace,
+		"x-consul-token", d.token,
+	)
+	return ctx, done
+}
+
+// proxyTCPAcceptedConn proxies the queries of a TCP or DoT connection, which
+// share the same framing, as in RFC 7858. Pipelined queries are resolved
+// concurrently, and a query that fails is answered with an error response
+// rather than closing the connection.
+func (d *DNSServer) proxyTCPAcceptedConn(ctx context.Context, conn net.Conn, client pbdns.DNSServiceClient, transport string) {
 	defer conn.Close()
-	logger := d.logger.Named("tcp")
+	ip := clientIP(conn.RemoteAddr())
+	if !d.allowedClient(transport, ip) {
+		return
+	}
+	if !d.acquireTCPConn(transport) {
+		d.logger.Named(transport).Warn("closing dns connection, too many open connections", "remote_addr", conn.RemoteAddr().String())
+		return
+	}
+	defer d.incrTCPConns(-1)
+	logger := d.logger.Named(transport)
+
+	w := &tcpWriter{conn: conn}
+	pipelined := make(chan struct{}, maxPipelinedQueries)
+	var wg sync.WaitGroup
+	// Responses to the queries already read are sent before the connection
+	// is closed.
+	defer wg.Wait()
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
 		}
-		err := conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		err := conn.SetReadDeadline(time.Now().Add(d.tcpIdleTimeout()))
 		if err != nil {
 			logger.Error("failure to set read deadline on connection", "error", err)
 			return
@@ -269,6 +614,8 @@ func (d *DNSServer) proxyTCPAcceptedConn(ctx context.Context, conn net.Conn, cli
 		if err != nil {
 			if err == io.EOF {
 				logger.Debug("ending connection after EOF", "error", err)
+			} else if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				logger.Debug("ending idle connection", "error", err)
 			} else {
 				logger.Error("failure to read", "error", err)
 			}
@@ -284,56 +631,176 @@ func (d *DNSServer) proxyTCPAcceptedConn(ctx context.Context, conn net.Conn, cli
 		data := make([]byte, size)
 		_, err = io.ReadFull(conn, data)
 		if err != nil {
+			recordError(transport, errClassTruncatedRead)
+			// The next query can't be found once a query is cut short.
 			logger.Error("error reading full tcp dns request ", "error", err)
-			// We can try reading it again but if this is a read timeout we don't necessarily want
-			// to close the connection
+			return
+		}
+
+		if d.rateLimited(transport, ip) {
+			if resp := d.rateLimitResponse(data); resp != nil {
+				if err := w.write(resp); err != nil {
+					recordError(transport, errClassWrite)
+					logger.Error("error writing response", "error", err)
+					return
+				}
+			}
 			continue
 		}
 
-		// Now that we have the request we can forward the dnsrequest to consul
-		req := &pbdns.QueryRequest{
-			Msg:      data,
-			Protocol: pbdns.Protocol_PROTOCOL_TCP,
+		select {
+		case pipelined <- struct{}{}:
+		case <-ctx.Done():
+			return
 		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-pipelined }()
+			d.queryConsulAndRespondTCP(ctx, w, transport, data)
+		}()
+	}
+}
 
-		ctx, done := context.WithTimeout(context.Background(), time.Minute*1)
-		defer done()
+// queryConsulAndRespondTCP resolves a query of a TCP or DoT connection, with
+// its own timeout, and writes the response. The connection is closed if the
+// response can't be written, which ends the reading of the next queries.
+func (d *DNSServer) queryConsulAndRespondTCP(ctx context.Context, w *tcpWriter, transport string, data []byte) {
+	logger := d.logger.Named(transport)
 
-		ctx = metadata.AppendToOutgoingContext(ctx,
-			"x-consul-partition", d.partition,
-			"x-consul-namespace", d.namespace,
-			"x-consul-token", d.token,
-		)
+	ctx, done := d.consulContext(ctx)
+	defer done()
 
-		logger.Debug("querying through tcp", "partition", d.partition, "namespace", d.namespace)
+	logger.Debug("querying through "+transport, "partition", d.partition, "namespace", d.namespace)
 
-		resp, err := client.Query(ctx, req)
-		if err != nil {
-			logger.Error("error resolving consul request", "error", err)
-			return
-		}
-		logger.Debug("total data length of dns response from consul", "size", len(resp.Msg))
+	start := time.Now()
+	resp, cached, err := d.resolve(ctx, transport, data)
+	if err != nil {
+		logger.Error("error resolving consul request", "error", err)
+	}
+	d.queryLog.record(transport, w.conn.RemoteAddr().String(), data, resp, cached, start)
+	if resp == nil {
+		return
+	}
+	logger.Debug("total data length of dns response from consul", "size", len(resp))
 
-		// This is a guard and shouldn't happen but if the response is > 65535
-		// then we will just close the connection.
-		if len(resp.Msg) > math.MaxUint16 {
-			logger.Error("consul response too large for DNS spec", "error", err)
-			return
+	if err := w.write(resp); err != nil {
+		recordError(transport, errClassWrite)
+		logger.Error("error writing response", "error", err)
+		w.conn.Close()
+	}
+}
+
+// writeTCPMessage writes a DNS message to a TCP or DoT connection.
+func writeTCPMessage(conn net.Conn, msg []byte) error {
+	// TCP DNS requests add a two byte length field prefixed to the message.
+	// Source: RFC1035 4.2.2.
+	if err := binary.Write(conn, binary.BigEndian, uint16(len(msg))); err != nil {
+		return fmt.Errorf("error writing length: %w", err)
+	}
+	_, err := conn.Write(msg)
+	return err
+}
+
+// resolve answers a DNS query from the response cache if possible, and
+// otherwise forwards it to Consul, or to the recursors if it's outside of the
+// Consul domains, and caches the response. Identical queries in flight are
+// forwarded once.
+//
+// If the query can't be answered, an error is returned along with a response
+// that keeps the ID and question of the query, so that the client doesn't
+// wait until it times out: FORMERR if the query is malformed, REFUSED if
+// Consul denied it, and otherwise a stale response from the cache or
+// SERVFAIL. The response is nil if the query has no valid header or is
+// itself a response, which mustn't be answered. Whether the response comes
+// from the cache is returned along with it.
+func (d *DNSServer) resolve(ctx context.Context, transport string, msg []byte) ([]byte, bool, error) {
+	question, err := checkQuery(msg)
+	if err != nil {
+		recordError(transport, errClassMalformedQuery)
+		return errorResponse(msg, dnsmessage.RCodeFormatError), false, err
+	}
+
+	q, coalescable := parseCacheQuery(transport, d.namespace, d.partition, msg)
+	cacheable := coalescable && d.cache != nil
+	if cacheable {
+		if resp := d.cache.get(q); resp != nil {
+			recordCacheLookup(transport, true)
+			return resp, true, nil
 		}
+		recordCacheLookup(transport, false)
+	}
 
-		// TCP DNS requests add a two byte length field prefixed to the message.
-		// Source: RFC1035 4.2.2.
-		err = binary.Write(conn, binary.BigEndian, uint16(len(resp.Msg)))
-		if err != nil {
-			logger.Warn("error writing length", "error", err)
-			return
+	forward := d.forwardToConsul
+	if d.recursors != nil && !inDomains(question.Name.String(), d.domains) {
+		forward = d.forwardToRecursors
+	}
+	var resp []byte
+	if coalescable {
+		resp, err = d.coalesce(ctx, transport, q, msg, forward)
+	} else {
+		resp, err = forward(ctx, transport, msg)
+	}
+	if err != nil {
+		// The token isn't allowed to make the query, which retrying won't fix
+		// and which mustn't be answered from the cache.
+		if status.Code(err) == codes.PermissionDenied {
+			return errorResponse(msg, dnsmessage.RCodeRefused), false, err
 		}
-		_, err = conn.Write(resp.Msg)
-		if err != nil {
-			logger.Error("error writing response", "error", err)
-			return
+		if cacheable {
+			if stale := d.cache.getStale(q); stale != nil {
+				recordStaleAnswer(transport)
+				return stale, true, err
+			}
 		}
+		return errorResponse(msg, dnsmessage.RCodeServerFailure), false, err
+	}
+	if cacheable {
+		d.cache.put(q, resp)
+	}
+	return resp, false, nil
+}
+
+// forwardToConsul forwards a DNS query to Consul.
+func (d *DNSServer) forwardToConsul(ctx context.Context, transport string, msg []byte) ([]byte, error) {
+	// Only UDP responses are limited in size.
+	protocol := pbdns.Protocol_PROTOCOL_TCP
+	if transport == transportUDP {
+		protocol = pbdns.Protocol_PROTOCOL_UDP
+	}
+	resp, err := d.queryConsul(ctx, transport, &pbdns.QueryRequest{
+		Msg:      msg,
+		Protocol: protocol,
+	})
+	if err != nil {
+		recordQuery(transport, msg, nil)
+		return nil, err
+	}
+	recordQuery(transport, msg, resp.Msg)
+
+	// This is a guard and shouldn't happen, but a response can't be larger
+	// than the 65535 bytes allowed by the TCP length prefix.
+	if len(resp.Msg) > math.MaxUint16 {
+		recordError(transport, errClassOversizeResponse)
+		return nil, fmt.Errorf("consul response too large for DNS spec: %d bytes", len(resp.Msg))
+	}
+	return resp.Msg, nil
+}
+
+// forwardToRecursors forwards a DNS query to the recursors.
+func (d *DNSServer) forwardToRecursors(ctx context.Context, transport string, msg []byte) ([]byte, error) {
+	// Queries over TLS and HTTPS are forwarded over TCP, like TCP queries,
+	// since their responses aren't limited in size.
+	network := transportTCP
+	if transport == transportUDP {
+		network = transportUDP
+	}
+	resp, err := d.recursors.forward(ctx, network, msg)
+	if err != nil {
+		recordError(transport, errClassRecursor)
 	}
+	recordRecursorQuery(transport, resp)
+	return resp, err
 }
 
 // Stop will shut down the server
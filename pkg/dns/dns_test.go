@@ -19,7 +19,10 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/dns/dnsmessage"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/hashicorp/consul-dataplane/pkg/dns/mocks"
 )
@@ -145,27 +148,48 @@ func (s *DNSTestSuite) Test_UDPProxy() {
 	testCases := map[string]struct {
 		dnsRequest   []byte
 		dnsResp      []byte
-		expected     error
 		expectedGRPC error
+		// errorResp is set if the proxy responds with errorRCode instead of
+		// relaying the response of Consul.
+		errorResp  bool
+		errorRCode dnsmessage.RCode
+		// malformed is set if the query isn't forwarded to Consul.
+		malformed bool
 	}{
 
 		"happy path": {
-			dnsRequest: genRandomBytes(512),
+			dnsRequest: buildQuery(s.T(), 1, "web.service.consul."),
 			dnsResp:    genRandomBytes(50),
 		},
 		"happy large response path": {
-			dnsRequest: genRandomBytes(50),
+			dnsRequest: buildQuery(s.T(), 2, "web.service.consul."),
 			dnsResp:    genRandomBytes(9216), // net.inet.udp.maxdgram for macs
 		},
 		"bad consul response too large": {
-			dnsRequest: genRandomBytes(50),
+			dnsRequest: buildQuery(s.T(), 3, "web.service.consul."),
 			dnsResp:    genRandomBytes(65536),
-			expected:   errors.New("timeout"),
+			errorResp:  true,
+			errorRCode: dnsmessage.RCodeServerFailure,
 		},
 		"bad consul response": {
-			dnsRequest:   genRandomBytes(512),
+			dnsRequest:   buildQuery(s.T(), 4, "web.service.consul."),
 			dnsResp:      genRandomBytes(50),
-			expectedGRPC: errors.New("timeout"),
+			expectedGRPC: errors.New("no servers"),
+			errorResp:    true,
+			errorRCode:   dnsmessage.RCodeServerFailure,
+		},
+		"permission denied": {
+			dnsRequest:   buildQuery(s.T(), 5, "web.service.consul."),
+			expectedGRPC: status.Error(codes.PermissionDenied, "ACL not found"),
+			errorResp:    true,
+			errorRCode:   dnsmessage.RCodeRefused,
+		},
+		"malformed query": {
+			// A header with a question count of 1 but no question.
+			dnsRequest: []byte{0, 6, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0},
+			errorResp:  true,
+			errorRCode: dnsmessage.RCodeFormatError,
+			malformed:  true,
 		},
 	}
 
@@ -179,19 +203,21 @@ func (s *DNSTestSuite) Test_UDPProxy() {
 				Msg: resp,
 			}
 
-			mockedDNSConsulClient.On("Query", mock.Anything, mock.Anything).
-				Run(func(args mock.Arguments) {
-					ctx, ok := args.Get(0).(context.Context)
-					require.True(s.T(), ok, "error casting to context.Context")
+			if !tc.malformed {
+				mockedDNSConsulClient.On("Query", mock.Anything, mock.Anything).
+					Run(func(args mock.Arguments) {
+						ctx, ok := args.Get(0).(context.Context)
+						require.True(s.T(), ok, "error casting to context.Context")
 
-					md, ok := metadata.FromOutgoingContext(ctx)
-					require.True(s.T(), ok, "error getting metadata from context")
+						md, ok := metadata.FromOutgoingContext(ctx)
+						require.True(s.T(), ok, "error getting metadata from context")
 
-					require.Equal(s.T(), "test-token", md.Get("x-consul-token")[0], "token not set in context")
-					require.Equal(s.T(), "test-namespace", md.Get("x-consul-namespace")[0], "namespace not set in context")
-					require.Equal(s.T(), "test-partition", md.Get("x-consul-partition")[0], "partition not set in context")
-				}).
-				Return(clientResp, tc.expectedGRPC).Once()
+						require.Equal(s.T(), "test-token", md.Get("x-consul-token")[0], "token not set in context")
+						require.Equal(s.T(), "test-namespace", md.Get("x-consul-namespace")[0], "namespace not set in context")
+						require.Equal(s.T(), "test-partition", md.Get("x-consul-partition")[0], "partition not set in context")
+					}).
+					Return(clientResp, tc.expectedGRPC).Once()
+			}
 			addr := fmt.Sprintf("127.0.0.1:%v", server.UdpPort())
 
 			conn, err := net.Dial("udp", addr)
@@ -207,13 +233,10 @@ func (s *DNSTestSuite) Test_UDPProxy() {
 			_ = conn.SetReadDeadline(time.Now().Add(time.Second * 1))
 			lengthRead, err := conn.Read(p)
 			s.T().Logf("read %v", lengthRead)
-			if tc.expectedGRPC != nil {
-				s.Require().Error(err)
-				s.Require().ErrorContains(err, tc.expectedGRPC.Error())
-			} else if tc.expected != nil {
-				s.Require().Error(err)
-				s.Require().ErrorContains(err, tc.expected.Error())
-				return
+			if tc.errorResp {
+				// The client gets an error response right away.
+				s.Require().NoError(err)
+				s.Require().Equal(errorResponse(req, tc.errorRCode), p[0:lengthRead])
 			} else {
 				s.Require().NoError(err, "exchange error")
 				s.Require().EqualValues(resp, p[0:lengthRead])
@@ -248,27 +271,47 @@ func (s *DNSTestSuite) Test_ProxydnsTCP() {
 	testCases := map[string]struct {
 		dnsRequest   []byte
 		dnsResp      []byte
-		expected     error
-		largeResp    bool
 		expectedGRPC error
+		// errorResp is set if the proxy responds with errorRCode instead of
+		// relaying the response of Consul.
+		errorResp  bool
+		errorRCode dnsmessage.RCode
+		// malformed is set if the query isn't forwarded to Consul.
+		malformed bool
 	}{
 		"happy path": {
-			dnsRequest: genRandomBytes(50),
+			dnsRequest: buildQuery(s.T(), 1, "web.service.consul."),
 			dnsResp:    genRandomBytes(50),
 		},
 		"happy path large ": {
-			dnsRequest: genRandomBytes(50),
+			dnsRequest: buildQuery(s.T(), 2, "web.service.consul."),
 			dnsResp:    genRandomBytes(65467),
 		},
 		"happy path large dns": {
-			dnsRequest: genRandomBytes(50),
+			dnsRequest: buildQuery(s.T(), 3, "web.service.consul."),
 			dnsResp:    genRandomBytes(65536),
-			largeResp:  true,
+			errorResp:  true,
+			errorRCode: dnsmessage.RCodeServerFailure,
 		},
 		"no consul server response": {
-			dnsRequest:   genRandomBytes(50),
+			dnsRequest:   buildQuery(s.T(), 4, "web.service.consul."),
 			dnsResp:      genRandomBytes(50),
-			expectedGRPC: errors.New("EOF"),
+			expectedGRPC: errors.New("no servers"),
+			errorResp:    true,
+			errorRCode:   dnsmessage.RCodeServerFailure,
+		},
+		"permission denied": {
+			dnsRequest:   buildQuery(s.T(), 5, "web.service.consul."),
+			expectedGRPC: status.Error(codes.PermissionDenied, "ACL not found"),
+			errorResp:    true,
+			errorRCode:   dnsmessage.RCodeRefused,
+		},
+		"malformed query": {
+			// A header with a question count of 1 but no question.
+			dnsRequest: []byte{0, 6, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0},
+			errorResp:  true,
+			errorRCode: dnsmessage.RCodeFormatError,
+			malformed:  true,
 		},
 	}
 	for name, tc := range testCases {
@@ -281,20 +324,22 @@ func (s *DNSTestSuite) Test_ProxydnsTCP() {
 				Msg: resp,
 			}
 
-			mockedDNSConsulClient.On("Query", mock.Anything, mock.Anything).
-				Run(func(args mock.Arguments) {
-					ctx, ok := args.Get(0).(context.Context)
-					require.True(s.T(), ok, "error casting to context.Context")
-
-					md, ok := metadata.FromOutgoingContext(ctx)
-					require.True(s.T(), ok, "error getting metadata from context")
-
-					require.Equal(s.T(), "test-token", md.Get("x-consul-token")[0], "token not set in context")
-					require.Equal(s.T(), "test-namespace", md.Get("x-consul-namespace")[0], "namespace not set in context")
-					require.Equal(s.T(), "test-partition", md.Get("x-consul-partition")[0], "partition not set in context")
-				}).
-				Return(clientResp, tc.expectedGRPC).
-				Once()
+			if !tc.malformed {
+				mockedDNSConsulClient.On("Query", mock.Anything, mock.Anything).
+					Run(func(args mock.Arguments) {
+						ctx, ok := args.Get(0).(context.Context)
+						require.True(s.T(), ok, "error casting to context.Context")
+
+						md, ok := metadata.FromOutgoingContext(ctx)
+						require.True(s.T(), ok, "error getting metadata from context")
+
+						require.Equal(s.T(), "test-token", md.Get("x-consul-token")[0], "token not set in context")
+						require.Equal(s.T(), "test-namespace", md.Get("x-consul-namespace")[0], "namespace not set in context")
+						require.Equal(s.T(), "test-partition", md.Get("x-consul-partition")[0], "partition not set in context")
+					}).
+					Return(clientResp, tc.expectedGRPC).
+					Once()
+			}
 			addr := fmt.Sprintf("127.0.0.1:%v", server.TcpPort())
 
 			conn, err := net.Dial("tcp", addr)
@@ -306,22 +351,15 @@ func (s *DNSTestSuite) Test_ProxydnsTCP() {
 
 			var length uint16
 			err = binary.Read(conn, binary.BigEndian, &length)
-			if tc.largeResp || tc.expectedGRPC != nil {
-				s.Require().Error(err)
-				s.Require().ErrorContains(err, "EOF")
-				return
-			}
 			s.Require().NoError(err)
 
 			p := make([]byte, length)
 			v, err := io.ReadFull(conn, p)
 
-			if tc.expected != nil {
-				s.Require().Error(err)
-				s.Require().ErrorContains(err, tc.expected.Error())
-			} else if tc.expectedGRPC != nil {
-				s.Require().Error(err)
-				s.Require().ErrorContains(err, "EOF")
+			if tc.errorResp {
+				// The client gets an error response right away.
+				s.Require().NoError(err)
+				s.Require().Equal(errorResponse(req, tc.errorRCode), p)
 			} else {
 				s.Require().NoError(err, "exchange error")
 				s.Require().EqualValues(resp, p)
@@ -0,0 +1,145 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+const (
+	// DefaultDoHPath is the default path of the DoH endpoint, as in RFC 8484.
+	DefaultDoHPath = "/dns-query"
+
+	// dohContentType is the media type of DNS messages in DoH requests and
+	// responses.
+	dohContentType = "application/dns-message"
+)
+
+// dohHandler returns the handler of DoH requests, as in RFC 8484. The query
+// is either base64url encoded in the dns parameter of a GET request, or the
+// body of a POST request.
+func (d *DNSServer) dohHandler(path string) http.Handler {
+	logger := d.logger.Named(transportDoH)
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(rw http.ResponseWriter, req *http.Request) {
+		ip := remoteIP(req)
+		if !d.allowedClient(transportDoH, ip) {
+			http.Error(rw, "client not allowed", http.StatusForbidden)
+			return
+		}
+
+		query, status, err := dohQuery(req)
+		if err != nil {
+			recordError(transportDoH, errClassMalformedQuery)
+			logger.Debug("invalid doh request", "error", err)
+			http.Error(rw, err.Error(), status)
+			return
+		}
+
+		if d.rateLimited(transportDoH, ip) {
+			resp := d.rateLimitResponse(query)
+			if resp == nil {
+				http.Error(rw, "too many dns queries", http.StatusTooManyRequests)
+				return
+			}
+			rw.Header().Set("Content-Type", dohContentType)
+			_, _ = rw.Write(resp)
+			return
+		}
+
+		ctx, done := d.consulContext(req.Context())
+		defer done()
+
+		logger.Debug("querying through doh", "partition", d.partition, "namespace", d.namespace)
+
+		start := time.Now()
+		resp, cached, err := d.resolve(ctx, transportDoH, query)
+		if err != nil {
+			logger.Error("error resolving consul request", "error", err)
+		}
+		d.queryLog.record(transportDoH, req.RemoteAddr, query, resp, cached, start)
+		if resp == nil {
+			http.Error(rw, "invalid dns query", http.StatusBadRequest)
+			return
+		}
+
+		rw.Header().Set("Content-Type", dohContentType)
+		// HTTP caches may keep the response as long as its records are valid.
+		if ttl, ok := responseTTL(resp); ok {
+			rw.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(ttl/time.Second)))
+		}
+		if _, err := rw.Write(resp); err != nil {
+			recordError(transportDoH, errClassWrite)
+			logger.Error("error writing response", "error", err)
+		}
+	})
+	return mux
+}
+
+// remoteIP returns the IP address of the client of a DoH request, which is
+// invalid if the remote address isn't an IP address.
+func remoteIP(req *http.Request) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(req.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addrPort.Addr().Unmap()
+}
+
+// dohQuery returns the DNS query of a DoH request, or an error along with
+// the HTTP status code of the response.
+func dohQuery(req *http.Request) ([]byte, int, error) {
+	switch req.Method {
+	case http.MethodGet:
+		param := req.URL.Query().Get("dns")
+		if param == "" {
+			return nil, http.StatusBadRequest, errors.New("missing dns parameter")
+		}
+		query, err := base64.RawURLEncoding.DecodeString(param)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid dns parameter: %w", err)
+		}
+		return query, http.StatusOK, nil
+	case http.MethodPost:
+		if ct := req.Header.Get("Content-Type"); ct != dohContentType {
+			return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %q", ct)
+		}
+		query, err := io.ReadAll(io.LimitReader(req.Body, maxUDPPayloadSize+1))
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("error reading request: %w", err)
+		}
+		if len(query) > maxUDPPayloadSize {
+			return nil, http.StatusRequestEntityTooLarge, errors.New("dns query too large")
+		}
+		return query, http.StatusOK, nil
+	default:
+		return nil, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", req.Method)
+	}
+}
+
+// serveDoH serves DoH requests until the context is canceled.
+func (d *DNSServer) serveDoH(ctx context.Context) {
+	logger := d.logger.Named(transportDoH)
+	srv := &http.Server{
+		Handler:           d.dohHandler(d.dohPath),
+		TLSConfig:         tlsConfig(d.certs),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.ServeTLS(d.listenerDoH, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("doh server failed", "error", err)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/proto-public/pbdns"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/hashicorp/consul-dataplane/pkg/dns/mocks"
+)
+
+func TestDoHQuery(t *testing.T) {
+	query := buildQuery(t, 0, "web.service.consul.")
+	cases := map[string]struct {
+		req        *http.Request
+		wantStatus int
+		wantErr    string
+	}{
+		"get": {
+			req:        httptest.NewRequest(http.MethodGet, "/dns-query?dns="+base64.RawURLEncoding.EncodeToString(query), nil),
+			wantStatus: http.StatusOK,
+		},
+		"get without a query": {
+			req:        httptest.NewRequest(http.MethodGet, "/dns-query", nil),
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "missing dns parameter",
+		},
+		"get with padding": {
+			req:        httptest.NewRequest(http.MethodGet, "/dns-query?dns="+base64.URLEncoding.EncodeToString(query[:len(query)-1]), nil),
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "invalid dns parameter",
+		},
+		"post": {
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(query))
+				req.Header.Set("Content-Type", "application/dns-message")
+				return req
+			}(),
+			wantStatus: http.StatusOK,
+		},
+		"post of another content type": {
+			req:        httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(query)),
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantErr:    `unsupported content type ""`,
+		},
+		"post of a large query": {
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(make([]byte, maxUDPPayloadSize+1)))
+				req.Header.Set("Content-Type", "application/dns-message")
+				return req
+			}(),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantErr:    "dns query too large",
+		},
+		"put": {
+			req:        httptest.NewRequest(http.MethodPut, "/dns-query", nil),
+			wantStatus: http.StatusMethodNotAllowed,
+			wantErr:    "method PUT not allowed",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, status, err := dohQuery(c.req)
+			require.Equal(t, c.wantStatus, status)
+			if c.wantErr != "" {
+				require.ErrorContains(t, err, c.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, query, got)
+		})
+	}
+}
+
+func TestEncryptedListeners(t *testing.T) {
+	const name = "web.service.consul."
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "dns-proxy")
+	consulResp := buildResponse(t, dnsmessage.Header{}, name, []dnsmessage.Resource{aRecord(name, 30)}, nil)
+
+	client := mocks.NewDNSServiceClient(t)
+	client.On("Query", mock.Anything, mock.Anything).Return(&pbdns.QueryResponse{Msg: consulResp}, nil)
+
+	server, err := NewDNSServer(DNSServerParams{
+		BindAddr:     "127.0.0.1",
+		Port:         0,
+		Logger:       hclog.NewNullLogger(),
+		Client:       client,
+		DisableCache: true,
+		DoTAddr:      "127.0.0.1:0",
+		DoHAddr:      "127.0.0.1:0",
+		TLSCertFile:  certFile,
+		TLSKeyFile:   keyFile,
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	require.NoError(t, server.Start(ctx))
+	t.Cleanup(server.Stop)
+	s := server.(*DNSServer)
+
+	pem, err := os.ReadFile(certFile)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(pem))
+	tlsCfg := &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+
+	t.Run("dot", func(t *testing.T) {
+		conn, err := tls.Dial("tcp", s.listenerDoT.Addr().String(), tlsCfg)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+		// A connection can carry several queries.
+		for id := uint16(1); id <= 2; id++ {
+			query := buildQuery(t, id, name)
+			require.NoError(t, binary.Write(conn, binary.BigEndian, uint16(len(query))))
+			_, err = conn.Write(query)
+			require.NoError(t, err)
+
+			var length uint16
+			require.NoError(t, binary.Read(conn, binary.BigEndian, &length))
+			resp := make([]byte, length)
+			_, err = io.ReadFull(conn, resp)
+			require.NoError(t, err)
+			require.Equal(t, consulResp, resp)
+		}
+	})
+
+	t.Run("doh", func(t *testing.T) {
+		httpClient := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsCfg},
+			Timeout:   5 * time.Second,
+		}
+		url := "https://" + s.listenerDoH.Addr().String() + DefaultDoHPath
+		query := buildQuery(t, 0, name)
+
+		check := func(resp *http.Response) {
+			t.Helper()
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, "application/dns-message", resp.Header.Get("Content-Type"))
+			require.Equal(t, "max-age=30", resp.Header.Get("Cache-Control"))
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, consulResp, body)
+		}
+
+		resp, err := httpClient.Get(url + "?dns=" + base64.RawURLEncoding.EncodeToString(query))
+		require.NoError(t, err)
+		check(resp)
+
+		resp, err = httpClient.Post(url, "application/dns-message", bytes.NewReader(query))
+		require.NoError(t, err)
+		check(resp)
+
+		// Responses to queries can't be answered.
+		resp, err = httpClient.Post(url, "application/dns-message", bytes.NewReader(consulResp))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp, err = httpClient.Get(strings.TrimSuffix(url, DefaultDoHPath) + "/other")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
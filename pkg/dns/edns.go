@@ -0,0 +1,102 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"math"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// minUDPPayloadSize is the size of the UDP responses that every client
+	// accepts, as in RFC 1035, and the least a client advertising a smaller
+	// size with EDNS0 is sent, as in RFC 6891.
+	minUDPPayloadSize = 512
+
+	// maxUDPPayloadSize is the size of the largest UDP query the proxy
+	// reads, which is the largest a UDP datagram can carry.
+	maxUDPPayloadSize = math.MaxUint16
+)
+
+// udpPayloadSize returns the size of the largest UDP response a client
+// accepts: the size advertised in the OPT record of its query, as in RFC
+// 6891, or minUDPPayloadSize if it doesn't have one.
+func udpPayloadSize(query []byte) int {
+	var p dnsmessage.Parser
+	if _, err := p.Start(query); err != nil {
+		return minUDPPayloadSize
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return minUDPPayloadSize
+	}
+	if err := p.SkipAllAnswers(); err != nil {
+		return minUDPPayloadSize
+	}
+	if err := p.SkipAllAuthorities(); err != nil {
+		return minUDPPayloadSize
+	}
+	for {
+		h, err := p.AdditionalHeader()
+		if err != nil {
+			return minUDPPayloadSize
+		}
+		if h.Type == dnsmessage.TypeOPT {
+			// The class of an OPT record is the UDP payload size.
+			return max(int(h.Class), minUDPPayloadSize)
+		}
+		if err := p.SkipAdditional(); err != nil {
+			return minUDPPayloadSize
+		}
+	}
+}
+
+// truncateResponse trims a response larger than size, so that it can be sent
+// over UDP. It keeps the question, the OPT record and as many answers as fit,
+// and sets the TC bit so that the client retries over TCP, as in RFC 2181.
+// It returns the response unchanged if it fits or can't be parsed, and
+// whether it was truncated.
+func truncateResponse(resp []byte, size int) ([]byte, bool) {
+	if len(resp) <= size {
+		return resp, false
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		return resp, false
+	}
+	answers := msg.Answers
+	additionals := msg.Additionals
+	msg.Truncated = true
+	msg.Authorities = nil
+	msg.Additionals = nil
+	for _, rr := range additionals {
+		if rr.Header.Type == dnsmessage.TypeOPT {
+			msg.Additionals = append(msg.Additionals, rr)
+		}
+	}
+
+	// Binary search for the most answers that fit.
+	pack := func(n int) []byte {
+		msg.Answers = answers[:n]
+		b, err := msg.Pack()
+		if err != nil {
+			return nil
+		}
+		return b
+	}
+	lo, hi := 0, len(answers)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if b := pack(mid); b != nil && len(b) <= size {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	truncated := pack(lo)
+	if truncated == nil {
+		return resp, false
+	}
+	return truncated, true
+}
@@ -0,0 +1,189 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/proto-public/pbdns"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/hashicorp/consul-dataplane/pkg/dns/mocks"
+)
+
+// optRecord is an OPT record advertising a UDP payload size, with a padding
+// option of the given length.
+func optRecord(size uint16, padding int) dnsmessage.Resource {
+	opt := &dnsmessage.OPTResource{}
+	if padding > 0 {
+		opt.Options = []dnsmessage.Option{{Code: 12, Data: make([]byte, padding)}}
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("."), Type: dnsmessage.TypeOPT, Class: dnsmessage.Class(size)},
+		Body:   opt,
+	}
+}
+
+// buildEDNSQuery builds a query with an OPT record.
+func buildEDNSQuery(t *testing.T, id uint16, name string, opt dnsmessage.Resource) []byte {
+	t.Helper()
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}},
+		Additionals: []dnsmessage.Resource{opt},
+	}
+	b, err := msg.Pack()
+	require.NoError(t, err)
+	return b
+}
+
+// buildLargeResponse builds a response with n A records of distinct names, so
+// that they can't be compressed, and an OPT record if edns is set.
+func buildLargeResponse(t *testing.T, id uint16, name string, n int, edns bool) []byte {
+	t.Helper()
+	var answers []dnsmessage.Resource
+	for i := 0; i < n; i++ {
+		answers = append(answers, aRecord(fmt.Sprintf("node-%d.%s", i, name), 30))
+	}
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, Response: true, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}},
+		Answers:     answers,
+		Authorities: []dnsmessage.Resource{soaRecord(30, 30)},
+	}
+	if edns {
+		msg.Additionals = []dnsmessage.Resource{optRecord(4096, 0)}
+	}
+	b, err := msg.Pack()
+	require.NoError(t, err)
+	return b
+}
+
+func TestUDPPayloadSize(t *testing.T) {
+	const name = "web.service.consul."
+	require.Equal(t, 512, udpPayloadSize(buildQuery(t, 1, name)))
+	require.Equal(t, 4096, udpPayloadSize(buildEDNSQuery(t, 1, name, optRecord(4096, 0))))
+	require.Equal(t, 512, udpPayloadSize(buildEDNSQuery(t, 1, name, optRecord(100, 0))), "sizes below 512 are treated as 512")
+	require.Equal(t, 512, udpPayloadSize([]byte{0x01}))
+}
+
+func TestTruncateResponse(t *testing.T) {
+	const name = "web.service.consul."
+
+	small := buildLargeResponse(t, 1, name, 2, false)
+	resp, truncated := truncateResponse(small, 512)
+	require.False(t, truncated)
+	require.Equal(t, small, resp)
+
+	// Unparseable responses are left alone.
+	garbage := genRandomBytes(1024)
+	garbage[2] |= 0x80
+	garbage[4], garbage[5] = 0xff, 0xff
+	resp, truncated = truncateResponse(garbage, 512)
+	require.False(t, truncated)
+	require.Equal(t, garbage, resp)
+
+	for _, edns := range []bool{false, true} {
+		t.Run(fmt.Sprintf("edns=%t", edns), func(t *testing.T) {
+			large := buildLargeResponse(t, 7, name, 100, edns)
+			require.Greater(t, len(large), 512)
+
+			resp, truncated := truncateResponse(large, 512)
+			require.True(t, truncated)
+			require.LessOrEqual(t, len(resp), 512)
+
+			var msg dnsmessage.Message
+			require.NoError(t, msg.Unpack(resp))
+			require.EqualValues(t, 7, msg.ID)
+			require.True(t, msg.Truncated)
+			require.Len(t, msg.Questions, 1)
+			require.NotEmpty(t, msg.Answers)
+			require.Less(t, len(msg.Answers), 100)
+			require.Empty(t, msg.Authorities)
+			if edns {
+				require.Len(t, msg.Additionals, 1)
+				require.Equal(t, dnsmessage.TypeOPT, msg.Additionals[0].Header.Type)
+			} else {
+				require.Empty(t, msg.Additionals)
+			}
+
+			// One more answer wouldn't fit.
+			msg.Answers = append(msg.Answers, aRecord(fmt.Sprintf("node-%d.%s", len(msg.Answers), name), 30))
+			b, err := msg.Pack()
+			require.NoError(t, err)
+			require.Greater(t, len(b), 512)
+		})
+	}
+}
+
+func TestUDPTruncation(t *testing.T) {
+	const name = "web.service.consul."
+	large := buildLargeResponse(t, 1, name, 100, true)
+	require.Greater(t, len(large), 512)
+	require.Less(t, len(large), 4096)
+
+	client := mocks.NewDNSServiceClient(t)
+	received := make(chan []byte, 2)
+	client.On("Query", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			received <- args.Get(1).(*pbdns.QueryRequest).Msg
+		}).
+		Return(&pbdns.QueryResponse{Msg: large}, nil)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &DNSServer{
+		client:  client,
+		connUDP: conn,
+		logger:  hclog.NewNullLogger(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go server.proxyUDP(ctx)
+
+	exchange := func(query []byte) []byte {
+		t.Helper()
+		c, err := net.Dial("udp", conn.LocalAddr().String())
+		require.NoError(t, err)
+		defer c.Close()
+		require.NoError(t, c.SetDeadline(time.Now().Add(5*time.Second)))
+		_, err = c.Write(query)
+		require.NoError(t, err)
+		buf := make([]byte, maxUDPPayloadSize)
+		n, err := c.Read(buf)
+		require.NoError(t, err)
+		return buf[:n]
+	}
+
+	// Without EDNS0, the response is truncated to 512 bytes.
+	resp := exchange(buildQuery(t, 1, name))
+	require.LessOrEqual(t, len(resp), 512)
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(resp))
+	require.True(t, msg.Truncated)
+	<-received
+
+	// A client advertising a large enough payload size gets the whole
+	// response, and queries larger than 512 bytes reach Consul whole.
+	query := buildEDNSQuery(t, 1, name, optRecord(4096, 1000))
+	require.Greater(t, len(query), 512)
+	resp = exchange(query)
+	require.Equal(t, large, resp)
+	require.Equal(t, query, <-received)
+}
@@ -0,0 +1,339 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// RateLimitActionRefuse answers the queries of clients over their rate
+	// limit with REFUSED.
+	RateLimitActionRefuse = "refuse"
+	// RateLimitActionDrop drops the queries of clients over their rate limit.
+	RateLimitActionDrop = "drop"
+
+	// DefaultRRLSlip is the default share of the responses dropped by RRL
+	// that are sent truncated instead: one in DefaultRRLSlip.
+	DefaultRRLSlip = 2
+
+	// maxTrackedBuckets bounds the number of token buckets, which are all
+	// reset if there are too many active ones, as there are when queries
+	// are sent from many spoofed addresses.
+	maxTrackedBuckets = 100000
+
+	// bucketSweepInterval is how often the full token buckets, which are
+	// idle, are removed.
+	bucketSweepInterval = time.Minute
+)
+
+// clientACL decides which clients may query the proxy by their IP address.
+// A nil *clientACL allows every client.
+type clientACL struct {
+	allow []netip.Prefix // if set, only these clients are allowed
+	deny  []netip.Prefix // takes precedence over allow
+}
+
+// newClientACL returns the ACL of the given CIDRs, or nil if there are none.
+func newClientACL(allow, deny []string) (*clientACL, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	a := &clientACL{}
+	var err error
+	if a.allow, err = parseCIDRs(allow); err != nil {
+		return nil, err
+	}
+	if a.deny, err = parseCIDRs(deny); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// parseCIDRs parses CIDRs such as "10.0.0.0/8".
+func parseCIDRs(cidrs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dns client CIDR %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// allowed returns whether a client may query the proxy.
+func (a *clientACL) allowed(ip netip.Addr) bool {
+	if a == nil {
+		return true
+	}
+	for _, prefix := range a.deny {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, prefix := range a.allow {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address of a client, which is invalid if the
+// address isn't an IP address.
+func clientIP(addr net.Addr) netip.Addr {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		if addr == nil {
+			return netip.Addr{}
+		}
+		addrPort, err := netip.ParseAddrPort(addr.String())
+		if err != nil {
+			return netip.Addr{}
+		}
+		return addrPort.Addr().Unmap()
+	}
+	parsed, _ := netip.AddrFromSlice(ip)
+	return parsed.Unmap()
+}
+
+// tokenBuckets rate limits events by key, such as queries by client, with a
+// token bucket per key. A nil *tokenBuckets allows every event.
+type tokenBuckets struct {
+	rate  float64 // tokens added per second
+	burst float64 // size of the buckets
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBuckets returns buckets of burst tokens refilled at rate tokens per
+// second, or nil if rate isn't positive. If burst isn't positive, the rate
+// rounded up is used.
+func newTokenBuckets(rate float64, burst int) *tokenBuckets {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if burst <= 0 {
+		b = float64(int(rate))
+		if b < rate {
+			b++
+		}
+	}
+	return &tokenBuckets{
+		rate:    rate,
+		burst:   b,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from the bucket of the key, returning false if it's
+// empty.
+func (t *tokenBuckets) allow(key string) bool {
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if now.Sub(t.swept) >= bucketSweepInterval {
+		t.sweep(now)
+	}
+	b, ok := t.buckets[key]
+	if !ok {
+		if len(t.buckets) >= maxTrackedBuckets {
+			t.buckets = make(map[string]*bucket)
+		}
+		b = &bucket{tokens: t.burst, last: now}
+		t.buckets[key] = b
+	}
+	b.tokens = min(t.burst, b.tokens+now.Sub(b.last).Seconds()*t.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep removes the buckets that are full again. The lock must be held.
+func (t *tokenBuckets) sweep(now time.Time) {
+	t.swept = now
+	for key, b := range t.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*t.rate >= t.burst {
+			delete(t.buckets, key)
+		}
+	}
+}
+
+// rrlAction is what response rate limiting does with a response.
+type rrlAction int
+
+const (
+	rrlSend rrlAction = iota
+	rrlDrop
+	rrlSlip
+)
+
+// responseRateLimiter limits the rate of identical UDP responses to the
+// clients of a network, so that the proxy is of little use to amplify
+// attacks on spoofed addresses. Some limited responses slip through
+// truncated, so that clients whose address is spoofed can still retry over
+// TCP. A nil *responseRateLimiter sends every response.
+type responseRateLimiter struct {
+	buckets *tokenBuckets
+	slip    uint64
+	limited atomic.Uint64
+}
+
+// newResponseRateLimiter returns a limiter of rate identical responses per
+// second, or nil if rate isn't positive. If slip isn't positive,
+// DefaultRRLSlip is used.
+func newResponseRateLimiter(rate float64, slip int) *responseRateLimiter {
+	buckets := newTokenBuckets(rate, 0)
+	if buckets == nil {
+		return nil
+	}
+	if slip <= 0 {
+		slip = DefaultRRLSlip
+	}
+	return &responseRateLimiter{buckets: buckets, slip: uint64(slip)}
+}
+
+// check returns whether a response to a client is sent, dropped or sent
+// truncated. Responses are identical if they have the same question and
+// rcode, and are sent to the same /24 IPv4 or /56 IPv6 network. Responses to
+// clients whose address is unknown aren't limited, since they'd all share a
+// limit.
+func (r *responseRateLimiter) check(ip netip.Addr, resp []byte) rrlAction {
+	if r == nil || !ip.IsValid() {
+		return rrlSend
+	}
+	bits := 24
+	if ip.Is6() {
+		bits = 56
+	}
+	network, _ := ip.Prefix(bits)
+
+	key := network.String()
+	var p dnsmessage.Parser
+	if h, err := p.Start(resp); err == nil {
+		key += "|" + h.RCode.String()
+		if q, err := p.Question(); err == nil {
+			key += "|" + strings.ToLower(q.Name.String()) + "|" + q.Type.String()
+		}
+	}
+	if r.buckets.allow(key) {
+		return rrlSend
+	}
+	if r.limited.Add(1)%r.slip == 0 {
+		return rrlSlip
+	}
+	return rrlDrop
+}
+
+// truncatedResponse returns a response with no records and the TC bit set,
+// so that the client retries over TCP, or nil if the response can't be
+// parsed.
+func truncatedResponse(resp []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return nil
+	}
+	h.Truncated = true
+	msg := dnsmessage.Message{Header: h}
+	if q, err := p.Question(); err == nil {
+		msg.Questions = []dnsmessage.Question{q}
+	}
+	b, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// allowedClient returns whether the client ACL allows a client, counting the
+// rejected queries.
+func (d *DNSServer) allowedClient(transport string, ip netip.Addr) bool {
+	if d.acl.allowed(ip) {
+		return true
+	}
+	recordRejectedQuery(transport, rejectReasonACL)
+	d.logger.Named(transport).Debug("rejected dns client by acl", "client", ip)
+	return false
+}
+
+// rateLimited returns whether a client is over its query rate limit,
+// counting the rejected queries. IPv4 clients are limited by address, and
+// IPv6 clients by /56 network, since a single client can pick any address of
+// its network. Clients whose address is unknown aren't limited, since they'd
+// all share a limit.
+func (d *DNSServer) rateLimited(transport string, ip netip.Addr) bool {
+	if !ip.IsValid() {
+		return false
+	}
+	key := ip.String()
+	if ip.Is6() {
+		network, _ := ip.Prefix(56)
+		key = network.String()
+	}
+	if d.rateLimits.allow(key) {
+		return false
+	}
+	recordRejectedQuery(transport, rejectReasonRateLimit)
+	return true
+}
+
+// rateLimitResponse returns the response to a query of a client over its
+// rate limit: REFUSED, or nil if the query is dropped.
+func (d *DNSServer) rateLimitResponse(query []byte) []byte {
+	if d.rateLimitAction == RateLimitActionDrop {
+		return nil
+	}
+	return errorResponse(query, dnsmessage.RCodeRefused)
+}
+
+// limitUDPResponse applies response rate limiting to a UDP response,
+// returning the response to send, which is nil if it's dropped.
+func (d *DNSServer) limitUDPResponse(ip netip.Addr, resp []byte) []byte {
+	switch d.rrl.check(ip, resp) {
+	case rrlDrop:
+		recordRejectedQuery(transportUDP, rejectReasonRRLDrop)
+		return nil
+	case rrlSlip:
+		recordRejectedQuery(transportUDP, rejectReasonRRLSlip)
+		return truncatedResponse(resp)
+	default:
+		return resp
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/proto-public/pbdns"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/hashicorp/consul-dataplane/pkg/dns/mocks"
+)
+
+func TestClientACL(t *testing.T) {
+	cases := map[string]struct {
+		allow, deny []string
+		allowed     []string
+		denied      []string
+	}{
+		"no cidrs": {
+			allowed: []string{"10.0.0.1", "::1"},
+		},
+		"allowlist": {
+			allow:   []string{"10.0.0.0/8", "fd00::/8"},
+			allowed: []string{"10.1.2.3", "fd00::1", "::ffff:10.0.0.1"},
+			denied:  []string{"192.168.0.1", "::1"},
+		},
+		"denylist": {
+			deny:    []string{"10.0.0.0/8"},
+			allowed: []string{"192.168.0.1"},
+			denied:  []string{"10.1.2.3"},
+		},
+		"deny takes precedence": {
+			allow:   []string{"10.0.0.0/8"},
+			deny:    []string{"10.1.0.0/16"},
+			allowed: []string{"10.2.0.1"},
+			denied:  []string{"10.1.0.1", "192.168.0.1"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			acl, err := newClientACL(c.allow, c.deny)
+			require.NoError(t, err)
+			for _, ip := range c.allowed {
+				require.True(t, acl.allowed(netip.MustParseAddr(ip).Unmap()), ip)
+			}
+			for _, ip := range c.denied {
+				require.False(t, acl.allowed(netip.MustParseAddr(ip).Unmap()), ip)
+			}
+		})
+	}
+
+	_, err := newClientACL([]string{"10.0.0.1"}, nil)
+	require.ErrorContains(t, err, `invalid dns client CIDR "10.0.0.1"`)
+}
+
+func TestClientIP(t *testing.T) {
+	require.Equal(t, netip.MustParseAddr("10.0.0.1"),
+		clientIP(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 53}))
+	require.Equal(t, netip.MustParseAddr("::1"),
+		clientIP(&net.TCPAddr{IP: net.ParseIP("::1"), Port: 53}))
+	require.False(t, clientIP(nil).IsValid())
+}
+
+func TestTokenBuckets(t *testing.T) {
+	require.Nil(t, newTokenBuckets(0, 10))
+
+	now := time.Now()
+	buckets := newTokenBuckets(2, 3)
+	buckets.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		require.True(t, buckets.allow("a"), "within the burst")
+	}
+	require.False(t, buckets.allow("a"))
+	require.True(t, buckets.allow("b"), "keys have their own bucket")
+
+	now = now.Add(500 * time.Millisecond)
+	require.True(t, buckets.allow("a"), "a token was added")
+	require.False(t, buckets.allow("a"))
+
+	// Full buckets are removed once idle.
+	now = now.Add(bucketSweepInterval)
+	require.True(t, buckets.allow("c"))
+	require.Len(t, buckets.buckets, 1)
+
+	// The burst defaults to the rate rounded up.
+	require.EqualValues(t, 3, newTokenBuckets(2.5, 0).burst)
+}
+
+func TestRateLimited(t *testing.T) {
+	testMetrics(t)
+	server := &DNSServer{rateLimits: newTokenBuckets(1, 1)}
+
+	require.False(t, server.rateLimited(transportUDP, netip.MustParseAddr("10.0.0.1")))
+	require.True(t, server.rateLimited(transportUDP, netip.MustParseAddr("10.0.0.1")))
+	require.False(t, server.rateLimited(transportUDP, netip.MustParseAddr("10.0.0.2")), "IPv4 clients are limited by address")
+
+	require.False(t, server.rateLimited(transportUDP, netip.MustParseAddr("fd00:0:0:1::1")))
+	require.True(t, server.rateLimited(transportUDP, netip.MustParseAddr("fd00:0:0:2::1")), "IPv6 clients are limited by /56")
+	require.False(t, server.rateLimited(transportUDP, netip.MustParseAddr("fd00:0:0:100::1")))
+
+	for i := 0; i < 3; i++ {
+		require.False(t, server.rateLimited(transportUDP, netip.Addr{}), "clients with no address aren't limited")
+	}
+}
+
+func TestResponseRateLimiter(t *testing.T) {
+	require.Equal(t, rrlSend, (*responseRateLimiter)(nil).check(netip.Addr{}, nil))
+
+	const name = "web.service.consul."
+	resp := buildResponse(t, dnsmessage.Header{ID: 1}, name, []dnsmessage.Resource{aRecord(name, 30)}, nil)
+	now := time.Now()
+	rrl := newResponseRateLimiter(1, 2)
+	rrl.buckets.now = func() time.Time { return now }
+
+	client := netip.MustParseAddr("10.0.0.1")
+	neighbor := netip.MustParseAddr("10.0.0.2")
+	require.Equal(t, rrlSend, rrl.check(client, resp))
+	// Clients of the same network share a limit, and every other limited
+	// response slips through.
+	require.Equal(t, rrlDrop, rrl.check(neighbor, resp))
+	require.Equal(t, rrlSlip, rrl.check(client, resp))
+	require.Equal(t, rrlDrop, rrl.check(client, resp))
+
+	require.Equal(t, rrlSend, rrl.check(netip.MustParseAddr("10.0.1.1"), resp), "other networks aren't limited")
+	other := buildResponse(t, dnsmessage.Header{ID: 1}, "db.service.consul.", nil, nil)
+	require.Equal(t, rrlSend, rrl.check(client, other), "other responses aren't limited")
+	for i := 0; i < 3; i++ {
+		require.Equal(t, rrlSend, rrl.check(netip.Addr{}, other), "clients with no address aren't limited")
+	}
+
+	truncated := truncatedResponse(resp)
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(truncated))
+	require.True(t, msg.Truncated)
+	require.EqualValues(t, 1, msg.ID)
+	require.Len(t, msg.Questions, 1)
+	require.Empty(t, msg.Answers)
+}
+
+func TestRejectedQueries(t *testing.T) {
+	sink := testMetrics(t)
+
+	const name = "web.service.consul."
+	consulResp := buildResponse(t, dnsmessage.Header{}, name, []dnsmessage.Resource{aRecord(name, 30)}, nil)
+	client := mocks.NewDNSServiceClient(t)
+	client.On("Query", mock.Anything, mock.Anything).Return(&pbdns.QueryResponse{Msg: consulResp}, nil).Maybe()
+
+	start := func(t *testing.T, p DNSServerParams) *DNSServer {
+		p.BindAddr = "127.0.0.1"
+		p.Logger = hclog.NewNullLogger()
+		p.Client = client
+		p.DisableCache = true
+		server, err := NewDNSServer(p)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		require.NoError(t, server.Start(ctx))
+		t.Cleanup(server.Stop)
+		return server.(*DNSServer)
+	}
+	query := func(t *testing.T, s *DNSServer, network string) (*dnsmessage.Message, error) {
+		port := s.UdpPort()
+		if network == "tcp" {
+			port = s.TcpPort()
+		}
+		conn, err := net.Dial(network, net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.SetDeadline(time.Now().Add(500*time.Millisecond)))
+
+		q := buildQuery(t, 1, name)
+		var resp []byte
+		if network == "tcp" {
+			if err := writeTCPMessage(conn, q); err != nil {
+				return nil, err
+			}
+			var length uint16
+			if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+				return nil, err
+			}
+			resp = make([]byte, length)
+			if _, err := io.ReadFull(conn, resp); err != nil {
+				return nil, err
+			}
+		} else {
+			_, err = conn.Write(q)
+			require.NoError(t, err)
+			buf := make([]byte, 512)
+			n, err := conn.Read(buf)
+			if err != nil {
+				return nil, err
+			}
+			resp = buf[:n]
+		}
+		var msg dnsmessage.Message
+		require.NoError(t, msg.Unpack(resp))
+		return &msg, nil
+	}
+
+	t.Run("acl", func(t *testing.T) {
+		s := start(t, DNSServerParams{DenyCIDRs: []string{"127.0.0.0/8"}})
+		for _, network := range []string{"udp", "tcp"} {
+			_, err := query(t, s, network)
+			require.Error(t, err, "denied clients get no response over %s", network)
+		}
+	})
+
+	t.Run("refuse", func(t *testing.T) {
+		s := start(t, DNSServerParams{RateLimit: 1})
+		msg, err := query(t, s, "udp")
+		require.NoError(t, err)
+		require.Equal(t, dnsmessage.RCodeSuccess, msg.RCode)
+		msg, err = query(t, s, "tcp")
+		require.NoError(t, err)
+		require.Equal(t, dnsmessage.RCodeRefused, msg.RCode)
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		s := start(t, DNSServerParams{RateLimit: 1, RateLimitAction: RateLimitActionDrop})
+		_, err := query(t, s, "udp")
+		require.NoError(t, err)
+		_, err = query(t, s, "udp")
+		require.Error(t, err)
+	})
+
+	data := sink.Data()
+	require.EqualValues(t, 1, data[0].Counters["dns_rejected_queries;transport=udp;reason=acl"].Count)
+	require.EqualValues(t, 1, data[0].Counters["dns_rejected_queries;transport=tcp;reason=acl"].Count)
+	require.EqualValues(t, 1, data[0].Counters["dns_rejected_queries;transport=tcp;reason=rate_limit"].Count)
+	require.EqualValues(t, 1, data[0].Counters["dns_rejected_queries;transport=udp;reason=rate_limit"].Count)
+}
@@ -0,0 +1,239 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/hashicorp/consul/proto-public/pbdns"
+	"github.com/hashicorp/go-metrics"
+	"golang.org/x/net/dns/dnsmessage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	transportUDP = "udp"
+	transportTCP = "tcp"
+	transportDoT = "dot"
+	transportDoH = "doh"
+
+	// Classes of the dns_errors counter, in addition to grpc_<code>.
+	errClassTimeout          = "timeout"
+	errClassOversizeResponse = "oversize_response"
+	errClassTruncatedRead    = "truncated_read"
+	errClassWrite            = "write"
+	errClassMalformedQuery   = "malformed_query"
+	errClassRecursor         = "recursor"
+
+	// Reasons of the dns_rejected_queries counter.
+	rejectReasonACL       = "acl"
+	rejectReasonRateLimit = "rate_limit"
+	rejectReasonRRLDrop   = "rrl_drop"
+	rejectReasonRRLSlip   = "rrl_slip"
+
+	// rcodeNone is the rcode label of queries that Consul didn't respond to.
+	rcodeNone = "none"
+)
+
+var (
+	queriesKey       = []string{"dns_queries"}
+	errorsKey        = []string{"dns_errors"}
+	queryDurationKey = []string{"dns_query_duration"}
+	inflightKey      = []string{"dns_inflight_queries"}
+	tcpConnsKey      = []string{"dns_tcp_connections"}
+
+	cacheHitsKey      = []string{"dns_cache_hits"}
+	cacheMissesKey    = []string{"dns_cache_misses"}
+	cacheEvictionsKey = []string{"dns_cache_evictions"}
+	cacheEntriesKey   = []string{"dns_cache_entries"}
+
+	staleAnswersKey       = []string{"dns_stale_answers"}
+	truncatedResponsesKey = []string{"dns_truncated_responses"}
+
+	udpQueueDepthKey    = []string{"dns_udp_queue_depth"}
+	droppedQueriesKey   = []string{"dns_dropped_queries"}
+	coalescedQueriesKey = []string{"dns_coalesced_queries"}
+	rejectedQueriesKey  = []string{"dns_rejected_queries"}
+	rejectedConnsKey    = []string{"dns_rejected_connections"}
+
+	recursorQueriesKey = []string{"dns_recursor_queries"}
+	recursorHealthyKey = []string{"dns_recursor_healthy"}
+)
+
+// incrInflight adjusts the number of queries being resolved by Consul.
+func (d *DNSServer) incrInflight(delta int64) {
+	metrics.SetGauge(inflightKey, float32(d.inflight.Add(delta)))
+}
+
+// incrTCPConns adjusts the number of open TCP connections.
+func (d *DNSServer) incrTCPConns(delta int64) {
+	metrics.SetGauge(tcpConnsKey, float32(d.tcpConns.Add(delta)))
+}
+
+// queryConsul forwards a DNS request to Consul, recording the in-flight
+// queries, the latency of the query and any error.
+func (d *DNSServer) queryConsul(ctx context.Context, transport string, req *pbdns.QueryRequest) (*pbdns.QueryResponse, error) {
+	d.incrInflight(1)
+	defer d.incrInflight(-1)
+
+	start := time.Now()
+	resp, err := d.client.Query(ctx, req)
+	metrics.MeasureSinceWithLabels(queryDurationKey, start, []metrics.Label{{Name: "transport", Value: transport}})
+	if err != nil {
+		recordError(transport, queryErrorClass(err))
+	}
+	return resp, err
+}
+
+// recordQuery counts a query with its type and the rcode of the response,
+// which is nil if Consul didn't respond.
+func recordQuery(transport string, query, resp []byte) {
+	rcode := rcodeNone
+	if resp != nil {
+		rcode = responseRCode(resp)
+	}
+	metrics.IncrCounterWithLabels(queriesKey, 1, []metrics.Label{
+		{Name: "transport", Value: transport},
+		{Name: "qtype", Value: queryType(query)},
+		{Name: "rcode", Value: rcode},
+	})
+}
+
+// recordRecursorQuery counts a query forwarded to the recursors with the
+// rcode of the response, which is nil if no recursor responded.
+func recordRecursorQuery(transport string, resp []byte) {
+	rcode := rcodeNone
+	if resp != nil {
+		rcode = responseRCode(resp)
+	}
+	metrics.IncrCounterWithLabels(recursorQueriesKey, 1, []metrics.Label{
+		{Name: "transport", Value: transport},
+		{Name: "rcode", Value: rcode},
+	})
+}
+
+// recordCacheLookup counts a hit or miss of the response cache.
+func recordCacheLookup(transport string, hit bool) {
+	key := cacheMissesKey
+	if hit {
+		key = cacheHitsKey
+	}
+	metrics.IncrCounterWithLabels(key, 1, []metrics.Label{{Name: "transport", Value: transport}})
+}
+
+// recordStaleAnswer counts a stale response served because Consul couldn't
+// answer.
+func recordStaleAnswer(transport string) {
+	metrics.IncrCounterWithLabels(staleAnswersKey, 1, []metrics.Label{{Name: "transport", Value: transport}})
+}
+
+// recordTruncatedResponse counts a UDP response truncated to fit the payload
+// size of the client.
+func recordTruncatedResponse() {
+	metrics.IncrCounter(truncatedResponsesKey, 1)
+}
+
+// recordDroppedQuery counts a UDP query dropped because the queue was full,
+// labeled by the drop policy.
+func recordDroppedQuery(policy string) {
+	metrics.IncrCounterWithLabels(droppedQueriesKey, 1, []metrics.Label{{Name: "policy", Value: policy}})
+}
+
+// recordRejectedQuery counts a query rejected by the client ACL or the rate
+// limits, labeled by transport and reason.
+func recordRejectedQuery(transport, reason string) {
+	metrics.IncrCounterWithLabels(rejectedQueriesKey, 1, []metrics.Label{
+		{Name: "transport", Value: transport},
+		{Name: "reason", Value: reason},
+	})
+}
+
+// recordRejectedConn counts a TCP or DoT connection closed because there
+// were too many open connections.
+func recordRejectedConn(transport string) {
+	metrics.IncrCounterWithLabels(rejectedConnsKey, 1, []metrics.Label{{Name: "transport", Value: transport}})
+}
+
+// recordCoalescedQuery counts a query answered with the response to an
+// identical query in flight.
+func recordCoalescedQuery(transport string) {
+	metrics.IncrCounterWithLabels(coalescedQueriesKey, 1, []metrics.Label{{Name: "transport", Value: transport}})
+}
+
+// recordError counts an error of the given class.
+func recordError(transport, class string) {
+	metrics.IncrCounterWithLabels(errorsKey, 1, []metrics.Label{
+		{Name: "transport", Value: transport},
+		{Name: "class", Value: class},
+	})
+}
+
+// queryErrorClass returns the class of an error returned by Consul's
+// DNSService.Query, either timeout or grpc_<code> in snake case.
+func queryErrorClass(err error) string {
+	code := status.Code(err)
+	if code == codes.DeadlineExceeded || errors.Is(err, context.DeadlineExceeded) {
+		return errClassTimeout
+	}
+	var b strings.Builder
+	b.WriteString("grpc_")
+	for i, r := range code.String() {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// queryType returns the type of the first question of a DNS query, "other" for
+// types without a name, or "unknown" if the query can't be parsed. Unnamed
+// types are grouped to bound the cardinality of the metrics.
+func queryType(msg []byte) string {
+	var p dnsmessage.Parser
+	if _, err := p.Start(msg); err != nil {
+		return "unknown"
+	}
+	q, err := p.Question()
+	if err != nil {
+		return "unknown"
+	}
+	name, ok := strings.CutPrefix(q.Type.String(), "Type")
+	if !ok {
+		return "other"
+	}
+	return name
+}
+
+// rcodeNames are the names of the rcodes in the DNS RFCs.
+var rcodeNames = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+// responseRCode returns the rcode of a DNS response, or "unknown" if the
+// response can't be parsed.
+func responseRCode(msg []byte) string {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return "unknown"
+	}
+	if name, ok := rcodeNames[h.RCode]; ok {
+		return name
+	}
+	return "other"
+}
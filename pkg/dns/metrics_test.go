@@ -0,0 +1,129 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/proto-public/pbdns"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-metrics"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/hashicorp/consul-dataplane/pkg/dns/mocks"
+)
+
+// buildMsg builds a DNS message with a single question.
+func buildMsg(t *testing.T, h dnsmessage.Header, qtype dnsmessage.Type) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, h)
+	require.NoError(t, b.StartQuestions())
+	require.NoError(t, b.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName("web.service.consul."),
+		Type:  qtype,
+		Class: dnsmessage.ClassINET,
+	}))
+	msg, err := b.Finish()
+	require.NoError(t, err)
+	return msg
+}
+
+func TestQueryType(t *testing.T) {
+	require.Equal(t, "SRV", queryType(buildMsg(t, dnsmessage.Header{ID: 1}, dnsmessage.TypeSRV)))
+	require.Equal(t, "AAAA", queryType(buildMsg(t, dnsmessage.Header{ID: 1}, dnsmessage.TypeAAAA)))
+	require.Equal(t, "other", queryType(buildMsg(t, dnsmessage.Header{ID: 1}, dnsmessage.Type(4242))))
+	require.Equal(t, "unknown", queryType([]byte{0x01}))
+}
+
+func TestResponseRCode(t *testing.T) {
+	require.Equal(t, "NOERROR", responseRCode(buildMsg(t, dnsmessage.Header{Response: true}, dnsmessage.TypeA)))
+	require.Equal(t, "NXDOMAIN", responseRCode(buildMsg(t, dnsmessage.Header{Response: true, RCode: dnsmessage.RCodeNameError}, dnsmessage.TypeA)))
+	require.Equal(t, "other", responseRCode(buildMsg(t, dnsmessage.Header{Response: true, RCode: dnsmessage.RCode(9)}, dnsmessage.TypeA)))
+	require.Equal(t, "unknown", responseRCode(nil))
+}
+
+func TestQueryErrorClass(t *testing.T) {
+	require.Equal(t, "timeout", queryErrorClass(status.Error(codes.DeadlineExceeded, "too slow")))
+	require.Equal(t, "timeout", queryErrorClass(fmt.Errorf("query: %w", context.DeadlineExceeded)))
+	require.Equal(t, "grpc_permission_denied", queryErrorClass(status.Error(codes.PermissionDenied, "denied")))
+	require.Equal(t, "grpc_unavailable", queryErrorClass(status.Error(codes.Unavailable, "no servers")))
+	require.Equal(t, "grpc_unknown", queryErrorClass(errors.New("boom")))
+}
+
+func TestTCPQueryMetrics(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	cfg := metrics.DefaultConfig("")
+	cfg.EnableHostname = false
+	cfg.EnableRuntimeMetrics = false
+	_, err := metrics.NewGlobal(cfg, sink)
+	require.NoError(t, err)
+	t.Cleanup(func() { metrics.Shutdown() })
+
+	query := buildMsg(t, dnsmessage.Header{ID: 1, RecursionDesired: true}, dnsmessage.TypeSRV)
+	answer := buildMsg(t, dnsmessage.Header{ID: 1, Response: true, RCode: dnsmessage.RCodeNameError}, dnsmessage.TypeSRV)
+
+	client := mocks.NewDNSServiceClient(t)
+	client.On("Query", mock.Anything, mock.Anything).Return(&pbdns.QueryResponse{Msg: answer}, nil).Once()
+	client.On("Query", mock.Anything, mock.Anything).Return(nil, status.Error(codes.Unavailable, "no servers")).Once()
+
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	server := &DNSServer{
+		client:      client,
+		listenerTCP: listener,
+		logger:      hclog.NewNullLogger(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go server.proxyTCP(ctx)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The first query is answered.
+	require.NoError(t, binary.Write(conn, binary.BigEndian, uint16(len(query))))
+	_, err = conn.Write(query)
+	require.NoError(t, err)
+	var length uint16
+	require.NoError(t, binary.Read(conn, binary.BigEndian, &length))
+	resp := make([]byte, length)
+	_, err = io.ReadFull(conn, resp)
+	require.NoError(t, err)
+	require.Equal(t, answer, resp)
+
+	// The second query fails, which is answered with SERVFAIL.
+	require.NoError(t, binary.Write(conn, binary.BigEndian, uint16(len(query))))
+	_, err = conn.Write(query)
+	require.NoError(t, err)
+	require.NoError(t, binary.Read(conn, binary.BigEndian, &length))
+	resp = make([]byte, length)
+	_, err = io.ReadFull(conn, resp)
+	require.NoError(t, err)
+	require.Equal(t, "SERVFAIL", responseRCode(resp))
+	require.NoError(t, conn.Close())
+
+	require.Eventually(t, func() bool {
+		data := sink.Data()
+		return data[0].Gauges["dns_tcp_connections"].Value == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	data := sink.Data()
+	require.EqualValues(t, 1, data[0].Counters["dns_queries;transport=tcp;qtype=SRV;rcode=NXDOMAIN"].Count)
+	require.EqualValues(t, 1, data[0].Counters["dns_queries;transport=tcp;qtype=SRV;rcode=none"].Count)
+	require.EqualValues(t, 1, data[0].Counters["dns_errors;transport=tcp;class=grpc_unavailable"].Count)
+	require.EqualValues(t, 2, data[0].Samples["dns_query_duration;transport=tcp"].Count)
+	require.EqualValues(t, 0, data[0].Gauges["dns_inflight_queries"].Value)
+}
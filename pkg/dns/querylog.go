@@ -0,0 +1,291 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// DefaultQueryLogMaxSize is the default size in megabytes of the query
+	// log file, above which it's rotated.
+	DefaultQueryLogMaxSize = 100
+
+	// DefaultQueryLogMaxFiles is the default number of rotated query log
+	// files kept.
+	DefaultQueryLogMaxFiles = 5
+)
+
+// QueryLogParams is the configuration of the query log, which records the
+// queries answered by the proxy.
+type QueryLogParams struct {
+	// Enabled enables the query log.
+	Enabled bool
+	// File is the path of the file the queries are written to as JSON lines.
+	// If empty, the queries are written to the logger of the proxy.
+	File string
+	// MaxSize is the size in megabytes of the file, above which it's rotated.
+	// If zero, DefaultQueryLogMaxSize is used.
+	MaxSize int
+	// MaxFiles is the number of rotated files kept. If zero,
+	// DefaultQueryLogMaxFiles is used.
+	MaxFiles int
+	// SampleRate is the share of the queries logged, between 0 and 1. If
+	// zero, every query is logged.
+	SampleRate float64
+	// Names are the domains of the names whose queries are logged. If empty,
+	// the queries of every name not in ExcludeNames are logged.
+	Names []string
+	// ExcludeNames are the domains of the names whose queries aren't logged,
+	// which takes precedence over Names.
+	ExcludeNames []string
+}
+
+// queryLogEntry is a query answered by the proxy.
+type queryLogEntry struct {
+	Time      time.Time `json:"time"`
+	Client    string    `json:"client"`
+	Transport string    `json:"transport"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	RCode     string    `json:"rcode"`
+	Answers   int       `json:"answers"`
+	LatencyMs float64   `json:"latency_ms"`
+	Cached    bool      `json:"cached"`
+}
+
+// queryLog logs the queries answered by the proxy, either to a logger or to
+// a file. A nil *queryLog logs nothing.
+type queryLog struct {
+	logger hclog.Logger  // nil if logging to a file
+	file   *rotatingFile // nil if logging to the logger
+
+	sampleRate   float64
+	names        []string // normalized
+	excludeNames []string // normalized
+	rand         func() float64
+}
+
+// newQueryLog returns the query log, or nil if it's disabled.
+func newQueryLog(p QueryLogParams, logger hclog.Logger) (*queryLog, error) {
+	if !p.Enabled {
+		return nil, nil
+	}
+	l := &queryLog{sampleRate: p.SampleRate, rand: rand.Float64}
+	for _, name := range p.Names {
+		l.names = append(l.names, normalizeDomain(name))
+	}
+	for _, name := range p.ExcludeNames {
+		l.excludeNames = append(l.excludeNames, normalizeDomain(name))
+	}
+	if p.File == "" {
+		l.logger = logger
+		return l, nil
+	}
+	maxSize := p.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultQueryLogMaxSize
+	}
+	maxFiles := p.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = DefaultQueryLogMaxFiles
+	}
+	file, err := openRotatingFile(p.File, int64(maxSize)<<20, maxFiles)
+	if err != nil {
+		return nil, fmt.Errorf("error opening dns query log: %w", err)
+	}
+	l.file = file
+	return l, nil
+}
+
+// record logs a query answered with resp, which is nil if the query wasn't
+// answered, unless the query is filtered out by its name or by sampling.
+func (l *queryLog) record(transport, client string, query, resp []byte, cached bool, start time.Time) {
+	if l == nil {
+		return
+	}
+	if l.sampleRate > 0 && l.sampleRate < 1 && l.rand() >= l.sampleRate {
+		return
+	}
+	entry := queryLogEntry{
+		Time:      start.UTC(),
+		Client:    client,
+		Transport: transport,
+		RCode:     rcodeNone,
+		LatencyMs: float64(time.Since(start)) / float64(time.Millisecond),
+		Cached:    cached,
+	}
+	var p dnsmessage.Parser
+	if _, err := p.Start(query); err == nil {
+		if q, err := p.Question(); err == nil {
+			entry.Name = q.Name.String()
+			entry.Type = strings.TrimPrefix(q.Type.String(), "Type")
+		}
+	}
+	if !l.logged(entry.Name) {
+		return
+	}
+	if resp != nil {
+		entry.RCode, entry.Answers = responseSummary(resp)
+	}
+
+	if l.file == nil {
+		l.logger.Info("dns query",
+			"client", entry.Client,
+			"transport", entry.Transport,
+			"name", entry.Name,
+			"type", entry.Type,
+			"rcode", entry.RCode,
+			"answers", entry.Answers,
+			"latency_ms", entry.LatencyMs,
+			"cached", entry.Cached,
+		)
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	_ = l.file.write(append(line, '\n'))
+}
+
+// logged returns whether the queries of a name are logged.
+func (l *queryLog) logged(name string) bool {
+	if inDomains(name, l.excludeNames) {
+		return false
+	}
+	return len(l.names) == 0 || inDomains(name, l.names)
+}
+
+// close closes the query log file, if any.
+func (l *queryLog) close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.close()
+}
+
+// responseSummary returns the rcode and the number of answers of a response.
+func responseSummary(resp []byte) (string, int) {
+	rcode := responseRCode(resp)
+	var p dnsmessage.Parser
+	if _, err := p.Start(resp); err != nil {
+		return rcode, 0
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return rcode, 0
+	}
+	answers := 0
+	for {
+		if _, err := p.AnswerHeader(); err != nil {
+			return rcode, answers
+		}
+		if err := p.SkipAnswer(); err != nil {
+			return rcode, answers
+		}
+		answers++
+	}
+}
+
+// rotatingFile is a file that's rotated once it reaches its maximum size,
+// keeping a number of rotated files suffixed .1, .2 and so on, .1 being the
+// most recent.
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// openRotatingFile opens a rotating file, appending to it if it exists.
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file. The lock must be held.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// write writes to the file, rotating it first if it'd grow beyond its
+// maximum size.
+func (f *rotatingFile) write(b []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return errors.New("query log file is closed")
+	}
+	if f.size > 0 && f.size+int64(len(b)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+	return err
+}
+
+// rotate renames the file and the rotated files, removing the oldest, and
+// opens a new file, which is the same file if renaming it failed. The lock
+// must be held.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	var err error
+	for i := f.maxFiles - 1; i >= 1 && err == nil; i-- {
+		err = os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = os.Rename(f.path, f.path+".1")
+	}
+	if openErr := f.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+// close closes the file.
+func (f *rotatingFile) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
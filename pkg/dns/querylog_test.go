@@ -0,0 +1,191 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/proto-public/pbdns"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/hashicorp/consul-dataplane/pkg/dns/mocks"
+)
+
+// readQueryLog reads the entries of a query log file.
+func readQueryLog(t *testing.T, path string) []queryLogEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var entries []queryLogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry queryLogEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+func TestQueryLog(t *testing.T) {
+	const name = "web.service.consul."
+	query := buildQuery(t, 1, name)
+	resp := buildResponse(t, dnsmessage.Header{ID: 1}, name,
+		[]dnsmessage.Resource{aRecord(name, 30), aRecord(name, 30)}, nil)
+
+	t.Run("disabled", func(t *testing.T) {
+		l, err := newQueryLog(QueryLogParams{File: filepath.Join(t.TempDir(), "queries.log")}, hclog.NewNullLogger())
+		require.NoError(t, err)
+		require.Nil(t, l)
+		l.record(transportUDP, "127.0.0.1:1234", query, resp, false, time.Now())
+		require.NoError(t, l.close())
+	})
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queries.log")
+		l, err := newQueryLog(QueryLogParams{
+			Enabled:      true,
+			File:         path,
+			Names:        []string{"service.consul"},
+			ExcludeNames: []string{"db.service.consul"},
+		}, hclog.NewNullLogger())
+		require.NoError(t, err)
+
+		start := time.Now()
+		l.record(transportUDP, "127.0.0.1:1234", query, resp, true, start)
+		l.record(transportTCP, "127.0.0.1:1234", query, nil, false, start)
+		l.record(transportUDP, "127.0.0.1:1234", buildQuery(t, 2, "db.service.consul."), resp, false, start)
+		l.record(transportUDP, "127.0.0.1:1234", buildQuery(t, 3, "example.com."), resp, false, start)
+		require.NoError(t, l.close())
+
+		entries := readQueryLog(t, path)
+		require.Len(t, entries, 2, "the queries of other names are filtered out")
+		require.Equal(t, "127.0.0.1:1234", entries[0].Client)
+		require.Equal(t, transportUDP, entries[0].Transport)
+		require.Equal(t, name, entries[0].Name)
+		require.Equal(t, "A", entries[0].Type)
+		require.Equal(t, "NOERROR", entries[0].RCode)
+		require.Equal(t, 2, entries[0].Answers)
+		require.True(t, entries[0].Cached)
+		require.GreaterOrEqual(t, entries[0].LatencyMs, 0.0)
+		require.WithinDuration(t, start, entries[0].Time, time.Millisecond)
+
+		require.Equal(t, rcodeNone, entries[1].RCode, "unanswered queries are logged")
+		require.Zero(t, entries[1].Answers)
+	})
+
+	t.Run("logger", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := newQueryLog(QueryLogParams{Enabled: true}, hclog.New(&hclog.LoggerOptions{Output: &buf, JSONFormat: true}))
+		require.NoError(t, err)
+		l.record(transportDoH, "127.0.0.1:1234", query, resp, false, time.Now())
+
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+		require.Equal(t, "dns query", entry["@message"])
+		require.Equal(t, name, entry["name"])
+		require.Equal(t, "NOERROR", entry["rcode"])
+		require.EqualValues(t, 2, entry["answers"])
+	})
+
+	t.Run("sampling", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queries.log")
+		l, err := newQueryLog(QueryLogParams{Enabled: true, File: path, SampleRate: 0.5}, hclog.NewNullLogger())
+		require.NoError(t, err)
+		samples := []float64{0.1, 0.7, 0.4, 0.5}
+		l.rand = func() float64 {
+			sample := samples[0]
+			samples = samples[1:]
+			return sample
+		}
+		for range 4 {
+			l.record(transportUDP, "127.0.0.1:1234", query, resp, false, time.Now())
+		}
+		require.NoError(t, l.close())
+		require.Len(t, readQueryLog(t, path), 2)
+	})
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	f, err := openRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		require.NoError(t, f.write([]byte(line)))
+	}
+	require.NoError(t, f.close())
+
+	read := func(path string) string {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(b)
+	}
+	require.Equal(t, "fourth\n", read(path))
+	require.Equal(t, "third\n", read(path+".1"))
+	require.Equal(t, "second\n", read(path+".2"))
+	require.NoFileExists(t, path+".3", "the oldest file is removed")
+
+	// An existing file is appended to.
+	f, err = openRotatingFile(path, 100, 2)
+	require.NoError(t, err)
+	require.NoError(t, f.write([]byte("fifth\n")))
+	require.NoError(t, f.close())
+	require.Equal(t, "fourth\nfifth\n", read(path))
+}
+
+func TestQueryLogServer(t *testing.T) {
+	const name = "web.service.consul."
+	consulResp := buildResponse(t, dnsmessage.Header{}, name, []dnsmessage.Resource{aRecord(name, 30)}, nil)
+	client := mocks.NewDNSServiceClient(t)
+	client.On("Query", mock.Anything, mock.Anything).Return(&pbdns.QueryResponse{Msg: consulResp}, nil).Once()
+
+	path := filepath.Join(t.TempDir(), "queries.log")
+	server, err := NewDNSServer(DNSServerParams{
+		BindAddr: "127.0.0.1",
+		Port:     0,
+		Logger:   hclog.NewNullLogger(),
+		Client:   client,
+		QueryLog: QueryLogParams{Enabled: true, File: path},
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	require.NoError(t, server.Start(ctx))
+	t.Cleanup(server.Stop)
+
+	conn, err := net.Dial("udp", server.(*DNSServer).connUDP.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 512)
+	for id := uint16(1); id <= 2; id++ {
+		_, err = conn.Write(buildQuery(t, id, name))
+		require.NoError(t, err)
+		_, err = conn.Read(buf)
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool {
+		b, err := os.ReadFile(path)
+		return err == nil && strings.Count(string(b), "\n") == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	entries := readQueryLog(t, path)
+	require.Equal(t, conn.LocalAddr().String(), entries[0].Client)
+	require.False(t, entries[0].Cached)
+	require.True(t, entries[1].Cached, "the second query is answered from the cache")
+}
@@ -0,0 +1,300 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-metrics"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// DefaultDomain is the default domain of the names resolved by Consul.
+	DefaultDomain = "consul."
+
+	// DefaultRecursorTimeout is the default timeout of a query to a recursor.
+	DefaultRecursorTimeout = 2 * time.Second
+
+	// recursorHealthCheckInterval is how often unhealthy recursors are
+	// probed.
+	recursorHealthCheckInterval = 10 * time.Second
+)
+
+// recursor is an upstream nameserver that the queries outside of the Consul
+// domains are forwarded to.
+type recursor struct {
+	addr    string // host:port
+	healthy atomic.Bool
+}
+
+// setHealthy records whether the recursor answers queries.
+func (r *recursor) setHealthy(healthy bool) {
+	r.healthy.Store(healthy)
+	v := float32(0)
+	if healthy {
+		v = 1
+	}
+	metrics.SetGaugeWithLabels(recursorHealthyKey, v, []metrics.Label{{Name: "recursor", Value: r.addr}})
+}
+
+// recursorPool forwards queries to recursors. Recursors are tried in order,
+// healthy ones first. A recursor that fails to answer is unhealthy until it
+// answers again, either a forwarded query or a periodic health check.
+type recursorPool struct {
+	recursors []*recursor
+	timeout   time.Duration
+	logger    hclog.Logger
+
+	// exchangeFn exchanges a query with a recursor. It's overridden in tests.
+	exchangeFn func(ctx context.Context, network, addr string, msg []byte) ([]byte, error)
+}
+
+// newRecursorPool returns a pool of the recursors at the given addresses,
+// which are all healthy to begin with. If timeout isn't positive,
+// DefaultRecursorTimeout is used.
+func newRecursorPool(addrs []string, timeout time.Duration, logger hclog.Logger) *recursorPool {
+	if timeout <= 0 {
+		timeout = DefaultRecursorTimeout
+	}
+	p := &recursorPool{
+		timeout:    timeout,
+		logger:     logger,
+		exchangeFn: exchange,
+	}
+	for _, addr := range addrs {
+		r := &recursor{addr: addr}
+		r.setHealthy(true)
+		p.recursors = append(p.recursors, r)
+	}
+	return p
+}
+
+// forward sends a query to the recursors until one answers, over the
+// transport the client used. UDP responses that are truncated are retried
+// over TCP, as a client would.
+func (p *recursorPool) forward(ctx context.Context, transport string, msg []byte) ([]byte, error) {
+	ordered := make([]*recursor, 0, len(p.recursors))
+	for _, r := range p.recursors {
+		if r.healthy.Load() {
+			ordered = append(ordered, r)
+		}
+	}
+	for _, r := range p.recursors {
+		if !r.healthy.Load() {
+			ordered = append(ordered, r)
+		}
+	}
+
+	var err error
+	for _, r := range ordered {
+		var resp []byte
+		resp, err = p.exchangeWithFallback(ctx, transport, r.addr, msg)
+		if err == nil {
+			if !r.healthy.Load() {
+				p.logger.Info("dns recursor is healthy again", "recursor", r.addr)
+			}
+			r.setHealthy(true)
+			return resp, nil
+		}
+		if r.healthy.Load() {
+			p.logger.Warn("dns recursor failed, marking it unhealthy", "recursor", r.addr, "error", err)
+		}
+		r.setHealthy(false)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("no dns recursor answered: %w", err)
+}
+
+// exchangeWithFallback exchanges a query with a recursor within the timeout,
+// falling back to TCP if the UDP response is truncated.
+func (p *recursorPool) exchangeWithFallback(ctx context.Context, transport, addr string, msg []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	resp, err := p.exchangeFn(ctx, transport, addr, msg)
+	if err != nil || transport == transportTCP {
+		return resp, err
+	}
+	var parser dnsmessage.Parser
+	if h, err := parser.Start(resp); err == nil && h.Truncated {
+		return p.exchangeFn(ctx, transportTCP, addr, msg)
+	}
+	return resp, nil
+}
+
+// runHealthChecks probes the unhealthy recursors until the context is
+// canceled, so that they're preferred again once they recover.
+func (p *recursorPool) runHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(recursorHealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, r := range p.recursors {
+			if !r.healthy.Load() {
+				p.checkHealth(ctx, r)
+			}
+		}
+	}
+}
+
+// checkHealth marks a recursor healthy if it answers a query for the NS
+// records of the root zone with any rcode.
+func (p *recursorPool) checkHealth(ctx context.Context, r *recursor) {
+	probe, err := (&dnsmessage.Message{
+		Header: dnsmessage.Header{ID: uint16(time.Now().UnixNano()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName("."),
+			Type:  dnsmessage.TypeNS,
+			Class: dnsmessage.ClassINET,
+		}},
+	}).Pack()
+	if err != nil {
+		return
+	}
+	if _, err := p.exchangeWithFallback(ctx, transportUDP, r.addr, probe); err != nil {
+		p.logger.Debug("dns recursor health check failed", "recursor", r.addr, "error", err)
+		return
+	}
+	p.logger.Info("dns recursor is healthy again", "recursor", r.addr)
+	r.setHealthy(true)
+}
+
+// exchange sends a query to a nameserver over UDP or TCP and returns its
+// response, which must match the ID of the query.
+func exchange(ctx context.Context, network, addr string, msg []byte) ([]byte, error) {
+	if len(msg) < 2 {
+		return nil, errors.New("query too short")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+	id := binary.BigEndian.Uint16(msg)
+
+	if network == transportTCP {
+		// TCP DNS messages are prefixed by their length, as in RFC 1035 4.2.2.
+		if err := binary.Write(conn, binary.BigEndian, uint16(len(msg))); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(msg); err != nil {
+			return nil, err
+		}
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, length)
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+		if !isResponseTo(resp, id) {
+			return nil, errors.New("response doesn't match the query")
+		}
+		return resp, nil
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxUDPPayloadSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray datagrams, which may be spoofed.
+		if isResponseTo(buf[:n], id) {
+			return append([]byte(nil), buf[:n]...), nil
+		}
+	}
+}
+
+// isResponseTo returns whether a message is a response with the given ID.
+func isResponseTo(msg []byte, id uint16) bool {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	return err == nil && h.Response && h.ID == id
+}
+
+// recursorAddr returns the host:port address of a recursor given as an IP
+// address or host name, with an optional port that defaults to 53.
+func recursorAddr(s string) (string, error) {
+	if s == "" {
+		return "", errors.New("empty dns recursor address")
+	}
+	if ip := net.ParseIP(s); ip != nil {
+		return net.JoinHostPort(s, "53"), nil
+	}
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		if host == "" || port == "" {
+			return "", fmt.Errorf("invalid dns recursor address %q", s)
+		}
+		return s, nil
+	}
+	if strings.Contains(s, ":") {
+		return "", fmt.Errorf("invalid dns recursor address %q", s)
+	}
+	return net.JoinHostPort(s, "53"), nil
+}
+
+// readResolvConf returns the nameservers of a resolv.conf file.
+func readResolvConf(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var nameservers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			nameservers = append(nameservers, fields[1])
+		}
+	}
+	return nameservers, scanner.Err()
+}
+
+// normalizeDomain returns a domain in lowercase with a trailing dot.
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, ".")) + "."
+}
+
+// inDomains returns whether a name is one of the domains or a subdomain of
+// one. Domains must be normalized.
+func inDomains(name string, domains []string) bool {
+	name = strings.ToLower(name)
+	for _, domain := range domains {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
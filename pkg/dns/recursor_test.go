@@ -0,0 +1,342 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/proto-public/pbdns"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/hashicorp/consul-dataplane/pkg/dns/mocks"
+)
+
+// answer returns a response to a query with the given header flags.
+func answer(t *testing.T, query []byte, truncated bool) []byte {
+	t.Helper()
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(query))
+	msg.Response = true
+	msg.Truncated = truncated
+	if !truncated {
+		msg.Answers = []dnsmessage.Resource{aRecord(msg.Questions[0].Name.String(), 30)}
+	}
+	b, err := msg.Pack()
+	require.NoError(t, err)
+	return b
+}
+
+// startNameserver runs a nameserver on a UDP and TCP port of the loopback
+// address, which answers queries with handle, and returns its address.
+func startNameserver(t *testing.T, handle func(network string, query []byte) []byte) string {
+	t.Helper()
+	var (
+		udp net.PacketConn
+		tcp net.Listener
+		err error
+	)
+	// The UDP port may already be taken over TCP.
+	for i := 0; i < 10; i++ {
+		udp, err = net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		tcp, err = net.Listen("tcp", udp.LocalAddr().String())
+		if err == nil {
+			break
+		}
+		udp.Close()
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+
+	go func() {
+		buf := make([]byte, maxUDPPayloadSize)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := handle(transportUDP, append([]byte(nil), buf[:n]...)); resp != nil {
+				_, _ = udp.WriteTo(resp, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length uint16
+				if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+					return
+				}
+				query := make([]byte, length)
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				resp := handle(transportTCP, query)
+				_ = binary.Write(conn, binary.BigEndian, uint16(len(resp)))
+				_, _ = conn.Write(resp)
+			}()
+		}
+	}()
+	return udp.LocalAddr().String()
+}
+
+func TestRecursorAddr(t *testing.T) {
+	cases := map[string]struct {
+		in, want, wantErr string
+	}{
+		"ipv4":           {in: "10.0.0.1", want: "10.0.0.1:53"},
+		"ipv4 with port": {in: "10.0.0.1:5353", want: "10.0.0.1:5353"},
+		"ipv6":           {in: "fd00::1", want: "[fd00::1]:53"},
+		"ipv6 with port": {in: "[fd00::1]:5353", want: "[fd00::1]:5353"},
+		"host":           {in: "dns.example.com", want: "dns.example.com:53"},
+		"host with port": {in: "dns.example.com:5353", want: "dns.example.com:5353"},
+		"empty":          {in: "", wantErr: "empty dns recursor address"},
+		"missing port":   {in: "10.0.0.1:", wantErr: `invalid dns recursor address "10.0.0.1:"`},
+		"invalid":        {in: "a:b:c", wantErr: `invalid dns recursor address "a:b:c"`},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			addr, err := recursorAddr(c.in)
+			if c.wantErr != "" {
+				require.EqualError(t, err, c.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.want, addr)
+		})
+	}
+}
+
+func TestReadResolvConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(t, os.WriteFile(path, []byte(`# generated
+search default.svc.cluster.local svc.cluster.local
+nameserver 10.96.0.10
+nameserver fd00::10
+options ndots:5
+`), 0600))
+	nameservers, err := readResolvConf(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.96.0.10", "fd00::10"}, nameservers)
+
+	_, err = readResolvConf(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
+
+func TestInDomains(t *testing.T) {
+	domains := []string{normalizeDomain("consul"), normalizeDomain("Alt.Example.")}
+	require.True(t, inDomains("web.service.consul.", domains))
+	require.True(t, inDomains("consul.", domains))
+	require.True(t, inDomains("WEB.service.alt.example.", domains))
+	require.False(t, inDomains("example.com.", domains))
+	require.False(t, inDomains("notconsul.", domains))
+	require.False(t, inDomains("example.", domains))
+}
+
+func TestIsProxyAddr(t *testing.T) {
+	loopback := net.ParseIP("127.0.0.1")
+	require.True(t, isProxyAddr("127.0.0.1:53", loopback, 53))
+	require.False(t, isProxyAddr("127.0.0.1:5353", loopback, 53))
+	require.False(t, isProxyAddr("10.0.0.1:53", loopback, 53))
+	require.True(t, isProxyAddr("127.0.0.2:53", net.IPv4zero, 53))
+	require.False(t, isProxyAddr("10.0.0.1:53", net.IPv4zero, 53))
+	require.False(t, isProxyAddr("dns.example.com:53", loopback, 53))
+}
+
+func TestNewDNSServerRecursors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(t, os.WriteFile(path, []byte("nameserver 127.0.0.1\nnameserver 10.96.0.10\n"), 0600))
+
+	server, err := NewDNSServer(DNSServerParams{
+		BindAddr:   "127.0.0.1",
+		Port:       53,
+		Logger:     hclog.NewNullLogger(),
+		ResolvConf: path,
+	})
+	require.NoError(t, err)
+	s := server.(*DNSServer)
+	require.Len(t, s.recursors.recursors, 1, "the proxy itself is ignored")
+	require.Equal(t, "10.96.0.10:53", s.recursors.recursors[0].addr)
+	require.Equal(t, []string{"consul."}, s.domains)
+
+	// The recursors flag takes precedence over the resolv.conf file.
+	server, err = NewDNSServer(DNSServerParams{
+		BindAddr:   "127.0.0.1",
+		Port:       53,
+		Logger:     hclog.NewNullLogger(),
+		Domains:    []string{"consul", "alt.example"},
+		Recursors:  []string{"10.0.0.2"},
+		ResolvConf: path,
+	})
+	require.NoError(t, err)
+	s = server.(*DNSServer)
+	require.Len(t, s.recursors.recursors, 1)
+	require.Equal(t, "10.0.0.2:53", s.recursors.recursors[0].addr)
+	require.Equal(t, []string{"consul.", "alt.example."}, s.domains)
+
+	// Without recursors, every query is forwarded to Consul.
+	server, err = NewDNSServer(DNSServerParams{
+		BindAddr: "127.0.0.1",
+		Port:     53,
+		Logger:   hclog.NewNullLogger(),
+	})
+	require.NoError(t, err)
+	require.Nil(t, server.(*DNSServer).recursors)
+
+	_, err = NewDNSServer(DNSServerParams{
+		BindAddr:  "127.0.0.1",
+		Port:      53,
+		Logger:    hclog.NewNullLogger(),
+		Recursors: []string{"a:b:c"},
+	})
+	require.EqualError(t, err, `invalid dns recursor address "a:b:c"`)
+}
+
+func TestExchange(t *testing.T) {
+	query := buildQuery(t, 7, "example.com.")
+	addr := startNameserver(t, func(network string, q []byte) []byte {
+		return answer(t, q, network == transportUDP)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := exchange(ctx, transportUDP, addr, query)
+	require.NoError(t, err)
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(resp))
+	require.EqualValues(t, 7, msg.ID)
+	require.True(t, msg.Truncated)
+
+	resp, err = exchange(ctx, transportTCP, addr, query)
+	require.NoError(t, err)
+	require.NoError(t, msg.Unpack(resp))
+	require.False(t, msg.Truncated)
+	require.Len(t, msg.Answers, 1)
+
+	// The UDP fallback to TCP.
+	p := newRecursorPool([]string{addr}, time.Second, hclog.NewNullLogger())
+	resp, err = p.forward(ctx, transportUDP, query)
+	require.NoError(t, err)
+	require.NoError(t, msg.Unpack(resp))
+	require.False(t, msg.Truncated)
+	require.Len(t, msg.Answers, 1)
+}
+
+func TestExchangeIgnoresMismatchedResponses(t *testing.T) {
+	addr := startNameserver(t, func(network string, q []byte) []byte {
+		resp := answer(t, q, false)
+		resp[0]++ // a different ID
+		return resp
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := exchange(ctx, transportUDP, addr, buildQuery(t, 7, "example.com."))
+	require.Error(t, err)
+	var nerr net.Error
+	require.True(t, errors.As(err, &nerr) && nerr.Timeout())
+}
+
+func TestRecursorPoolFailover(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		tried []string
+		down  = map[string]bool{"a:53": true}
+	)
+	p := newRecursorPool([]string{"a:53", "b:53"}, time.Second, hclog.NewNullLogger())
+	p.exchangeFn = func(_ context.Context, network, addr string, msg []byte) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		tried = append(tried, addr)
+		if down[addr] {
+			return nil, errors.New("i/o timeout")
+		}
+		return answer(t, msg, false), nil
+	}
+	query := buildQuery(t, 1, "example.com.")
+
+	// The first recursor fails, so the second answers.
+	_, err := p.forward(context.Background(), transportUDP, query)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a:53", "b:53"}, tried)
+	require.False(t, p.recursors[0].healthy.Load())
+
+	// The unhealthy recursor is tried last.
+	tried = nil
+	_, err = p.forward(context.Background(), transportUDP, query)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b:53"}, tried)
+
+	// It's healthy again once a health check succeeds.
+	p.checkHealth(context.Background(), p.recursors[0])
+	require.False(t, p.recursors[0].healthy.Load())
+	down["a:53"] = false
+	p.checkHealth(context.Background(), p.recursors[0])
+	require.True(t, p.recursors[0].healthy.Load())
+	tried = nil
+	_, err = p.forward(context.Background(), transportUDP, query)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a:53"}, tried)
+
+	// If every recursor fails, the last error is returned.
+	down["a:53"], down["b:53"] = true, true
+	_, err = p.forward(context.Background(), transportUDP, query)
+	require.EqualError(t, err, "no dns recursor answered: i/o timeout")
+}
+
+func TestResolveRecursors(t *testing.T) {
+	consulResp := buildResponse(t, dnsmessage.Header{ID: 1}, "web.service.consul.", []dnsmessage.Resource{aRecord("web.service.consul.", 30)}, nil)
+	client := mocks.NewDNSServiceClient(t)
+	client.On("Query", mock.Anything, mock.Anything).Return(&pbdns.QueryResponse{Msg: consulResp}, nil).Once()
+
+	recursorUp := true
+	p := newRecursorPool([]string{"10.0.0.2:53"}, time.Second, hclog.NewNullLogger())
+	p.exchangeFn = func(_ context.Context, network, addr string, msg []byte) ([]byte, error) {
+		if !recursorUp {
+			return nil, errors.New("connection refused")
+		}
+		return answer(t, msg, false), nil
+	}
+	server := &DNSServer{
+		client:    client,
+		logger:    hclog.NewNullLogger(),
+		domains:   []string{"consul."},
+		recursors: p,
+	}
+
+	// Names under the Consul domains are resolved by Consul.
+	resp, _, err := server.resolve(context.Background(), transportUDP, buildQuery(t, 1, "web.service.consul."))
+	require.NoError(t, err)
+	require.Equal(t, consulResp, resp)
+
+	// Other names are resolved by the recursors.
+	query := buildQuery(t, 2, "example.com.")
+	resp, _, err = server.resolve(context.Background(), transportUDP, query)
+	require.NoError(t, err)
+	require.Equal(t, answer(t, query, false), resp)
+
+	recursorUp = false
+	resp, _, err = server.resolve(context.Background(), transportUDP, query)
+	require.EqualError(t, err, "no dns recursor answered: connection refused")
+	require.Equal(t, errorResponse(query, dnsmessage.RCodeServerFailure), resp)
+}
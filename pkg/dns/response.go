@@ -0,0 +1,63 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// checkQuery returns the first question of a DNS query, or an error if the
+// query is malformed: if its header or questions can't be parsed, it doesn't
+// have a question, or it's a response, which mustn't be forwarded.
+func checkQuery(msg []byte) (dnsmessage.Question, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return dnsmessage.Question{}, fmt.Errorf("malformed query: %w", err)
+	}
+	if h.Response {
+		return dnsmessage.Question{}, errors.New("malformed query: message is a response")
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return dnsmessage.Question{}, fmt.Errorf("malformed query: %w", err)
+	}
+	if len(questions) == 0 {
+		return dnsmessage.Question{}, errors.New("malformed query: no question")
+	}
+	return questions[0], nil
+}
+
+// errorResponse builds a response to a query with the given rcode and no
+// records, echoing the ID, opcode, RD bit and question of the query. It
+// returns nil if the query has no valid header or is itself a response,
+// which must not be answered.
+func errorResponse(query []byte, rcode dnsmessage.RCode) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil || h.Response {
+		return nil
+	}
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               h.ID,
+			Response:         true,
+			OpCode:           h.OpCode,
+			RecursionDesired: h.RecursionDesired,
+			RCode:            rcode,
+		},
+	}
+	// The question is only echoed if it can be parsed.
+	if q, err := p.Question(); err == nil {
+		msg.Questions = []dnsmessage.Question{q}
+	}
+	resp, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	return resp
+}
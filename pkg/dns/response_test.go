@@ -0,0 +1,48 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestErrorResponse(t *testing.T) {
+	resp := errorResponse(buildQuery(t, 42, "web.service.consul."), dnsmessage.RCodeServerFailure)
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(resp))
+	require.EqualValues(t, 42, msg.ID)
+	require.True(t, msg.Response)
+	require.True(t, msg.RecursionDesired)
+	require.Equal(t, dnsmessage.RCodeServerFailure, msg.RCode)
+	require.Len(t, msg.Questions, 1)
+	require.Equal(t, "web.service.consul.", msg.Questions[0].Name.String())
+
+	// Responses and messages without a header aren't answered.
+	require.Nil(t, errorResponse(buildResponse(t, dnsmessage.Header{}, "web.service.consul.", nil, nil), dnsmessage.RCodeServerFailure))
+	require.Nil(t, errorResponse([]byte{0x01}, dnsmessage.RCodeServerFailure))
+
+	// The question is omitted if it can't be parsed.
+	resp = errorResponse([]byte{0, 9, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0xff}, dnsmessage.RCodeServerFailure)
+	require.NoError(t, msg.Unpack(resp))
+	require.EqualValues(t, 9, msg.ID)
+	require.Empty(t, msg.Questions)
+}
+
+func TestCheckQuery(t *testing.T) {
+	q, err := checkQuery(buildQuery(t, 1, "web.service.consul."))
+	require.NoError(t, err)
+	require.Equal(t, "web.service.consul.", q.Name.String())
+
+	_, err = checkQuery([]byte{0x01})
+	require.ErrorContains(t, err, "malformed query")
+	_, err = checkQuery([]byte{0, 9, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0xff})
+	require.ErrorContains(t, err, "malformed query")
+	_, err = checkQuery([]byte{0, 9, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	require.EqualError(t, err, "malformed query: no question")
+	_, err = checkQuery(buildResponse(t, dnsmessage.Header{}, "web.service.consul.", nil, nil))
+	require.EqualError(t, err, "malformed query: message is a response")
+}
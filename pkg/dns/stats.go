@@ -0,0 +1,87 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import "github.com/hashicorp/go-metrics/prometheus"
+
+var Counters = []prometheus.CounterDefinition{
+	{
+		Name: []string{"dns_queries"},
+		Help: "This will count the DNS queries proxied to Consul, labeled by transport (udp, tcp, dot or doh), query type and the rcode of Consul's response (none if Consul didn't respond).",
+	},
+	{
+		Name: []string{"dns_errors"},
+		Help: "This will count the errors encountered while proxying DNS queries, labeled by transport and class: timeout, grpc_<code>, oversize_response, truncated_read, write, malformed_query or recursor.",
+	},
+	{
+		Name: []string{"dns_cache_hits"},
+		Help: "This will count the DNS queries answered from the response cache, labeled by transport.",
+	},
+	{
+		Name: []string{"dns_cache_misses"},
+		Help: "This will count the cacheable DNS queries that weren't in the response cache, labeled by transport.",
+	},
+	{
+		Name: []string{"dns_cache_evictions"},
+		Help: "This will count the responses evicted from the full response cache.",
+	},
+	{
+		Name: []string{"dns_stale_answers"},
+		Help: "This will count the expired responses served from the response cache because Consul couldn't answer, labeled by transport.",
+	},
+	{
+		Name: []string{"dns_recursor_queries"},
+		Help: "This will count the DNS queries outside of the Consul domains forwarded to the recursors, labeled by transport and the rcode of the response (none if no recursor responded).",
+	},
+	{
+		Name: []string{"dns_dropped_queries"},
+		Help: "This will count the UDP queries dropped because the queue of queries waiting for a worker was full, labeled by the drop policy: drop-newest, drop-oldest or servfail.",
+	},
+	{
+		Name: []string{"dns_rejected_queries"},
+		Help: "This will count the DNS queries rejected by the client ACL or the rate limits, labeled by transport and reason: acl, rate_limit, rrl_drop or rrl_slip.",
+	},
+	{
+		Name: []string{"dns_rejected_connections"},
+		Help: "This will count the TCP and DoT connections closed because the maximum number of open connections was reached, labeled by transport.",
+	},
+	{
+		Name: []string{"dns_coalesced_queries"},
+		Help: "This will count the DNS queries answered with the response to an identical query in flight instead of being forwarded, labeled by transport.",
+	},
+	{
+		Name: []string{"dns_truncated_responses"},
+		Help: "This will count the UDP responses truncated to fit the payload size advertised by the client.",
+	},
+}
+
+var Summaries = []prometheus.SummaryDefinition{
+	{
+		Name: []string{"dns_query_duration"},
+		Help: "This will be a sample of the time in milliseconds it takes Consul to respond to a DNS query, labeled by transport.",
+	},
+}
+
+var Gauges = []prometheus.GaugeDefinition{
+	{
+		Name: []string{"dns_inflight_queries"},
+		Help: "This will track the number of DNS queries currently being resolved by Consul.",
+	},
+	{
+		Name: []string{"dns_tcp_connections"},
+		Help: "This will track the number of open TCP connections to the DNS proxy.",
+	},
+	{
+		Name: []string{"dns_cache_entries"},
+		Help: "This will track the number of responses in the response cache.",
+	},
+	{
+		Name: []string{"dns_udp_queue_depth"},
+		Help: "This will track the number of UDP queries waiting for a worker.",
+	},
+	{
+		Name: []string{"dns_recursor_healthy"},
+		Help: "This will track whether each DNS recursor, by its address, answers queries (1) or not (0).",
+	},
+}
@@ -0,0 +1,78 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-metrics"
+)
+
+const (
+	// DefaultTCPIdleTimeout is the default time a TCP or DoT connection is
+	// kept open while the client sends no queries.
+	DefaultTCPIdleTimeout = 5 * time.Second
+
+	// DefaultTCPMaxConns is the default number of open TCP and DoT
+	// connections, above which new connections are closed.
+	DefaultTCPMaxConns = 1000
+
+	// maxPipelinedQueries is the number of queries of a connection resolved
+	// concurrently, above which the next queries aren't read until a
+	// response is sent.
+	maxPipelinedQueries = 100
+
+	// tcpWriteTimeout bounds how long writing a response can take, so that a
+	// client that doesn't read its responses doesn't hold the connection.
+	tcpWriteTimeout = 10 * time.Second
+)
+
+// acquireTCPConn counts a new TCP or DoT connection, returning false if
+// there are too many open connections already.
+func (d *DNSServer) acquireTCPConn(transport string) bool {
+	maxConns := int64(d.tcpMaxConns)
+	if maxConns <= 0 {
+		maxConns = DefaultTCPMaxConns
+	}
+	for {
+		n := d.tcpConns.Load()
+		if n >= maxConns {
+			recordRejectedConn(transport)
+			return false
+		}
+		if d.tcpConns.CompareAndSwap(n, n+1) {
+			metrics.SetGauge(tcpConnsKey, float32(n+1))
+			return true
+		}
+	}
+}
+
+// tcpIdleTimeout returns the time a connection is kept open while the client
+// sends no queries.
+func (d *DNSServer) tcpIdleTimeout() time.Duration {
+	if d.tcpIdle <= 0 {
+		return DefaultTCPIdleTimeout
+	}
+	return d.tcpIdle
+}
+
+// tcpWriter serializes the responses to the queries of a connection, which
+// are resolved concurrently and answered in the order they're resolved, as
+// RFC 7766 allows.
+type tcpWriter struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// write writes a DNS message to the connection.
+func (w *tcpWriter) write(msg []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout)); err != nil {
+		return err
+	}
+	return writeTCPMessage(w.conn, msg)
+}
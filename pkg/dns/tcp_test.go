@@ -0,0 +1,133 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/proto-public/pbdns"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+	"google.golang.org/grpc"
+
+	"github.com/hashicorp/consul-dataplane/pkg/dns/mocks"
+)
+
+// startTCPServer starts proxying the TCP connections of a DNS server.
+func startTCPServer(t *testing.T, server *DNSServer) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server.listenerTCP = listener
+	server.logger = hclog.NewNullLogger()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		listener.Close()
+	})
+	go server.proxyTCP(ctx)
+	return listener.Addr().String()
+}
+
+// readTCPMessage reads a DNS message from a TCP connection.
+func readTCPMessage(t *testing.T, conn net.Conn) []byte {
+	t.Helper()
+	var length uint16
+	require.NoError(t, binary.Read(conn, binary.BigEndian, &length))
+	msg := make([]byte, length)
+	_, err := io.ReadFull(conn, msg)
+	require.NoError(t, err)
+	return msg
+}
+
+func TestTCPPipelining(t *testing.T) {
+	const slowName, fastName, failName = "slow.service.consul.", "fast.service.consul.", "fail.service.consul."
+	release := make(chan struct{})
+
+	client := mocks.NewDNSServiceClient(t)
+	client.On("Query", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			req := args.Get(1).(*pbdns.QueryRequest)
+			var p dnsmessage.Parser
+			_, err := p.Start(req.Msg)
+			require.NoError(t, err)
+			q, err := p.Question()
+			require.NoError(t, err)
+			if q.Name.String() == slowName {
+				<-release
+			}
+		}).
+		Return(func(_ context.Context, req *pbdns.QueryRequest, _ ...grpc.CallOption) *pbdns.QueryResponse {
+			return &pbdns.QueryResponse{Msg: answer(t, req.Msg, false)}
+		}, func(_ context.Context, req *pbdns.QueryRequest, _ ...grpc.CallOption) error {
+			if binary.BigEndian.Uint16(req.Msg) == 3 {
+				return errors.New("no servers")
+			}
+			return nil
+		})
+
+	addr := startTCPServer(t, &DNSServer{client: client})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	slow := buildQuery(t, 1, slowName)
+	fast := buildQuery(t, 2, fastName)
+	fail := buildQuery(t, 3, failName)
+	for _, q := range [][]byte{slow, fast} {
+		require.NoError(t, writeTCPMessage(conn, q))
+	}
+
+	// The second query is answered while the first is still being resolved.
+	require.Equal(t, answer(t, fast, false), readTCPMessage(t, conn))
+	close(release)
+	require.Equal(t, answer(t, slow, false), readTCPMessage(t, conn))
+
+	// A query that fails is answered, and the connection stays open.
+	require.NoError(t, writeTCPMessage(conn, fail))
+	require.Equal(t, errorResponse(fail, dnsmessage.RCodeServerFailure), readTCPMessage(t, conn))
+	require.NoError(t, writeTCPMessage(conn, fast))
+	require.Equal(t, answer(t, fast, false), readTCPMessage(t, conn))
+}
+
+func TestTCPConnLimits(t *testing.T) {
+	sink := testMetrics(t)
+
+	client := mocks.NewDNSServiceClient(t)
+	addr := startTCPServer(t, &DNSServer{
+		client:      client,
+		tcpMaxConns: 1,
+		tcpIdle:     200 * time.Millisecond,
+	})
+
+	first, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer first.Close()
+	require.NoError(t, first.SetDeadline(time.Now().Add(5*time.Second)))
+
+	// The connection over the limit is closed.
+	require.Eventually(t, func() bool {
+		second, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer second.Close()
+		require.NoError(t, second.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		_, err = second.Read(make([]byte, 1))
+		return errors.Is(err, io.EOF)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The idle connection is closed.
+	_, err = first.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+
+	require.GreaterOrEqual(t, sink.Data()[0].Counters["dns_rejected_connections;transport=tcp"].Count, 1)
+}
@@ -0,0 +1,20 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"crypto/tls"
+
+	"github.com/hashicorp/consul-dataplane/internal/certreload"
+)
+
+// tlsConfig returns the TLS config of a DoT or DoH listener, which serves
+// the reloaded certificate and negotiates the given application protocols.
+func tlsConfig(certs *certreload.Reloader, nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     nextProtos,
+	}
+}
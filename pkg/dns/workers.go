@@ -0,0 +1,103 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"context"
+	"net"
+
+	"github.com/hashicorp/go-metrics"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// DefaultUDPWorkers is the default number of UDP queries resolved
+	// concurrently.
+	DefaultUDPWorkers = 100
+
+	// DefaultUDPQueueSize is the default number of UDP queries waiting for a
+	// worker.
+	DefaultUDPQueueSize = 1000
+)
+
+// Drop policies, which decide what happens to UDP queries when the queue is
+// full.
+const (
+	// DropPolicyNewest drops the query that doesn't fit in the queue.
+	DropPolicyNewest = "drop-newest"
+	// DropPolicyOldest drops the query that has been waiting the longest, to
+	// make room for the new one.
+	DropPolicyOldest = "drop-oldest"
+	// DropPolicyServfail answers the query that doesn't fit in the queue with
+	// SERVFAIL.
+	DropPolicyServfail = "servfail"
+)
+
+// udpQuery is a UDP query waiting for a worker.
+type udpQuery struct {
+	msg  []byte
+	addr net.Addr
+}
+
+// startUDPWorkers starts the workers that resolve the UDP queries of the
+// returned queue, until the context is canceled.
+func (d *DNSServer) startUDPWorkers(ctx context.Context) chan udpQuery {
+	workers := d.udpWorkers
+	if workers <= 0 {
+		workers = DefaultUDPWorkers
+	}
+	queueSize := d.udpQueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultUDPQueueSize
+	}
+	queue := make(chan udpQuery, queueSize)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case q := <-queue:
+					metrics.SetGauge(udpQueueDepthKey, float32(len(queue)))
+					d.queryConsulAndRespondUDP(q.msg, q.addr)
+				}
+			}
+		}()
+	}
+	return queue
+}
+
+// enqueueUDP queues a UDP query for a worker, applying the drop policy if
+// the queue is full.
+func (d *DNSServer) enqueueUDP(queue chan udpQuery, q udpQuery) {
+	for {
+		select {
+		case queue <- q:
+			metrics.SetGauge(udpQueueDepthKey, float32(len(queue)))
+			return
+		default:
+		}
+
+		switch d.udpDropPolicy {
+		case DropPolicyOldest:
+			select {
+			case <-queue:
+				recordDroppedQuery(DropPolicyOldest)
+			default:
+			}
+			// Retry now that there's room, unless a worker made room first.
+			continue
+		case DropPolicyServfail:
+			recordDroppedQuery(DropPolicyServfail)
+			if resp := errorResponse(q.msg, dnsmessage.RCodeServerFailure); resp != nil {
+				if _, err := d.connUDP.WriteTo(resp, q.addr); err != nil {
+					recordError(transportUDP, errClassWrite)
+				}
+			}
+		default:
+			recordDroppedQuery(DropPolicyNewest)
+		}
+		return
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/proto-public/pbdns"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-metrics"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+	"google.golang.org/grpc"
+
+	"github.com/hashicorp/consul-dataplane/pkg/dns/mocks"
+)
+
+// testMetrics sets up an in-memory metrics sink for a test.
+func testMetrics(t *testing.T) *metrics.InmemSink {
+	t.Helper()
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	cfg := metrics.DefaultConfig("")
+	cfg.EnableHostname = false
+	cfg.EnableRuntimeMetrics = false
+	_, err := metrics.NewGlobal(cfg, sink)
+	require.NoError(t, err)
+	t.Cleanup(func() { metrics.Shutdown() })
+	return sink
+}
+
+func TestEnqueueUDP(t *testing.T) {
+	sink := testMetrics(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	first := udpQuery{msg: buildQuery(t, 1, "web.service.consul."), addr: client.LocalAddr()}
+	second := udpQuery{msg: buildQuery(t, 2, "web.service.consul."), addr: client.LocalAddr()}
+
+	cases := map[string]struct {
+		policy    string
+		wantQueue uint16 // the ID of the query left in the queue
+	}{
+		"drop newest by default": {policy: "", wantQueue: 1},
+		"drop newest":            {policy: DropPolicyNewest, wantQueue: 1},
+		"drop oldest":            {policy: DropPolicyOldest, wantQueue: 2},
+		"servfail":               {policy: DropPolicyServfail, wantQueue: 1},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			server := &DNSServer{connUDP: conn, logger: hclog.NewNullLogger(), udpDropPolicy: c.policy}
+			queue := make(chan udpQuery, 1)
+			server.enqueueUDP(queue, first)
+			server.enqueueUDP(queue, second)
+			require.Len(t, queue, 1)
+			q := <-queue
+			require.Equal(t, c.wantQueue, binary.BigEndian.Uint16(q.msg))
+
+			if c.policy == DropPolicyServfail {
+				require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+				buf := make([]byte, 512)
+				n, _, err := client.ReadFrom(buf)
+				require.NoError(t, err)
+				require.Equal(t, errorResponse(second.msg, dnsmessage.RCodeServerFailure), buf[:n])
+			}
+		})
+	}
+
+	data := sink.Data()
+	require.EqualValues(t, 2, data[0].Counters["dns_dropped_queries;policy=drop-newest"].Count)
+	require.EqualValues(t, 1, data[0].Counters["dns_dropped_queries;policy=drop-oldest"].Count)
+	require.EqualValues(t, 1, data[0].Counters["dns_dropped_queries;policy=servfail"].Count)
+}
+
+func TestUDPWorkers(t *testing.T) {
+	const queries = 6
+	var inflight, maxInflight atomic.Int32
+	release := make(chan struct{})
+
+	client := mocks.NewDNSServiceClient(t)
+	client.On("Query", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			n := inflight.Add(1)
+			for {
+				m := maxInflight.Load()
+				if n <= m || maxInflight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			<-release
+			inflight.Add(-1)
+		}).
+		Return(func(_ context.Context, req *pbdns.QueryRequest, _ ...grpc.CallOption) *pbdns.QueryResponse {
+			return &pbdns.QueryResponse{Msg: answer(t, req.Msg, false)}
+		}, nil)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &DNSServer{
+		client:     client,
+		connUDP:    conn,
+		logger:     hclog.NewNullLogger(),
+		udpWorkers: 2,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go server.proxyUDP(ctx)
+
+	c, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	for id := uint16(1); id <= queries; id++ {
+		// Distinct names, so that the queries aren't coalesced.
+		_, err := c.Write(buildQuery(t, id, fmt.Sprintf("web-%d.service.consul.", id)))
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool { return inflight.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+	close(release)
+
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 512)
+	for i := 0; i < queries; i++ {
+		_, err := c.Read(buf)
+		require.NoError(t, err)
+	}
+	require.EqualValues(t, 2, maxInflight.Load(), "queries are resolved by at most 2 workers")
+}
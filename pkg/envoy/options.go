@@ -0,0 +1,284 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package envoy
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	flagConcurrency       = "--concurrency"
+	flagDrainTime         = "--drain-time-s"
+	flagDrainStrategy     = "--drain-strategy"
+	flagLogLevel          = "--log-level"
+	flagComponentLogLevel = "--component-log-level"
+	flagBaseID            = "--base-id"
+	flagServiceCluster    = "--service-cluster"
+	flagServiceNode       = "--service-node"
+	flagFileFlushInterval = "--file-flush-interval-msec"
+)
+
+// shortFlags maps the short aliases of the managed options to their long
+// names. Of the managed options, only --log-level has one.
+var shortFlags = map[string]string{
+	"-l": flagLogLevel,
+}
+
+// switchFlags are the Envoy flags that take no value, so that the argument
+// following any other unmanaged flag is known to be its value.
+var switchFlags = map[string]bool{
+	"--allow-unknown-static-fields":   true,
+	"--reject-unknown-dynamic-fields": true,
+	"--ignore-unknown-dynamic-fields": true,
+	"--skip-deprecated-logs":          true,
+	"--disable-hot-restart":           true,
+	"--enable-mutex-tracing":          true,
+	"--cpuset-threads":                true,
+	"--use-dynamic-base-id":           true,
+	"--enable-fine-grain-logging":     true,
+	"--log-format-escaped":            true,
+	"--enable-core-dump":              true,
+	"--skip-hot-restart-on-no-parent": true,
+	"--skip-hot-restart-parent-stats": true,
+	"--version":                       true,
+	"--help":                          true,
+}
+
+// Options are the Envoy command line options managed by consul-dataplane. A
+// nil or empty field is unset and will not be passed to Envoy.
+//
+// See https://www.envoyproxy.io/docs/envoy/latest/operations/cli.
+type Options struct {
+	// Concurrency is the number of worker threads to run.
+	Concurrency *int
+
+	// DrainTimeSeconds is the time in seconds that Envoy will drain connections
+	// during a hot restart or when listeners are modified or removed.
+	DrainTimeSeconds *int
+
+	// DrainStrategy is the behaviour of Envoy during the drain sequence, either
+	// "gradual" or "immediate".
+	DrainStrategy string
+
+	// LogLevel is the default logging level.
+	LogLevel string
+
+	// ComponentLogLevels are the logging levels of individual components,
+	// keyed by component name.
+	ComponentLogLevels map[string]string
+
+	// BaseID is the base ID used when allocating shared memory regions.
+	BaseID *int
+
+	// ServiceCluster overrides the local service cluster name.
+	ServiceCluster string
+
+	// ServiceNode overrides the local service node name.
+	ServiceNode string
+
+	// FileFlushInterval is the interval at which access logs are flushed. It is
+	// passed to Envoy with millisecond precision.
+	FileFlushInterval *time.Duration
+}
+
+// ParseArgs extracts the options managed by consul-dataplane from args, in
+// either the "--flag value" or "--flag=value" form, or in the short form of
+// the flag if Envoy has one (e.g. "-l debug"). All other arguments are
+// returned unmodified and in order. If an option is repeated, the last
+// occurrence wins, except for component log levels which are merged per
+// component.
+func ParseArgs(args []string) (Options, []string, error) {
+	var (
+		opts Options
+		rest []string
+	)
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if long, ok := shortFlags[name]; ok {
+			name = long
+		}
+		set, ok := optionSetters[name]
+		if !ok {
+			rest = append(rest, args[i])
+			// Pass the value of an unmanaged flag through with it, even if
+			// it looks like a managed option.
+			if strings.HasPrefix(name, "-") && !hasValue && !switchFlags[name] && i+1 < len(args) {
+				i++
+				rest = append(rest, args[i])
+			}
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return Options{}, nil, fmt.Errorf("missing value for envoy option %s", name)
+			}
+			i++
+			value = args[i]
+		}
+		if err := set(&opts, value); err != nil {
+			return Options{}, nil, fmt.Errorf("invalid value %q for envoy option %s: %w", value, name, err)
+		}
+	}
+	return opts, rest, nil
+}
+
+var optionSetters = map[string]func(o *Options, value string) error{
+	flagConcurrency: func(o *Options, value string) error {
+		return setInt(&o.Concurrency, value)
+	},
+	flagDrainTime: func(o *Options, value string) error {
+		return setInt(&o.DrainTimeSeconds, value)
+	},
+	flagDrainStrategy: func(o *Options, value string) error {
+		o.DrainStrategy = value
+		return nil
+	},
+	flagLogLevel: func(o *Options, value string) error {
+		o.LogLevel = value
+		return nil
+	},
+	flagComponentLogLevel: func(o *Options, value string) error {
+		levels, err := parseComponentLogLevels(value)
+		if err != nil {
+			return err
+		}
+		o.ComponentLogLevels = mergeComponentLogLevels(o.ComponentLogLevels, levels)
+		return nil
+	},
+	flagBaseID: func(o *Options, value string) error {
+		return setInt(&o.BaseID, value)
+	},
+	flagServiceCluster: func(o *Options, value string) error {
+		o.ServiceCluster = value
+		return nil
+	},
+	flagServiceNode: func(o *Options, value string) error {
+		o.ServiceNode = value
+		return nil
+	},
+	flagFileFlushInterval: func(o *Options, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		d := time.Duration(n) * time.Millisecond
+		o.FileFlushInterval = &d
+		return nil
+	},
+}
+
+func setInt(p **int, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*p = &n
+	return nil
+}
+
+// parseComponentLogLevels parses a list of the form
+// "upstream:debug,connection:trace".
+func parseComponentLogLevels(value string) (map[string]string, error) {
+	levels := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		component, level, ok := strings.Cut(pair, ":")
+		if !ok || component == "" || level == "" {
+			return nil, fmt.Errorf("expected <component>:<level>, got %q", pair)
+		}
+		levels[component] = level
+	}
+	return levels, nil
+}
+
+func mergeComponentLogLevels(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Merge returns a copy of o with every option that is set in override
+// replacing the value in o.
+func (o Options) Merge(override Options) Options {
+	if override.Concurrency != nil {
+		o.Concurrency = override.Concurrency
+	}
+	if override.DrainTimeSeconds != nil {
+		o.DrainTimeSeconds = override.DrainTimeSeconds
+	}
+	if override.DrainStrategy != "" {
+		o.DrainStrategy = override.DrainStrategy
+	}
+	if override.LogLevel != "" {
+		o.LogLevel = override.LogLevel
+	}
+	o.ComponentLogLevels = mergeComponentLogLevels(o.ComponentLogLevels, override.ComponentLogLevels)
+	if override.BaseID != nil {
+		o.BaseID = override.BaseID
+	}
+	if override.ServiceCluster != "" {
+		o.ServiceCluster = override.ServiceCluster
+	}
+	if override.ServiceNode != "" {
+		o.ServiceNode = override.ServiceNode
+	}
+	if override.FileFlushInterval != nil {
+		o.FileFlushInterval = override.FileFlushInterval
+	}
+	return o
+}
+
+// Args returns the options as Envoy command line arguments, with each flag
+// and its value as separate elements.
+func (o Options) Args() []string {
+	var args []string
+	if o.Concurrency != nil {
+		args = append(args, flagConcurrency, strconv.Itoa(*o.Concurrency))
+	}
+	if o.DrainTimeSeconds != nil {
+		args = append(args, flagDrainTime, strconv.Itoa(*o.DrainTimeSeconds))
+	}
+	if o.DrainStrategy != "" {
+		args = append(args, flagDrainStrategy, o.DrainStrategy)
+	}
+	if o.LogLevel != "" {
+		args = append(args, flagLogLevel, o.LogLevel)
+	}
+	if len(o.ComponentLogLevels) > 0 {
+		components := make([]string, 0, len(o.ComponentLogLevels))
+		for c := range o.ComponentLogLevels {
+			components = append(components, c)
+		}
+		sort.Strings(components)
+		pairs := make([]string, len(components))
+		for i, c := range components {
+			pairs[i] = c + ":" + o.ComponentLogLevels[c]
+		}
+		args = append(args, flagComponentLogLevel, strings.Join(pairs, ","))
+	}
+	if o.BaseID != nil {
+		args = append(args, flagBaseID, strconv.Itoa(*o.BaseID))
+	}
+	if o.ServiceCluster != "" {
+		args = append(args, flagServiceCluster, o.ServiceCluster)
+	}
+	if o.ServiceNode != "" {
+		args = append(args, flagServiceNode, o.ServiceNode)
+	}
+	if o.FileFlushInterval != nil {
+		args = append(args, flagFileFlushInterval, strconv.FormatInt(o.FileFlushInterval.Milliseconds(), 10))
+	}
+	return args
+}
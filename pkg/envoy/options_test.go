@@ -0,0 +1,220 @@
+// Copyright IBM Corp. 2022, 2026
+// SPDX-License-Identifier: MPL-2.0
+
+package envoy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(n int) *int { return &n }
+
+func durationPtr(d time.Duration) *time.Duration { return &d }
+
+func TestParseArgs(t *testing.T) {
+	cases := map[string]struct {
+		args   []string
+		opts   Options
+		rest   []string
+		expErr string
+	}{
+		"no args": {
+			args: nil,
+		},
+		"unmanaged args are passed through in order": {
+			args: []string{"--test-output", "/tmp/out", "--disable-extensions", "foo"},
+			rest: []string{"--test-output", "/tmp/out", "--disable-extensions", "foo"},
+		},
+		"separate values": {
+			args: []string{
+				"--concurrency", "4",
+				"--drain-time-s", "10",
+				"--drain-strategy", "gradual",
+				"--log-level", "debug",
+				"--component-log-level", "upstream:debug,connection:trace",
+				"--base-id", "7",
+				"--service-cluster", "web",
+				"--service-node", "web-1",
+				"--file-flush-interval-msec", "1500",
+			},
+			opts: Options{
+				Concurrency:        intPtr(4),
+				DrainTimeSeconds:   intPtr(10),
+				DrainStrategy:      "gradual",
+				LogLevel:           "debug",
+				ComponentLogLevels: map[string]string{"upstream": "debug", "connection": "trace"},
+				BaseID:             intPtr(7),
+				ServiceCluster:     "web",
+				ServiceNode:        "web-1",
+				FileFlushInterval:  durationPtr(1500 * time.Millisecond),
+			},
+		},
+		"inline values": {
+			args: []string{
+				"--concurrency=4",
+				"--drain-time-s=10",
+				"--drain-strategy=gradual",
+				"--log-level=debug",
+				"--component-log-level=upstream:debug",
+				"--base-id=7",
+				"--service-cluster=web",
+				"--service-node=web-1",
+				"--file-flush-interval-msec=1500",
+			},
+			opts: Options{
+				Concurrency:        intPtr(4),
+				DrainTimeSeconds:   intPtr(10),
+				DrainStrategy:      "gradual",
+				LogLevel:           "debug",
+				ComponentLogLevels: map[string]string{"upstream": "debug"},
+				BaseID:             intPtr(7),
+				ServiceCluster:     "web",
+				ServiceNode:        "web-1",
+				FileFlushInterval:  durationPtr(1500 * time.Millisecond),
+			},
+		},
+		"managed and unmanaged args mixed": {
+			args: []string{"--test-output", "/tmp/out", "--concurrency", "1", "--disable-extensions", "foo"},
+			opts: Options{Concurrency: intPtr(1)},
+			rest: []string{"--test-output", "/tmp/out", "--disable-extensions", "foo"},
+		},
+		"short flags": {
+			args: []string{"-l", "debug", "-c", "/etc/envoy.yaml"},
+			opts: Options{LogLevel: "debug"},
+			rest: []string{"-c", "/etc/envoy.yaml"},
+		},
+		"values that look like short flags": {
+			args: []string{"--admin-address-path", "-l", "--service-node", "-l", "--disable-hot-restart", "-l", "info"},
+			opts: Options{ServiceNode: "-l", LogLevel: "info"},
+			rest: []string{"--admin-address-path", "-l", "--disable-hot-restart"},
+		},
+		"short and long flags are merged": {
+			args: []string{"--log-level", "info", "-l=trace"},
+			opts: Options{LogLevel: "trace"},
+		},
+		"repeated option last wins": {
+			args: []string{"--log-level", "debug", "--log-level=trace"},
+			opts: Options{LogLevel: "trace"},
+		},
+		"repeated component log levels are merged": {
+			args: []string{"--component-log-level", "upstream:debug,http:info", "--component-log-level", "http:trace"},
+			opts: Options{ComponentLogLevels: map[string]string{"upstream": "debug", "http": "trace"}},
+		},
+		"missing value": {
+			args:   []string{"--test-output", "/tmp/out", "--concurrency"},
+			expErr: "missing value for envoy option --concurrency",
+		},
+		"invalid int": {
+			args:   []string{"--base-id", "one"},
+			expErr: `invalid value "one" for envoy option --base-id`,
+		},
+		"invalid file flush interval": {
+			args:   []string{"--file-flush-interval-msec=1s"},
+			expErr: `invalid value "1s" for envoy option --file-flush-interval-msec`,
+		},
+		"invalid component log level": {
+			args:   []string{"--component-log-level", "upstream"},
+			expErr: `invalid value "upstream" for envoy option --component-log-level`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			opts, rest, err := ParseArgs(tc.args)
+			if tc.expErr != "" {
+				require.ErrorContains(t, err, tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.opts, opts)
+			require.Equal(t, tc.rest, rest)
+		})
+	}
+}
+
+func TestOptionsMerge(t *testing.T) {
+	base := Options{
+		Concurrency:        intPtr(2),
+		DrainTimeSeconds:   intPtr(30),
+		DrainStrategy:      "immediate",
+		LogLevel:           "info",
+		ComponentLogLevels: map[string]string{"upstream": "info", "http": "info"},
+		BaseID:             intPtr(1),
+		ServiceCluster:     "web",
+		ServiceNode:        "web-1",
+		FileFlushInterval:  durationPtr(time.Second),
+	}
+
+	t.Run("empty override", func(t *testing.T) {
+		require.Equal(t, base, base.Merge(Options{}))
+	})
+
+	t.Run("empty base", func(t *testing.T) {
+		require.Equal(t, base, Options{}.Merge(base))
+	})
+
+	t.Run("override every option", func(t *testing.T) {
+		override := Options{
+			Concurrency:        intPtr(8),
+			DrainTimeSeconds:   intPtr(0),
+			DrainStrategy:      "gradual",
+			LogLevel:           "trace",
+			ComponentLogLevels: map[string]string{"http": "debug", "router": "trace"},
+			BaseID:             intPtr(0),
+			ServiceCluster:     "api",
+			ServiceNode:        "api-1",
+			FileFlushInterval:  durationPtr(0),
+		}
+		require.Equal(t, Options{
+			Concurrency:        intPtr(8),
+			DrainTimeSeconds:   intPtr(0),
+			DrainStrategy:      "gradual",
+			LogLevel:           "trace",
+			ComponentLogLevels: map[string]string{"upstream": "info", "http": "debug", "router": "trace"},
+			BaseID:             intPtr(0),
+			ServiceCluster:     "api",
+			ServiceNode:        "api-1",
+			FileFlushInterval:  durationPtr(0),
+		}, base.Merge(override))
+
+		// The base options must not be modified.
+		require.Equal(t, map[string]string{"upstream": "info", "http": "info"}, base.ComponentLogLevels)
+	})
+}
+
+func TestOptionsArgs(t *testing.T) {
+	require.Empty(t, Options{}.Args())
+
+	opts := Options{
+		Concurrency:        intPtr(0),
+		DrainTimeSeconds:   intPtr(30),
+		DrainStrategy:      "immediate",
+		LogLevel:           "info",
+		ComponentLogLevels: map[string]string{"upstream": "debug", "connection": "trace"},
+		BaseID:             intPtr(3),
+		ServiceCluster:     "web",
+		ServiceNode:        "web-1",
+		FileFlushInterval:  durationPtr(2500 * time.Millisecond),
+	}
+	args := opts.Args()
+	require.Equal(t, []string{
+		"--concurrency", "0",
+		"--drain-time-s", "30",
+		"--drain-strategy", "immediate",
+		"--log-level", "info",
+		"--component-log-level", "connection:trace,upstream:debug",
+		"--base-id", "3",
+		"--service-cluster", "web",
+		"--service-node", "web-1",
+		"--file-flush-interval-msec", "2500",
+	}, args)
+
+	// The args must round trip.
+	parsed, rest, err := ParseArgs(args)
+	require.NoError(t, err)
+	require.Empty(t, rest)
+	require.Equal(t, opts, parsed)
+}
@@ -5,11 +5,13 @@ package envoy
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"strconv"
@@ -52,6 +54,11 @@ type ProxyManager interface {
 type Proxy struct {
 	cfg ProxyConfig
 
+	// passthroughOpts are the options parsed from cfg.ExtraArgs, and
+	// passthroughArgs are the remaining arguments.
+	passthroughOpts Options
+	passthroughArgs []string
+
 	// client that will dial the managed Envoy proxy
 	client *http.Client
 
@@ -77,9 +84,25 @@ type ProxyConfig struct {
 	// Defaults to 19000
 	AdminBindPort int
 
-	// ExtraArgs are additional arguments that will be passed to Envoy.
+	// Options are the Envoy command line options configured on the dataplane.
+	Options Options
+
+	// ExtraArgs are additional arguments that will be passed to Envoy. Any
+	// options managed by consul-dataplane (see Options) take precedence over
+	// the values in Options and those inferred by the dataplane.
 	ExtraArgs []string
 
+	// DrainAllListeners determines whether Drain drains all listeners rather
+	// than only inbound listeners. Gateway listeners are not marked as inbound
+	// so must be drained this way.
+	DrainAllListeners bool
+
+	// ReadyWithoutListeners determines whether the proxy is considered ready
+	// while it is still waiting for its initial listener set, as long as no
+	// dynamic listeners have been received. Gateways may not be given any
+	// listeners until routes or services are bound to them.
+	ReadyWithoutListeners bool
+
 	// Logger that will be used to emit log messages.
 	//
 	// Note: Envoy logs are *not* written to this logger, and instead are written
@@ -125,9 +148,16 @@ func NewProxy(cfg ProxyConfig) (*Proxy, error) {
 	if cfg.EnvoyErrorStream == nil {
 		cfg.EnvoyErrorStream = os.Stderr
 	}
+	passthroughOpts, passthroughArgs, err := ParseArgs(cfg.ExtraArgs)
+	if err != nil {
+		return nil, err
+	}
 	return &Proxy{
 		cfg: cfg,
 
+		passthroughOpts: passthroughOpts,
+		passthroughArgs: passthroughArgs,
+
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
@@ -174,12 +204,17 @@ func (p *Proxy) Run(ctx context.Context) error {
 	return nil
 }
 
-// Start draining inbound connections to the Envoy proxy process.
+// Start draining inbound connections to the Envoy proxy process, or
+// connections to all listeners if DrainAllListeners is set.
 //
 // Note: the caller is responsible for ensuring Drain is not called concurrently
 // with Run, as this is thread-unsafe.
 func (p *Proxy) Drain() error {
-	envoyDrainListenersUrl := fmt.Sprintf("http://%s/drain_listeners?inboundonly&graceful&skip_exit", net.JoinHostPort(p.cfg.AdminAddr, strconv.Itoa(p.cfg.AdminBindPort)))
+	drainQuery := "inboundonly&graceful&skip_exit"
+	if p.cfg.DrainAllListeners {
+		drainQuery = "graceful&skip_exit"
+	}
+	envoyDrainListenersUrl := fmt.Sprintf("http://%s/drain_listeners?%s", net.JoinHostPort(p.cfg.AdminAddr, strconv.Itoa(p.cfg.AdminBindPort)), drainQuery)
 	switch p.getState() {
 	case stateExited:
 		// Nothing to do!
@@ -191,8 +226,8 @@ func (p *Proxy) Drain() error {
 		// Nothing to do!
 		return nil
 	case stateRunning:
-		// Start draining inbound connections.
-		p.cfg.Logger.Debug("draining inbound connections to proxy")
+		// Start draining connections.
+		p.cfg.Logger.Debug("draining connections to proxy", "all_listeners", p.cfg.DrainAllListeners)
 		p.transitionState(stateRunning, stateDraining)
 		_, err := p.client.Post(envoyDrainListenersUrl, "text/plain", nil)
 		if err != nil {
@@ -355,24 +390,23 @@ func (p *Proxy) buildCommand(ctx context.Context, cfgYaml string) *exec.Cmd {
 		logLevel = "info"
 	}
 
-	// Updating loglevel value if --log-level is present in extra args
-	newExtraArgs, valOfLoggerInExtraArgs := removeArgAndGetValue(p.cfg.ExtraArgs, "--log-level")
+	// Options passed through as extra args take precedence over those
+	// configured on the dataplane, which take precedence over the log level
+	// inferred above.
+	opts := Options{LogLevel: logLevel}.
+		Merge(p.cfg.Options).
+		Merge(p.passthroughOpts)
 
-	if len(valOfLoggerInExtraArgs) > 0 {
-		logLevel = valOfLoggerInExtraArgs
+	args := []string{
+		"--config-yaml", cfgYaml,
+		"--log-format", logFormat,
 	}
-
-	args := append(
-		[]string{
-			"--config-yaml", cfgYaml,
-			"--log-format", logFormat,
-			"--log-level", logLevel,
-
-			// TODO(NET-713): support hot restarts.
-			"--disable-hot-restart",
-		},
-		newExtraArgs...,
+	args = append(args, opts.Args()...)
+	args = append(args,
+		// TODO(NET-713): support hot restarts.
+		"--disable-hot-restart",
 	)
+	args = append(args, p.passthroughArgs...)
 
 	cmd := exec.CommandContext(ctx, p.cfg.ExecutablePath, args...)
 	cmd.Stdout = p.cfg.EnvoyOutputStream
@@ -381,18 +415,6 @@ func (p *Proxy) buildCommand(ctx context.Context, cfgYaml string) *exec.Cmd {
 	return cmd
 }
 
-// removeArgAndGetValue Function to get new args after removing given key
-// and also returns the value of key
-func removeArgAndGetValue(stringAr []string, key string) ([]string, string) {
-	for index, item := range stringAr {
-		if item == key {
-			valueToReturn := stringAr[index+1]
-			return append(stringAr[:index], stringAr[index+2:]...), valueToReturn
-		}
-	}
-	return stringAr, ""
-}
-
 func (p *Proxy) Ready() (bool, error) {
 
 	switch p.getState() {
@@ -414,9 +436,96 @@ func (p *Proxy) Ready() (bool, error) {
 			defer rsp.Body.Close()
 		}
 
-		return rsp.StatusCode == 200, nil
+		if rsp.StatusCode == http.StatusOK {
+			return true, nil
+		}
+		if !p.cfg.ReadyWithoutListeners {
+			return false, nil
+		}
+
+		// The ready endpoint responds with the server state. Envoy stays in
+		// the INITIALIZING state until it receives its initial listener set,
+		// which is also the state before it has received anything over xDS.
+		body, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			return false, err
+		}
+		if strings.TrimSpace(string(body)) != "INITIALIZING" {
+			return false, nil
+		}
+		ldsReceived, err := p.ldsReceived()
+		if err != nil || !ldsReceived {
+			return false, err
+		}
+		hasListeners, err := p.hasDynamicListeners()
+		if err != nil {
+			return false, err
+		}
+		return !hasListeners, nil
 	default:
 		return false, nil
 	}
 
 }
+
+// ldsReceived returns true if Envoy has accepted a listener set over xDS,
+// even an empty one.
+func (p *Proxy) ldsReceived() (bool, error) {
+	envoyStatsURL := fmt.Sprintf(
+		"http://%s/stats?filter=%s",
+		net.JoinHostPort(p.cfg.AdminAddr, strconv.Itoa(p.cfg.AdminBindPort)),
+		url.QueryEscape(`^listener_manager\.lds\.update_success$`),
+	)
+	rsp, err := p.client.Get(envoyStatsURL)
+	if err != nil {
+		return false, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("envoy: unexpected status code from stats: %d", rsp.StatusCode)
+	}
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) != "listener_manager.lds.update_success" {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("envoy: invalid lds update count %q: %w", value, err)
+		}
+		return n > 0, nil
+	}
+	return false, nil
+}
+
+// hasDynamicListeners returns true if Envoy has received any listeners over
+// xDS, whether they are active, warming or draining.
+func (p *Proxy) hasDynamicListeners() (bool, error) {
+	envoyConfigDumpURL := fmt.Sprintf(
+		"http://%s/config_dump?resource=dynamic_listeners",
+		net.JoinHostPort(p.cfg.AdminAddr, strconv.Itoa(p.cfg.AdminBindPort)),
+	)
+	rsp, err := p.client.Get(envoyConfigDumpURL)
+	if err != nil {
+		return false, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("envoy: unexpected status code from config dump: %d", rsp.StatusCode)
+	}
+
+	var dump struct {
+		Configs []json.RawMessage `json:"configs"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&dump); err != nil {
+		return false, err
+	}
+	return len(dump.Configs) > 0, nil
+}
@@ -10,8 +10,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -300,3 +305,232 @@ func TestProxy_EnvoyExtraArgs(t *testing.T) {
 		return p.cmd.Process.Signal(syscall.Signal(0)) == os.ErrProcessDone
 	}, 2*time.Second, 50*time.Millisecond)
 }
+
+func TestProxy_BuildCommandOptionPrecedence(t *testing.T) {
+	// Each option may be inferred by the dataplane (log level only), set in
+	// the dataplane config, passed through as an extra arg, or any combination
+	// of these. Extra args take precedence over the dataplane config, which
+	// takes precedence over the inferred value.
+	options := []struct {
+		flag        string
+		inferred    string
+		config      Options
+		configValue string
+		passthrough string
+	}{
+		{flag: "--concurrency", config: Options{Concurrency: intPtr(2)}, configValue: "2", passthrough: "4"},
+		{flag: "--drain-time-s", config: Options{DrainTimeSeconds: intPtr(30)}, configValue: "30", passthrough: "5"},
+		{flag: "--drain-strategy", config: Options{DrainStrategy: "immediate"}, configValue: "immediate", passthrough: "gradual"},
+		{flag: "--log-level", inferred: "warn", config: Options{LogLevel: "info"}, configValue: "info", passthrough: "debug"},
+		{flag: "--component-log-level", config: Options{ComponentLogLevels: map[string]string{"upstream": "info"}}, configValue: "upstream:info", passthrough: "upstream:trace"},
+		{flag: "--base-id", config: Options{BaseID: intPtr(1)}, configValue: "1", passthrough: "2"},
+		{flag: "--service-cluster", config: Options{ServiceCluster: "web"}, configValue: "web", passthrough: "api"},
+		{flag: "--service-node", config: Options{ServiceNode: "web-1"}, configValue: "web-1", passthrough: "api-1"},
+		{flag: "--file-flush-interval-msec", config: Options{FileFlushInterval: durationPtr(time.Second)}, configValue: "1000", passthrough: "250"},
+	}
+
+	for _, opt := range options {
+		for _, withConfig := range []bool{false, true} {
+			for _, withPassthrough := range []bool{false, true} {
+				for _, inline := range []bool{false, true} {
+					if inline && !withPassthrough {
+						continue
+					}
+					name := fmt.Sprintf("%s config=%t passthrough=%t inline=%t", opt.flag, withConfig, withPassthrough, inline)
+					t.Run(name, func(t *testing.T) {
+						extraArgs := []string{"--test-output", "/tmp/out"}
+						expected := opt.inferred
+						cfg := ProxyConfig{
+							Logger:          hclog.New(&hclog.LoggerOptions{Level: hclog.Warn, Output: io.Discard}),
+							ExecutablePath:  "testdata/fake-envoy",
+							BootstrapConfig: []byte("hello world"),
+						}
+						if withConfig {
+							cfg.Options = opt.config
+							expected = opt.configValue
+						}
+						if withPassthrough {
+							if inline {
+								extraArgs = append(extraArgs, opt.flag+"="+opt.passthrough)
+							} else {
+								extraArgs = append(extraArgs, opt.flag, opt.passthrough)
+							}
+							expected = opt.passthrough
+						}
+						cfg.ExtraArgs = extraArgs
+
+						p, err := NewProxy(cfg)
+						require.NoError(t, err)
+
+						args := p.buildCommand(context.Background(), "hello world").Args[1:]
+
+						var values []string
+						for i, arg := range args {
+							if arg == opt.flag {
+								require.Less(t, i+1, len(args), "flag %s has no value", opt.flag)
+								values = append(values, args[i+1])
+							}
+							require.NotContains(t, arg, opt.flag+"=", "inline flag should be normalized")
+						}
+						if expected == "" {
+							require.Empty(t, values)
+						} else {
+							require.Equal(t, []string{expected}, values)
+						}
+
+						// Unmanaged args must always be passed through.
+						require.Equal(t, []string{"--test-output", "/tmp/out"}, args[len(args)-2:])
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestNewProxy_InvalidExtraArgs(t *testing.T) {
+	_, err := NewProxy(ProxyConfig{
+		ExecutablePath:  "testdata/fake-envoy",
+		BootstrapConfig: []byte("hello world"),
+		ExtraArgs:       []string{"--concurrency", "lots"},
+	})
+	require.ErrorContains(t, err, `invalid value "lots" for envoy option --concurrency`)
+}
+
+// adminServer starts a fake Envoy admin server and returns a running Proxy
+// configured to talk to it.
+func adminServer(t *testing.T, cfg ProxyConfig, handler http.HandlerFunc) *Proxy {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+	require.NoError(t, err)
+	cfg.AdminAddr = host
+	cfg.AdminBindPort, err = strconv.Atoi(port)
+	require.NoError(t, err)
+	cfg.Logger = hclog.NewNullLogger()
+
+	return &Proxy{cfg: cfg, client: srv.Client(), state: stateRunning}
+}
+
+func TestProxy_Drain(t *testing.T) {
+	cases := map[string]struct {
+		drainAll      bool
+		expectedQuery string
+	}{
+		"inbound only":  {expectedQuery: "inboundonly&graceful&skip_exit"},
+		"all listeners": {drainAll: true, expectedQuery: "graceful&skip_exit"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var gotQuery string
+			p := adminServer(t, ProxyConfig{DrainAllListeners: tc.drainAll}, func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/drain_listeners", r.URL.Path)
+				gotQuery = r.URL.RawQuery
+			})
+
+			require.NoError(t, p.Drain())
+			require.Equal(t, tc.expectedQuery, gotQuery)
+			require.Equal(t, stateDraining, p.getState())
+		})
+	}
+}
+
+func TestProxy_Ready(t *testing.T) {
+	cases := map[string]struct {
+		readyWithoutListeners bool
+		readyStatus           int
+		readyBody             string
+		ldsStats              string
+		listenersDump         string
+		expected              bool
+		expectErr             bool
+	}{
+		"live": {
+			readyStatus: http.StatusOK,
+			readyBody:   "LIVE",
+			expected:    true,
+		},
+		"initializing": {
+			readyStatus: http.StatusServiceUnavailable,
+			readyBody:   "INITIALIZING",
+			expected:    false,
+		},
+		"initializing without listeners allowed and none received": {
+			readyWithoutListeners: true,
+			readyStatus:           http.StatusServiceUnavailable,
+			readyBody:             "INITIALIZING\n",
+			ldsStats:              "listener_manager.lds.update_success: 1\n",
+			listenersDump:         `{}`,
+			expected:              true,
+		},
+		"initializing without listeners allowed and xds never received": {
+			readyWithoutListeners: true,
+			readyStatus:           http.StatusServiceUnavailable,
+			readyBody:             "INITIALIZING\n",
+			ldsStats:              "listener_manager.lds.update_success: 0\n",
+			listenersDump:         `{}`,
+			expected:              false,
+		},
+		"initializing without listeners allowed and lds stats missing": {
+			readyWithoutListeners: true,
+			readyStatus:           http.StatusServiceUnavailable,
+			readyBody:             "INITIALIZING\n",
+			listenersDump:         `{}`,
+			expected:              false,
+		},
+		"initializing without listeners allowed but some received": {
+			readyWithoutListeners: true,
+			readyStatus:           http.StatusServiceUnavailable,
+			readyBody:             "INITIALIZING\n",
+			ldsStats:              "listener_manager.lds.update_success: 2\n",
+			listenersDump:         `{"configs": [{"name": "default:1.2.3.4:8443"}]}`,
+			expected:              false,
+		},
+		"draining without listeners allowed": {
+			readyWithoutListeners: true,
+			readyStatus:           http.StatusServiceUnavailable,
+			readyBody:             "DRAINING\n",
+			listenersDump:         `{}`,
+			expected:              false,
+		},
+		"invalid config dump": {
+			readyWithoutListeners: true,
+			readyStatus:           http.StatusServiceUnavailable,
+			readyBody:             "INITIALIZING\n",
+			ldsStats:              "listener_manager.lds.update_success: 1\n",
+			listenersDump:         `not json`,
+			expectErr:             true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := adminServer(t, ProxyConfig{ReadyWithoutListeners: tc.readyWithoutListeners}, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/ready":
+					w.WriteHeader(tc.readyStatus)
+					_, _ = w.Write([]byte(tc.readyBody))
+				case "/stats":
+					require.Equal(t, `^listener_manager\.lds\.update_success$`, r.URL.Query().Get("filter"))
+					_, _ = w.Write([]byte(tc.ldsStats))
+				case "/config_dump":
+					require.Equal(t, "dynamic_listeners", r.URL.Query().Get("resource"))
+					_, _ = w.Write([]byte(tc.listenersDump))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+
+			ready, err := p.Ready()
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, ready)
+		})
+	}
+}
@@ -4,44 +4,137 @@
 package metricscache
 
 import (
+	"math"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 
 	"github.com/hashicorp/go-metrics"
 )
 
-type metric struct {
+// DefaultMaxSeries is the default maximum number of distinct series cached
+// until a real sink is set.
+const DefaultMaxSeries = 10000
+
+// droppedKey is the counter reported to the real sink with the number of
+// updates that were dropped because the cache was full.
+var droppedKey = []string{"metrics_cache", "dropped"}
+
+// series is the aggregated value of a single metric, identified by its key
+// and labels. Gauges keep the last value, counters the sum of increments, and
+// samples and keys the count, sum, minimum and maximum of the values.
+type series struct {
 	key    []string
-	val    float32
 	labels []metrics.Label
+
+	val   float32 // the last value of a gauge
+	count int
+	sum   float64
+	min   float32
+	max   float32
+}
+
+func (s *series) observe(val float32) {
+	if s.count == 0 || val < s.min {
+		s.min = val
+	}
+	if s.count == 0 || val > s.max {
+		s.max = val
+	}
+	s.count++
+	s.sum += float64(val)
+}
+
+// replaySummary replays a lossy summary of values, emitting at most three
+// regardless of how many were observed: the minimum, the maximum and the mean
+// of the other values. The count and sum of the values aren't preserved, but
+// the replay costs the same for every series.
+func (s *series) replaySummary(emit func(val float32)) {
+	if s.count == 0 {
+		return
+	}
+	emit(s.min)
+	if s.count == 1 {
+		return
+	}
+	emit(s.max)
+	if s.count == 2 {
+		return
+	}
+	emit(float32((s.sum - float64(s.min) - float64(s.max)) / float64(s.count-2)))
+}
+
+// DroppedStats is the number of updates of each type of metric that were
+// dropped because the cache was full.
+type DroppedStats struct {
+	Gauges   uint64
+	Counters uint64
+	Samples  uint64
+	Keys     uint64
+}
+
+// Total returns the total number of dropped updates.
+func (d DroppedStats) Total() uint64 {
+	return d.Gauges + d.Counters + d.Samples + d.Keys
 }
 
 // Sink is a temporary sink that caches metrics until a real sink is set in SetSink.
-// it implements the metrics.MetricSink interface
+// it implements the metrics.MetricSink and metrics.ShutdownSink interfaces.
+//
+// Metrics are aggregated in place, keyed by name and labels, so the cache
+// only grows with the number of distinct series. Once maxSeries series are
+// cached, updates to new series are dropped and counted.
 type Sink struct {
-	gauges   []metric
-	counters []metric
-	samples  []metric
-	keys     []metric
+	gauges   map[string]*series
+	counters map[string]*series
+	samples  map[string]*series
+	keys     map[string]*series
+
+	maxSeries int
+	numSeries int
+
+	droppedGauges   atomic.Uint64
+	droppedCounters atomic.Uint64
+	droppedSamples  atomic.Uint64
+	droppedKeys     atomic.Uint64
 
 	realSink metrics.MetricSink
+	shutdown bool
 
 	mu        sync.Mutex
 	checkLock *atomic.Bool
 	once      sync.Once
 }
 
-// NewSink returns a pointer to a sink with empty cache
+var (
+	_ metrics.MetricSink   = (*Sink)(nil)
+	_ metrics.ShutdownSink = (*Sink)(nil)
+)
+
+// NewSink returns a pointer to a sink with empty cache that caches up to
+// DefaultMaxSeries series.
 func NewSink() *Sink {
+	return NewSinkWithMaxSeries(DefaultMaxSeries)
+}
+
+// NewSinkWithMaxSeries returns a pointer to a sink with empty cache that
+// caches up to maxSeries series. If maxSeries isn't positive,
+// DefaultMaxSeries is used.
+func NewSinkWithMaxSeries(maxSeries int) *Sink {
+	if maxSeries <= 0 {
+		maxSeries = DefaultMaxSeries
+	}
 	checkLock := &atomic.Bool{}
 	checkLock.Store(true)
 
 	return &Sink{
-		gauges:    []metric{},
-		counters:  []metric{},
-		samples:   []metric{},
-		keys:      []metric{},
-		mu:        sync.Mutex{}, // this lock is used to control access around the slices of metrics above
+		gauges:    make(map[string]*series),
+		counters:  make(map[string]*series),
+		samples:   make(map[string]*series),
+		keys:      make(map[string]*series),
+		maxSeries: maxSeries,
+		mu:        sync.Mutex{}, // this lock is used to control access around the cached metrics above
 		checkLock: checkLock,    // we only need to check the lock if we haven't yet set the real sink
 	}
 }
@@ -63,7 +156,9 @@ func (s *Sink) SetGaugeWithLabels(key []string, val float32, labels []metrics.La
 		return
 	}
 
-	s.gauges = append(s.gauges, metric{key: key, val: val, labels: labels})
+	if m := s.series(s.gauges, &s.droppedGauges, key, labels); m != nil {
+		m.val = val
+	}
 }
 
 // EmitKey sends metrics to the real sink otherwise caches them
@@ -78,7 +173,9 @@ func (s *Sink) EmitKey(key []string, val float32) {
 		return
 	}
 
-	s.keys = append(s.keys, metric{key: key, val: val})
+	if m := s.series(s.keys, &s.droppedKeys, key, nil); m != nil {
+		m.observe(val)
+	}
 }
 
 // IncrCounter defaults to IncrCounterWithLabels
@@ -98,7 +195,10 @@ func (s *Sink) IncrCounterWithLabels(key []string, val float32, labels []metrics
 		s.realSink.IncrCounterWithLabels(key, val, labels)
 		return
 	}
-	s.counters = append(s.counters, metric{key: key, val: val, labels: labels})
+
+	if m := s.series(s.counters, &s.droppedCounters, key, labels); m != nil {
+		m.sum += float64(val)
+	}
 }
 
 // AddSample defaults to AddSampleWithLabels
@@ -117,40 +217,153 @@ func (s *Sink) AddSampleWithLabels(key []string, val float32, labels []metrics.L
 		s.realSink.AddSampleWithLabels(key, val, labels)
 		return
 	}
-	s.samples = append(s.samples, metric{key: key, val: val, labels: labels})
+
+	if m := s.series(s.samples, &s.droppedSamples, key, labels); m != nil {
+		m.observe(val)
+	}
+}
+
+// series returns the cached series for the key and labels, adding it if the
+// cache isn't full. It returns nil, and counts the update as dropped, if the
+// cache is full or the sink has been shut down.
+func (s *Sink) series(cache map[string]*series, dropped *atomic.Uint64, key []string, labels []metrics.Label) *series {
+	if s.shutdown {
+		dropped.Add(1)
+		return nil
+	}
+	id := seriesID(key, labels)
+	if m, ok := cache[id]; ok {
+		return m
+	}
+	if s.numSeries >= s.maxSeries {
+		dropped.Add(1)
+		return nil
+	}
+	m := &series{key: key, labels: labels}
+	cache[id] = m
+	s.numSeries++
+	return m
+}
+
+// seriesID identifies a series by its key and labels, regardless of the order
+// of the labels.
+func seriesID(key []string, labels []metrics.Label) string {
+	var b strings.Builder
+	b.WriteString(strings.Join(key, "."))
+	if len(labels) == 0 {
+		return b.String()
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, l := range labels {
+		pairs = append(pairs, l.Name+"="+l.Value)
+	}
+	sort.Strings(pairs)
+	for _, p := range pairs {
+		b.WriteByte(0)
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// Dropped returns the number of updates that were dropped because the cache
+// was full or the sink had been shut down before a real sink was set.
+func (s *Sink) Dropped() DroppedStats {
+	return DroppedStats{
+		Gauges:   s.droppedGauges.Load(),
+		Counters: s.droppedCounters.Load(),
+		Samples:  s.droppedSamples.Load(),
+		Keys:     s.droppedKeys.Load(),
+	}
 }
 
 // SetSink takes a sink and will ensure that the sink sets the value
 // and then starts forwarding metrics on to the realSink once called.
-// It will also replay all the cached metrics and send them to the realSink
+// It will also replay all the cached metrics and send them to the realSink.
+// It has no effect if the sink has been shut down.
 func (s *Sink) SetSink(newSink metrics.MetricSink) {
 	s.once.Do(func() {
 		s.mu.Lock()
 		defer s.mu.Unlock()
-		s.checkLock.Store(false)
+		if s.shutdown {
+			return
+		}
 		s.realSink = newSink
 		s.replay()
+		// The real sink is only read without the lock once it has been set.
+		s.checkLock.Store(false)
 	})
 }
 
-// replay will send cached metrics to the realSink. Once done it will empty the cached store.
-func (s *Sink) replay() {
+// Shutdown implements metrics.ShutdownSink. If a real sink is set, it's shut
+// down so that it flushes its metrics. Otherwise the cached metrics can never
+// be delivered, so they're discarded and later updates are dropped.
+func (s *Sink) Shutdown() {
+	if ok := s.checkLock.Load(); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
 	if s.realSink != nil {
-		for _, sample := range s.samples {
-			s.realSink.AddSampleWithLabels(sample.key, sample.val, sample.labels)
-		}
-		s.samples = []metric{} // empty out after replaying samples
-		for _, gauge := range s.gauges {
-			s.realSink.SetGaugeWithLabels(gauge.key, gauge.val, gauge.labels)
+		if ss, ok := s.realSink.(metrics.ShutdownSink); ok {
+			ss.Shutdown()
 		}
-		s.gauges = []metric{} // empty out after replaying gauges
-		for _, counter := range s.counters {
-			s.realSink.IncrCounterWithLabels(counter.key, counter.val, counter.labels)
-		}
-		s.counters = []metric{} // empty out after replaying counters
-		for _, key := range s.keys {
-			s.realSink.EmitKey(key.key, key.val)
+		return
+	}
+
+	s.shutdown = true
+	s.reset()
+}
+
+// replay will send cached metrics to the realSink. Once done it will empty the cached store.
+func (s *Sink) replay() {
+	if s.realSink == nil {
+		return
+	}
+	for _, sample := range s.samples {
+		sample.replaySummary(func(val float32) {
+			s.realSink.AddSampleWithLabels(sample.key, val, sample.labels)
+		})
+	}
+	for _, gauge := range s.gauges {
+		s.realSink.SetGaugeWithLabels(gauge.key, gauge.val, gauge.labels)
+	}
+	for _, counter := range s.counters {
+		s.realSink.IncrCounterWithLabels(counter.key, float32(counter.sum), counter.labels)
+	}
+	for _, key := range s.keys {
+		key.replaySummary(func(val float32) {
+			s.realSink.EmitKey(key.key, val)
+		})
+	}
+	s.reportDropped()
+	s.reset() // empty out after replaying
+}
+
+// reportDropped reports the number of dropped updates of each type of metric
+// to the realSink.
+func (s *Sink) reportDropped() {
+	dropped := s.Dropped()
+	for _, d := range []struct {
+		kind  string
+		count uint64
+	}{
+		{"gauge", dropped.Gauges},
+		{"counter", dropped.Counters},
+		{"sample", dropped.Samples},
+		{"key", dropped.Keys},
+	} {
+		if d.count == 0 {
+			continue
 		}
-		s.keys = []metric{} // empty out after replaying keys
+		val := float32(math.Min(float64(d.count), math.MaxFloat32))
+		s.realSink.IncrCounterWithLabels(droppedKey, val, []metrics.Label{{Name: "type", Value: d.kind}})
 	}
 }
+
+func (s *Sink) reset() {
+	s.gauges = make(map[string]*series)
+	s.counters = make(map[string]*series)
+	s.samples = make(map[string]*series)
+	s.keys = make(map[string]*series)
+	s.numSeries = 0
+}
@@ -45,17 +45,18 @@ func TestMetricsCache_BasicPath(t *testing.T) {
 	mykey := data[0].Points["mykey"]
 	require.EqualValues(t, mykey[0], 3)
 
-	// counter's based off being set four times with values 4, 8, 16, 32
+	// counter's cached increments of 4, 8 and 16 are replayed as a single
+	// increment of 28, followed by 32
 	mycounter := data[0].Counters["mycounter"]
-	require.EqualValues(t, 4, mycounter.Count)
+	require.EqualValues(t, 2, mycounter.Count)
 	require.EqualValues(t, 60, mycounter.Sum)
-	require.EqualValues(t, 4, mycounter.Min)
+	require.EqualValues(t, 28, mycounter.Min)
 	require.EqualValues(t, 32, mycounter.Max)
 
 	sink.IncrCounter([]string{"mycounter"}, 2)
 	data = realSink.Data()
 	mycounter = data[0].Counters["mycounter"]
-	require.EqualValues(t, 5, mycounter.Count)
+	require.EqualValues(t, 3, mycounter.Count)
 	require.EqualValues(t, 62, mycounter.Sum)
 	require.EqualValues(t, 2, mycounter.Min)
 	require.EqualValues(t, 32, mycounter.Max)
@@ -108,10 +109,152 @@ func TestMetricsCache_ParallelTest(t *testing.T) {
 	mysamples := data[0].Samples["mysample"]
 	mykey := data[0].Points["mykey"]
 	mycounter := data[0].Counters["mycounter"]
-	require.EqualValues(t, 100, mysamples.Count)
+	// Cached samples and keys are replayed as a summary of at most three
+	// values.
+	require.LessOrEqual(t, mysamples.Count, 100)
+	require.EqualValues(t, 1, mysamples.Min)
+	require.EqualValues(t, 1, mysamples.Max)
 	require.EqualValues(t, 100, mygauge.Value)
 
-	require.EqualValues(t, 100, len(mykey))
-	require.EqualValues(t, 100, mycounter.Count)
+	require.LessOrEqual(t, len(mykey), 100)
+	require.EqualValues(t, 100, mycounter.Sum)
 
 }
+
+func TestMetricsCache_Aggregation(t *testing.T) {
+	sink := NewSink()
+
+	labelsA := []metrics.Label{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}}
+	labelsB := []metrics.Label{{Name: "b", Value: "2"}, {Name: "a", Value: "1"}}
+	for i := 0; i < 1000; i++ {
+		sink.SetGaugeWithLabels([]string{"mygauge"}, float32(i), labelsA)
+		sink.IncrCounterWithLabels([]string{"mycounter"}, 1, labelsB)
+		sink.AddSampleWithLabels([]string{"mysample"}, float32(i), labelsA)
+		sink.EmitKey([]string{"mykey"}, 2)
+	}
+	sink.IncrCounter([]string{"mycounter"}, 5)
+
+	// Label order doesn't matter, and each name and labels are cached once.
+	require.Len(t, sink.gauges, 1)
+	require.Len(t, sink.counters, 2)
+	require.Len(t, sink.samples, 1)
+	require.Len(t, sink.keys, 1)
+
+	realSink := metrics.NewInmemSink(time.Second, time.Second)
+	sink.SetSink(realSink)
+	data := realSink.Data()
+
+	mygauge := data[0].Gauges["mygauge;a=1;b=2"]
+	require.EqualValues(t, 999, mygauge.Value)
+
+	mycounter := data[0].Counters["mycounter;b=2;a=1"]
+	require.EqualValues(t, 1, mycounter.Count)
+	require.EqualValues(t, 1000, mycounter.Sum)
+	require.EqualValues(t, 5, data[0].Counters["mycounter"].Sum)
+
+	// Samples and keys are replayed as their minimum, maximum and the mean
+	// of the other values.
+	mysamples := data[0].Samples["mysample;a=1;b=2"]
+	require.EqualValues(t, 3, mysamples.Count)
+	require.InDelta(t, 0+999+499.5, mysamples.Sum, 0.01)
+	require.EqualValues(t, 0, mysamples.Min)
+	require.EqualValues(t, 999, mysamples.Max)
+
+	mykey := data[0].Points["mykey"]
+	require.Equal(t, []float32{2, 2, 2}, mykey)
+
+	require.NotContains(t, data[0].Counters, "metrics_cache.dropped;type=counter")
+	require.Empty(t, sink.counters)
+}
+
+// countingSink counts the metrics emitted to it.
+type countingSink struct {
+	*metrics.BlackholeSink
+	emitted int
+}
+
+func (s *countingSink) AddSampleWithLabels([]string, float32, []metrics.Label) { s.emitted++ }
+func (s *countingSink) EmitKey([]string, float32)                              { s.emitted++ }
+
+func TestMetricsCache_ReplayCost(t *testing.T) {
+	sink := NewSink()
+	for i := 0; i < 100000; i++ {
+		sink.AddSample([]string{"sample1"}, float32(i))
+		sink.AddSample([]string{"sample2"}, 1)
+		sink.EmitKey([]string{"key"}, float32(i))
+	}
+	sink.AddSample([]string{"sample3"}, 1)
+
+	// The replay emits at most three values per series, however many values
+	// were observed.
+	realSink := &countingSink{BlackholeSink: &metrics.BlackholeSink{}}
+	sink.SetSink(realSink)
+	require.Equal(t, 3+3+3+1, realSink.emitted)
+}
+
+func TestMetricsCache_MaxSeries(t *testing.T) {
+	sink := NewSinkWithMaxSeries(2)
+
+	sink.SetGauge([]string{"gauge1"}, 1)
+	sink.IncrCounter([]string{"counter1"}, 1)
+	sink.SetGauge([]string{"gauge2"}, 1)
+	sink.IncrCounter([]string{"counter2"}, 1)
+	sink.IncrCounter([]string{"counter2"}, 1)
+	sink.AddSample([]string{"sample"}, 1)
+	sink.EmitKey([]string{"key"}, 1)
+	// Updates to cached series aren't dropped.
+	sink.IncrCounter([]string{"counter1"}, 1)
+
+	require.Equal(t, DroppedStats{Gauges: 1, Counters: 2, Samples: 1, Keys: 1}, sink.Dropped())
+	require.EqualValues(t, 5, sink.Dropped().Total())
+
+	realSink := metrics.NewInmemSink(time.Second, time.Second)
+	sink.SetSink(realSink)
+	data := realSink.Data()
+
+	require.EqualValues(t, 1, data[0].Gauges["gauge1"].Value)
+	require.EqualValues(t, 2, data[0].Counters["counter1"].Sum)
+	require.NotContains(t, data[0].Gauges, "gauge2")
+	require.NotContains(t, data[0].Counters, "counter2")
+
+	require.EqualValues(t, 1, data[0].Counters["metrics_cache.dropped;type=gauge"].Sum)
+	require.EqualValues(t, 2, data[0].Counters["metrics_cache.dropped;type=counter"].Sum)
+	require.EqualValues(t, 1, data[0].Counters["metrics_cache.dropped;type=sample"].Sum)
+	require.EqualValues(t, 1, data[0].Counters["metrics_cache.dropped;type=key"].Sum)
+}
+
+type shutdownSink struct {
+	*metrics.BlackholeSink
+	shutdown bool
+}
+
+func (s *shutdownSink) Shutdown() { s.shutdown = true }
+
+func TestMetricsCache_Shutdown(t *testing.T) {
+	t.Run("with real sink", func(t *testing.T) {
+		sink := NewSink()
+		realSink := &shutdownSink{BlackholeSink: &metrics.BlackholeSink{}}
+		sink.SetSink(realSink)
+
+		sink.Shutdown()
+		require.True(t, realSink.shutdown)
+	})
+
+	t.Run("without real sink", func(t *testing.T) {
+		sink := NewSink()
+		sink.IncrCounter([]string{"mycounter"}, 1)
+
+		sink.Shutdown()
+		require.Empty(t, sink.counters)
+
+		// Later updates are dropped, and the sink can't be set anymore.
+		sink.IncrCounter([]string{"mycounter"}, 1)
+		require.Empty(t, sink.counters)
+		require.EqualValues(t, 1, sink.Dropped().Counters)
+
+		realSink := &shutdownSink{BlackholeSink: &metrics.BlackholeSink{}}
+		sink.SetSink(realSink)
+		sink.Shutdown()
+		require.False(t, realSink.shutdown)
+	})
+}